@@ -0,0 +1,8 @@
+// The openapi spec is the contract of the http api. It is embedded, so the handlers can check the requests and
+// the responses against it at runtime
+package api
+
+import _ "embed"
+
+//go:embed shopping-cart-api.yaml
+var Spec []byte
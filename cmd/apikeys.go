@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/mysql"
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/postgres"
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/sqlite"
+	"github.com/Harital/shopping-cart/internal/config"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/Harital/shopping-cart/internal/core/services"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	apiKeysCommand = "apikeys"
+
+	apiKeysCreate = "create"
+	apiKeysList   = "list"
+	apiKeysRevoke = "revoke"
+)
+
+// Runs shopping-cart apikeys create|list|revoke [args] [flags]. The flags, the env variables and the config file are
+// the same as the server ones. The arguments of the action go before the flags, I.E.
+//
+//	shopping-cart apikeys create checkout read,write
+//	shopping-cart apikeys list
+//	shopping-cart apikeys revoke 5b9a2ecf-0a37-4f4b-9c57-0d4d2e7e3a11
+func runAPIKeys(name string, args []string) error {
+	usage := fmt.Errorf("usage: %s %s %s <name> <scopes>|%s|%s <id> [flags]", name, apiKeysCommand, apiKeysCreate,
+		apiKeysList, apiKeysRevoke)
+	if len(args) == 0 {
+		return usage
+	}
+	action := args[0]
+
+	var positional int
+	switch action {
+	case apiKeysCreate:
+		positional = 2
+	case apiKeysList:
+		positional = 0
+	case apiKeysRevoke:
+		positional = 1
+	default:
+		return usage
+	}
+	if len(args) < 1+positional {
+		return usage
+	}
+	actionArgs, flags := args[1:1+positional], args[1+positional:]
+
+	cfg, cfgErr := config.Load(name+" "+apiKeysCommand+" "+action, flags, os.Getenv)
+	if errors.Is(cfgErr, flag.ErrHelp) {
+		return nil
+	}
+	if cfgErr != nil {
+		return fmt.Errorf("invalid configuration --> %w", cfgErr)
+	}
+	zerolog.SetGlobalLevel(cfg.Log.Level)
+
+	repo, closeRepo, repoErr := newAPIKeysRepository(cfg.Database)
+	if repoErr != nil {
+		return repoErr
+	}
+	defer closeRepo()
+
+	svc := services.NewAPIKeysService(repo)
+	ctx := context.Background()
+
+	switch action {
+	case apiKeysCreate:
+		scopes, parseErr := model.ParseAPIKeyScopes(actionArgs[1])
+		if parseErr != nil {
+			return parseErr
+		}
+		key, secret, createErr := svc.Create(ctx, actionArgs[0], scopes)
+		if createErr != nil {
+			return createErr
+		}
+		// The secret is not stored, so this is the only chance to get it
+		fmt.Printf("id:     %s\nscopes: %s\nkey:    %s\n", key.Id, model.FormatAPIKeyScopes(key.Scopes), secret)
+
+	case apiKeysList:
+		keys, listErr := svc.List(ctx)
+		if listErr != nil {
+			return listErr
+		}
+		printAPIKeys(keys)
+
+	case apiKeysRevoke:
+		if revokeErr := svc.Revoke(ctx, actionArgs[0]); revokeErr != nil {
+			return revokeErr
+		}
+		log.Info().Str("id", actionArgs[0]).Msg("api key revoked")
+	}
+	return nil
+}
+
+// Keys are stored in the database, so the memory driver is of no use here
+func newAPIKeysRepository(cfg config.DatabaseConfig) (ports.APIKeysRepository, func(), error) {
+	if cfg.Driver == config.MemoryDriver {
+		return nil, nil, errors.New("the memory driver cannot keep api keys between runs")
+	}
+	db, dbErr := openDatabase(cfg)
+	if dbErr != nil {
+		return nil, nil, fmt.Errorf("cannot connect to the database --> %w", dbErr)
+	}
+	closeDB := func() { db.Close() }
+
+	// Same as the server. A sqlite file may not exist until the first key is created
+	if cfg.AutoMigrate || cfg.Driver == config.SQLiteDriver {
+		applied, migrateErr := newMigrator(cfg.Driver, db).Up(context.Background())
+		logAppliedMigrations(applied)
+		if migrateErr != nil {
+			closeDB()
+			return nil, nil, fmt.Errorf("migrating the database --> %w", migrateErr)
+		}
+	}
+
+	switch cfg.Driver {
+	case config.PostgresDriver:
+		return postgres.NewAPIKeysRepository(db), closeDB, nil
+	case config.SQLiteDriver:
+		return sqlite.NewAPIKeysRepository(db), closeDB, nil
+	}
+	return mysql.NewAPIKeysRepository(db), closeDB, nil
+}
+
+// Meant for humans, so it is written as a table in the standard output instead of being logged
+func printAPIKeys(keys []model.APIKey) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCREATED AT\tREVOKED AT")
+	for _, key := range keys {
+		revokedAt := "-"
+		if key.RevokedAt != nil {
+			revokedAt = key.RevokedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", key.Id, key.Name, model.FormatAPIKeyScopes(key.Scopes),
+			key.CreatedAt.UTC().Format(time.RFC3339), revokedAt)
+	}
+	w.Flush()
+}
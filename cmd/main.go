@@ -2,65 +2,334 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"expvar"
+	"flag"
+	"fmt"
 	"net/http"
+	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
-	"time"
 
+	"github.com/Harital/shopping-cart/api"
 	httpHandlers "github.com/Harital/shopping-cart/internal/adapters/handlers/http"
+	httpPublishers "github.com/Harital/shopping-cart/internal/adapters/publishers/http"
+	"github.com/Harital/shopping-cart/internal/adapters/publishers/logger"
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/memory"
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/migrations"
 	"github.com/Harital/shopping-cart/internal/adapters/repositories/mysql"
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/postgres"
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/sqlite"
+	httpReservers "github.com/Harital/shopping-cart/internal/adapters/reservers/http"
+	"github.com/Harital/shopping-cart/internal/adapters/reservers/resilient"
+	"github.com/Harital/shopping-cart/internal/config"
+	"github.com/Harital/shopping-cart/internal/core/ports"
 	"github.com/Harital/shopping-cart/internal/core/services"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-const (
-	localPort       = "8080"
-	defaultLogLevel = zerolog.InfoLevel
-	shutdownTimeout = 5 * time.Second
-)
+// Every route of the api hangs from here
+const apiBasePath = "/shopping-cart/v1/"
 
-func setupRouter() *gin.Engine {
+// Exposes the app metrics (I.E. the reserver circuit breaker state) in json format, and the request, query and
+// reservation metrics in prometheus format
+func setupRouter(mode string) *gin.Engine {
 	// Using gin, as it is a very useful (and easy to use) http server engine
-	gin.SetMode(gin.DebugMode) // Debug mode for testing purposes. Should be changed to release in pruduction
-	router := gin.Default()    // Getting a default router. It will  do the job
+	gin.SetMode(mode)       // Debug mode logs every request. Only meant for development
+	router := gin.Default() // Getting a default router. It will  do the job
+
+	router.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	return router
 }
 
+// Opens the database of the configured driver. The memory driver has none
+func openDatabase(cfg config.DatabaseConfig) (*sql.DB, error) {
+	switch cfg.Driver {
+	case config.PostgresDriver:
+		return postgres.InitPostgresDB(postgres.Config{
+			Host:     cfg.Host,
+			Port:     cfg.Port,
+			User:     cfg.User,
+			Password: cfg.Password,
+			DataBase: cfg.Name,
+		})
+
+	case config.SQLiteDriver:
+		return sqlite.InitSQLiteDB(sqlite.Config{Path: cfg.Path})
+	}
+
+	return mysql.InitMySqlDB(mysql.Config{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		User:     cfg.User,
+		Password: cfg.Password,
+		DataBase: cfg.Name,
+	})
+}
+
+// Every driver has its own dialect, hence its own migrations
+func newMigrator(driver string, db *sql.DB) *migrations.Migrator {
+	switch driver {
+	case config.PostgresDriver:
+		return postgres.NewMigrator(db)
+	case config.SQLiteDriver:
+		return sqlite.NewMigrator(db)
+	}
+	return mysql.NewMigrator(db)
+}
+
+// Every port backed by the configured storage
+type repositories struct {
+	items           ports.CartItemsRepository
+	outbox          ports.ReservationOutbox
+	cartEvents      ports.CartEventsOutbox
+	idempotencyKeys ports.IdempotencyKeysRepository
+	apiKeys         ports.APIKeysRepository
+}
+
+// The cart items and their reservation tasks are written together, so all of them share the same storage
+func newRepositories(cfg config.DatabaseConfig) (repositories, error) {
+	if cfg.Driver == config.MemoryDriver {
+		log.Warn().Msg("carts are kept in memory. They are lost when the service stops")
+		store := memory.NewStore()
+		return repositories{
+			items:           memory.NewCartItemsRepository(store),
+			outbox:          memory.NewReservationOutbox(store),
+			cartEvents:      memory.NewCartEventsOutbox(store),
+			idempotencyKeys: memory.NewIdempotencyKeysRepository(store),
+			apiKeys:         memory.NewAPIKeysRepository(store),
+		}, nil
+	}
+
+	db, dbErr := openDatabase(cfg)
+
+	// There is no database server nor admin to migrate a sqlite file, so the app always does it
+	if dbErr == nil && (cfg.AutoMigrate || cfg.Driver == config.SQLiteDriver) {
+		applied, migrateErr := newMigrator(cfg.Driver, db).Up(context.Background())
+		logAppliedMigrations(applied)
+		if migrateErr != nil {
+			dbErr = fmt.Errorf("migrating the database --> %w", migrateErr)
+		}
+	}
+
+	switch cfg.Driver {
+	case config.PostgresDriver:
+		return repositories{
+			items:           postgres.NewCartItemsRepository(db),
+			outbox:          postgres.NewReservationOutbox(db),
+			cartEvents:      postgres.NewCartEventsOutbox(db),
+			idempotencyKeys: postgres.NewIdempotencyKeysRepository(db),
+			apiKeys:         postgres.NewAPIKeysRepository(db),
+		}, dbErr
+	case config.SQLiteDriver:
+		return repositories{
+			items:           sqlite.NewCartItemsRepository(db),
+			outbox:          sqlite.NewReservationOutbox(db),
+			cartEvents:      sqlite.NewCartEventsOutbox(db),
+			idempotencyKeys: sqlite.NewIdempotencyKeysRepository(db),
+			apiKeys:         sqlite.NewAPIKeysRepository(db),
+		}, dbErr
+	}
+	return repositories{
+		items:           mysql.NewCartItemsRepository(db),
+		outbox:          mysql.NewReservationOutbox(db),
+		cartEvents:      mysql.NewCartEventsOutbox(db),
+		idempotencyKeys: mysql.NewIdempotencyKeysRepository(db),
+		apiKeys:         mysql.NewAPIKeysRepository(db),
+	}, dbErr
+}
+
+func reservationDispatcherConfig(cfg config.ReservationsConfig) services.ReservationDispatcherConfig {
+	return services.ReservationDispatcherConfig{
+		PollInterval:  cfg.PollInterval,
+		BatchSize:     cfg.BatchSize,
+		ClaimLease:    cfg.ClaimLease,
+		MaxAttempts:   cfg.MaxAttempts,
+		BaseBackoff:   cfg.BaseBackoff,
+		MaxBackoff:    cfg.MaxBackoff,
+		Workers:       cfg.Workers,
+		QueueSize:     cfg.QueueSize,
+		PurgeInterval: cfg.PurgeInterval,
+	}
+}
+
+func cartEventsDispatcherConfig(cfg config.CartsConfig) services.CartEventsDispatcherConfig {
+	return services.CartEventsDispatcherConfig{
+		PollInterval:  cfg.EventsPollInterval,
+		BatchSize:     cfg.EventsBatchSize,
+		ClaimLease:    cfg.EventsClaimLease,
+		MaxAttempts:   cfg.EventsMaxAttempts,
+		BaseBackoff:   cfg.EventsBaseBackoff,
+		MaxBackoff:    cfg.EventsMaxBackoff,
+		PurgeInterval: cfg.EventsPurgeInterval,
+	}
+}
+
+// Every call to the reserver is retried a few times. If it keeps failing, the breaker opens and the
+// reservations stay queued in the outbox until the reserver recovers
+func newItemReserver(cfg config.ReserverConfig) *resilient.ItemReserver {
+	return resilient.NewItemReserver(
+		httpReservers.NewItemReserver(cfg.URL, cfg.Timeout),
+		resilient.RetryPolicy{
+			MaxAttempts: cfg.Retry.MaxAttempts,
+			BaseDelay:   cfg.Retry.BaseDelay,
+			MaxDelay:    cfg.Retry.MaxDelay,
+		},
+		resilient.NewCircuitBreaker(resilient.CircuitBreakerConfig{
+			FailureThreshold: cfg.CircuitBreaker.FailureThreshold,
+			OpenTimeout:      cfg.CircuitBreaker.OpenTimeout,
+		}),
+	)
+}
+
+// Abandoned carts go to the marketing webhook. Without it they are only logged
+func newCartEventsPublisher(cfg config.CartsConfig) ports.CartEventsPublisher {
+	if cfg.AbandonedWebhookURL == "" {
+		return logger.NewCartEventsPublisher()
+	}
+	return httpPublishers.NewCartEventsPublisher(cfg.AbandonedWebhookURL, cfg.AbandonedWebhookTimeout)
+}
+
 func main() {
 
+	// shopping-cart migrate up|down|status manages the schema of the database instead of running the server
+	if len(os.Args) > 1 && os.Args[1] == migrateCommand {
+		if migrateErr := runMigrate(os.Args[0], os.Args[2:]); migrateErr != nil {
+			log.Fatal().Err(migrateErr).Msg("migration failed")
+		}
+		return
+	}
+
+	// shopping-cart apikeys create|list|revoke manages the keys of the back office tools and services
+	if len(os.Args) > 1 && os.Args[1] == apiKeysCommand {
+		if apiKeysErr := runAPIKeys(os.Args[0], os.Args[2:]); apiKeysErr != nil {
+			log.Fatal().Err(apiKeysErr).Msg("api keys command failed")
+		}
+		return
+	}
+
+	// Settings come from the config file, the env variables and the flags. See the config package
+	cfg, cfgErr := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if errors.Is(cfgErr, flag.ErrHelp) {
+		return
+	}
+	if cfgErr != nil {
+		log.Fatal().Err(cfgErr).Msg("invalid configuration")
+	}
+
 	// Using zerolog as it allows to write the logs in json format. It´s useful for parsing them
-	// Default log level should be set in an variable that could be adjustable, ideally in run time to debug potential problems.
-	zerolog.SetGlobalLevel(defaultLogLevel)
+	// The log level could be adjustable in run time to debug potential problems.
+	zerolog.SetGlobalLevel(cfg.Log.Level)
 
-	router := setupRouter()
+	router := setupRouter(cfg.Server.Mode)
 
 	// default context that handles the signals
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 
-	// We should setup an authenticated endpoint in production. In order to do that, middlewares should be added
-	routerGroupWithoutAuth := router.Group("/shopping-cart/v1/")
-
 	// Create all handlers, services and repos. In production code a dependency injection tool may be advisable,
 	// as this part could get potentially big
-	db, dbErr := mysql.InitMySqlDB()
-	if dbErr != nil {
-		log.Error().Msg("Cannot connect to the database " + dbErr.Error())
+	repos, repoErr := newRepositories(cfg.Database)
+	if repoErr != nil {
+		log.Error().Msg("Cannot connect to the database " + repoErr.Error())
 	}
-	repo := mysql.NewCartItemsRepository(db)
 
-	// These host values should be retrieved from env variables depending on the stac
-	svc := services.NewCartItemsService(repo, "http://www.reservationhost.com", 60*time.Second)
-	h := httpHandlers.NewCartItemsHandler(routerGroupWithoutAuth, svc)
+	// The spec is the contract. Requests, and responses if asked to, are checked against it before reaching the handlers
+	var contract []gin.HandlerFunc
+	if cfg.Server.ValidateRequests || cfg.Server.ValidateResponses {
+		openAPI, openAPIErr := httpHandlers.NewOpenAPIMiddleware(api.Spec, httpHandlers.OpenAPIConfig{
+			ValidateRequests:  cfg.Server.ValidateRequests,
+			ValidateResponses: cfg.Server.ValidateResponses,
+		})
+		if openAPIErr != nil {
+			log.Fatal().Err(openAPIErr).Msg("invalid openapi spec")
+		}
+		contract = append(contract, openAPI)
+	}
+
+	// Clients are authenticated before anything else, so they can only use their own carts. Back office tools and
+	// services send an api key instead, and can use any cart
+	authentication := []gin.HandlerFunc{httpHandlers.NewAPIKeyMiddleware(services.NewAPIKeysService(repos.apiKeys))}
+	// Shoppers not logged in yet are guests, identified by a cookie. Their carts are merged once they log in
+	if cfg.Guests.Enabled {
+		authentication = append(authentication, httpHandlers.NewGuestMiddleware(httpHandlers.GuestConfig{
+			CookieMaxAge: cfg.Guests.CookieMaxAge,
+			SecureCookie: cfg.Guests.SecureCookie,
+		}))
+	}
+	if cfg.Auth.JWKSFile != "" {
+		keys, keysErr := httpHandlers.LoadKeySet(cfg.Auth.JWKSFile)
+		if keysErr != nil {
+			log.Fatal().Err(keysErr).Msg("invalid json web key set")
+		}
+		authentication = append(authentication, httpHandlers.NewJWTMiddleware(httpHandlers.JWTConfig{
+			Keys:     keys,
+			Issuer:   cfg.Auth.Issuer,
+			Audience: cfg.Auth.Audience,
+			Leeway:   cfg.Auth.Leeway,
+		}))
+	} else {
+		log.Warn().Msg("no json web key set configured. Anyone knowing the id of a cart can use it")
+	}
+	// Requests are measured before anything else, so the ones rejected by the other middlewares are counted as well
+	apiGroup := router.Group(apiBasePath, httpHandlers.NewMetricsMiddleware())
+	cartsGroup := apiGroup.Group("", append(authentication, contract...)...)
+	// Callbacks come from the reserver, not from the clients. They are signed instead, see below
+	callbacksGroup := apiGroup.Group("", contract...)
+
+	// Retries of the requests sent with an Idempotency-Key are answered with the first response
+	idempotencySvc := services.NewIdempotencyService(repos.idempotencyKeys, services.IdempotencyServiceConfig{
+		TTL:           cfg.Idempotency.TTL,
+		Lease:         cfg.Idempotency.Lease,
+		PurgeInterval: cfg.Idempotency.PurgeInterval,
+	})
+	go idempotencySvc.Run(ctx)
+
+	svc := services.NewCartItemsService(repos.items, newItemReserver(cfg.Reserver))
+	h := httpHandlers.NewCartItemsHandler(cartsGroup, svc, httpHandlers.NewIdempotencyMiddleware(idempotencySvc))
 	h.Register()
 
+	// Callbacks are not authenticated with tokens, but signed by the reserver with a shared secret.
+	// Without the secret every callback is rejected
+	if cfg.Reserver.CallbackSecret == "" {
+		log.Warn().Msg("no reservation callback secret configured. Every reservation callback will be rejected")
+	}
+	callbackHandler := httpHandlers.NewReservationCallbackHandler(callbacksGroup, svc,
+		[]byte(cfg.Reserver.CallbackSecret), cfg.Reserver.CallbackMaxAge)
+	callbackHandler.Register()
+
+	// Reservations are taken from the outbox in background and processed by a pool of workers.
+	// The pool is drained when the service stops
+	dispatcher := services.NewReservationDispatcher(repos.outbox, svc.ProcessReservationTask, reservationDispatcherConfig(cfg.Reservations))
+	go dispatcher.Run(ctx)
+
+	// Idle carts are deleted in background and their reservations released, so the stock is not held forever.
+	// A TTL of 0 keeps the carts forever
+	if cfg.Carts.TTL > 0 {
+		sweeper := services.NewCartSweeper(repos.items, services.CartSweeperConfig{
+			TTL:       cfg.Carts.TTL,
+			Interval:  cfg.Carts.SweepInterval,
+			BatchSize: cfg.Carts.SweepBatchSize,
+		})
+		go sweeper.Run(ctx)
+	}
+
+	// The abandoned carts written by the sweeper are published in background, and retried until the webhook
+	// takes them. It runs even with a TTL of 0, so the carts abandoned before are not lost
+	cartEventsDispatcher := services.NewCartEventsDispatcher(repos.cartEvents, newCartEventsPublisher(cfg.Carts),
+		cartEventsDispatcherConfig(cfg.Carts))
+	go cartEventsDispatcher.Run(ctx)
+
 	// Start gin service
 	log.Debug().Msg("Running")
 	ginSrv := &http.Server{
-		Addr:    ":" + localPort,
+		Addr:    ":" + strconv.Itoa(cfg.Server.Port),
 		Handler: router,
 	}
 
@@ -76,12 +345,17 @@ func main() {
 	stop()
 
 	// Shut down with timeout in order to allow any running operation to finish
-	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if shutdownErr := ginSrv.Shutdown(ctx); shutdownErr != nil {
 		log.Error().Msg("Forcing shutdown: " + shutdownErr.Error())
 	}
 
+	// After the http server, so no request is left behind. Reservations not processed in time go back to the outbox
+	if shutdownErr := dispatcher.Shutdown(ctx); shutdownErr != nil {
+		log.Error().Msg("Forcing reservation workers shutdown: " + shutdownErr.Error())
+	}
+
 	log.Debug().Msg("Stopped")
 }
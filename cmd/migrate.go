@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/migrations"
+	"github.com/Harital/shopping-cart/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	migrateCommand = "migrate"
+
+	migrateUp     = "up"
+	migrateDown   = "down"
+	migrateStatus = "status"
+)
+
+// Runs shopping-cart migrate up|down|status [flags]. The flags, the env variables and the config file are the same
+// as the server ones. The schema is usually changed by an admin user, I.E.
+// shopping-cart migrate up -database-user root -database-password-file /run/secrets/db_root_password
+func runMigrate(name string, args []string) error {
+	usage := fmt.Errorf("usage: %s %s %s|%s|%s [flags]", name, migrateCommand, migrateUp, migrateDown, migrateStatus)
+	if len(args) == 0 {
+		return usage
+	}
+	action := args[0]
+	if action != migrateUp && action != migrateDown && action != migrateStatus {
+		return usage
+	}
+
+	cfg, cfgErr := config.Load(name+" "+migrateCommand+" "+action, args[1:], os.Getenv)
+	if errors.Is(cfgErr, flag.ErrHelp) {
+		return nil
+	}
+	if cfgErr != nil {
+		return fmt.Errorf("invalid configuration --> %w", cfgErr)
+	}
+	zerolog.SetGlobalLevel(cfg.Log.Level)
+
+	if cfg.Database.Driver == config.MemoryDriver {
+		return errors.New("the memory driver has no schema to migrate")
+	}
+	db, dbErr := openDatabase(cfg.Database)
+	if dbErr != nil {
+		return fmt.Errorf("cannot connect to the database --> %w", dbErr)
+	}
+	defer db.Close()
+
+	migrator := newMigrator(cfg.Database.Driver, db)
+	ctx := context.Background()
+
+	switch action {
+	case migrateUp:
+		applied, upErr := migrator.Up(ctx)
+		logAppliedMigrations(applied)
+		if upErr != nil {
+			return upErr
+		}
+		if len(applied) == 0 {
+			log.Info().Msg("database schema already up to date")
+		}
+
+	case migrateDown:
+		migration, downErr := migrator.Down(ctx)
+		if downErr != nil {
+			return downErr
+		}
+		log.Info().Int64("version", migration.Version).Str("name", migration.Name).Msg("migration rolled back")
+
+	case migrateStatus:
+		statuses, statusErr := migrator.Status(ctx)
+		if statusErr != nil {
+			return statusErr
+		}
+		printMigrationStatus(statuses)
+	}
+	return nil
+}
+
+func logAppliedMigrations(applied []migrations.Migration) {
+	for _, migration := range applied {
+		log.Info().Int64("version", migration.Version).Str("name", migration.Name).Msg("migration applied")
+	}
+}
+
+// Meant for humans, so it is written as a table in the standard output instead of being logged
+func printMigrationStatus(statuses []migrations.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	w.Flush()
+}
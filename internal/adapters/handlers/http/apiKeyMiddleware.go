@@ -0,0 +1,53 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	// Gin key with the id of the api key that authenticated the request. The JWT middleware lets these requests
+	// through without a token
+	apiKeyIdKey = "apiKeyId"
+)
+
+// Authenticates the back office tools and services by their X-API-Key header. They can use any cart, so no subject
+// is put into the request context, and the service does not check who owns the cart.
+// Reading needs the read scope and changing the carts the write one. Requests without the header are left to the
+// next middleware
+func NewAPIKeyMiddleware(svc ports.APIKeysService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret := c.GetHeader(apiKeyHeader)
+		if secret == "" {
+			c.Next()
+			return
+		}
+
+		key, authErr := svc.Authenticate(c.Request.Context(), secret)
+		if authErr != nil {
+			writeError(c, authErr, "authenticating api key")
+			return
+		}
+
+		scope := requiredScope(c.Request.Method)
+		if !key.Allows(scope) {
+			writeError(c, fmt.Errorf("api key %s without %s scope --> %w", key.Id, scope, model.ErrInsufficientScope), "api key scope")
+			return
+		}
+
+		c.Set(apiKeyIdKey, key.Id)
+		c.Next()
+	}
+}
+
+func requiredScope(method string) model.APIKeyScope {
+	if method == http.MethodGet || method == http.MethodHead {
+		return model.ReadScope
+	}
+	return model.WriteScope
+}
@@ -0,0 +1,118 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Harital/shopping-cart/internal/core/mocks"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+const apiKey = "sck_secret"
+
+func Test_APIKeyMiddleware_GivenJWTMiddlewareBehind(t *testing.T) {
+	keySet, parseErr := ParseKeySet([]byte(`{"keys":[{"kty":"oct","kid":"hs","k":"c2VjcmV0"}]}`))
+	require.NoError(t, parseErr)
+
+	readKey := model.APIKey{Id: "1", Name: "back office", Scopes: []model.APIKeyScope{model.ReadScope}}
+	adminKey := model.APIKey{Id: "2", Name: "checkout", Scopes: []model.APIKeyScope{model.AdminScope}}
+
+	type input struct {
+		method string
+		apiKey string
+	}
+	type want struct {
+		httpCode int
+		code     string
+		// The subject is never set for api keys, so the service does not check the owner of the cart
+		reached bool
+	}
+	tests := []struct {
+		name  string
+		in    input
+		mocks func(svc *mocks.MockAPIKeysService)
+		want  want
+	}{
+		{
+			name: "WhenNoAPIKey_ThenTokenIsRequired",
+			in:   input{method: http.MethodGet},
+			mocks: func(svc *mocks.MockAPIKeysService) {
+				svc.EXPECT().Authenticate(gomock.Any(), gomock.Any()).Times(0)
+			},
+			want: want{httpCode: 401, code: "missing_token"},
+		}, {
+			name: "WhenInvalidAPIKey_ThenUnauthorized",
+			in:   input{method: http.MethodGet, apiKey: apiKey},
+			mocks: func(svc *mocks.MockAPIKeysService) {
+				svc.EXPECT().Authenticate(gomock.Any(), apiKey).Return(model.APIKey{}, model.ErrInvalidAPIKey)
+			},
+			want: want{httpCode: 401, code: "invalid_api_key"},
+		}, {
+			name: "WhenAuthenticationFails_ThenInternalError",
+			in:   input{method: http.MethodGet, apiKey: apiKey},
+			mocks: func(svc *mocks.MockAPIKeysService) {
+				svc.EXPECT().Authenticate(gomock.Any(), apiKey).Return(model.APIKey{}, errors.New("random error"))
+			},
+			want: want{httpCode: 500, code: "internal_error"},
+		}, {
+			name: "WhenReadWithReadScope_ThenRequestGoesThroughWithoutToken",
+			in:   input{method: http.MethodGet, apiKey: apiKey},
+			mocks: func(svc *mocks.MockAPIKeysService) {
+				svc.EXPECT().Authenticate(gomock.Any(), apiKey).Return(readKey, nil)
+			},
+			want: want{httpCode: 200, reached: true},
+		}, {
+			name: "WhenChangeWithReadScope_ThenForbidden",
+			in:   input{method: http.MethodPatch, apiKey: apiKey},
+			mocks: func(svc *mocks.MockAPIKeysService) {
+				svc.EXPECT().Authenticate(gomock.Any(), apiKey).Return(readKey, nil)
+			},
+			want: want{httpCode: 403, code: "insufficient_scope"},
+		}, {
+			name: "WhenChangeWithAdminScope_ThenRequestGoesThroughWithoutToken",
+			in:   input{method: http.MethodDelete, apiKey: apiKey},
+			mocks: func(svc *mocks.MockAPIKeysService) {
+				svc.EXPECT().Authenticate(gomock.Any(), apiKey).Return(adminKey, nil)
+			},
+			want: want{httpCode: 200, reached: true},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			svc := mocks.NewMockAPIKeysService(mockCtrl)
+			tc.mocks(svc)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			group := router.Group("", NewAPIKeyMiddleware(svc), NewJWTMiddleware(JWTConfig{Keys: keySet}))
+
+			reached := false
+			group.Handle(tc.in.method, "/carts", func(c *gin.Context) {
+				_, authenticated := model.SubjectFromContext(c.Request.Context())
+				reached = !authenticated
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest(tc.in.method, "/carts", nil)
+			if tc.in.apiKey != "" {
+				req.Header.Set(apiKeyHeader, tc.in.apiKey)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.want.httpCode, w.Code)
+			assert.Equal(t, tc.want.reached, reached)
+			if tc.want.code != "" {
+				assert.Contains(t, w.Body.String(), `"code":"`+tc.want.code+`"`)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	authorizationHeader   = "Authorization"
+	wwwAuthenticateHeader = "WWW-Authenticate"
+	bearerScheme          = "Bearer"
+)
+
+type JWTConfig struct {
+	Keys *KeySet
+	// Checked against the iss and aud claims, if set
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// Authenticates the clients by the JWT sent as bearer token. The subject of the token is put into the request
+// context, so the services know whose request it is. Tokens must expire and have a subject.
+// Requests already authenticated by an api key, or made as a guest, need no token. See NewAPIKeyMiddleware and
+// NewGuestMiddleware
+func NewJWTMiddleware(cfg JWTConfig) gin.HandlerFunc {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	parser := jwt.NewParser(options...)
+
+	return func(c *gin.Context) {
+		_, byAPIKey := c.Get(apiKeyIdKey)
+		_, asGuest := c.Get(guestKey)
+		if byAPIKey || asGuest {
+			c.Next()
+			return
+		}
+
+		tokenString, found := bearerToken(c)
+		if !found {
+			c.Header(wwwAuthenticateHeader, bearerScheme)
+			writeError(c, errMissingToken, "no bearer token")
+			return
+		}
+
+		var claims jwt.RegisteredClaims
+		if _, parseErr := parser.ParseWithClaims(tokenString, &claims, cfg.Keys.keyFunc); parseErr != nil {
+			c.Header(wwwAuthenticateHeader, bearerScheme+` error="invalid_token"`)
+			writeError(c, fmt.Errorf("%w --> %w", errInvalidToken, parseErr), "invalid bearer token")
+			return
+		}
+		if claims.Subject == "" {
+			c.Header(wwwAuthenticateHeader, bearerScheme+` error="invalid_token"`)
+			writeError(c, fmt.Errorf("token without subject --> %w", errInvalidToken), "invalid bearer token")
+			return
+		}
+
+		c.Request = c.Request.WithContext(model.WithSubject(c.Request.Context(), claims.Subject))
+		c.Next()
+	}
+}
+
+// The scheme is case insensitive, I.E. bearer works as well
+func bearerToken(c *gin.Context) (string, bool) {
+	scheme, token, found := strings.Cut(c.GetHeader(authorizationHeader), " ")
+	token = strings.TrimSpace(token)
+	if !found || !strings.EqualFold(scheme, bearerScheme) || token == "" {
+		return "", false
+	}
+	return token, true
+}
@@ -0,0 +1,215 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	hsKid    = "hs-1"
+	rsKid    = "rs-1"
+	hsSecret = "a-secret-shared-with-the-identity-provider"
+	issuer   = "https://id.example.com"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// One key of each supported type, plus an EC key that must be skipped
+func testKeySet(t *testing.T) (*rsa.PrivateKey, []byte) {
+	rsaKey, keyErr := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, keyErr)
+
+	jwks := fmt.Sprintf(`{"keys":[
+		{"kty":"oct","kid":%q,"alg":"HS256","k":%q},
+		{"kty":"RSA","kid":%q,"use":"sig","n":%q,"e":%q},
+		{"kty":"EC","kid":"ec-1","crv":"P-256","x":"x","y":"y"}
+	]}`, hsKid, b64([]byte(hsSecret)), rsKid, b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()))
+	return rsaKey, []byte(jwks)
+}
+
+func Test_ParseKeySet_GivenJWKS(t *testing.T) {
+	tests := []struct {
+		name    string
+		jwks    string
+		wantErr bool
+		wantLen int
+	}{
+		{
+			name:    "WhenNotJson_ThenError",
+			jwks:    `keys`,
+			wantErr: true,
+		}, {
+			name:    "WhenNoSupportedKey_ThenError",
+			jwks:    `{"keys":[{"kty":"EC","kid":"ec-1"},{"kty":"oct","kid":"enc","use":"enc","k":"c2VjcmV0"}]}`,
+			wantErr: true,
+		}, {
+			name:    "WhenOctKeyWithoutSecret_ThenError",
+			jwks:    `{"keys":[{"kty":"oct","kid":"hs"}]}`,
+			wantErr: true,
+		}, {
+			name:    "WhenRSAKeyWithBrokenModulus_ThenError",
+			jwks:    `{"keys":[{"kty":"RSA","kid":"rs","n":"%%%","e":"AQAB"}]}`,
+			wantErr: true,
+		}, {
+			name:    "WhenKeyForAnotherAlgorithm_ThenItIsSkipped",
+			jwks:    `{"keys":[{"kty":"RSA","kid":"ps","alg":"PS256","n":"AQAB","e":"AQAB"},{"kty":"oct","kid":"hs","k":"c2VjcmV0"}]}`,
+			wantLen: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			keySet, parseErr := ParseKeySet([]byte(tc.jwks))
+
+			if tc.wantErr {
+				assert.Error(t, parseErr)
+				return
+			}
+			if assert.NoError(t, parseErr) {
+				assert.Len(t, keySet.keys, tc.wantLen)
+			}
+		})
+	}
+}
+
+func Test_JWTMiddleware_GivenKeySet(t *testing.T) {
+	rsaKey, jwks := testKeySet(t)
+	keySet, parseErr := ParseKeySet(jwks)
+	require.NoError(t, parseErr)
+
+	otherKey, keyErr := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, keyErr)
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "alice", "iss": issuer, "exp": time.Now().Add(time.Minute).Unix()}
+	}
+	sign := func(method jwt.SigningMethod, kid string, claims jwt.MapClaims, key any) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, signErr := token.SignedString(key)
+		require.NoError(t, signErr)
+		return signed
+	}
+	withoutClaim := func(claim string) jwt.MapClaims {
+		claims := validClaims()
+		delete(claims, claim)
+		return claims
+	}
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	otherIssuer := validClaims()
+	otherIssuer["iss"] = "https://someone.else.com"
+
+	type want struct {
+		httpCode        int
+		code            string
+		wwwAuthenticate string
+		subject         string
+	}
+	tests := []struct {
+		name          string
+		authorization string
+		want          want
+	}{
+		{
+			name:          "WhenNoAuthorization_ThenMissingToken",
+			authorization: "",
+			want:          want{httpCode: 401, code: "missing_token", wwwAuthenticate: "Bearer"},
+		}, {
+			name:          "WhenAnotherScheme_ThenMissingToken",
+			authorization: "Basic YWxpY2U6c2VjcmV0",
+			want:          want{httpCode: 401, code: "missing_token", wwwAuthenticate: "Bearer"},
+		}, {
+			name:          "WhenGarbage_ThenInvalidToken",
+			authorization: "Bearer garbage",
+			want:          want{httpCode: 401, code: "invalid_token", wwwAuthenticate: `Bearer error="invalid_token"`},
+		}, {
+			name:          "WhenValidHS256Token_ThenSubjectIsInTheContext",
+			authorization: "Bearer " + sign(jwt.SigningMethodHS256, hsKid, validClaims(), []byte(hsSecret)),
+			want:          want{httpCode: 200, subject: "alice"},
+		}, {
+			name:          "WhenHS256TokenWithoutKidAndSingleHS256Key_ThenSubjectIsInTheContext",
+			authorization: "bearer " + sign(jwt.SigningMethodHS256, "", validClaims(), []byte(hsSecret)),
+			want:          want{httpCode: 200, subject: "alice"},
+		}, {
+			name:          "WhenValidRS256Token_ThenSubjectIsInTheContext",
+			authorization: "Bearer " + sign(jwt.SigningMethodRS256, rsKid, validClaims(), rsaKey),
+			want:          want{httpCode: 200, subject: "alice"},
+		}, {
+			name:          "WhenRS256TokenSignedWithAnotherKey_ThenInvalidToken",
+			authorization: "Bearer " + sign(jwt.SigningMethodRS256, rsKid, validClaims(), otherKey),
+			want:          want{httpCode: 401, code: "invalid_token", wwwAuthenticate: `Bearer error="invalid_token"`},
+		}, {
+			name:          "WhenUnknownKid_ThenInvalidToken",
+			authorization: "Bearer " + sign(jwt.SigningMethodHS256, "hs-2", validClaims(), []byte(hsSecret)),
+			want:          want{httpCode: 401, code: "invalid_token", wwwAuthenticate: `Bearer error="invalid_token"`},
+		}, {
+			// The kid of an RSA key with an HS256 token. The public key must never be used as a secret
+			name:          "WhenAlgorithmDoesNotMatchTheKey_ThenInvalidToken",
+			authorization: "Bearer " + sign(jwt.SigningMethodHS256, rsKid, validClaims(), []byte(hsSecret)),
+			want:          want{httpCode: 401, code: "invalid_token", wwwAuthenticate: `Bearer error="invalid_token"`},
+		}, {
+			name:          "WhenUnsignedToken_ThenInvalidToken",
+			authorization: "Bearer " + sign(jwt.SigningMethodNone, hsKid, validClaims(), jwt.UnsafeAllowNoneSignatureType),
+			want:          want{httpCode: 401, code: "invalid_token", wwwAuthenticate: `Bearer error="invalid_token"`},
+		}, {
+			name:          "WhenExpiredToken_ThenInvalidToken",
+			authorization: "Bearer " + sign(jwt.SigningMethodHS256, hsKid, expired, []byte(hsSecret)),
+			want:          want{httpCode: 401, code: "invalid_token", wwwAuthenticate: `Bearer error="invalid_token"`},
+		}, {
+			name:          "WhenTokenDoesNotExpire_ThenInvalidToken",
+			authorization: "Bearer " + sign(jwt.SigningMethodHS256, hsKid, withoutClaim("exp"), []byte(hsSecret)),
+			want:          want{httpCode: 401, code: "invalid_token", wwwAuthenticate: `Bearer error="invalid_token"`},
+		}, {
+			name:          "WhenTokenFromAnotherIssuer_ThenInvalidToken",
+			authorization: "Bearer " + sign(jwt.SigningMethodHS256, hsKid, otherIssuer, []byte(hsSecret)),
+			want:          want{httpCode: 401, code: "invalid_token", wwwAuthenticate: `Bearer error="invalid_token"`},
+		}, {
+			name:          "WhenTokenWithoutSubject_ThenInvalidToken",
+			authorization: "Bearer " + sign(jwt.SigningMethodHS256, hsKid, withoutClaim("sub"), []byte(hsSecret)),
+			want:          want{httpCode: 401, code: "invalid_token", wwwAuthenticate: `Bearer error="invalid_token"`},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+
+			var subject string
+			router.GET("/carts", NewJWTMiddleware(JWTConfig{Keys: keySet, Issuer: issuer}), func(c *gin.Context) {
+				subject, _ = model.SubjectFromContext(c.Request.Context())
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest(http.MethodGet, "/carts", nil)
+			if tc.authorization != "" {
+				req.Header.Set(authorizationHeader, tc.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.want.httpCode, w.Code)
+			assert.Equal(t, tc.want.wwwAuthenticate, w.Header().Get(wwwAuthenticateHeader))
+			assert.Equal(t, tc.want.subject, subject)
+			if tc.want.code != "" {
+				assert.Contains(t, w.Body.String(), `"code":"`+tc.want.code+`"`)
+			}
+		})
+	}
+}
@@ -1,76 +1,188 @@
 package http
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/Harital/shopping-cart/internal/core/model"
 	"github.com/Harital/shopping-cart/internal/core/ports"
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog/log"
+)
+
+const (
+	cartIdParam = "cartId"
+	itemIdParam = "itemId"
+	// Same size as the cart id column in the database
+	maxCartIdLength = 36
+
+	etagHeader    = "ETag"
+	ifMatchHeader = "If-Match"
+	// No version is ever negative, so a change with it always fails
+	unmatchableVersion = -1
 )
 
 type CartItemshandler struct {
 	router          *gin.RouterGroup
 	cartItemService ports.CartItemsService
+	// Adding an item is not idempotent, as the quantities are merged. See NewIdempotencyMiddleware
+	idempotency gin.HandlerFunc
 }
 
-func NewCartItemsHandler(r *gin.RouterGroup, svc ports.CartItemsService) *CartItemshandler {
+func NewCartItemsHandler(r *gin.RouterGroup, svc ports.CartItemsService, idempotency gin.HandlerFunc) *CartItemshandler {
 	return &CartItemshandler{
 		router:          r,
 		cartItemService: svc,
+		idempotency:     idempotency,
 	}
 }
 
 // This functionality could be done in the constructor, but it is not a good practise to add
 // logic (that can potentially fail) in the constructor
 func (cih *CartItemshandler) Register() {
-	cih.router.GET("/items", cih.getCartItems)
-	cih.router.POST("/items", cih.addCartItems)
+	cih.router.GET("/carts/:"+cartIdParam+"/items", cih.getCartItems)
+	cih.router.POST("/carts/:"+cartIdParam+"/items", cih.idempotency, cih.addCartItems)
+	cih.router.DELETE("/carts/:"+cartIdParam+"/items/:"+itemIdParam, cih.removeCartItem)
+	cih.router.PATCH("/carts/:"+cartIdParam+"/items/:"+itemIdParam, cih.updateCartItem)
+	// Folding the same guest cart twice would add its quantities twice, so it is idempotent the same way adding is
+	cih.router.POST("/carts/:"+cartIdParam+"/merge", cih.idempotency, cih.mergeCart)
+}
+
+// Gin guarantees that the parameter is not empty, as the route would not match otherwise.
+// We only need to make sure that it fits in the database
+func cartIdFromPath(c *gin.Context) (string, bool) {
+	cartId := c.Param(cartIdParam)
+	if len(cartId) > maxCartIdLength {
+		writeError(c, fmt.Errorf("cart id %s --> %w", cartId, errBadRequest), "cart id too long")
+		return "", false
+	}
+	return cartId, true
+}
+
+// The version of the cart is sent as a strong etag, I.E. "3"
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Without If-Match (or with *) the change is applied whatever the version of the cart is.
+// Anything else must be one of our etags. Weak etags, lists or garbage can never match, as If-Match uses strong comparison
+func expectedVersionFromHeader(c *gin.Context) *int64 {
+	ifMatch := strings.TrimSpace(c.GetHeader(ifMatchHeader))
+	if ifMatch == "" || ifMatch == "*" {
+		return nil
+	}
+
+	version := int64(unmatchableVersion)
+	if len(ifMatch) > 2 && strings.HasPrefix(ifMatch, `"`) && strings.HasSuffix(ifMatch, `"`) {
+		if parsed, parseErr := strconv.ParseInt(ifMatch[1:len(ifMatch)-1], 10, 64); parseErr == nil && parsed >= 0 {
+			version = parsed
+		}
+	}
+	return &version
 }
 
 func (cih CartItemshandler) getCartItems(c *gin.Context) {
-	items, getErr := cih.cartItemService.Get(c)
+	cartId, ok := cartIdFromPath(c)
+	if !ok {
+		return
+	}
+
+	cart, getErr := cih.cartItemService.Get(c.Request.Context(), cartId)
 
-	// Other error types should be checked here, like if the user is properly authenticated.
-	// The response should be different dependint on the error type
 	if getErr != nil {
-		resp := model.NewErrorResponse("Error getting the cart items")
-		log.
-			Error().
-			Err(getErr).
-			Msg("when getting cart items")
-		c.JSON(http.StatusInternalServerError, resp)
+		writeError(c, getErr, "when getting cart items")
 		return
 	}
 
-	resp := model.NewGetCartITemsResponse(&items)
+	resp := model.NewGetCartITemsResponse(&cart.Items)
+	c.Header(etagHeader, versionETag(cart.Version))
 	c.JSON(http.StatusOK, *resp)
 }
 
 func (cih CartItemshandler) addCartItems(c *gin.Context) {
+	cartId, ok := cartIdFromPath(c)
+	if !ok {
+		return
+	}
+
 	var item model.CartItemRequest
 	if bindErr := c.ShouldBindJSON(&item); bindErr != nil {
-		resp := model.NewErrorResponse("bad request")
-		log.
-			Error().
-			Err(bindErr).
-			Msg("Bad json request")
 		// We could consider here to print the body that caused this error for debugbging purposes
-		c.JSON(http.StatusBadRequest, resp)
+		writeError(c, fmt.Errorf("%w --> %w", errBadRequest, bindErr), "Bad json request")
 		return
 	}
 
-	// We could make more input checks, like all the require fields are filled, they have the proper format, etc
-
-	addErr := cih.cartItemService.Add(c, item.Item)
+	version, addErr := cih.cartItemService.Add(c.Request.Context(), cartId, item.Item, expectedVersionFromHeader(c))
 	if addErr != nil {
-		resp := model.NewErrorResponse("internal error")
-		log.
-			Error().
-			Err(addErr).
-			Msg("adding an item to the basket")
-		c.JSON(http.StatusInternalServerError, resp)
+		writeError(c, addErr, "adding an item to the basket")
 		return
 	}
+	c.Header(etagHeader, versionETag(version))
 	c.Status(http.StatusAccepted)
 }
+
+func (cih CartItemshandler) removeCartItem(c *gin.Context) {
+	cartId, ok := cartIdFromPath(c)
+	if !ok {
+		return
+	}
+
+	version, removeErr := cih.cartItemService.Remove(c.Request.Context(), cartId, c.Param(itemIdParam), expectedVersionFromHeader(c))
+	if removeErr != nil {
+		writeError(c, removeErr, "removing an item from the basket")
+		return
+	}
+
+	// The release of the reservation, if any, is done in background
+	c.Header(etagHeader, versionETag(version))
+	c.Status(http.StatusAccepted)
+}
+
+func (cih CartItemshandler) updateCartItem(c *gin.Context) {
+	cartId, ok := cartIdFromPath(c)
+	if !ok {
+		return
+	}
+
+	var update model.UpdateCartItemRequest
+	if bindErr := c.ShouldBindJSON(&update); bindErr != nil {
+		writeError(c, fmt.Errorf("%w --> %w", errBadRequest, bindErr), "Bad json request")
+		return
+	}
+
+	version, updateErr := cih.cartItemService.UpdateQuantity(c.Request.Context(), cartId, c.Param(itemIdParam), *update.Quantity, expectedVersionFromHeader(c))
+	if updateErr != nil {
+		writeError(c, updateErr, "updating the quantity of an item in the basket")
+		return
+	}
+
+	c.Header(etagHeader, versionETag(version))
+	c.Status(http.StatusAccepted)
+}
+
+// The guest cart is the one in the path, named guestId in the spec. Gin needs the same wildcard name in every route
+// that shares the segment, hence the cartId param. The cart it is merged into comes in the body
+func (cih CartItemshandler) mergeCart(c *gin.Context) {
+	guestCartId, ok := cartIdFromPath(c)
+	if !ok {
+		return
+	}
+
+	var merge model.MergeCartRequest
+	if bindErr := c.ShouldBindJSON(&merge); bindErr != nil {
+		writeError(c, fmt.Errorf("%w --> %w", errBadRequest, bindErr), "Bad json request")
+		return
+	}
+
+	cart, mergeErr := cih.cartItemService.Merge(c.Request.Context(), guestCartId, merge.CartId, expectedVersionFromHeader(c))
+	if mergeErr != nil {
+		writeError(c, mergeErr, "merging the guest cart")
+		return
+	}
+
+	// Same as getting the cart, so the client does not need to read it again
+	resp := model.NewGetCartITemsResponse(&cart.Items)
+	c.Header(etagHeader, versionETag(cart.Version))
+	c.JSON(http.StatusOK, *resp)
+}
@@ -2,10 +2,12 @@ package http
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Harital/shopping-cart/internal/core/mocks"
 	"github.com/Harital/shopping-cart/internal/core/model"
@@ -21,41 +23,101 @@ type CartItemHandlerMocks struct {
 type want struct {
 	httpCode int
 	body     string
+	// Version of the cart sent back, if any
+	etag string
 }
 
+const (
+	cartId   = "5b9a2ecf-0a37-4f4b-9c57-0d4d2e7e3a11"
+	itemsUrl = "/shopping-cart/v1/carts/" + cartId + "/items"
+)
+
 var (
 	internalError = errors.New("Internal Error")
+	// One character longer than the cart id column
+	tooLongItemsUrl = "/shopping-cart/v1/carts/" + strings.Repeat("a", 37) + "/items"
 )
 
+// Requests go straight to the handler. The middleware has its own tests
+func noIdempotency(*gin.Context) {}
+
+// gomock compares the pointed values, so any pointer to the same version matches
+func expectedVersion(version int64) *int64 {
+	return &version
+}
+
 func Test_GetCartItems_GivenInitializedHandler(t *testing.T) {
+	reservationUpdatedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
 
+	type input struct {
+		url string
+	}
 	tests := []struct {
 		name  string
+		in    input
 		mocks func(m CartItemHandlerMocks)
 		want  want
 	}{
 		{
+			name: "WhenGetCartItemsAndCartIdTooLong_ThenBadRequest",
+			in: input{
+				url: tooLongItemsUrl,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().Get(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"version":"1.0.0","code":"bad_request","Message":"bad request"}`,
+			},
+		}, {
 			name: "WhenGetCartItemsAndError_ThenErrorIsReturned",
+			in: input{
+				url: itemsUrl,
+			},
 			mocks: func(m CartItemHandlerMocks) {
-				m.svc.EXPECT().Get(gomock.Any()).
-					Return([]model.CartItem{}, internalError)
+				m.svc.EXPECT().Get(gomock.Any(), cartId).
+					Return(model.Cart{}, internalError)
 			},
 			want: want{
 				httpCode: 500,
-				body:     `{"version":"1.0.0","Message":"Error getting the cart items"}`,
+				body:     `{"version":"1.0.0","code":"internal_error","Message":"internal error"}`,
+			},
+		}, {
+			name: "WhenGetCartItemsAndEmptyCart_ThenEmptyItems",
+			in: input{
+				url: itemsUrl,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().Get(gomock.Any(), cartId).
+					Return(model.Cart{}, nil)
+			},
+			want: want{
+				httpCode: 200,
+				body:     `{"Version":"1.0.0","Items":[]}`,
+				etag:     `"0"`,
 			},
 		}, {
 			name: "WhenGetCartItemsAndOK_ThenItemsAreRetrieved",
+			in: input{
+				url: itemsUrl,
+			},
 			mocks: func(m CartItemHandlerMocks) {
-				m.svc.EXPECT().Get(gomock.Any()).
-					Return([]model.CartItem{
-						{Id: "1", Name: "bottle", Quantity: 10, ReservationId: "reservationId5"},
-						{Id: "2", Name: "mouse", Quantity: 4, ReservationId: "mouseReservationId"},
-					}, nil)
+				m.svc.EXPECT().Get(gomock.Any(), cartId).
+					Return(model.Cart{Version: 7, Items: []model.CartItem{
+						{Id: "1", Name: "bottle", Quantity: 10, ReservationId: "reservationId5", ReservedQuantity: 10,
+							ReservationStatus: model.ReservationReserved, ReservationUpdatedAt: &reservationUpdatedAt},
+						{Id: "2", Name: "mouse", Quantity: 4, ReservationId: "mouseReservationId", ReservedQuantity: 3,
+							ReservationStatus: model.ReservationFailed, ReservationError: "out of stock", ReservationUpdatedAt: &reservationUpdatedAt},
+					}}, nil)
 			},
 			want: want{
 				httpCode: 200,
-				body:     `{"Version":"1.0.0","Items":[{"id":"1","name":"bottle","quantity":10,"reservationId":"reservationId5"},{"id":"2","name":"mouse","quantity":4,"reservationId":"mouseReservationId"}]}`,
+				body: `{"Version":"1.0.0","Items":[` +
+					`{"id":"1","name":"bottle","quantity":10,"reservationId":"reservationId5","reservedQuantity":10,"reservationStatus":"reserved","reservationUpdatedAt":"2024-01-01T10:00:00Z"},` +
+					`{"id":"2","name":"mouse","quantity":4,"reservationId":"mouseReservationId","reservedQuantity":3,"reservationStatus":"failed","reservationError":"out of stock","reservationUpdatedAt":"2024-01-01T10:00:00Z"}]}`,
+				etag: `"7"`,
 			},
 		},
 	}
@@ -66,7 +128,7 @@ func Test_GetCartItems_GivenInitializedHandler(t *testing.T) {
 
 			respRecorder := httptest.NewRecorder()
 			router := gin.Default()
-			rg := router.Group("/shopping-cart/v1")
+			rg := router.Group("/shopping-cart/v1", contract(t))
 
 			m := CartItemHandlerMocks{
 				svc: mocks.NewMockCartItemsService(mockCtrl),
@@ -74,10 +136,10 @@ func Test_GetCartItems_GivenInitializedHandler(t *testing.T) {
 
 			tc.mocks(m)
 
-			hndl := NewCartItemsHandler(rg, m.svc)
+			hndl := NewCartItemsHandler(rg, m.svc, noIdempotency)
 			hndl.Register()
 
-			req := httptest.NewRequest(http.MethodGet, "/shopping-cart/v1/items", nil)
+			req := httptest.NewRequest(http.MethodGet, tc.in.url, nil)
 
 			router.ServeHTTP(respRecorder, req)
 
@@ -85,13 +147,16 @@ func Test_GetCartItems_GivenInitializedHandler(t *testing.T) {
 			// Here we could not compare the body itself but convert the json to an struct and comparing the struct
 			// If the json is misordered it would not fail.
 			assert.Equal(t, tc.want.body, respRecorder.Body.String())
+			assert.Equal(t, tc.want.etag, respRecorder.Header().Get("ETag"))
 		})
 	}
 }
 
 func Test_AddCartItems_GivenInitializedHandler(t *testing.T) {
 	type input struct {
-		body string
+		url     string
+		body    string
+		ifMatch string
 	}
 	tests := []struct {
 		name  string
@@ -100,22 +165,93 @@ func Test_AddCartItems_GivenInitializedHandler(t *testing.T) {
 		want  want
 	}{
 		{
+			name: "WhenPostNewItemAndCartIdTooLong_ThenError",
+			in: input{
+				url: tooLongItemsUrl,
+				body: `{
+				    "version": "1.0.0",
+					"item": {
+						"id": "1",
+						"name": "fancy pants",
+						"quantity": 1
+					}
+				}`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					Add(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"version":"1.0.0","code":"bad_request","Message":"bad request"}`,
+			},
+		}, {
 			name: "WhenPostNewItemAndInvalidJson_ThenError",
 			in: input{
+				url:  itemsUrl,
 				body: "not a json",
 			},
 			mocks: func(m CartItemHandlerMocks) {
 				m.svc.EXPECT().
-					Add(gomock.Any(), gomock.Any()).
+					Add(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			want: want{
 				httpCode: 400,
-				body:     `{"version":"1.0.0","Message":"bad request"}`,
+				body:     `{"version":"1.0.0","code":"bad_request","Message":"bad request"}`,
+			},
+		}, {
+			name: "WhenPostNewItemAndSeveralInvalidFields_ThenEveryOneIsReported",
+			in: input{
+				url: itemsUrl,
+				body: `{
+				    "version": "1.0.0",
+					"item": {
+						"id": "",
+						"name": "` + strings.Repeat("a", 51) + `",
+						"quantity": 0
+					}
+				}`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					Add(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 400,
+				body: `{"version":"1.0.0","code":"bad_request","Message":"bad request","errors":[` +
+					`{"field":"item.id","message":"is required"},` +
+					`{"field":"item.name","message":"must be at most 50 characters long"},` +
+					`{"field":"item.quantity","message":"must be at least 1"}]}`,
+			},
+		}, {
+			name: "WhenPostNewItemAndUnknownVersion_ThenBadRequest",
+			in: input{
+				url: itemsUrl,
+				body: `{
+				    "version": "2.0.0",
+					"item": {
+						"id": "1",
+						"name": "fancy pants",
+						"quantity": 1
+					}
+				}`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					Add(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"version":"1.0.0","code":"bad_request","Message":"bad request","errors":[{"field":"version","message":"must be one of 1.0.0"}]}`,
 			},
 		}, {
 			name: "WhenPostNewItemAndErrorAdding_ThenError",
 			in: input{
+				url: itemsUrl,
 				body: `{
 				    "version": "1.0.0",
 					"item": {
@@ -127,21 +263,22 @@ func Test_AddCartItems_GivenInitializedHandler(t *testing.T) {
 			},
 			mocks: func(m CartItemHandlerMocks) {
 				m.svc.EXPECT().
-					Add(gomock.Any(), model.CartItem{
+					Add(gomock.Any(), cartId, model.CartItem{
 						Id:            "1",
 						Name:          "fancy pants",
 						Quantity:      1,
 						ReservationId: "",
-					}).
-					Return(internalError)
+					}, nil).
+					Return(int64(0), internalError)
 			},
 			want: want{
 				httpCode: 500,
-				body:     `{"version":"1.0.0","Message":"internal error"}`,
+				body:     `{"version":"1.0.0","code":"internal_error","Message":"internal error"}`,
 			},
 		}, {
 			name: "WhenPostNewItemAndOK_ThenAccepted",
 			in: input{
+				url: itemsUrl,
 				body: `{
 				    "version": "1.0.0",
 					"item": {
@@ -153,19 +290,122 @@ func Test_AddCartItems_GivenInitializedHandler(t *testing.T) {
 			},
 			mocks: func(m CartItemHandlerMocks) {
 				m.svc.EXPECT().
-					Add(gomock.Any(), model.CartItem{
+					Add(gomock.Any(), cartId, model.CartItem{
 						Id:            "1",
 						Name:          "fancy pants",
 						Quantity:      1,
 						ReservationId: "",
-					}).
-					Return(nil)
+					}, nil).
+					Return(int64(1), nil)
+			},
+			want: want{
+				httpCode: 202,
+				body:     ``,
+				etag:     `"1"`,
+			},
+		}, {
+			name: "WhenPostNewItemAndIfMatchesCurrentVersion_ThenAcceptedWithNewVersion",
+			in: input{
+				url: itemsUrl,
+				body: `{
+				    "version": "1.0.0",
+					"item": {
+						"id": "1",
+						"name": "fancy pants",
+						"quantity": 1
+					}
+				}`,
+				ifMatch: `"3"`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					Add(gomock.Any(), cartId, model.CartItem{
+						Id:            "1",
+						Name:          "fancy pants",
+						Quantity:      1,
+						ReservationId: "",
+					}, expectedVersion(3)).
+					Return(int64(4), nil)
+			},
+			want: want{
+				httpCode: 202,
+				body:     ``,
+				etag:     `"4"`,
+			},
+		}, {
+			name: "WhenPostNewItemAndCartChanged_ThenPreconditionFailedWithCurrentVersion",
+			in: input{
+				url: itemsUrl,
+				body: `{
+				    "version": "1.0.0",
+					"item": {
+						"id": "1",
+						"name": "fancy pants",
+						"quantity": 1
+					}
+				}`,
+				ifMatch: `"3"`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					Add(gomock.Any(), cartId, gomock.Any(), expectedVersion(3)).
+					Return(int64(0), fmt.Errorf("wrapped --> %w", &model.VersionConflictError{CartId: cartId, Expected: 3, Current: 5}))
+			},
+			want: want{
+				httpCode: 412,
+				body:     `{"version":"1.0.0","code":"version_conflict","Message":"the cart has been modified"}`,
+				etag:     `"5"`,
+			},
+		}, {
+			name: "WhenPostNewItemAndIfMatchesAnything_ThenVersionIsNotChecked",
+			in: input{
+				url: itemsUrl,
+				body: `{
+				    "version": "1.0.0",
+					"item": {
+						"id": "1",
+						"name": "fancy pants",
+						"quantity": 1
+					}
+				}`,
+				ifMatch: "*",
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					Add(gomock.Any(), cartId, gomock.Any(), nil).
+					Return(int64(4), nil)
 			},
 			want: want{
 				httpCode: 202,
 				body:     ``,
+				etag:     `"4"`,
+			},
+		}, {
+			// If-Match uses the strong comparison, so weak etags never match
+			name: "WhenPostNewItemAndIfMatchWeakEtag_ThenNoVersionCanMatch",
+			in: input{
+				url: itemsUrl,
+				body: `{
+				    "version": "1.0.0",
+					"item": {
+						"id": "1",
+						"name": "fancy pants",
+						"quantity": 1
+					}
+				}`,
+				ifMatch: `W/"3"`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					Add(gomock.Any(), cartId, gomock.Any(), expectedVersion(-1)).
+					Return(int64(0), &model.VersionConflictError{CartId: cartId, Expected: -1, Current: 3})
+			},
+			want: want{
+				httpCode: 412,
+				body:     `{"version":"1.0.0","code":"version_conflict","Message":"the cart has been modified"}`,
+				etag:     `"3"`,
 			},
-		}, 
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -174,7 +414,7 @@ func Test_AddCartItems_GivenInitializedHandler(t *testing.T) {
 
 			respRecorder := httptest.NewRecorder()
 			router := gin.Default()
-			rg := router.Group("/shopping-cart/v1")
+			rg := router.Group("/shopping-cart/v1", contract(t))
 
 			m := CartItemHandlerMocks{
 				svc: mocks.NewMockCartItemsService(mockCtrl),
@@ -182,10 +422,13 @@ func Test_AddCartItems_GivenInitializedHandler(t *testing.T) {
 
 			tc.mocks(m)
 
-			hndl := NewCartItemsHandler(rg, m.svc)
+			hndl := NewCartItemsHandler(rg, m.svc, noIdempotency)
 			hndl.Register()
 
-			req := httptest.NewRequest(http.MethodPost, "/shopping-cart/v1/items", strings.NewReader(tc.in.body))
+			req := httptest.NewRequest(http.MethodPost, tc.in.url, strings.NewReader(tc.in.body))
+			if tc.in.ifMatch != "" {
+				req.Header.Set("If-Match", tc.in.ifMatch)
+			}
 
 			router.ServeHTTP(respRecorder, req)
 
@@ -193,6 +436,487 @@ func Test_AddCartItems_GivenInitializedHandler(t *testing.T) {
 			// Same as before. Here we could not compare the body itself but convert the json to an struct and comparing the struct
 			// If the json is misordered it would not fail.
 			assert.Equal(t, tc.want.body, respRecorder.Body.String())
+			assert.Equal(t, tc.want.etag, respRecorder.Header().Get("ETag"))
+		})
+	}
+}
+
+func Test_RemoveCartItem_GivenInitializedHandler(t *testing.T) {
+	type input struct {
+		url     string
+		ifMatch string
+	}
+	tests := []struct {
+		name  string
+		in    input
+		mocks func(m CartItemHandlerMocks)
+		want  want
+	}{
+		{
+			name: "WhenDeleteItemAndCartIdTooLong_ThenBadRequest",
+			in: input{
+				url: tooLongItemsUrl + "/1",
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					Remove(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"version":"1.0.0","code":"bad_request","Message":"bad request"}`,
+			},
+		}, {
+			name: "WhenDeleteItemAndItemNotFound_ThenNotFound",
+			in: input{
+				url: itemsUrl + "/1",
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					Remove(gomock.Any(), cartId, "1", nil).
+					Return(int64(0), fmt.Errorf("wrapped --> %w", model.ErrItemNotFound))
+			},
+			want: want{
+				httpCode: 404,
+				body:     `{"version":"1.0.0","code":"item_not_found","Message":"item not found"}`,
+			},
+		}, {
+			name: "WhenDeleteItemAndError_ThenError",
+			in: input{
+				url: itemsUrl + "/1",
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					Remove(gomock.Any(), cartId, "1", nil).
+					Return(int64(0), internalError)
+			},
+			want: want{
+				httpCode: 500,
+				body:     `{"version":"1.0.0","code":"internal_error","Message":"internal error"}`,
+			},
+		}, {
+			name: "WhenDeleteItemAndOK_ThenAccepted",
+			in: input{
+				url: itemsUrl + "/1",
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					Remove(gomock.Any(), cartId, "1", nil).
+					Return(int64(4), nil)
+			},
+			want: want{
+				httpCode: 202,
+				body:     ``,
+				etag:     `"4"`,
+			},
+		}, {
+			name: "WhenDeleteItemAndCartChanged_ThenPreconditionFailedWithCurrentVersion",
+			in: input{
+				url:     itemsUrl + "/1",
+				ifMatch: `"3"`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					Remove(gomock.Any(), cartId, "1", expectedVersion(3)).
+					Return(int64(0), &model.VersionConflictError{CartId: cartId, Expected: 3, Current: 6})
+			},
+			want: want{
+				httpCode: 412,
+				body:     `{"version":"1.0.0","code":"version_conflict","Message":"the cart has been modified"}`,
+				etag:     `"6"`,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			respRecorder := httptest.NewRecorder()
+			router := gin.Default()
+			rg := router.Group("/shopping-cart/v1", contract(t))
+
+			m := CartItemHandlerMocks{
+				svc: mocks.NewMockCartItemsService(mockCtrl),
+			}
+
+			tc.mocks(m)
+
+			hndl := NewCartItemsHandler(rg, m.svc, noIdempotency)
+			hndl.Register()
+
+			req := httptest.NewRequest(http.MethodDelete, tc.in.url, nil)
+			if tc.in.ifMatch != "" {
+				req.Header.Set("If-Match", tc.in.ifMatch)
+			}
+
+			router.ServeHTTP(respRecorder, req)
+
+			assert.Equal(t, tc.want.httpCode, respRecorder.Code)
+			assert.Equal(t, tc.want.body, respRecorder.Body.String())
+			assert.Equal(t, tc.want.etag, respRecorder.Header().Get("ETag"))
+		})
+	}
+}
+
+func Test_UpdateCartItem_GivenInitializedHandler(t *testing.T) {
+	type input struct {
+		url     string
+		body    string
+		ifMatch string
+		accept  string
+	}
+	tests := []struct {
+		name  string
+		in    input
+		mocks func(m CartItemHandlerMocks)
+		want  want
+	}{
+		{
+			name: "WhenPatchItemAndInvalidJson_ThenBadRequest",
+			in: input{
+				url:  itemsUrl + "/1",
+				body: "not a json",
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					UpdateQuantity(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"version":"1.0.0","code":"bad_request","Message":"bad request"}`,
+			},
+		}, {
+			name: "WhenPatchItemAndMissingQuantity_ThenBadRequest",
+			in: input{
+				url:  itemsUrl + "/1",
+				body: `{"version": "1.0.0"}`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					UpdateQuantity(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"version":"1.0.0","code":"bad_request","Message":"bad request","errors":[{"field":"quantity","message":"is required"}]}`,
+			},
+		}, {
+			name: "WhenPatchItemAndNegativeQuantity_ThenBadRequest",
+			in: input{
+				url:  itemsUrl + "/1",
+				body: `{"version": "1.0.0", "quantity": -1}`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					UpdateQuantity(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"version":"1.0.0","code":"bad_request","Message":"bad request","errors":[{"field":"quantity","message":"must be at least 0"}]}`,
+			},
+		}, {
+			name: "WhenPatchItemAndUnknownVersion_ThenBadRequest",
+			in: input{
+				url:  itemsUrl + "/1",
+				body: `{"version": "2.0.0", "quantity": 3}`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					UpdateQuantity(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"version":"1.0.0","code":"bad_request","Message":"bad request","errors":[{"field":"version","message":"must be one of 1.0.0"}]}`,
+			},
+		}, {
+			name: "WhenPatchItemAndMissingQuantityAndProblemAccepted_ThenProblemWithTheField",
+			in: input{
+				url:    itemsUrl + "/1",
+				body:   `{"version": "1.0.0"}`,
+				accept: "application/problem+json",
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					UpdateQuantity(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"type":"urn:shopping-cart:problem:bad_request","title":"bad request","status":400,"detail":"quantity is required","instance":"` + itemsUrl + `/1","code":"bad_request","errors":[{"field":"quantity","message":"is required"}]}`,
+			},
+		}, {
+			name: "WhenPatchItemAndItemNotFoundAndProblemAccepted_ThenProblem",
+			in: input{
+				url:    itemsUrl + "/1",
+				body:   `{"version": "1.0.0", "quantity": 3}`,
+				accept: "application/json, application/problem+json",
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					UpdateQuantity(gomock.Any(), cartId, "1", 3, nil).
+					Return(int64(0), fmt.Errorf("wrapped --> %w", model.ErrItemNotFound))
+			},
+			want: want{
+				httpCode: 404,
+				body:     `{"type":"urn:shopping-cart:problem:item_not_found","title":"item not found","status":404,"instance":"` + itemsUrl + `/1","code":"item_not_found"}`,
+			},
+		}, {
+			name: "WhenPatchItemAndItemNotFound_ThenNotFound",
+			in: input{
+				url:  itemsUrl + "/1",
+				body: `{"version": "1.0.0", "quantity": 3}`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					UpdateQuantity(gomock.Any(), cartId, "1", 3, nil).
+					Return(int64(0), model.ErrItemNotFound)
+			},
+			want: want{
+				httpCode: 404,
+				body:     `{"version":"1.0.0","code":"item_not_found","Message":"item not found"}`,
+			},
+		}, {
+			name: "WhenPatchItemAndError_ThenError",
+			in: input{
+				url:  itemsUrl + "/1",
+				body: `{"version": "1.0.0", "quantity": 3}`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					UpdateQuantity(gomock.Any(), cartId, "1", 3, nil).
+					Return(int64(0), internalError)
+			},
+			want: want{
+				httpCode: 500,
+				body:     `{"version":"1.0.0","code":"internal_error","Message":"internal error"}`,
+			},
+		}, {
+			name: "WhenPatchItemWithZeroQuantityAndOK_ThenAccepted",
+			in: input{
+				url:  itemsUrl + "/1",
+				body: `{"version": "1.0.0", "quantity": 0}`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					UpdateQuantity(gomock.Any(), cartId, "1", 0, nil).
+					Return(int64(2), nil)
+			},
+			want: want{
+				httpCode: 202,
+				body:     ``,
+				etag:     `"2"`,
+			},
+		}, {
+			name: "WhenPatchItemAndCartChanged_ThenPreconditionFailedWithCurrentVersion",
+			in: input{
+				url:     itemsUrl + "/1",
+				body:    `{"version": "1.0.0", "quantity": 3}`,
+				ifMatch: `"1"`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					UpdateQuantity(gomock.Any(), cartId, "1", 3, expectedVersion(1)).
+					Return(int64(0), &model.VersionConflictError{CartId: cartId, Expected: 1, Current: 2})
+			},
+			want: want{
+				httpCode: 412,
+				body:     `{"version":"1.0.0","code":"version_conflict","Message":"the cart has been modified"}`,
+				etag:     `"2"`,
+			},
+		}, {
+			name: "WhenPatchItemAndIfMatchesCurrentVersion_ThenAcceptedWithNewVersion",
+			in: input{
+				url:     itemsUrl + "/1",
+				body:    `{"version": "1.0.0", "quantity": 3}`,
+				ifMatch: `"1"`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					UpdateQuantity(gomock.Any(), cartId, "1", 3, expectedVersion(1)).
+					Return(int64(2), nil)
+			},
+			want: want{
+				httpCode: 202,
+				body:     ``,
+				etag:     `"2"`,
+			},
+		}, {
+			name: "WhenPatchItemAndOK_ThenAccepted",
+			in: input{
+				url:  itemsUrl + "/1",
+				body: `{"version": "1.0.0", "quantity": 3}`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().
+					UpdateQuantity(gomock.Any(), cartId, "1", 3, nil).
+					Return(int64(2), nil)
+			},
+			want: want{
+				httpCode: 202,
+				body:     ``,
+				etag:     `"2"`,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			respRecorder := httptest.NewRecorder()
+			router := gin.Default()
+			rg := router.Group("/shopping-cart/v1", contract(t))
+
+			m := CartItemHandlerMocks{
+				svc: mocks.NewMockCartItemsService(mockCtrl),
+			}
+
+			tc.mocks(m)
+
+			hndl := NewCartItemsHandler(rg, m.svc, noIdempotency)
+			hndl.Register()
+
+			req := httptest.NewRequest(http.MethodPatch, tc.in.url, strings.NewReader(tc.in.body))
+			if tc.in.ifMatch != "" {
+				req.Header.Set("If-Match", tc.in.ifMatch)
+			}
+			if tc.in.accept != "" {
+				req.Header.Set("Accept", tc.in.accept)
+			}
+
+			router.ServeHTTP(respRecorder, req)
+
+			assert.Equal(t, tc.want.httpCode, respRecorder.Code)
+			assert.Equal(t, tc.want.body, respRecorder.Body.String())
+			assert.Equal(t, tc.want.etag, respRecorder.Header().Get("ETag"))
+		})
+	}
+}
+
+func Test_MergeCart_GivenInitializedHandler(t *testing.T) {
+	const guestCartId = "0d4d2e7e-0a37-4f4b-9c57-5b9a2ecf3a11"
+	mergeUrl := "/shopping-cart/v1/carts/" + guestCartId + "/merge"
+	mergeBody := `{"version": "1.0.0", "cartId": "` + cartId + `"}`
+
+	type input struct {
+		url     string
+		body    string
+		ifMatch string
+	}
+	tests := []struct {
+		name  string
+		in    input
+		mocks func(m CartItemHandlerMocks)
+		want  want
+	}{
+		{
+			name: "WhenMergeWithoutCartId_ThenBadRequest",
+			in: input{
+				url:  mergeUrl,
+				body: `{"version": "1.0.0"}`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().Merge(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"version":"1.0.0","code":"bad_request","Message":"bad request","errors":[{"field":"cartId","message":"is required"}]}`,
+			},
+		}, {
+			name: "WhenMergeSameCart_ThenBadRequest",
+			in: input{
+				url:  "/shopping-cart/v1/carts/" + cartId + "/merge",
+				body: mergeBody,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().Merge(gomock.Any(), cartId, cartId, nil).
+					Return(model.Cart{}, fmt.Errorf("cart %s --> %w", cartId, model.ErrSameCart))
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"version":"1.0.0","code":"same_cart","Message":"the guest cart and the cart are the same one"}`,
+			},
+		}, {
+			name: "WhenMergeUnknownGuestCart_ThenNotFound",
+			in: input{
+				url:  mergeUrl,
+				body: mergeBody,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().Merge(gomock.Any(), guestCartId, cartId, nil).
+					Return(model.Cart{}, model.ErrCartNotFound)
+			},
+			want: want{
+				httpCode: 404,
+				body:     `{"version":"1.0.0","code":"cart_not_found","Message":"cart not found"}`,
+			},
+		}, {
+			name: "WhenMergeGuestCartOfSomeoneElse_ThenForbidden",
+			in: input{
+				url:  mergeUrl,
+				body: mergeBody,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().Merge(gomock.Any(), guestCartId, cartId, nil).
+					Return(model.Cart{}, model.ErrCartForbidden)
+			},
+			want: want{
+				httpCode: 403,
+				body:     `{"version":"1.0.0","code":"cart_forbidden","Message":"the cart belongs to another user"}`,
+			},
+		}, {
+			name: "WhenMergeWithIfMatch_ThenMergedCartIsReturned",
+			in: input{
+				url:     mergeUrl,
+				body:    mergeBody,
+				ifMatch: `"4"`,
+			},
+			mocks: func(m CartItemHandlerMocks) {
+				m.svc.EXPECT().Merge(gomock.Any(), guestCartId, cartId, expectedVersion(4)).
+					Return(model.Cart{Version: 5, Items: []model.CartItem{
+						{Id: "1", Name: "bottle", Quantity: 3, ReservedQuantity: 0, ReservationStatus: model.ReservationPending},
+					}}, nil)
+			},
+			want: want{
+				httpCode: 200,
+				body:     `{"Version":"1.0.0","Items":[{"id":"1","name":"bottle","quantity":3,"reservationId":"","reservedQuantity":0,"reservationStatus":"pending"}]}`,
+				etag:     `"5"`,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			respRecorder := httptest.NewRecorder()
+			router := gin.Default()
+			rg := router.Group("/shopping-cart/v1", contract(t))
+
+			m := CartItemHandlerMocks{
+				svc: mocks.NewMockCartItemsService(mockCtrl),
+			}
+
+			tc.mocks(m)
+
+			hndl := NewCartItemsHandler(rg, m.svc, noIdempotency)
+			hndl.Register()
+
+			req := httptest.NewRequest(http.MethodPost, tc.in.url, strings.NewReader(tc.in.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.in.ifMatch != "" {
+				req.Header.Set("If-Match", tc.in.ifMatch)
+			}
+
+			router.ServeHTTP(respRecorder, req)
+
+			assert.Equal(t, tc.want.httpCode, respRecorder.Code)
+			assert.Equal(t, tc.want.body, respRecorder.Body.String())
+			assert.Equal(t, tc.want.etag, respRecorder.Header().Get("ETag"))
 		})
 	}
 }
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/Harital/shopping-cart/internal/core/domainerr"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	acceptHeader      = "Accept"
+	contentTypeHeader = "Content-Type"
+	// The type of every problem is this prefix plus its code
+	problemTypePrefix = "urn:shopping-cart:problem:"
+)
+
+var (
+	// Errors of the http layer itself. The service never sees these requests
+	errBadRequest       = domainerr.New(domainerr.Validation, "bad_request", "bad request")
+	errInvalidSignature = domainerr.New(domainerr.Unauthorized, "invalid_signature", "unauthorized")
+	errMissingToken     = domainerr.New(domainerr.Unauthorized, "missing_token", "bearer token required")
+	errInvalidToken     = domainerr.New(domainerr.Unauthorized, "invalid_token", "invalid bearer token")
+	// Anything that is not a domain error. Its details are logged, never sent to the client
+	errInternal = domainerr.New("", "internal_error", "internal error")
+
+	statusByKind = map[domainerr.Kind]int{
+		domainerr.NotFound:     http.StatusNotFound,
+		domainerr.Validation:   http.StatusBadRequest,
+		domainerr.Conflict:     http.StatusConflict,
+		domainerr.Unavailable:  http.StatusServiceUnavailable,
+		domainerr.Unauthorized: http.StatusUnauthorized,
+		domainerr.Forbidden:    http.StatusForbidden,
+	}
+	// A few errors need a more specific status than the one of their kind
+	statusByCode = map[string]int{
+		model.ErrVersionConflict.Code:      http.StatusPreconditionFailed,
+		model.ErrIdempotencyKeyReused.Code: http.StatusUnprocessableEntity,
+	}
+)
+
+// The validation errors name the fields as the clients send them, I.E. quantity instead of Quantity
+func init() {
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(model.FieldName)
+	}
+}
+
+// Translates the error into its status code and the domain error sent to the client
+func classify(err error) (int, *domainerr.Error) {
+	domainErr, ok := domainerr.As(err)
+	if !ok {
+		domainErr = errInternal
+	}
+
+	status, found := statusByCode[domainErr.Code]
+	if !found {
+		status, found = statusByKind[domainErr.Kind]
+	}
+	if !found {
+		status = http.StatusInternalServerError
+	}
+	return status, domainErr
+}
+
+// The fields that failed the validation, either when binding the request or in the service. Errors that are not
+// about fields, I.E. a malformed json, have none
+func fieldErrors(err error) []model.FieldError {
+	var validationErr *model.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Fields
+	}
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return model.FieldErrors(validationErrs)
+	}
+	return nil
+}
+
+// Only the clients that ask for problem+json get it. Anything else, I.E. */* or application/json, gets the
+// ErrorResponse, as it did before
+func wantsProblem(c *gin.Context) bool {
+	for _, accepted := range strings.Split(c.GetHeader(acceptHeader), ",") {
+		mediaType, params, parseErr := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if parseErr == nil && mediaType == model.ProblemContentType && params["q"] != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+func newProblem(c *gin.Context, status int, domainErr *domainerr.Error, fields []model.FieldError) model.Problem {
+	problem := model.Problem{
+		Type:     problemTypePrefix + domainErr.Code,
+		Title:    domainErr.Message,
+		Status:   status,
+		Instance: c.Request.URL.Path,
+		Code:     domainErr.Code,
+		Errors:   fields,
+	}
+	if len(fields) > 0 {
+		details := make([]string, 0, len(fields))
+		for _, field := range fields {
+			details = append(details, field.String())
+		}
+		problem.Detail = strings.Join(details, ", ")
+	}
+	return problem
+}
+
+// Every handler and middleware writes its errors through here, so the same error always gets the same response.
+// The client only gets the code and the message of the domain error, plus the fields that are not valid.
+// The whole chain, with the details, goes to the log.
+// Aborts the request, so the middlewares after this one are not run either
+func writeError(c *gin.Context, err error, logMsg string) {
+	status, domainErr := classify(err)
+
+	// Client errors are expected. Server ones need to be looked at
+	event := log.Info()
+	if status >= http.StatusInternalServerError {
+		event = log.Error()
+	}
+	event.
+		Err(err).
+		Int("status", status).
+		Str("code", domainErr.Code).
+		Msg(logMsg)
+
+	// The current version is sent back, so the client can get the cart again and retry
+	var conflict *model.VersionConflictError
+	if errors.As(err, &conflict) {
+		c.Header(etagHeader, versionETag(conflict.Current))
+	}
+
+	fields := fieldErrors(err)
+	if !wantsProblem(c) {
+		resp := model.NewErrorResponse(domainErr.Code, domainErr.Message)
+		resp.Errors = fields
+		c.AbortWithStatusJSON(status, resp)
+		return
+	}
+	// Gin keeps the content type when it is already set
+	c.Header(contentTypeHeader, model.ProblemContentType)
+	c.AbortWithStatusJSON(status, newProblem(c, status, domainErr, fields))
+}
@@ -0,0 +1,144 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// We use Gherkin notation for the tests
+func Test_Classify_GivenErrors(t *testing.T) {
+	type want struct {
+		httpCode int
+		code     string
+		message  string
+	}
+	tests := []struct {
+		name string
+		err  error
+		want want
+	}{
+		{
+			name: "WhenNotFound_ThenNotFound",
+			err:  fmt.Errorf("removing item --> %w", model.ErrItemNotFound),
+			want: want{httpCode: http.StatusNotFound, code: "item_not_found", message: "item not found"},
+		}, {
+			name: "WhenValidation_ThenBadRequest",
+			err:  fmt.Errorf("updating item --> %w", model.ErrInvalidQuantity),
+			want: want{httpCode: http.StatusBadRequest, code: "invalid_quantity", message: "invalid quantity"},
+		}, {
+			name: "WhenServiceValidation_ThenBadRequest",
+			err:  fmt.Errorf("item 1 --> %w", &model.ValidationError{Fields: []model.FieldError{{Field: "quantity", Message: "must be at least 1"}}}),
+			want: want{httpCode: http.StatusBadRequest, code: "invalid_request", message: "invalid request"},
+		}, {
+			name: "WhenConflict_ThenConflict",
+			err:  model.ErrIdempotencyKeyInProgress,
+			want: want{httpCode: http.StatusConflict, code: "idempotency_key_in_progress", message: "request with the same idempotency key in progress"},
+		}, {
+			name: "WhenVersionConflict_ThenPreconditionFailed",
+			err:  fmt.Errorf("adding item --> %w", &model.VersionConflictError{CartId: "cart", Expected: 1, Current: 2}),
+			want: want{httpCode: http.StatusPreconditionFailed, code: "version_conflict", message: "the cart has been modified"},
+		}, {
+			name: "WhenIdempotencyKeyReused_ThenUnprocessableEntity",
+			err:  model.ErrIdempotencyKeyReused,
+			want: want{httpCode: http.StatusUnprocessableEntity, code: "idempotency_key_reused", message: "idempotency key already used by a different request"},
+		}, {
+			name: "WhenUnavailable_ThenServiceUnavailable",
+			err:  fmt.Errorf("reserving --> %w", model.ErrCircuitOpen),
+			want: want{httpCode: http.StatusServiceUnavailable, code: "reserver_circuit_open", message: "reserver circuit breaker is open"},
+		}, {
+			name: "WhenUnauthorized_ThenUnauthorized",
+			err:  errInvalidSignature,
+			want: want{httpCode: http.StatusUnauthorized, code: "invalid_signature", message: "unauthorized"},
+		}, {
+			name: "WhenForbidden_ThenForbidden",
+			err:  fmt.Errorf("cart 1 --> %w", model.ErrCartForbidden),
+			want: want{httpCode: http.StatusForbidden, code: "cart_forbidden", message: "the cart belongs to another user"},
+		}, {
+			name: "WhenNotDomainError_ThenInternalErrorWithoutDetails",
+			err:  errors.New("dial tcp 10.0.0.1:3306: connection refused"),
+			want: want{httpCode: http.StatusInternalServerError, code: "internal_error", message: "internal error"},
+		}, {
+			// The outermost domain error wins, and the wrapped details are not sent
+			name: "WhenWrappingSeveralDomainErrors_ThenOutermost",
+			err:  fmt.Errorf("%w --> %w", errBadRequest, fmt.Errorf("secret detail --> %w", model.ErrItemNotFound)),
+			want: want{httpCode: http.StatusBadRequest, code: "bad_request", message: "bad request"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			httpCode, domainErr := classify(tc.err)
+
+			assert.Equal(t, tc.want.httpCode, httpCode)
+			assert.Equal(t, tc.want.code, domainErr.Code)
+			assert.Equal(t, tc.want.message, domainErr.Message)
+		})
+	}
+}
+
+func Test_WriteError_GivenAcceptHeader(t *testing.T) {
+	const (
+		errorResponseBody = `{"version":"1.0.0","code":"item_not_found","Message":"item not found"}`
+		problemBody       = `{"type":"urn:shopping-cart:problem:item_not_found","title":"item not found","status":404,"instance":"/carts/1/items/2","code":"item_not_found"}`
+	)
+	type want struct {
+		contentType string
+		body        string
+	}
+	tests := []struct {
+		name   string
+		accept string
+		want   want
+	}{
+		{
+			name:   "WhenNoAccept_ThenErrorResponse",
+			accept: "",
+			want:   want{contentType: "application/json; charset=utf-8", body: errorResponseBody},
+		}, {
+			name:   "WhenAnything_ThenErrorResponse",
+			accept: "*/*",
+			want:   want{contentType: "application/json; charset=utf-8", body: errorResponseBody},
+		}, {
+			name:   "WhenJson_ThenErrorResponse",
+			accept: "application/json",
+			want:   want{contentType: "application/json; charset=utf-8", body: errorResponseBody},
+		}, {
+			name:   "WhenProblem_ThenProblem",
+			accept: "application/problem+json",
+			want:   want{contentType: "application/problem+json", body: problemBody},
+		}, {
+			name:   "WhenProblemAmongOthers_ThenProblem",
+			accept: "application/json;q=0.9, application/problem+json",
+			want:   want{contentType: "application/problem+json", body: problemBody},
+		}, {
+			name:   "WhenProblemRefused_ThenErrorResponse",
+			accept: "application/problem+json;q=0",
+			want:   want{contentType: "application/json; charset=utf-8", body: errorResponseBody},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(respRecorder)
+			c.Request = httptest.NewRequest(http.MethodDelete, "/carts/1/items/2", nil)
+			if tc.accept != "" {
+				c.Request.Header.Set("Accept", tc.accept)
+			}
+
+			writeError(c, fmt.Errorf("removing item --> %w", model.ErrItemNotFound), "removing item")
+
+			assert.Equal(t, http.StatusNotFound, respRecorder.Code)
+			assert.Equal(t, tc.want.contentType, respRecorder.Header().Get("Content-Type"))
+			assert.Equal(t, tc.want.body, respRecorder.Body.String())
+			assert.True(t, c.IsAborted())
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	guestCookie = "shopping_cart_guest"
+	// Gin key with the subject of the guest the request is made as. The JWT middleware lets these requests through
+	// without a token
+	guestKey = "guest"
+	// 256 random bits, base64url encoded without padding
+	guestTokenBytes  = 32
+	guestTokenLength = 43
+	// Tells the guests apart from the users of the identity provider in the owners of the carts
+	guestSubjectPrefix = "guest:"
+)
+
+type GuestConfig struct {
+	// Lifetime of the cookie. It is renewed on every request made as a guest
+	CookieMaxAge time.Duration
+	// The cookie is only sent over https
+	SecureCookie bool
+}
+
+// Lets the shoppers fill a cart before logging in. Requests without an api key nor an Authorization header are made
+// as the guest of the cookie, and a new guest is given to the ones without it. The guest is the subject of the
+// request, so it owns the carts it fills as any user would.
+// Requests with a token keep the guest of the cookie, if any, so the user can merge the carts it filled as a guest
+func NewGuestMiddleware(cfg GuestConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, byAPIKey := c.Get(apiKeyIdKey); byAPIKey {
+			c.Next()
+			return
+		}
+
+		token, cookieErr := c.Cookie(guestCookie)
+		hasToken := cookieErr == nil && len(token) == guestTokenLength
+		ctx := c.Request.Context()
+
+		if c.GetHeader(authorizationHeader) != "" {
+			if hasToken {
+				c.Request = c.Request.WithContext(model.WithGuest(ctx, guestSubject(token)))
+			}
+			c.Next()
+			return
+		}
+
+		if !hasToken {
+			var tokenErr error
+			if token, tokenErr = newGuestToken(); tokenErr != nil {
+				writeError(c, tokenErr, "creating guest")
+				return
+			}
+		}
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(guestCookie, token, int(cfg.CookieMaxAge.Seconds()), "/", "", cfg.SecureCookie, true)
+
+		subject := guestSubject(token)
+		c.Request = c.Request.WithContext(model.WithSubject(model.WithGuest(ctx, subject), subject))
+		c.Set(guestKey, subject)
+		c.Next()
+	}
+}
+
+func newGuestToken() (string, error) {
+	random := make([]byte, guestTokenBytes)
+	if _, randErr := rand.Read(random); randErr != nil {
+		return "", fmt.Errorf("generating guest token --> %w", randErr)
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// The token is a secret, so only its hash is stored as the owner of the carts
+func guestSubject(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return guestSubjectPrefix + hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GuestMiddleware_GivenJWTMiddlewareBehind(t *testing.T) {
+	keySet, parseErr := ParseKeySet([]byte(`{"keys":[{"kty":"oct","kid":"hs","k":"` + b64([]byte(hsSecret)) + `"}]}`))
+	require.NoError(t, parseErr)
+	token, signErr := jwt.NewWithClaims(jwt.SigningMethodHS256,
+		jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Minute).Unix()}).SignedString([]byte(hsSecret))
+	require.NoError(t, signErr)
+
+	guestToken := strings.Repeat("g", guestTokenLength)
+
+	type input struct {
+		cookie        string
+		authorization string
+		byAPIKey      bool
+	}
+	type want struct {
+		httpCode int
+		// Empty if the request is not made as a guest
+		subject string
+		guest   string
+		// The token of the cookie set in the response, if any. New means a token other than the one sent
+		cookie    string
+		newCookie bool
+	}
+	tests := []struct {
+		name string
+		in   input
+		want want
+	}{
+		{
+			name: "WhenNoCookie_ThenRequestIsMadeAsNewGuest",
+			in:   input{},
+			want: want{httpCode: 200, newCookie: true},
+		}, {
+			name: "WhenMalformedCookie_ThenRequestIsMadeAsNewGuest",
+			in:   input{cookie: "short"},
+			want: want{httpCode: 200, newCookie: true},
+		}, {
+			name: "WhenCookie_ThenRequestIsMadeAsItsGuestAndCookieIsRenewed",
+			in:   input{cookie: guestToken},
+			want: want{httpCode: 200, subject: guestSubject(guestToken), guest: guestSubject(guestToken), cookie: guestToken},
+		}, {
+			name: "WhenTokenAndCookie_ThenRequestIsMadeAsTheUserThatWasTheGuest",
+			in:   input{cookie: guestToken, authorization: "Bearer " + token},
+			want: want{httpCode: 200, subject: "alice", guest: guestSubject(guestToken)},
+		}, {
+			name: "WhenToken_ThenRequestIsMadeAsTheUser",
+			in:   input{authorization: "Bearer " + token},
+			want: want{httpCode: 200, subject: "alice"},
+		}, {
+			name: "WhenInvalidToken_ThenUnauthorizedInsteadOfGuest",
+			in:   input{cookie: guestToken, authorization: "Bearer nonsense"},
+			want: want{httpCode: 401},
+		}, {
+			name: "WhenAPIKey_ThenNoGuest",
+			in:   input{cookie: guestToken, byAPIKey: true},
+			want: want{httpCode: 200},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			apiKey := func(c *gin.Context) {
+				if tc.in.byAPIKey {
+					c.Set(apiKeyIdKey, "1")
+				}
+			}
+			group := router.Group("", apiKey,
+				NewGuestMiddleware(GuestConfig{CookieMaxAge: time.Hour, SecureCookie: true}),
+				NewJWTMiddleware(JWTConfig{Keys: keySet}))
+
+			var subject, guest string
+			group.GET("/carts", func(c *gin.Context) {
+				subject, _ = model.SubjectFromContext(c.Request.Context())
+				guest, _ = model.GuestFromContext(c.Request.Context())
+				c.Status(http.StatusOK)
+			})
+
+			req, _ := http.NewRequest(http.MethodGet, "/carts", nil)
+			if tc.in.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: guestCookie, Value: tc.in.cookie})
+			}
+			if tc.in.authorization != "" {
+				req.Header.Set(authorizationHeader, tc.in.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.want.httpCode, w.Code)
+
+			cookies := w.Result().Cookies()
+			if !tc.want.newCookie && tc.want.cookie == "" {
+				assert.Empty(t, cookies)
+				assert.Equal(t, tc.want.subject, subject)
+				assert.Equal(t, tc.want.guest, guest)
+				return
+			}
+
+			require.Len(t, cookies, 1)
+			cookie := cookies[0]
+			assert.Equal(t, guestCookie, cookie.Name)
+			assert.True(t, cookie.HttpOnly)
+			assert.True(t, cookie.Secure)
+			assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+			assert.Equal(t, 3600, cookie.MaxAge)
+			if tc.want.newCookie {
+				assert.Len(t, cookie.Value, guestTokenLength)
+				assert.NotEqual(t, tc.in.cookie, cookie.Value)
+			} else {
+				assert.Equal(t, tc.want.cookie, cookie.Value)
+			}
+			// The guest is the subject of the request, so it owns the carts it fills
+			assert.Equal(t, guestSubject(cookie.Value), subject)
+			assert.Equal(t, guestSubject(cookie.Value), guest)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// Set on the replayed responses, so the clients can tell them apart
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	// The key stored in the database is longer, as it is scoped by the caller. See scopedKey
+	maxIdempotencyKeyLength = 255
+	// Cart requests are tiny. Anything bigger is not worth buffering and hashing
+	maxIdempotentBodySize = 64 * 1024
+
+	// Callers that own their idempotency keys
+	apiKeyCaller    = "apiKey"
+	subjectCaller   = "subject"
+	anonymousCaller = "anonymous"
+)
+
+var (
+	// Only the headers that describe the response are replayed. Anything else belongs to the first request
+	replayedHeaders = []string{"Content-Type", etagHeader}
+)
+
+// Keeps a copy of the body written by the handlers, so it can be stored along with the response
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+func (rr *responseRecorder) WriteString(s string) (int, error) {
+	rr.body.WriteString(s)
+	return rr.ResponseWriter.WriteString(s)
+}
+
+// Retries of a request sent with an Idempotency-Key get the response to the first one instead of being applied
+// again. Requests without the header go through untouched
+func NewIdempotencyMiddleware(svc ports.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(c, fmt.Errorf("idempotency key of %d characters --> %w", len(key), errBadRequest), "idempotency key too long")
+			return
+		}
+
+		body, readErr := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodySize))
+		if readErr != nil {
+			writeError(c, fmt.Errorf("%w --> %w", errBadRequest, readErr), "reading the request body")
+			return
+		}
+		// The handler reads the body again
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are chosen by the clients, so two callers may pick the same one
+		key = scopedKey(c, key)
+		stored, startErr := svc.Start(c.Request.Context(), key, requestHash(c.Request, body))
+		switch {
+		case startErr != nil:
+			writeError(c, startErr, "starting idempotent request")
+			return
+		case stored != nil:
+			replay(c, *stored)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// The client may have given up on the request, which is the reason it will be retried. The response
+		// must be stored anyway
+		ctx := context.WithoutCancel(c.Request.Context())
+
+		// Server errors are not final. The retries are processed again
+		if recorder.Status() >= http.StatusInternalServerError {
+			if abandonErr := svc.Abandon(ctx, key); abandonErr != nil {
+				log.
+					Error().
+					Err(abandonErr).
+					Msg("abandoning idempotent request. Retries are rejected until the key expires")
+			}
+			return
+		}
+
+		response := model.IdempotentResponse{
+			StatusCode: recorder.Status(),
+			Headers:    map[string]string{},
+			Body:       recorder.body.Bytes(),
+		}
+		for _, header := range replayedHeaders {
+			if value := recorder.Header().Get(header); value != "" {
+				response.Headers[header] = value
+			}
+		}
+		if completeErr := svc.Complete(ctx, key, response); completeErr != nil {
+			log.
+				Error().
+				Err(completeErr).
+				Msg("storing idempotent response. Retries are rejected until the key expires")
+		}
+	}
+}
+
+// Prefixes the key with the scope of its caller, so every caller has its own keys. See callerScope
+func scopedKey(c *gin.Context, key string) string {
+	kind, caller := requestCaller(c)
+	return callerScope(kind, caller) + ":" + key
+}
+
+// Back office tools are told apart by their api key, and users and guests by their subject. Requests without both
+// (I.E. authentication disabled) share their keys
+func requestCaller(c *gin.Context) (string, string) {
+	if apiKeyId, found := c.Get(apiKeyIdKey); found {
+		return apiKeyCaller, fmt.Sprint(apiKeyId)
+	}
+	if subject, found := model.SubjectFromContext(c.Request.Context()); found {
+		return subjectCaller, subject
+	}
+	return anonymousCaller, ""
+}
+
+// Hashed, so the scope of a caller never looks like the key of another one, whatever characters they use, and
+// the scoped key fits in the column whatever the size of the subject
+func callerScope(kind string, caller string) string {
+	scope := sha256.Sum256([]byte(kind + "\x00" + caller))
+	return hex.EncodeToString(scope[:])
+}
+
+// Same key with another method, path, If-Match or body is a different request. So is the same request sent by another
+// user, who must never get the response given to someone else
+func requestHash(r *http.Request, body []byte) string {
+	subject, _ := model.SubjectFromContext(r.Context())
+	hash := sha256.New()
+	for _, part := range []string{r.Method, r.URL.Path, r.Header.Get(ifMatchHeader), subject} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replay(c *gin.Context, response model.IdempotentResponse) {
+	for header, value := range response.Headers {
+		c.Header(header, value)
+	}
+	c.Header(idempotentReplayedHeader, "true")
+	c.Status(response.StatusCode)
+	if len(response.Body) > 0 {
+		_, _ = c.Writer.Write(response.Body)
+	}
+	c.Abort()
+}
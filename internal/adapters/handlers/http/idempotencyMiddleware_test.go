@@ -0,0 +1,312 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Harital/shopping-cart/internal/core/mocks"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+const (
+	idempotencyKey = "8e0f4a9c-5d1e-4c55-a3c4-3f2ab1f1d6a7"
+	idempotentBody = `{"item":{"id":"1","name":"screen","quantity":2}}`
+)
+
+var (
+	// Requests without a subject nor an api key share their keys
+	anonymousKey = callerScope(anonymousCaller, "") + ":" + idempotencyKey
+)
+
+// Stands for the handler protected by the middleware. It needs the body, so it checks that it is still readable
+type fakeHandler struct {
+	calls      int
+	statusCode int
+}
+
+func (fh *fakeHandler) handle(c *gin.Context) {
+	fh.calls++
+	body, _ := io.ReadAll(c.Request.Body)
+	if string(body) != idempotentBody {
+		c.JSON(http.StatusBadRequest, model.NewErrorResponse("bad_request", "bad request"))
+		return
+	}
+	if fh.statusCode != http.StatusAccepted {
+		c.JSON(fh.statusCode, model.NewErrorResponse("internal_error", "internal error"))
+		return
+	}
+	c.Header(etagHeader, `"1"`)
+	c.Status(http.StatusAccepted)
+}
+
+func Test_IdempotencyMiddleware_GivenProtectedHandler(t *testing.T) {
+	type input struct {
+		key string
+		// Status code answered by the handler
+		statusCode int
+	}
+	type want struct {
+		httpCode     int
+		body         string
+		etag         string
+		replayed     bool
+		handlerCalls int
+	}
+	tests := []struct {
+		name  string
+		in    input
+		mocks func(svc *mocks.MockIdempotencyService)
+		want  want
+	}{
+		{
+			name: "WhenNoKey_ThenRequestIsProcessedAsUsual",
+			in:   input{key: "", statusCode: http.StatusAccepted},
+			mocks: func(svc *mocks.MockIdempotencyService) {
+				svc.EXPECT().Start(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			want: want{httpCode: 202, etag: `"1"`, handlerCalls: 1},
+		}, {
+			name: "WhenKeyTooLong_ThenBadRequest",
+			in:   input{key: strings.Repeat("k", 256), statusCode: http.StatusAccepted},
+			mocks: func(svc *mocks.MockIdempotencyService) {
+				svc.EXPECT().Start(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			want: want{httpCode: 400, body: `{"version":"1.0.0","code":"bad_request","Message":"bad request"}`},
+		}, {
+			name: "WhenNewKey_ThenRequestIsProcessedAndResponseIsStored",
+			in:   input{key: idempotencyKey, statusCode: http.StatusAccepted},
+			mocks: func(svc *mocks.MockIdempotencyService) {
+				svc.EXPECT().Start(gomock.Any(), anonymousKey, gomock.Any()).Return(nil, nil)
+				svc.EXPECT().Complete(gomock.Any(), anonymousKey, model.IdempotentResponse{
+					StatusCode: 202,
+					Headers:    map[string]string{"ETag": `"1"`},
+					Body:       nil,
+				}).Return(nil)
+			},
+			want: want{httpCode: 202, etag: `"1"`, handlerCalls: 1},
+		}, {
+			name: "WhenKeyAlreadyDone_ThenStoredResponseIsReplayed",
+			in:   input{key: idempotencyKey, statusCode: http.StatusAccepted},
+			mocks: func(svc *mocks.MockIdempotencyService) {
+				svc.EXPECT().Start(gomock.Any(), anonymousKey, gomock.Any()).Return(&model.IdempotentResponse{
+					StatusCode: 202,
+					Headers:    map[string]string{"ETag": `"7"`},
+				}, nil)
+			},
+			want: want{httpCode: 202, etag: `"7"`, replayed: true, handlerCalls: 0},
+		}, {
+			name: "WhenStoredResponseHasBody_ThenBodyIsReplayed",
+			in:   input{key: idempotencyKey, statusCode: http.StatusAccepted},
+			mocks: func(svc *mocks.MockIdempotencyService) {
+				svc.EXPECT().Start(gomock.Any(), anonymousKey, gomock.Any()).Return(&model.IdempotentResponse{
+					StatusCode: 412,
+					Headers:    map[string]string{"ETag": `"3"`, "Content-Type": "application/json; charset=utf-8"},
+					Body:       []byte(`{"version":"1.0.0","code":"version_conflict","Message":"the cart has been modified"}`),
+				}, nil)
+			},
+			want: want{httpCode: 412, body: `{"version":"1.0.0","code":"version_conflict","Message":"the cart has been modified"}`, etag: `"3"`, replayed: true},
+		}, {
+			name: "WhenKeyUsedByAnotherRequest_ThenUnprocessableEntity",
+			in:   input{key: idempotencyKey, statusCode: http.StatusAccepted},
+			mocks: func(svc *mocks.MockIdempotencyService) {
+				svc.EXPECT().Start(gomock.Any(), anonymousKey, gomock.Any()).Return(nil, model.ErrIdempotencyKeyReused)
+			},
+			want: want{httpCode: 422, body: `{"version":"1.0.0","code":"idempotency_key_reused","Message":"idempotency key already used by a different request"}`},
+		}, {
+			name: "WhenFirstRequestInProgress_ThenConflict",
+			in:   input{key: idempotencyKey, statusCode: http.StatusAccepted},
+			mocks: func(svc *mocks.MockIdempotencyService) {
+				svc.EXPECT().Start(gomock.Any(), anonymousKey, gomock.Any()).Return(nil, model.ErrIdempotencyKeyInProgress)
+			},
+			want: want{httpCode: 409, body: `{"version":"1.0.0","code":"idempotency_key_in_progress","Message":"request with the same idempotency key in progress"}`},
+		}, {
+			name: "WhenStartFails_ThenInternalError",
+			in:   input{key: idempotencyKey, statusCode: http.StatusAccepted},
+			mocks: func(svc *mocks.MockIdempotencyService) {
+				svc.EXPECT().Start(gomock.Any(), anonymousKey, gomock.Any()).Return(nil, internalError)
+			},
+			want: want{httpCode: 500, body: `{"version":"1.0.0","code":"internal_error","Message":"internal error"}`},
+		}, {
+			// Server errors are not replayed, so the retry can succeed
+			name: "WhenRequestFailsWithServerError_ThenKeyIsAbandoned",
+			in:   input{key: idempotencyKey, statusCode: http.StatusInternalServerError},
+			mocks: func(svc *mocks.MockIdempotencyService) {
+				svc.EXPECT().Start(gomock.Any(), anonymousKey, gomock.Any()).Return(nil, nil)
+				svc.EXPECT().Abandon(gomock.Any(), anonymousKey).Return(nil)
+			},
+			want: want{httpCode: 500, body: `{"version":"1.0.0","code":"internal_error","Message":"internal error"}`, handlerCalls: 1},
+		}, {
+			// A retry would get the same answer
+			name: "WhenRequestFailsWithClientError_ThenResponseIsStored",
+			in:   input{key: idempotencyKey, statusCode: http.StatusNotFound},
+			mocks: func(svc *mocks.MockIdempotencyService) {
+				svc.EXPECT().Start(gomock.Any(), anonymousKey, gomock.Any()).Return(nil, nil)
+				svc.EXPECT().Complete(gomock.Any(), anonymousKey, model.IdempotentResponse{
+					StatusCode: 404,
+					Headers:    map[string]string{"Content-Type": "application/json; charset=utf-8"},
+					Body:       []byte(`{"version":"1.0.0","code":"internal_error","Message":"internal error"}`),
+				}).Return(nil)
+			},
+			want: want{httpCode: 404, body: `{"version":"1.0.0","code":"internal_error","Message":"internal error"}`, handlerCalls: 1},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			svc := mocks.NewMockIdempotencyService(mockCtrl)
+			tc.mocks(svc)
+
+			handler := &fakeHandler{statusCode: tc.in.statusCode}
+			respRecorder := httptest.NewRecorder()
+			router := gin.Default()
+			router.POST(itemsUrl, NewIdempotencyMiddleware(svc), handler.handle)
+
+			req := httptest.NewRequest(http.MethodPost, itemsUrl, strings.NewReader(idempotentBody))
+			if tc.in.key != "" {
+				req.Header.Set("Idempotency-Key", tc.in.key)
+			}
+			router.ServeHTTP(respRecorder, req)
+
+			assert.Equal(t, tc.want.httpCode, respRecorder.Code)
+			assert.Equal(t, tc.want.body, respRecorder.Body.String())
+			assert.Equal(t, tc.want.etag, respRecorder.Header().Get("ETag"))
+			assert.Equal(t, tc.want.replayed, respRecorder.Header().Get("Idempotent-Replayed") == "true")
+			assert.Equal(t, tc.want.handlerCalls, handler.calls)
+		})
+	}
+}
+
+func Test_IdempotencyRequestHash_GivenIdempotencyMiddleware(t *testing.T) {
+	hashOf := func(method string, url string, ifMatch string, body string) string {
+		req := httptest.NewRequest(method, url, nil)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		return requestHash(req, []byte(body))
+	}
+	hash := hashOf(http.MethodPost, itemsUrl, "", idempotentBody)
+
+	t.Run("WhenSameRequest_ThenSameHash", func(t *testing.T) {
+		assert.Equal(t, hash, hashOf(http.MethodPost, itemsUrl, "", idempotentBody))
+		assert.Len(t, hash, 64)
+	})
+	t.Run("WhenAnythingDiffers_ThenDifferentHash", func(t *testing.T) {
+		assert.NotEqual(t, hash, hashOf(http.MethodPost, itemsUrl, "", `{"item":{"id":"1","name":"screen","quantity":3}}`))
+		assert.NotEqual(t, hash, hashOf(http.MethodPost, "/shopping-cart/v1/carts/another/items", "", idempotentBody))
+		assert.NotEqual(t, hash, hashOf(http.MethodPost, itemsUrl, `"2"`, idempotentBody))
+	})
+}
+
+// The service is called with a context that outlives the request, as the client may be gone by then
+func Test_IdempotencyMiddleware_GivenCanceledRequest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	svc := mocks.NewMockIdempotencyService(mockCtrl)
+	svc.EXPECT().Start(gomock.Any(), anonymousKey, gomock.Any()).Return(nil, nil)
+	svc.EXPECT().Complete(gomock.Any(), anonymousKey, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ string, _ model.IdempotentResponse) error {
+			assert.NoError(t, ctx.Err())
+			return nil
+		})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	router := gin.Default()
+	router.POST(itemsUrl, NewIdempotencyMiddleware(svc), func(c *gin.Context) {
+		cancel()
+		c.Status(http.StatusAccepted)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, itemsUrl, strings.NewReader(idempotentBody)).WithContext(ctx)
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+// Keys are chosen by the clients, so the same key sent by two callers must not collide
+func Test_IdempotencyMiddleware_GivenAuthenticatedRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		subject  string
+		apiKeyId string
+		want     string
+	}{
+		{
+			name:    "WhenSubject_ThenKeyIsScopedBySubject",
+			subject: "user-1",
+			want:    callerScope(subjectCaller, "user-1") + ":" + idempotencyKey,
+		}, {
+			name:     "WhenApiKey_ThenKeyIsScopedByApiKey",
+			apiKeyId: "user-1",
+			want:     callerScope(apiKeyCaller, "user-1") + ":" + idempotencyKey,
+		}, {
+			name: "WhenNoSubjectNorApiKey_ThenKeyIsScopedAsAnonymous",
+			want: anonymousKey,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			svc := mocks.NewMockIdempotencyService(mockCtrl)
+			svc.EXPECT().Start(gomock.Any(), tc.want, gomock.Any()).
+				DoAndReturn(func(ctx context.Context, _ string, _ string) (*model.IdempotentResponse, error) {
+					// The request context is the one carrying the subject
+					subject, _ := model.SubjectFromContext(ctx)
+					assert.Equal(t, tc.subject, subject)
+					return nil, nil
+				})
+			svc.EXPECT().Complete(gomock.Any(), tc.want, gomock.Any()).Return(nil)
+
+			router := gin.Default()
+			router.POST(itemsUrl, func(c *gin.Context) {
+				if tc.apiKeyId != "" {
+					c.Set(apiKeyIdKey, tc.apiKeyId)
+				}
+			}, NewIdempotencyMiddleware(svc), func(c *gin.Context) {
+				c.Status(http.StatusAccepted)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, itemsUrl, strings.NewReader(idempotentBody))
+			req = req.WithContext(model.WithSubject(req.Context(), tc.subject))
+			req.Header.Set("Idempotency-Key", idempotencyKey)
+			router.ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+}
+
+func Test_CallerScope_GivenSameCaller(t *testing.T) {
+	t.Run("WhenUserAndApiKeyWithSameId_ThenScopesDiffer", func(t *testing.T) {
+		assert.NotEqual(t, callerScope(subjectCaller, "1"), callerScope(apiKeyCaller, "1"))
+	})
+
+	t.Run("WhenSubjectLooksLikeAnotherScopedKey_ThenScopesDiffer", func(t *testing.T) {
+		// Without hashing, user-1 with the key a:b and user-1:a with the key b would collide
+		assert.NotEqual(t, callerScope(subjectCaller, "user-1")+":a:b", callerScope(subjectCaller, "user-1:a")+":b")
+	})
+}
+
+func Test_IdempotencyMiddleware_GivenBigBody(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	svc := mocks.NewMockIdempotencyService(mockCtrl)
+	svc.EXPECT().Start(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	handler := &fakeHandler{statusCode: http.StatusAccepted}
+
+	router := gin.Default()
+	router.POST(itemsUrl, NewIdempotencyMiddleware(svc), handler.handle)
+
+	respRecorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, itemsUrl, strings.NewReader(strings.Repeat(" ", maxIdempotentBodySize+1)))
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	router.ServeHTTP(respRecorder, req)
+
+	assert.Equal(t, http.StatusBadRequest, respRecorder.Code)
+	assert.Equal(t, 0, handler.calls)
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Key types of the json web keys we support, and the only algorithm each one can be used with
+var algorithmByKeyType = map[string]string{
+	"oct": jwt.SigningMethodHS256.Alg(),
+	"RSA": jwt.SigningMethodRS256.Alg(),
+}
+
+// Only the members we need of a json web key (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// Secret of the oct keys
+	K string `json:"k"`
+	// Modulus and exponent of the RSA public keys
+	N string `json:"n"`
+	E string `json:"e"`
+}
+
+type signingKey struct {
+	kid string
+	alg string
+	// []byte for HS256, *rsa.PublicKey for RS256
+	key any
+}
+
+// Keys the client tokens can be signed with. Every key is bound to a single algorithm, so a token signed with HS256
+// is never checked against the secret of an RSA key, or the other way round
+type KeySet struct {
+	keys []signingKey
+}
+
+func LoadKeySet(path string) (*KeySet, error) {
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, fmt.Errorf("reading key set %s --> %w", path, readErr)
+	}
+	return ParseKeySet(data)
+}
+
+// Keys that cannot be used to check signatures (I.E. encryption keys or unsupported types) are skipped, as key sets
+// are usually shared with other services. Broken keys are not, as they are surely a mistake
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if unmarshalErr := json.Unmarshal(data, &set); unmarshalErr != nil {
+		return nil, fmt.Errorf("parsing key set --> %w", unmarshalErr)
+	}
+
+	keySet := &KeySet{}
+	for i, jwk := range set.Keys {
+		alg, supported := algorithmByKeyType[jwk.Kty]
+		if !supported || jwk.Use == "enc" || (jwk.Alg != "" && jwk.Alg != alg) {
+			log.Warn().Str("kid", jwk.Kid).Str("kty", jwk.Kty).Str("alg", jwk.Alg).Msg("skipping unsupported json web key")
+			continue
+		}
+
+		key, keyErr := jwk.signingKey()
+		if keyErr != nil {
+			return nil, fmt.Errorf("key %d (kid %q) --> %w", i, jwk.Kid, keyErr)
+		}
+		keySet.keys = append(keySet.keys, signingKey{kid: jwk.Kid, alg: alg, key: key})
+	}
+
+	if len(keySet.keys) == 0 {
+		return nil, errors.New("no HS256 nor RS256 key in the key set")
+	}
+	return keySet, nil
+}
+
+func (jwk jsonWebKey) signingKey() (any, error) {
+	if jwk.Kty == "oct" {
+		secret, decodeErr := base64.RawURLEncoding.DecodeString(jwk.K)
+		if decodeErr != nil || len(secret) == 0 {
+			return nil, errors.New("invalid k")
+		}
+		return secret, nil
+	}
+
+	n, nErr := base64.RawURLEncoding.DecodeString(jwk.N)
+	e, eErr := base64.RawURLEncoding.DecodeString(jwk.E)
+	if nErr != nil || eErr != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid n or e")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+// Picks the key by the kid of the token. Tokens without kid are accepted when there is a single key for their
+// algorithm, which is the usual case of a shared HS256 secret
+func (ks *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	alg := token.Method.Alg()
+
+	var candidates []signingKey
+	for _, key := range ks.keys {
+		if key.alg != alg {
+			continue
+		}
+		if kid != "" && key.kid == kid {
+			return key.key, nil
+		}
+		candidates = append(candidates, key)
+	}
+
+	if kid == "" && len(candidates) == 1 {
+		return candidates[0].key, nil
+	}
+	return nil, fmt.Errorf("no %s key with kid %q", alg, kid)
+}
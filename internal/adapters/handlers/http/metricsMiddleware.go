@@ -0,0 +1,43 @@
+package http
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Published through prometheus, so they can be read from the /metrics endpoint
+var httpMetrics = struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}{
+	requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shopping_cart_http_requests_total",
+		Help: "Requests handled, by method, route and status code",
+	}, []string{"method", "route", "status"}),
+	duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "shopping_cart_http_request_duration_seconds",
+		Help:    "Time taken to handle the requests, by method and route",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"}),
+}
+
+func init() {
+	prometheus.MustRegister(httpMetrics.requests, httpMetrics.duration)
+}
+
+// Counts and times every request of the routes of the group. The route is the registered path, I.E.
+// /shopping-cart/v1/carts/:cartId/items, so the cart ids do not blow up the number of series.
+// Meant to be the first middleware of the group, so the requests rejected by the others are counted as well
+func NewMetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		httpMetrics.requests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpMetrics.duration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
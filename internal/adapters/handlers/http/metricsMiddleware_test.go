@@ -0,0 +1,69 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Number of observations of the histogram
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	var metric dto.Metric
+	require.NoError(t, observer.(prometheus.Histogram).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func Test_MetricsMiddleware_GivenRouteOfTheGroup(t *testing.T) {
+	const route = "/carts/:cartId/items"
+
+	type want struct {
+		status string
+	}
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		want    want
+	}{
+		{
+			name: "WhenRequestHandled_ThenCountedByRouteAndStatus",
+			handler: func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			},
+			want: want{status: "200"},
+		}, {
+			name: "WhenRequestRejected_ThenCountedWithTheRejectionStatus",
+			handler: func(c *gin.Context) {
+				c.AbortWithStatus(http.StatusUnauthorized)
+			},
+			want: want{status: "401"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// The metrics are global, so only the difference is checked
+			requests := httpMetrics.requests.WithLabelValues(http.MethodGet, route, tc.want.status)
+			before := testutil.ToFloat64(requests)
+			duration := httpMetrics.duration.WithLabelValues(http.MethodGet, route)
+			samplesBefore := sampleCount(t, duration)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			group := router.Group("", NewMetricsMiddleware())
+			group.GET(route, tc.handler)
+
+			req, _ := http.NewRequest(http.MethodGet, "/carts/5b9a2ecf-0a37-4f4b-9c57-0d4d2e7e3a11/items", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, before+1, testutil.ToFloat64(requests))
+			assert.Equal(t, samplesBefore+1, sampleCount(t, duration))
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+type OpenAPIConfig struct {
+	// Requests that do not follow the spec are rejected with a 400 before reaching the handlers
+	ValidateRequests bool
+	// Responses that do not follow the spec are replaced by a 500. Every response is buffered until it has been
+	// checked, so it is meant for tests
+	ValidateResponses bool
+}
+
+// Holds the response until it has been checked against the spec. Gin writes the headers right into the real writer,
+// but the status and the body are only sent once the response is known to be right
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (bw *bufferedWriter) WriteHeader(code int) {
+	bw.status = code
+}
+
+func (bw *bufferedWriter) WriteHeaderNow() {}
+
+func (bw *bufferedWriter) Write(data []byte) (int, error) {
+	return bw.body.Write(data)
+}
+
+func (bw *bufferedWriter) WriteString(s string) (int, error) {
+	return bw.body.WriteString(s)
+}
+
+func (bw *bufferedWriter) Status() int {
+	if bw.status == 0 {
+		return http.StatusOK
+	}
+	return bw.status
+}
+
+func (bw *bufferedWriter) Size() int {
+	return bw.body.Len()
+}
+
+func (bw *bufferedWriter) Written() bool {
+	return bw.status != 0 || bw.body.Len() > 0
+}
+
+// Checks the requests, and optionally the responses, against the openapi spec, so the spec is the source of truth
+// of the api. Routes that are not in the spec, I.E. /debug/vars, go through untouched
+func NewOpenAPIMiddleware(spec []byte, cfg OpenAPIConfig) (gin.HandlerFunc, error) {
+	doc, loadErr := openapi3.NewLoader().LoadFromData(spec)
+	if loadErr != nil {
+		return nil, fmt.Errorf("loading openapi spec --> %w", loadErr)
+	}
+	if validateErr := doc.Validate(context.Background()); validateErr != nil {
+		return nil, fmt.Errorf("openapi spec is not valid --> %w", validateErr)
+	}
+	router, routerErr := gorillamux.NewRouter(doc)
+	if routerErr != nil {
+		return nil, fmt.Errorf("building openapi router --> %w", routerErr)
+	}
+
+	options := &openapi3filter.Options{
+		MultiError:            true,
+		IncludeResponseStatus: true,
+		// Authentication is checked by its own middlewares
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(c *gin.Context) {
+		route, pathParams, findErr := router.FindRoute(c.Request)
+		if errors.Is(findErr, routers.ErrPathNotFound) || errors.Is(findErr, routers.ErrMethodNotAllowed) {
+			return
+		}
+		if findErr != nil {
+			writeError(c, fmt.Errorf("%w --> %w", errBadRequest, findErr), "finding openapi route")
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		}
+		// The body is read and restored, so the handler can read it again
+		if cfg.ValidateRequests {
+			if validateErr := openapi3filter.ValidateRequest(c, input); validateErr != nil {
+				writeError(c, requestValidationError(validateErr), "request does not follow the openapi spec")
+				return
+			}
+		}
+		if !cfg.ValidateResponses {
+			return
+		}
+
+		writer := c.Writer
+		buffered := &bufferedWriter{ResponseWriter: writer}
+		c.Writer = buffered
+		c.Next()
+		c.Writer = writer
+
+		responseInput := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 buffered.Status(),
+			Header:                 writer.Header(),
+			Options:                options,
+		}
+		validateErr := openapi3filter.ValidateResponse(context.WithoutCancel(c), responseInput.SetBodyBytes(buffered.body.Bytes()))
+		if validateErr != nil {
+			// Loud on purpose. The headers of the wrong response must not reach the client either
+			for header := range writer.Header() {
+				writer.Header().Del(header)
+			}
+			writeError(c, fmt.Errorf("response %d to %s %s --> %w", buffered.Status(), c.Request.Method, c.Request.URL.Path, validateErr),
+				"response does not follow the openapi spec")
+			return
+		}
+
+		writer.WriteHeader(buffered.Status())
+		if buffered.body.Len() == 0 {
+			writer.WriteHeaderNow()
+			return
+		}
+		if _, writeErr := writer.Write(buffered.body.Bytes()); writeErr != nil {
+			log.
+				Error().
+				Err(writeErr).
+				Msg("writing validated response")
+		}
+	}, nil
+}
+
+// Requests with field errors are reported as any other validation error. Anything else, I.E. a malformed json,
+// is just a bad request
+func requestValidationError(validateErr error) error {
+	var fields []model.FieldError
+	collectFieldErrors(validateErr, "", &fields)
+	if len(fields) == 0 {
+		return fmt.Errorf("%w --> %w", errBadRequest, validateErr)
+	}
+	return fmt.Errorf("%w --> %w", &model.ValidationError{Fields: fields}, validateErr)
+}
+
+// Parameters are named as they are in the spec, I.E. If-Match. Body fields after their json path, I.E. item.quantity
+func collectFieldErrors(err error, field string, fields *[]model.FieldError) {
+	switch typedErr := err.(type) {
+	case *openapi3filter.RequestError:
+		if typedErr.Parameter != nil {
+			field = typedErr.Parameter.Name
+		}
+		if typedErr.Err == nil {
+			if field != "" {
+				*fields = append(*fields, model.FieldError{Field: field, Message: typedErr.Reason})
+			}
+			return
+		}
+		collectFieldErrors(typedErr.Err, field, fields)
+	case openapi3.MultiError:
+		for _, inner := range typedErr {
+			collectFieldErrors(inner, field, fields)
+		}
+	case *openapi3.SchemaError:
+		path := typedErr.JSONPointer()
+		if field != "" {
+			path = append([]string{field}, path...)
+		}
+		*fields = append(*fields, model.FieldError{Field: strings.Join(path, "."), Message: typedErr.Reason})
+	default:
+		if inner := errors.Unwrap(err); inner != nil {
+			collectFieldErrors(inner, field, fields)
+		}
+	}
+}
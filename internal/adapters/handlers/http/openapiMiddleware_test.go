@@ -0,0 +1,188 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Harital/shopping-cart/api"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Checks every response of the handler tests against the spec. The requests are not checked, so the handlers
+// still get the wrong ones
+func contract(t *testing.T) gin.HandlerFunc {
+	middleware, newErr := NewOpenAPIMiddleware(api.Spec, OpenAPIConfig{ValidateResponses: true})
+	require.NoError(t, newErr)
+	return middleware
+}
+
+// We use Gherkin notation for the tests
+func Test_NewOpenAPIMiddleware_GivenSpec(t *testing.T) {
+	t.Run("WhenEmbeddedSpec_ThenOK", func(t *testing.T) {
+		_, newErr := NewOpenAPIMiddleware(api.Spec, OpenAPIConfig{ValidateRequests: true, ValidateResponses: true})
+
+		assert.NoError(t, newErr)
+	})
+
+	t.Run("WhenSpecIsNotValid_ThenError", func(t *testing.T) {
+		_, newErr := NewOpenAPIMiddleware([]byte("openapi: 3.0.3\npaths: {}\n"), OpenAPIConfig{ValidateRequests: true})
+
+		assert.Error(t, newErr)
+	})
+}
+
+func Test_OpenAPIMiddleware_GivenRequests(t *testing.T) {
+	type input struct {
+		method string
+		url    string
+		body   string
+		header map[string]string
+	}
+	type want struct {
+		httpCode     int
+		body         string
+		handlerCalls int
+	}
+	tests := []struct {
+		name string
+		in   input
+		want want
+	}{
+		{
+			name: "WhenRequestFollowsTheSpec_ThenHandlerIsCalled",
+			in: input{
+				method: http.MethodPost,
+				url:    itemsUrl,
+				body:   `{"version":"1.0.0","item":{"id":"1","name":"screen","quantity":2}}`,
+			},
+			want: want{httpCode: http.StatusAccepted, handlerCalls: 1},
+		}, {
+			name: "WhenBodyBreaksTheSpec_ThenEveryFieldIsReported",
+			in: input{
+				method: http.MethodPost,
+				url:    itemsUrl,
+				body:   `{"version":"2.0.0","item":{"id":"one","quantity":0}}`,
+			},
+			want: want{
+				httpCode: http.StatusBadRequest,
+				body: `{"version":"1.0.0","code":"invalid_request","Message":"invalid request","errors":[` +
+					`{"field":"item.id","message":"string doesn't match the regular expression \"^[0-9]{1,9}$\""},` +
+					`{"field":"item.quantity","message":"number must be at least 1"},` +
+					`{"field":"version","message":"value is not one of the allowed values [\"1.0.0\"]"}]}`,
+			},
+		}, {
+			name: "WhenBodyIsNotJson_ThenBadRequest",
+			in: input{
+				method: http.MethodPost,
+				url:    itemsUrl,
+				body:   `not a json`,
+			},
+			want: want{
+				httpCode: http.StatusBadRequest,
+				body:     `{"version":"1.0.0","code":"bad_request","Message":"bad request"}`,
+			},
+		}, {
+			name: "WhenRouteIsNotInTheSpec_ThenHandlerIsCalled",
+			in: input{
+				method: http.MethodGet,
+				url:    "/debug/vars",
+			},
+			want: want{httpCode: http.StatusAccepted, handlerCalls: 1},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			middleware, newErr := NewOpenAPIMiddleware(api.Spec, OpenAPIConfig{ValidateRequests: true})
+			require.NoError(t, newErr)
+
+			calls := 0
+			handler := func(c *gin.Context) {
+				calls++
+				c.Status(http.StatusAccepted)
+			}
+			router := gin.New()
+			router.Use(middleware)
+			router.Handle(tc.in.method, strings.Split(tc.in.url, "?")[0], handler)
+
+			req := httptest.NewRequest(tc.in.method, tc.in.url, strings.NewReader(tc.in.body))
+			req.Header.Set("Content-Type", "application/json")
+			respRecorder := httptest.NewRecorder()
+			router.ServeHTTP(respRecorder, req)
+
+			assert.Equal(t, tc.want.httpCode, respRecorder.Code)
+			assert.Equal(t, tc.want.body, respRecorder.Body.String())
+			assert.Equal(t, tc.want.handlerCalls, calls)
+		})
+	}
+}
+
+func Test_OpenAPIMiddleware_GivenResponses(t *testing.T) {
+	type want struct {
+		httpCode int
+		body     string
+		etag     string
+	}
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		handler gin.HandlerFunc
+		want    want
+	}{
+		{
+			name:   "WhenResponseFollowsTheSpec_ThenItIsSent",
+			method: http.MethodGet,
+			url:    itemsUrl,
+			handler: func(c *gin.Context) {
+				c.Header(etagHeader, `"1"`)
+				c.JSON(http.StatusOK, gin.H{"Version": "1.0.0", "Items": []gin.H{}})
+			},
+			want: want{httpCode: http.StatusOK, body: `{"Items":[],"Version":"1.0.0"}`, etag: `"1"`},
+		}, {
+			name:   "WhenResponseWithoutBodyFollowsTheSpec_ThenItIsSent",
+			method: http.MethodPost,
+			url:    callbackUrl,
+			handler: func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			},
+			want: want{httpCode: http.StatusNoContent},
+		}, {
+			name:   "WhenBodyBreaksTheSpec_ThenInternalError",
+			method: http.MethodGet,
+			url:    itemsUrl,
+			handler: func(c *gin.Context) {
+				c.Header(etagHeader, `"1"`)
+				c.JSON(http.StatusOK, gin.H{"version": "1.0.0", "items": []gin.H{}})
+			},
+			want: want{httpCode: http.StatusInternalServerError, body: `{"version":"1.0.0","code":"internal_error","Message":"internal error"}`},
+		}, {
+			name:   "WhenStatusIsNotInTheSpec_ThenInternalError",
+			method: http.MethodGet,
+			url:    itemsUrl,
+			handler: func(c *gin.Context) {
+				c.Status(http.StatusTeapot)
+			},
+			want: want{httpCode: http.StatusInternalServerError, body: `{"version":"1.0.0","code":"internal_error","Message":"internal error"}`},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(contract(t))
+			router.Handle(tc.method, tc.url, tc.handler)
+
+			respRecorder := httptest.NewRecorder()
+			router.ServeHTTP(respRecorder, httptest.NewRequest(tc.method, tc.url, nil))
+
+			assert.Equal(t, tc.want.httpCode, respRecorder.Code)
+			assert.Equal(t, tc.want.body, respRecorder.Body.String())
+			assert.Equal(t, tc.want.etag, respRecorder.Header().Get("ETag"))
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Hex encoded HMAC-SHA256 of the timestamp, a dot and the raw body, with the secret shared with the reserver.
+	// I.E. sha256=3f2a...
+	signatureHeader = "X-Signature"
+	signaturePrefix = "sha256="
+	// Unix time, in seconds, when the reserver signed the callback. Signed along with the body, so a captured
+	// callback cannot be replayed once it is too old
+	signatureTimestampHeader = "X-Signature-Timestamp"
+	// Callbacks are tiny. Anything bigger is not worth reading
+	maxCallbackBodySize = 64 * 1024
+)
+
+type ReservationCallbackHandler struct {
+	router              *gin.RouterGroup
+	reservationsService ports.ReservationsService
+	secret              []byte
+	// Callbacks signed longer ago, or further in the future, are rejected. It covers the clock skew as well
+	maxAge time.Duration
+}
+
+func NewReservationCallbackHandler(r *gin.RouterGroup, svc ports.ReservationsService, secret []byte,
+	maxAge time.Duration) *ReservationCallbackHandler {
+	return &ReservationCallbackHandler{
+		router:              r,
+		reservationsService: svc,
+		secret:              secret,
+		maxAge:              maxAge,
+	}
+}
+
+func (rch *ReservationCallbackHandler) Register() {
+	rch.router.POST("/reservations/callback", rch.reservationCallback)
+}
+
+func (rch ReservationCallbackHandler) reservationCallback(c *gin.Context) {
+	body, readErr := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxCallbackBodySize))
+	if readErr != nil {
+		writeError(c, fmt.Errorf("%w --> %w", errBadRequest, readErr), "reading reservation callback")
+		return
+	}
+
+	// The signature is checked before parsing anything, as the body cannot be trusted until then
+	if !rch.validSignature(body, c.GetHeader(signatureTimestampHeader), c.GetHeader(signatureHeader)) {
+		writeError(c, errInvalidSignature, "reservation callback with invalid signature")
+		return
+	}
+
+	// The body has already been read. It is restored so it can be bound as usual
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	var callback model.ReservationCallback
+	if bindErr := c.ShouldBindJSON(&callback); bindErr != nil {
+		writeError(c, fmt.Errorf("%w --> %w", errBadRequest, bindErr), "Bad json request")
+		return
+	}
+
+	completeErr := rch.reservationsService.CompleteReservation(c.Request.Context(), callback)
+	if completeErr != nil {
+		// The reserver is expected to send the callback again, unless the error is its own fault
+		writeError(c, fmt.Errorf("item %s of cart %s --> %w", callback.ItemId, callback.CartId, completeErr), "completing reservation")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Without a secret no callback can be trusted, so every one is rejected
+func (rch ReservationCallbackHandler) validSignature(body []byte, timestamp string, signature string) bool {
+	if len(rch.secret) == 0 || !strings.HasPrefix(signature, signaturePrefix) || !rch.fresh(timestamp) {
+		return false
+	}
+
+	received, decodeErr := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if decodeErr != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, rch.secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	// Constant time comparison, so the signature cannot be guessed byte by byte
+	return hmac.Equal(received, mac.Sum(nil))
+}
+
+// The timestamp is only trusted once the signature has been checked, but a stale one can be rejected right away
+func (rch ReservationCallbackHandler) fresh(timestamp string) bool {
+	seconds, parseErr := strconv.ParseInt(timestamp, 10, 64)
+	if parseErr != nil {
+		return false
+	}
+
+	age := time.Since(time.Unix(seconds, 0))
+	return age <= rch.maxAge && age >= -rch.maxAge
+}
@@ -0,0 +1,309 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/mocks"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+const (
+	callbackUrl    = "/shopping-cart/v1/reservations/callback"
+	callbackSecret = "callbackSecret"
+	callbackMaxAge = 5 * time.Minute
+)
+
+type ReservationCallbackHandlerMocks struct {
+	svc *mocks.MockReservationsService
+}
+
+func sign(secret string, timestamp string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func Test_ReservationCallback_GivenInitializedHandler(t *testing.T) {
+	reservedBody := `{"version":"1.0.0","cartId":"` + cartId + `","itemId":"1","reservationId":"fancyReservationId","quantity":2}`
+	failedBody := `{"version":"1.0.0","cartId":"` + cartId + `","itemId":"1","failureReason":"out of stock"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-callbackMaxAge-time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(callbackMaxAge+time.Minute).Unix(), 10)
+
+	type input struct {
+		secret    string
+		body      string
+		timestamp string
+		signature string
+	}
+	tests := []struct {
+		name  string
+		in    input
+		mocks func(m ReservationCallbackHandlerMocks)
+		want  want
+	}{
+		{
+			name: "WhenCallbackWithoutSignature_ThenUnauthorized",
+			in: input{
+				secret:    callbackSecret,
+				timestamp: now,
+				body:      reservedBody,
+				signature: "",
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 401,
+				body:     `{"version":"1.0.0","code":"invalid_signature","Message":"unauthorized"}`,
+			},
+		}, {
+			name: "WhenCallbackSignedWithAnotherSecret_ThenUnauthorized",
+			in: input{
+				secret:    callbackSecret,
+				timestamp: now,
+				body:      reservedBody,
+				signature: sign("anotherSecret", now, reservedBody),
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 401,
+				body:     `{"version":"1.0.0","code":"invalid_signature","Message":"unauthorized"}`,
+			},
+		}, {
+			name: "WhenCallbackBodyTamperedWith_ThenUnauthorized",
+			in: input{
+				secret:    callbackSecret,
+				timestamp: now,
+				body:      strings.Replace(reservedBody, `"quantity":2`, `"quantity":20`, 1),
+				signature: sign(callbackSecret, now, reservedBody),
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 401,
+				body:     `{"version":"1.0.0","code":"invalid_signature","Message":"unauthorized"}`,
+			},
+		}, {
+			name: "WhenCallbackWithoutTimestamp_ThenUnauthorized",
+			in: input{
+				secret:    callbackSecret,
+				body:      reservedBody,
+				timestamp: "",
+				signature: sign(callbackSecret, "", reservedBody),
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 401,
+				body:     `{"version":"1.0.0","code":"invalid_signature","Message":"unauthorized"}`,
+			},
+		}, {
+			name: "WhenCallbackSignedTooLongAgo_ThenUnauthorized",
+			in: input{
+				secret:    callbackSecret,
+				body:      reservedBody,
+				timestamp: stale,
+				signature: sign(callbackSecret, stale, reservedBody),
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 401,
+				body:     `{"version":"1.0.0","code":"invalid_signature","Message":"unauthorized"}`,
+			},
+		}, {
+			name: "WhenCallbackSignedInTheFuture_ThenUnauthorized",
+			in: input{
+				secret:    callbackSecret,
+				body:      reservedBody,
+				timestamp: future,
+				signature: sign(callbackSecret, future, reservedBody),
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 401,
+				body:     `{"version":"1.0.0","code":"invalid_signature","Message":"unauthorized"}`,
+			},
+		}, {
+			name: "WhenOldCallbackReplayedWithNewTimestamp_ThenUnauthorized",
+			in: input{
+				secret:    callbackSecret,
+				body:      reservedBody,
+				timestamp: now,
+				signature: sign(callbackSecret, stale, reservedBody),
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 401,
+				body:     `{"version":"1.0.0","code":"invalid_signature","Message":"unauthorized"}`,
+			},
+		}, {
+			name: "WhenNoSecretConfigured_ThenEveryCallbackIsUnauthorized",
+			in: input{
+				secret:    "",
+				timestamp: now,
+				body:      reservedBody,
+				signature: sign("", now, reservedBody),
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 401,
+				body:     `{"version":"1.0.0","code":"invalid_signature","Message":"unauthorized"}`,
+			},
+		}, {
+			name: "WhenCallbackWithoutItemId_ThenBadRequest",
+			in: input{
+				secret:    callbackSecret,
+				timestamp: now,
+				body:      `{"version":"1.0.0","cartId":"` + cartId + `","reservationId":"fancyReservationId"}`,
+				signature: sign(callbackSecret, now, `{"version":"1.0.0","cartId":"`+cartId+`","reservationId":"fancyReservationId"}`),
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"version":"1.0.0","code":"bad_request","Message":"bad request","errors":[{"field":"itemId","message":"is required"}]}`,
+			},
+		}, {
+			name: "WhenCallbackIsInvalid_ThenBadRequest",
+			in: input{
+				secret:    callbackSecret,
+				timestamp: now,
+				body:      reservedBody,
+				signature: sign(callbackSecret, now, reservedBody),
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), gomock.Any()).
+					Return(fmt.Errorf("wrapped --> %w", model.ErrInvalidReservationCallback))
+			},
+			want: want{
+				httpCode: 400,
+				body:     `{"version":"1.0.0","code":"invalid_reservation_callback","Message":"invalid reservation callback"}`,
+			},
+		}, {
+			name: "WhenCompletingReservationFails_ThenInternalError",
+			in: input{
+				secret:    callbackSecret,
+				timestamp: now,
+				body:      reservedBody,
+				signature: sign(callbackSecret, now, reservedBody),
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), gomock.Any()).
+					Return(internalError)
+			},
+			want: want{
+				httpCode: 500,
+				body:     `{"version":"1.0.0","code":"internal_error","Message":"internal error"}`,
+			},
+		}, {
+			name: "WhenReservedCallbackAndOK_ThenNoContent",
+			in: input{
+				secret:    callbackSecret,
+				timestamp: now,
+				body:      reservedBody,
+				signature: sign(callbackSecret, now, reservedBody),
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), model.ReservationCallback{
+					Version:       "1.0.0",
+					CartId:        cartId,
+					ItemId:        "1",
+					ReservationId: "fancyReservationId",
+					Quantity:      2,
+				}).Return(nil)
+			},
+			want: want{
+				httpCode: 204,
+				body:     ``,
+			},
+		}, {
+			name: "WhenFailedCallbackAndOK_ThenNoContent",
+			in: input{
+				secret:    callbackSecret,
+				timestamp: now,
+				body:      failedBody,
+				signature: sign(callbackSecret, now, failedBody),
+			},
+			mocks: func(m ReservationCallbackHandlerMocks) {
+				m.svc.EXPECT().CompleteReservation(gomock.Any(), model.ReservationCallback{
+					Version:       "1.0.0",
+					CartId:        cartId,
+					ItemId:        "1",
+					FailureReason: "out of stock",
+				}).Return(nil)
+			},
+			want: want{
+				httpCode: 204,
+				body:     ``,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			respRecorder := httptest.NewRecorder()
+			router := gin.Default()
+			rg := router.Group("/shopping-cart/v1", contract(t))
+
+			m := ReservationCallbackHandlerMocks{
+				svc: mocks.NewMockReservationsService(mockCtrl),
+			}
+
+			tc.mocks(m)
+
+			hndl := NewReservationCallbackHandler(rg, m.svc, []byte(tc.in.secret), callbackMaxAge)
+			hndl.Register()
+
+			req := httptest.NewRequest(http.MethodPost, callbackUrl, strings.NewReader(tc.in.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.in.signature != "" {
+				req.Header.Set("X-Signature", tc.in.signature)
+			}
+			if tc.in.timestamp != "" {
+				req.Header.Set("X-Signature-Timestamp", tc.in.timestamp)
+			}
+
+			router.ServeHTTP(respRecorder, req)
+
+			assert.Equal(t, tc.want.httpCode, respRecorder.Code)
+			assert.Equal(t, tc.want.body, respRecorder.Body.String())
+		})
+	}
+}
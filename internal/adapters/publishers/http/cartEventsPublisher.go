@@ -0,0 +1,44 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/go-resty/resty/v2"
+)
+
+// Marketing webhook that receives the abandoned carts
+type CartEventsPublisher struct {
+	client *resty.Client
+	url    string
+}
+
+// A single client is shared by every call, so connections to the webhook are reused
+func NewCartEventsPublisher(url string, timeout time.Duration) *CartEventsPublisher {
+	client := resty.New().
+		SetTimeout(timeout).
+		SetHeader("Content-Type", "application/json")
+
+	return &CartEventsPublisher{client: client, url: url}
+}
+
+func (cp *CartEventsPublisher) PublishAbandonedCart(ctx context.Context, cart model.AbandonedCart) error {
+	response, publishErr := cp.client.R().
+		SetBody(cart).
+		SetContext(ctx).
+		Post(cp.url)
+
+	if publishErr != nil {
+		return fmt.Errorf("publishing abandoned cart %s --> %w", cart.CartId, publishErr)
+	}
+
+	// Any 2xx means that the webhook got it. I.E. 202 for webhooks that queue the event
+	if !response.IsSuccess() {
+		return fmt.Errorf("bad http response while publishing abandoned cart %s: %d %s",
+			cart.CartId, response.StatusCode(), response.String())
+	}
+
+	return nil
+}
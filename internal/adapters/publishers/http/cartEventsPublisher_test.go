@@ -0,0 +1,84 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	someTime      = time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)
+	abandonedCart = model.AbandonedCart{
+		CartId:    "5b9a2ecf-0a37-4f4b-9c57-0d4d2e7e3a11",
+		OwnerId:   "user-1",
+		Items:     []model.CartItem{{Id: "1", Name: "potato", Quantity: 2}},
+		CreatedAt: someTime,
+		UpdatedAt: someTime,
+		ExpiredAt: someTime.Add(time.Hour),
+	}
+)
+
+// We use Gherkin notation for the tests
+func Test_PublishAbandonedCart_GivenHttpCartEventsPublisher(t *testing.T) {
+	tests := []struct {
+		name                   string
+		timeout                time.Duration
+		webhookFakeHttpHandler func(t *testing.T, w http.ResponseWriter, r *http.Request)
+		wantErr                bool
+	}{
+		{
+			name:    "WhenPublishAndBadHttpResponse_ThenError",
+			timeout: 3 * time.Second,
+			webhookFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantErr: true,
+		}, {
+			name:    "WhenPublishAndTimesOut_ThenError",
+			timeout: 1 * time.Second,
+			webhookFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				time.Sleep(2 * time.Second)
+			},
+			wantErr: true,
+		}, {
+			name:    "WhenPublishAndAccepted_ThenCartSent",
+			timeout: 3 * time.Second,
+			webhookFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/abandoned", r.URL.Path)
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.JSONEq(t, `{"cartId":"5b9a2ecf-0a37-4f4b-9c57-0d4d2e7e3a11","ownerId":"user-1",`+
+					`"items":[{"id":"1","name":"potato","quantity":2,"reservationId":"","reservedQuantity":0}],`+
+					`"createdAt":"2024-09-01T10:00:00Z","updatedAt":"2024-09-01T10:00:00Z","expiredAt":"2024-09-01T11:00:00Z"}`,
+					string(body))
+				w.WriteHeader(http.StatusAccepted)
+			},
+			wantErr: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			webhookFakeHttpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tc.webhookFakeHttpHandler(t, w, r)
+			}))
+			defer webhookFakeHttpServer.Close()
+
+			publisher := NewCartEventsPublisher(webhookFakeHttpServer.URL+"/abandoned", tc.timeout)
+
+			publishErr := publisher.PublishAbandonedCart(context.Background(), abandonedCart)
+			if tc.wantErr {
+				assert.Error(t, publishErr)
+			} else {
+				assert.NoError(t, publishErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/rs/zerolog/log"
+)
+
+// Used when there is no marketing webhook. The abandoned carts are only logged, so they are not lost silently
+type CartEventsPublisher struct{}
+
+func NewCartEventsPublisher() *CartEventsPublisher {
+	return &CartEventsPublisher{}
+}
+
+func (cp *CartEventsPublisher) PublishAbandonedCart(ctx context.Context, cart model.AbandonedCart) error {
+	log.
+		Info().
+		Str("cartId", cart.CartId).
+		Str("ownerId", cart.OwnerId).
+		Int("items", len(cart.Items)).
+		Time("updatedAt", cart.UpdatedAt).
+		Msg("cart abandoned")
+	return nil
+}
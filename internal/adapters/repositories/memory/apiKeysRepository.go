@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+type APIKeysRepository struct {
+	store *Store
+}
+
+func NewAPIKeysRepository(store *Store) *APIKeysRepository {
+	return &APIKeysRepository{store: store}
+}
+
+// The caller gets a copy, so it cannot change the stored key without the lock
+func copyAPIKey(key *model.APIKey) model.APIKey {
+	copied := *key
+	copied.Scopes = slices.Clone(key.Scopes)
+	if key.RevokedAt != nil {
+		revokedAt := *key.RevokedAt
+		copied.RevokedAt = &revokedAt
+	}
+	return copied
+}
+
+func (akr *APIKeysRepository) Create(_ context.Context, key model.APIKey) error {
+	akr.store.mutex.Lock()
+	defer akr.store.mutex.Unlock()
+
+	stored := copyAPIKey(&key)
+	akr.store.apiKeys = append(akr.store.apiKeys, &stored)
+	return nil
+}
+
+func (akr *APIKeysRepository) GetByHash(_ context.Context, hash string) (model.APIKey, error) {
+	akr.store.mutex.Lock()
+	defer akr.store.mutex.Unlock()
+
+	for _, key := range akr.store.apiKeys {
+		if key.Hash == hash {
+			return copyAPIKey(key), nil
+		}
+	}
+	return model.APIKey{}, fmt.Errorf("api key by hash --> %w", model.ErrAPIKeyNotFound)
+}
+
+func (akr *APIKeysRepository) List(_ context.Context) ([]model.APIKey, error) {
+	akr.store.mutex.Lock()
+	defer akr.store.mutex.Unlock()
+
+	keys := make([]model.APIKey, 0, len(akr.store.apiKeys))
+	for _, key := range akr.store.apiKeys {
+		keys = append(keys, copyAPIKey(key))
+	}
+	slices.SortStableFunc(keys, func(a, b model.APIKey) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return keys, nil
+}
+
+func (akr *APIKeysRepository) Revoke(_ context.Context, id string, revokedAt time.Time) error {
+	akr.store.mutex.Lock()
+	defer akr.store.mutex.Unlock()
+
+	for _, key := range akr.store.apiKeys {
+		if key.Id == id {
+			if key.RevokedAt == nil {
+				key.RevokedAt = &revokedAt
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("api key %s --> %w", id, model.ErrAPIKeyNotFound)
+}
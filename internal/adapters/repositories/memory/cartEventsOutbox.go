@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+type CartEventsOutbox struct {
+	store *Store
+}
+
+func NewCartEventsOutbox(store *Store) *CartEventsOutbox {
+	return &CartEventsOutbox{store: store}
+}
+
+func (ceo *CartEventsOutbox) Claim(_ context.Context, limit int, lease time.Duration) ([]model.CartEvent, error) {
+	ceo.store.mutex.Lock()
+	defer ceo.store.mutex.Unlock()
+
+	now := time.Now().UTC()
+
+	// Events are kept in creation order, so the oldest ones are claimed first
+	events := []model.CartEvent{}
+	for _, e := range ceo.store.events {
+		if len(events) >= limit {
+			break
+		}
+		if e.status != taskStatusPending || e.nextAttemptAt.After(now) || e.claimedUntil.After(now) {
+			continue
+		}
+
+		e.claimedUntil = now.Add(lease)
+		e.event.Attempts++
+		event := e.event
+		event.Cart = copyAbandonedCart(e.event.Cart)
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Published events are dropped. Unlike a table, the store would grow forever otherwise
+func (ceo *CartEventsOutbox) MarkDone(_ context.Context, eventId int64) error {
+	ceo.store.mutex.Lock()
+	defer ceo.store.mutex.Unlock()
+
+	_, i, found := ceo.store.event(eventId)
+	if !found {
+		return fmt.Errorf("cart event %d --> %w", eventId, model.ErrCartEventNotFound)
+	}
+	ceo.store.events = append(ceo.store.events[:i], ceo.store.events[i+1:]...)
+	return nil
+}
+
+func (ceo *CartEventsOutbox) Retry(_ context.Context, eventId int64, nextAttemptAt time.Time, lastErr string) error {
+	return ceo.update(eventId, func(e *outboxEvent) {
+		e.nextAttemptAt = nextAttemptAt
+		e.claimedUntil = time.Time{}
+		e.lastError = lastErr
+	})
+}
+
+func (ceo *CartEventsOutbox) MarkDead(_ context.Context, eventId int64, lastErr string) error {
+	return ceo.update(eventId, func(e *outboxEvent) {
+		e.status = taskStatusDead
+		e.claimedUntil = time.Time{}
+		e.lastError = lastErr
+	})
+}
+
+// Published events are already dropped by MarkDone
+func (ceo *CartEventsOutbox) DeleteDone(_ context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (ceo *CartEventsOutbox) update(eventId int64, change func(e *outboxEvent)) error {
+	ceo.store.mutex.Lock()
+	defer ceo.store.mutex.Unlock()
+
+	e, _, found := ceo.store.event(eventId)
+	if !found {
+		return fmt.Errorf("cart event %d --> %w", eventId, model.ErrCartEventNotFound)
+	}
+	change(e)
+	return nil
+}
@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+type IdempotencyKeysRepository struct {
+	store *Store
+}
+
+func NewIdempotencyKeysRepository(store *Store) *IdempotencyKeysRepository {
+	return &IdempotencyKeysRepository{store: store}
+}
+
+func (ikr *IdempotencyKeysRepository) Claim(_ context.Context, record model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+	ikr.store.mutex.Lock()
+	defer ikr.store.mutex.Unlock()
+
+	if stored, found := ikr.store.idempotencyKeys[record.Key]; found && stored.ExpiresAt.After(time.Now().UTC()) {
+		return copyIdempotencyRecord(stored), false, nil
+	}
+
+	stored := copyIdempotencyRecord(&record)
+	ikr.store.idempotencyKeys[record.Key] = &stored
+	return record, true, nil
+}
+
+func (ikr *IdempotencyKeysRepository) Complete(_ context.Context, key string, response model.IdempotentResponse, expiresAt time.Time) error {
+	ikr.store.mutex.Lock()
+	defer ikr.store.mutex.Unlock()
+
+	stored, found := ikr.store.idempotencyKeys[key]
+	if !found {
+		return fmt.Errorf("idempotency key %s --> %w", key, model.ErrIdempotencyKeyNotFound)
+	}
+	stored.Response = copyIdempotentResponse(&response)
+	stored.ExpiresAt = expiresAt
+	return nil
+}
+
+func (ikr *IdempotencyKeysRepository) Delete(_ context.Context, key string) error {
+	ikr.store.mutex.Lock()
+	defer ikr.store.mutex.Unlock()
+
+	delete(ikr.store.idempotencyKeys, key)
+	return nil
+}
+
+func (ikr *IdempotencyKeysRepository) DeleteExpired(_ context.Context) (int64, error) {
+	ikr.store.mutex.Lock()
+	defer ikr.store.mutex.Unlock()
+
+	now := time.Now().UTC()
+	var deleted int64
+	for key, stored := range ikr.store.idempotencyKeys {
+		if !stored.ExpiresAt.After(now) {
+			delete(ikr.store.idempotencyKeys, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Same as copyItem. Neither the caller nor the store can change what the other one holds
+func copyIdempotencyRecord(record *model.IdempotencyRecord) model.IdempotencyRecord {
+	copied := *record
+	if record.Response != nil {
+		copied.Response = copyIdempotentResponse(record.Response)
+	}
+	return copied
+}
+
+func copyIdempotentResponse(response *model.IdempotentResponse) *model.IdempotentResponse {
+	copied := *response
+	copied.Headers = make(map[string]string, len(response.Headers))
+	for name, value := range response.Headers {
+		copied.Headers[name] = value
+	}
+	copied.Body = append([]byte(nil), response.Body...)
+	return &copied
+}
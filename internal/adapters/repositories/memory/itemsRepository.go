@@ -0,0 +1,316 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+// Same semantics as the mysql repository. Quantities of the same item are merged within the same cart and every
+// change that affects the reservation writes the corresponding task in the outbox
+type CartItemsRepository struct {
+	store *Store
+}
+
+func NewCartItemsRepository(store *Store) *CartItemsRepository {
+	return &CartItemsRepository{store: store}
+}
+
+func (cir *CartItemsRepository) Get(_ context.Context, cartId string) (model.Cart, error) {
+	cir.store.mutex.Lock()
+	defer cir.store.mutex.Unlock()
+
+	c, found := cir.store.carts[cartId]
+	if !found {
+		return model.Cart{Items: []model.CartItem{}}, nil
+	}
+
+	items := make([]model.CartItem, 0, len(c.order))
+	for _, itemId := range c.order {
+		items = append(items, copyItem(c.items[itemId]))
+	}
+	return model.Cart{Version: c.version, Items: items}, nil
+}
+
+func (cir *CartItemsRepository) GetItem(_ context.Context, cartId string, itemId string) (model.CartItem, error) {
+	cir.store.mutex.Lock()
+	defer cir.store.mutex.Unlock()
+
+	item, found := cir.store.item(cartId, itemId)
+	if !found {
+		return model.CartItem{}, fmt.Errorf("item id %s in cart %s --> %w", itemId, cartId, model.ErrItemNotFound)
+	}
+	return copyItem(item), nil
+}
+
+func (cir *CartItemsRepository) Add(_ context.Context, cartId string, item model.CartItem, expectedVersion *int64) (model.CartItem, int64, error) {
+	cir.store.mutex.Lock()
+	defer cir.store.mutex.Unlock()
+
+	if _, versionErr := cir.store.checkVersion(cartId, expectedVersion); versionErr != nil {
+		return model.CartItem{}, 0, versionErr
+	}
+	c := cir.store.cart(cartId)
+
+	stored, found := c.items[item.Id]
+	if found {
+		merged := *stored
+		merged.Quantity += item.Quantity
+		if quantityErr := merged.CheckMergedQuantity(); quantityErr != nil {
+			return model.CartItem{}, 0, quantityErr
+		}
+		stored.Quantity = merged.Quantity
+	} else {
+		// Reservation fields are managed by the repository. Whatever comes in the request is ignored
+		stored = &model.CartItem{
+			Id:                item.Id,
+			Name:              item.Name,
+			Quantity:          item.Quantity,
+			ReservationStatus: model.ReservationPending,
+		}
+		c.items[item.Id] = stored
+		c.order = append(c.order, item.Id)
+	}
+
+	if stored.NeedsReservation() {
+		cir.requestReservation(cartId, stored)
+	}
+	c.changed()
+	return copyItem(stored), c.version, nil
+}
+
+func (cir *CartItemsRepository) SetReservationId(_ context.Context, cartId string, item model.CartItem, reservationId string) error {
+	cir.store.mutex.Lock()
+	defer cir.store.mutex.Unlock()
+
+	stored, found := cir.store.item(cartId, item.Id)
+	if !found {
+		return fmt.Errorf("item id %s in cart %s --> %w", item.Id, cartId, model.ErrItemNotFound)
+	}
+
+	stored.ReservationId = reservationId
+	stored.ReservedQuantity = item.Quantity
+	stored.ReservationError = ""
+	setStatus(stored, model.ReservationReserved)
+	return nil
+}
+
+func (cir *CartItemsRepository) SetReservationFailed(_ context.Context, cartId string, itemId string, reason string) error {
+	cir.store.mutex.Lock()
+	defer cir.store.mutex.Unlock()
+
+	stored, found := cir.store.item(cartId, itemId)
+	if !found {
+		return fmt.Errorf("item id %s in cart %s --> %w", itemId, cartId, model.ErrItemNotFound)
+	}
+
+	stored.ReservationError = reason
+	setStatus(stored, model.ReservationFailed)
+	return nil
+}
+
+func (cir *CartItemsRepository) SetReservationReleased(_ context.Context, cartId string, itemId string, reservationId string) error {
+	cir.store.mutex.Lock()
+	defer cir.store.mutex.Unlock()
+
+	stored, found := cir.store.item(cartId, itemId)
+	if !found || stored.ReservationId != reservationId {
+		return fmt.Errorf("item id %s with reservation %s in cart %s --> %w", itemId, reservationId, cartId, model.ErrItemNotFound)
+	}
+
+	stored.ReservationId = ""
+	stored.ReservedQuantity = 0
+	setStatus(stored, model.ReservationReleased)
+	return nil
+}
+
+func (cir *CartItemsRepository) Remove(_ context.Context, cartId string, itemId string, expectedVersion *int64) (model.CartItem, int64, error) {
+	cir.store.mutex.Lock()
+	defer cir.store.mutex.Unlock()
+
+	if _, versionErr := cir.store.checkVersion(cartId, expectedVersion); versionErr != nil {
+		return model.CartItem{}, 0, versionErr
+	}
+	stored, found := cir.store.item(cartId, itemId)
+	if !found {
+		return model.CartItem{}, 0, fmt.Errorf("item id %s in cart %s --> %w", itemId, cartId, model.ErrItemNotFound)
+	}
+
+	c := cir.store.carts[cartId]
+	delete(c.items, itemId)
+	for i, id := range c.order {
+		if id == itemId {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+
+	// Items whose reservation has not been done yet have nothing to release
+	if stored.ReservationId != "" {
+		cir.store.addTask(model.NewReleaseTask(cartId, *stored))
+	}
+	c.changed()
+	return copyItem(stored), c.version, nil
+}
+
+func (cir *CartItemsRepository) UpdateQuantity(_ context.Context, cartId string, itemId string, quantity int, expectedVersion *int64) (model.CartItem, int64, error) {
+	cir.store.mutex.Lock()
+	defer cir.store.mutex.Unlock()
+
+	c, versionErr := cir.store.checkVersion(cartId, expectedVersion)
+	if versionErr != nil {
+		return model.CartItem{}, 0, versionErr
+	}
+	stored, found := cir.store.item(cartId, itemId)
+	if !found {
+		return model.CartItem{}, 0, fmt.Errorf("item id %s in cart %s --> %w", itemId, cartId, model.ErrItemNotFound)
+	}
+
+	stored.Quantity = quantity
+	if stored.NeedsReservation() {
+		cir.requestReservation(cartId, stored)
+	}
+	c.changed()
+	return copyItem(stored), c.version, nil
+}
+
+func (cir *CartItemsRepository) CartOwner(_ context.Context, cartId string) (string, error) {
+	cir.store.mutex.Lock()
+	defer cir.store.mutex.Unlock()
+
+	if c, found := cir.store.carts[cartId]; found {
+		return c.owner, nil
+	}
+	return "", nil
+}
+
+func (cir *CartItemsRepository) ClaimCart(_ context.Context, cartId string, ownerId string) (string, error) {
+	cir.store.mutex.Lock()
+	defer cir.store.mutex.Unlock()
+
+	c := cir.store.cart(cartId)
+	if c.owner == "" {
+		c.owner = ownerId
+	}
+	return c.owner, nil
+}
+
+func (cir *CartItemsRepository) Merge(_ context.Context, guestCartId string, cartId string, expectedVersion *int64) (model.Cart, error) {
+	cir.store.mutex.Lock()
+	defer cir.store.mutex.Unlock()
+
+	guest, found := cir.store.carts[guestCartId]
+	if !found {
+		return model.Cart{}, fmt.Errorf("guest cart %s --> %w", guestCartId, model.ErrCartNotFound)
+	}
+	if _, versionErr := cir.store.checkVersion(cartId, expectedVersion); versionErr != nil {
+		return model.Cart{}, versionErr
+	}
+	// Checked before changing anything, as there is no transaction to roll back
+	if existing, found := cir.store.carts[cartId]; found {
+		for _, itemId := range guest.order {
+			if stored, found := existing.items[itemId]; found {
+				if _, _, mergeErr := model.MergeCartItem(*stored, *guest.items[itemId]); mergeErr != nil {
+					return model.Cart{}, mergeErr
+				}
+			}
+		}
+	}
+	c := cir.store.cart(cartId)
+
+	for _, itemId := range guest.order {
+		guestItem := guest.items[itemId]
+		stored, found := c.items[itemId]
+		if found {
+			merged, releaseGuest, _ := model.MergeCartItem(*stored, *guestItem)
+			if releaseGuest {
+				cir.store.addTask(model.NewReleaseTask(guestCartId, *guestItem))
+			}
+			*stored = merged
+		} else {
+			// Moved as it is, reservation included
+			moved := copyItem(guestItem)
+			stored = &moved
+			c.items[itemId] = stored
+			c.order = append(c.order, itemId)
+		}
+
+		// The reserve tasks of the guest cart find nothing to reserve once it is gone
+		if stored.NeedsReservation() {
+			cir.requestReservation(cartId, stored)
+		}
+	}
+	delete(cir.store.carts, guestCartId)
+	c.changed()
+
+	items := make([]model.CartItem, 0, len(c.order))
+	for _, itemId := range c.order {
+		items = append(items, copyItem(c.items[itemId]))
+	}
+	return model.Cart{Version: c.version, Items: items}, nil
+}
+
+// Must be called with the lock held
+func (cir *CartItemsRepository) requestReservation(cartId string, item *model.CartItem) {
+	setStatus(item, model.ReservationPending)
+	cir.store.addTask(model.NewReserveTask(cartId, *item))
+}
+
+func setStatus(item *model.CartItem, status model.ReservationStatus) {
+	now := time.Now().UTC()
+	item.ReservationStatus = status
+	item.ReservationUpdatedAt = &now
+}
+
+func (cir *CartItemsRepository) ExpireCarts(_ context.Context, idleSince time.Time, limit int) ([]model.AbandonedCart, error) {
+	cir.store.mutex.Lock()
+	defer cir.store.mutex.Unlock()
+
+	var idle []string
+	for cartId, c := range cir.store.carts {
+		if c.updatedAt.Before(idleSince) {
+			idle = append(idle, cartId)
+		}
+	}
+	// Oldest first, as the sql repositories
+	sort.Slice(idle, func(i, j int) bool {
+		return cir.store.carts[idle[i]].updatedAt.Before(cir.store.carts[idle[j]].updatedAt)
+	})
+	if len(idle) > limit {
+		idle = idle[:limit]
+	}
+
+	expiredAt := time.Now().UTC()
+	carts := make([]model.AbandonedCart, 0, len(idle))
+	for _, cartId := range idle {
+		c := cir.store.carts[cartId]
+		items := make([]model.CartItem, 0, len(c.order))
+		for _, itemId := range c.order {
+			item := copyItem(c.items[itemId])
+			// Same as removing the items one by one
+			if item.ReservationId != "" {
+				cir.store.addTask(model.NewReleaseTask(cartId, item))
+			}
+			items = append(items, item)
+		}
+		delete(cir.store.carts, cartId)
+
+		cart := model.AbandonedCart{
+			CartId:    cartId,
+			OwnerId:   c.owner,
+			Items:     items,
+			CreatedAt: c.createdAt,
+			UpdatedAt: c.updatedAt,
+			ExpiredAt: expiredAt,
+		}
+		// Empty carts are not worth a reminder
+		if len(items) > 0 {
+			cir.store.addEvent(model.NewAbandonedCartEvent(copyAbandonedCart(cart)))
+		}
+		carts = append(carts, cart)
+	}
+	return carts, nil
+}
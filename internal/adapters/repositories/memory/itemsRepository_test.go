@@ -0,0 +1,34 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/repositorytest"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+)
+
+func Test_CartItemsRepository_Conformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) (ports.CartItemsRepository, ports.ReservationOutbox) {
+		store := NewStore()
+		return NewCartItemsRepository(store), NewReservationOutbox(store)
+	})
+}
+
+func Test_CartEventsOutbox_Conformance(t *testing.T) {
+	repositorytest.RunCartEvents(t, func(t *testing.T) (ports.CartItemsRepository, ports.CartEventsOutbox) {
+		store := NewStore()
+		return NewCartItemsRepository(store), NewCartEventsOutbox(store)
+	})
+}
+
+func Test_IdempotencyKeysRepository_Conformance(t *testing.T) {
+	repositorytest.RunIdempotencyKeys(t, func(t *testing.T) ports.IdempotencyKeysRepository {
+		return NewIdempotencyKeysRepository(NewStore())
+	})
+}
+
+func Test_APIKeysRepository_Conformance(t *testing.T) {
+	repositorytest.RunAPIKeys(t, func(t *testing.T) ports.APIKeysRepository {
+		return NewAPIKeysRepository(NewStore())
+	})
+}
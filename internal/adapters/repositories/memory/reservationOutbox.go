@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+type ReservationOutbox struct {
+	store *Store
+}
+
+func NewReservationOutbox(store *Store) *ReservationOutbox {
+	return &ReservationOutbox{store: store}
+}
+
+func (ro *ReservationOutbox) Claim(_ context.Context, limit int, lease time.Duration) ([]model.ReservationTask, error) {
+	ro.store.mutex.Lock()
+	defer ro.store.mutex.Unlock()
+
+	now := time.Now().UTC()
+
+	// Tasks are kept in creation order, so the oldest ones are claimed first
+	tasks := []model.ReservationTask{}
+	for _, t := range ro.store.tasks {
+		if len(tasks) >= limit {
+			break
+		}
+		if t.status != taskStatusPending || t.nextAttemptAt.After(now) || t.claimedUntil.After(now) {
+			continue
+		}
+
+		t.claimedUntil = now.Add(lease)
+		t.task.Attempts++
+		tasks = append(tasks, t.task)
+	}
+	return tasks, nil
+}
+
+// Done tasks are dropped. Unlike a table, the store would grow forever otherwise
+func (ro *ReservationOutbox) MarkDone(_ context.Context, taskId int64) error {
+	ro.store.mutex.Lock()
+	defer ro.store.mutex.Unlock()
+
+	_, i, found := ro.store.task(taskId)
+	if !found {
+		return fmt.Errorf("task %d --> %w", taskId, model.ErrReservationTaskNotFound)
+	}
+	ro.store.tasks = append(ro.store.tasks[:i], ro.store.tasks[i+1:]...)
+	return nil
+}
+
+func (ro *ReservationOutbox) Retry(_ context.Context, taskId int64, nextAttemptAt time.Time, lastErr string) error {
+	return ro.update(taskId, func(t *outboxTask) {
+		t.nextAttemptAt = nextAttemptAt
+		t.claimedUntil = time.Time{}
+		t.lastError = lastErr
+	})
+}
+
+func (ro *ReservationOutbox) Postpone(_ context.Context, taskId int64, nextAttemptAt time.Time) error {
+	return ro.update(taskId, func(t *outboxTask) {
+		t.nextAttemptAt = nextAttemptAt
+		t.claimedUntil = time.Time{}
+		// Gives back the attempt added by the claim
+		t.task.Attempts--
+	})
+}
+
+func (ro *ReservationOutbox) MarkDead(_ context.Context, taskId int64, lastErr string) error {
+	return ro.update(taskId, func(t *outboxTask) {
+		t.status = taskStatusDead
+		t.claimedUntil = time.Time{}
+		t.lastError = lastErr
+	})
+}
+
+// Done tasks are already dropped by MarkDone
+func (ro *ReservationOutbox) DeleteDone(_ context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (ro *ReservationOutbox) update(taskId int64, change func(t *outboxTask)) error {
+	ro.store.mutex.Lock()
+	defer ro.store.mutex.Unlock()
+
+	t, _, found := ro.store.task(taskId)
+	if !found {
+		return fmt.Errorf("task %d --> %w", taskId, model.ErrReservationTaskNotFound)
+	}
+	change(t)
+	return nil
+}
@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReservationOutbox_GivenTasksInStore(t *testing.T) {
+	ctx := context.Background()
+	item := model.CartItem{Id: "1", Name: "screen", Quantity: 2}
+
+	tests := []struct {
+		name string
+		// Receives the only task in the store, already claimed
+		act       func(o *ReservationOutbox, task model.ReservationTask) error
+		wantErr   bool
+		wantTasks int
+		// Attempts of the task claimed again, if any
+		wantAttempts int
+	}{
+		{
+			name:      "WhenClaimedTaskIsClaimedAgain_ThenNothingIsReturnedUntilTheLeaseExpires",
+			act:       func(o *ReservationOutbox, task model.ReservationTask) error { return nil },
+			wantTasks: 0,
+		}, {
+			name: "WhenTaskIsDone_ThenItIsNotClaimedAnymore",
+			act: func(o *ReservationOutbox, task model.ReservationTask) error {
+				return o.MarkDone(ctx, task.Id)
+			},
+			wantTasks: 0,
+		}, {
+			name: "WhenTaskIsDead_ThenItIsNotClaimedAnymore",
+			act: func(o *ReservationOutbox, task model.ReservationTask) error {
+				return o.MarkDead(ctx, task.Id, "too many attempts")
+			},
+			wantTasks: 0,
+		}, {
+			name: "WhenTaskIsRetried_ThenItIsClaimedAgainWithAnotherAttempt",
+			act: func(o *ReservationOutbox, task model.ReservationTask) error {
+				return o.Retry(ctx, task.Id, time.Now().Add(-time.Second), "reserver down")
+			},
+			wantTasks:    1,
+			wantAttempts: 2,
+		}, {
+			name: "WhenTaskIsRetriedLater_ThenItIsNotClaimedYet",
+			act: func(o *ReservationOutbox, task model.ReservationTask) error {
+				return o.Retry(ctx, task.Id, time.Now().Add(time.Hour), "reserver down")
+			},
+			wantTasks: 0,
+		}, {
+			name: "WhenTaskIsPostponed_ThenTheAttemptIsGivenBack",
+			act: func(o *ReservationOutbox, task model.ReservationTask) error {
+				return o.Postpone(ctx, task.Id, time.Now().Add(-time.Second))
+			},
+			wantTasks:    1,
+			wantAttempts: 1,
+		}, {
+			name: "WhenUnknownTask_ThenError",
+			act: func(o *ReservationOutbox, task model.ReservationTask) error {
+				return o.MarkDone(ctx, task.Id+1)
+			},
+			wantErr:   true,
+			wantTasks: 0,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewStore()
+			repo := NewCartItemsRepository(store)
+			o := NewReservationOutbox(store)
+
+			_, _, addErr := repo.Add(ctx, "cart", item, nil)
+			require.NoError(t, addErr)
+			claimed, claimErr := o.Claim(ctx, 10, time.Minute)
+			require.NoError(t, claimErr)
+			require.Len(t, claimed, 1)
+
+			actErr := tc.act(o, claimed[0])
+
+			if tc.wantErr {
+				assert.Error(t, actErr)
+			} else {
+				assert.NoError(t, actErr)
+			}
+			tasks, claimErr := o.Claim(ctx, 10, time.Minute)
+			assert.NoError(t, claimErr)
+			assert.Len(t, tasks, tc.wantTasks)
+			if tc.wantTasks > 0 {
+				assert.Equal(t, tc.wantAttempts, tasks[0].Attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+// Outbox statuses. Same ones as in the mysql outbox
+const (
+	taskStatusPending = "pending"
+	taskStatusDead    = "dead"
+)
+
+// In process storage for local development and tests. Everything is lost when the service stops.
+// The repository and the outbox share the store, so an item and its reservation task are written under the same
+// lock, which is the in memory counterpart of the mysql transaction
+type Store struct {
+	mutex      sync.Mutex
+	carts      map[string]*cart
+	tasks      []*outboxTask
+	lastTaskId int64
+	// Abandoned cart events, written along with the deletion of the carts
+	events      []*outboxEvent
+	lastEventId int64
+	// Requests sent with an Idempotency-Key, by key
+	idempotencyKeys map[string]*model.IdempotencyRecord
+	// Keys of the back office tools and services
+	apiKeys []*model.APIKey
+}
+
+// Items are kept in insertion order, so they are always listed in the same order
+type cart struct {
+	items   map[string]*model.CartItem
+	order   []string
+	version int64
+	// Empty until someone claims the cart
+	owner     string
+	createdAt time.Time
+	// Last change made by the clients, same as the version
+	updatedAt time.Time
+}
+
+// Must be called with the lock held, once a change made by the clients is done
+func (c *cart) changed() {
+	c.version++
+	c.updatedAt = time.Now().UTC()
+}
+
+type outboxTask struct {
+	task          model.ReservationTask
+	status        string
+	nextAttemptAt time.Time
+	claimedUntil  time.Time
+	lastError     string
+}
+
+type outboxEvent struct {
+	event         model.CartEvent
+	status        string
+	nextAttemptAt time.Time
+	claimedUntil  time.Time
+	lastError     string
+}
+
+func NewStore() *Store {
+	return &Store{
+		carts:           make(map[string]*cart),
+		idempotencyKeys: make(map[string]*model.IdempotencyRecord),
+	}
+}
+
+// Must be called with the lock held
+func (s *Store) cart(cartId string) *cart {
+	c, found := s.carts[cartId]
+	if !found {
+		now := time.Now().UTC()
+		c = &cart{items: make(map[string]*model.CartItem), createdAt: now, updatedAt: now}
+		s.carts[cartId] = c
+	}
+	return c
+}
+
+// Must be called with the lock held
+func (s *Store) item(cartId string, itemId string) (*model.CartItem, bool) {
+	c, found := s.carts[cartId]
+	if !found {
+		return nil, false
+	}
+	item, found := c.items[itemId]
+	return item, found
+}
+
+// Must be called with the lock held. Same checks as the sql repositories: the version is checked before the item,
+// and a cart that does not exist is at version 0. The caller increases the version once the change is done
+func (s *Store) checkVersion(cartId string, expectedVersion *int64) (*cart, error) {
+	c, found := s.carts[cartId]
+	var current int64
+	if found {
+		current = c.version
+	}
+	if conflictErr := model.CheckCartVersion(cartId, expectedVersion, current); conflictErr != nil {
+		return nil, conflictErr
+	}
+	return c, nil
+}
+
+// Must be called with the lock held. Only the fields a reserver needs are kept in the snapshot, as in the mysql outbox
+func (s *Store) addTask(task model.ReservationTask) {
+	s.lastTaskId++
+	task.Id = s.lastTaskId
+	task.CreatedAt = time.Now().UTC()
+	task.Item = model.CartItem{
+		Id:            task.Item.Id,
+		Name:          task.Item.Name,
+		Quantity:      task.Item.Quantity,
+		ReservationId: task.Item.ReservationId,
+	}
+
+	s.tasks = append(s.tasks, &outboxTask{
+		task:          task,
+		status:        taskStatusPending,
+		nextAttemptAt: task.CreatedAt,
+	})
+}
+
+// Must be called with the lock held
+func (s *Store) task(taskId int64) (*outboxTask, int, bool) {
+	for i, t := range s.tasks {
+		if t.task.Id == taskId {
+			return t, i, true
+		}
+	}
+	return nil, 0, false
+}
+
+// Must be called with the lock held
+func (s *Store) addEvent(event model.CartEvent) {
+	s.lastEventId++
+	event.Id = s.lastEventId
+	event.CreatedAt = time.Now().UTC()
+
+	s.events = append(s.events, &outboxEvent{
+		event:         event,
+		status:        taskStatusPending,
+		nextAttemptAt: event.CreatedAt,
+	})
+}
+
+// Must be called with the lock held
+func (s *Store) event(eventId int64) (*outboxEvent, int, bool) {
+	for i, e := range s.events {
+		if e.event.Id == eventId {
+			return e, i, true
+		}
+	}
+	return nil, 0, false
+}
+
+// The caller gets a copy, so it cannot change the stored item without the lock
+func copyItem(item *model.CartItem) model.CartItem {
+	copied := *item
+	if item.ReservationUpdatedAt != nil {
+		updatedAt := *item.ReservationUpdatedAt
+		copied.ReservationUpdatedAt = &updatedAt
+	}
+	return copied
+}
+
+// Same as copyItem, for the carts kept in the events outbox
+func copyAbandonedCart(cart model.AbandonedCart) model.AbandonedCart {
+	items := make([]model.CartItem, 0, len(cart.Items))
+	for i := range cart.Items {
+		items = append(items, copyItem(&cart.Items[i]))
+	}
+	cart.Items = items
+	return cart
+}
@@ -0,0 +1,291 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+const (
+	migrationsTable = "schema_migrations"
+)
+
+var (
+	// I.E. 0002_add_cart_version.up.sql. The version is the number, the name is only informative
+	fileNameRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+	ErrNothingToRollBack = errors.New("no migration has been applied")
+)
+
+// A numbered change of the schema. Up applies it and Down undoes it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations that have not been applied yet have no AppliedAt
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Applies the migrations of a database and keeps track of them in the schema_migrations table.
+// Every database has its own dialect, so every repository embeds its own migrations
+type Migrator struct {
+	db     *sql.DB
+	flavor sqlbuilder.Flavor
+	files  fs.FS
+}
+
+// The files are read from the root of the given fs, so embedded files need fs.Sub
+func NewMigrator(db *sql.DB, flavor sqlbuilder.Flavor, files fs.FS) *Migrator {
+	return &Migrator{db: db, flavor: flavor, files: files}
+}
+
+// Returns the migrations sorted by version. Every migration must have an up file. Down files are optional,
+// but migrations without them cannot be rolled back
+func (m *Migrator) Migrations() ([]Migration, error) {
+	entries, readErr := fs.ReadDir(m.files, ".")
+	if readErr != nil {
+		return nil, fmt.Errorf("reading migrations --> %w", readErr)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		parts := fileNameRegexp.FindStringSubmatch(entry.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("migration file %s is not named like 0001_name.up.sql or 0001_name.down.sql", entry.Name())
+		}
+		version, _ := strconv.ParseInt(parts[1], 10, 64)
+
+		content, fileErr := fs.ReadFile(m.files, entry.Name())
+		if fileErr != nil {
+			return nil, fmt.Errorf("reading migration file %s --> %w", entry.Name(), fileErr)
+		}
+
+		migration, found := byVersion[version]
+		if !found {
+			migration = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != parts[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, parts[2])
+		}
+		if parts[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Applies every pending migration, in order. Returns the applied ones.
+// Each migration is applied in its own transaction. Be aware that mysql commits every DDL statement right away,
+// so a failed migration may be left half applied there
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	migrations, applied, loadErr := m.load(ctx)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	// A database migrated by a newer version of the app is not touched. The schema could be incompatible
+	known := map[int64]bool{}
+	for _, migration := range migrations {
+		known[migration.Version] = true
+	}
+	for version := range applied {
+		if !known[version] {
+			return nil, fmt.Errorf("database has migration %d, unknown to this version of the app", version)
+		}
+	}
+
+	var done []Migration
+	for _, migration := range migrations {
+		if _, isApplied := applied[migration.Version]; isApplied {
+			continue
+		}
+		if applyErr := m.apply(ctx, migration.Up, func(tx *sql.Tx) error {
+			ib := m.flavor.NewInsertBuilder()
+			ib.InsertInto(migrationsTable).
+				Cols("version", "name", "appliedAt").
+				Values(migration.Version, migration.Name, time.Now().UTC())
+			query, args := ib.Build()
+			_, insertErr := tx.ExecContext(ctx, query, args...)
+			return insertErr
+		}); applyErr != nil {
+			return done, fmt.Errorf("applying migration %04d_%s --> %w", migration.Version, migration.Name, applyErr)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Rolls back the last applied migration. Returns the rolled back one
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	migrations, applied, loadErr := m.load(ctx)
+	if loadErr != nil {
+		return Migration{}, loadErr
+	}
+
+	var last int64 = -1
+	for version := range applied {
+		if version > last {
+			last = version
+		}
+	}
+	if last < 0 {
+		return Migration{}, ErrNothingToRollBack
+	}
+
+	idx := sort.Search(len(migrations), func(i int) bool { return migrations[i].Version >= last })
+	if idx == len(migrations) || migrations[idx].Version != last {
+		return Migration{}, fmt.Errorf("database has migration %d, unknown to this version of the app", last)
+	}
+	migration := migrations[idx]
+	if migration.Down == "" {
+		return Migration{}, fmt.Errorf("migration %04d_%s has no down file, so it cannot be rolled back", migration.Version, migration.Name)
+	}
+
+	if applyErr := m.apply(ctx, migration.Down, func(tx *sql.Tx) error {
+		db := m.flavor.NewDeleteBuilder()
+		db.DeleteFrom(migrationsTable).Where(db.Equal("version", migration.Version))
+		query, args := db.Build()
+		_, deleteErr := tx.ExecContext(ctx, query, args...)
+		return deleteErr
+	}); applyErr != nil {
+		return Migration{}, fmt.Errorf("rolling back migration %04d_%s --> %w", migration.Version, migration.Name, applyErr)
+	}
+	return migration, nil
+}
+
+// Every known migration, applied or not, plus the applied ones unknown to this version of the app, sorted by version
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, applied, loadErr := m.load(ctx)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if appliedMigration, isApplied := applied[migration.Version]; isApplied {
+			status.AppliedAt = appliedMigration.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, appliedMigration := range applied {
+		statuses = append(statuses, appliedMigration)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Reads the migration files and the applied migrations. The tracking table is created the first time
+func (m *Migrator) load(ctx context.Context) ([]Migration, map[int64]MigrationStatus, error) {
+	migrations, migrationsErr := m.Migrations()
+	if migrationsErr != nil {
+		return nil, nil, migrationsErr
+	}
+
+	ctb := m.flavor.NewCreateTableBuilder()
+	ctb.CreateTable(migrationsTable).IfNotExists().
+		Define("version", "bigint", "PRIMARY KEY").
+		Define("name", "varchar(255)", "NOT NULL").
+		Define("appliedAt", "timestamp", "NOT NULL")
+	createQuery, _ := ctb.Build()
+	if _, createErr := m.db.ExecContext(ctx, createQuery); createErr != nil {
+		return nil, nil, fmt.Errorf("creating %s table --> %w", migrationsTable, createErr)
+	}
+
+	sb := m.flavor.NewSelectBuilder()
+	sb.Select("version", "name", "appliedAt").From(migrationsTable)
+	query, args := sb.Build()
+	rows, selectErr := m.db.QueryContext(ctx, query, args...)
+	if selectErr != nil {
+		return nil, nil, fmt.Errorf("reading applied migrations --> %w", selectErr)
+	}
+	defer rows.Close()
+
+	applied := map[int64]MigrationStatus{}
+	for rows.Next() {
+		var status MigrationStatus
+		var appliedAt time.Time
+		if scanErr := rows.Scan(&status.Version, &status.Name, &appliedAt); scanErr != nil {
+			return nil, nil, fmt.Errorf("scanning applied migrations --> %w", scanErr)
+		}
+		status.AppliedAt = &appliedAt
+		applied[status.Version] = status
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, nil, fmt.Errorf("reading applied migrations --> %w", rowsErr)
+	}
+	return migrations, applied, nil
+}
+
+// Runs the statements of the script and the tracking change in the same transaction
+func (m *Migrator) apply(ctx context.Context, script string, track func(tx *sql.Tx) error) error {
+	tx, beginErr := m.db.BeginTx(ctx, nil)
+	if beginErr != nil {
+		return fmt.Errorf("starting transaction --> %w", beginErr)
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer func() { _ = tx.Rollback() }()
+
+	for _, statement := range statements(script) {
+		if _, execErr := tx.ExecContext(ctx, statement); execErr != nil {
+			return execErr
+		}
+	}
+	if trackErr := track(tx); trackErr != nil {
+		return fmt.Errorf("updating %s --> %w", migrationsTable, trackErr)
+	}
+	return tx.Commit()
+}
+
+// Not every driver runs several statements at once (I.E. mysql without multiStatements), so they are run one by one.
+// A statement ends with a semicolon at the end of a line. Comment only chunks are skipped
+func statements(script string) []string {
+	var result []string
+	for _, chunk := range strings.SplitAfter(script, ";\n") {
+		if hasCode(chunk) {
+			result = append(result, strings.TrimSpace(chunk))
+		}
+	}
+	return result
+}
+
+func hasCode(chunk string) bool {
+	for _, line := range strings.Split(chunk, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package migrations_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/migrations"
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/mysql"
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/postgres"
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/sqlite"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	validFiles = fstest.MapFS{
+		"0001_create_carts.up.sql": {Data: []byte(`-- Comments are skipped
+CREATE TABLE cart (
+  id varchar(36) PRIMARY KEY
+);
+CREATE TABLE cartItem (cartId varchar(36), id integer);
+`)},
+		"0001_create_carts.down.sql":      {Data: []byte("DROP TABLE cartItem;\nDROP TABLE cart;\n")},
+		"0002_add_item_name.up.sql":       {Data: []byte("ALTER TABLE cartItem ADD COLUMN name varchar(50);")},
+		"0002_add_item_name.down.sql":     {Data: []byte("ALTER TABLE cartItem DROP COLUMN name;")},
+		"0003_add_item_quantity.up.sql":   {Data: []byte("ALTER TABLE cartItem ADD COLUMN quantity integer;")},
+		"0003_add_item_quantity.down.sql": {Data: []byte("ALTER TABLE cartItem DROP COLUMN quantity;")},
+	}
+)
+
+// Real database, so the statements are actually run. Every test gets its own file
+func newDB(t *testing.T) *sql.DB {
+	db, openErr := sql.Open("sqlite", filepath.Join(t.TempDir(), "migrations.db"))
+	require.NoError(t, openErr)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func withFiles(files fstest.MapFS, extra fstest.MapFS) fstest.MapFS {
+	merged := fstest.MapFS{}
+	for name, file := range files {
+		merged[name] = file
+	}
+	for name, file := range extra {
+		merged[name] = file
+	}
+	return merged
+}
+
+func versions(migrationList []migrations.Migration) []int64 {
+	result := []int64{}
+	for _, migration := range migrationList {
+		result = append(result, migration.Version)
+	}
+	return result
+}
+
+func appliedVersions(t *testing.T, m *migrations.Migrator) []int64 {
+	statuses, statusErr := m.Status(context.TODO())
+	require.NoError(t, statusErr)
+
+	result := []int64{}
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			result = append(result, status.Version)
+		}
+	}
+	return result
+}
+
+// We use Gherkin notation for the tests
+func Test_Up_GivenMigrationFiles(t *testing.T) {
+	t.Run("WhenEmptyDatabase_ThenEveryMigrationIsAppliedInOrder", func(t *testing.T) {
+		m := migrations.NewMigrator(newDB(t), sqlbuilder.SQLite, validFiles)
+
+		applied, upErr := m.Up(context.TODO())
+
+		assert.NoError(t, upErr)
+		assert.Equal(t, []int64{1, 2, 3}, versions(applied))
+		assert.Equal(t, []int64{1, 2, 3}, appliedVersions(t, m))
+	})
+
+	t.Run("WhenAlreadyMigrated_ThenNothingIsApplied", func(t *testing.T) {
+		m := migrations.NewMigrator(newDB(t), sqlbuilder.SQLite, validFiles)
+		_, upErr := m.Up(context.TODO())
+		require.NoError(t, upErr)
+
+		applied, upErr := m.Up(context.TODO())
+
+		assert.NoError(t, upErr)
+		assert.Empty(t, applied)
+	})
+
+	t.Run("WhenNewMigrationIsAdded_ThenOnlyTheNewOneIsApplied", func(t *testing.T) {
+		db := newDB(t)
+		_, upErr := migrations.NewMigrator(db, sqlbuilder.SQLite, validFiles).Up(context.TODO())
+		require.NoError(t, upErr)
+
+		m := migrations.NewMigrator(db, sqlbuilder.SQLite, withFiles(validFiles, fstest.MapFS{
+			"0004_add_item_price.up.sql": {Data: []byte("ALTER TABLE cartItem ADD COLUMN price integer;")},
+		}))
+		applied, upErr := m.Up(context.TODO())
+
+		assert.NoError(t, upErr)
+		assert.Equal(t, []int64{4}, versions(applied))
+	})
+
+	t.Run("WhenMigrationFails_ThenItIsNotTrackedAndTheNextOnesAreNotApplied", func(t *testing.T) {
+		m := migrations.NewMigrator(newDB(t), sqlbuilder.SQLite, withFiles(validFiles, fstest.MapFS{
+			"0002_add_item_name.up.sql": {Data: []byte("ALTER TABLE unknownTable ADD COLUMN name varchar(50);")},
+		}))
+
+		applied, upErr := m.Up(context.TODO())
+
+		assert.ErrorContains(t, upErr, "0002_add_item_name")
+		assert.Equal(t, []int64{1}, versions(applied))
+		assert.Equal(t, []int64{1}, appliedVersions(t, m))
+	})
+
+	t.Run("WhenDatabaseHasUnknownMigration_ThenError", func(t *testing.T) {
+		db := newDB(t)
+		_, upErr := migrations.NewMigrator(db, sqlbuilder.SQLite, withFiles(validFiles, fstest.MapFS{
+			"0004_add_item_price.up.sql": {Data: []byte("ALTER TABLE cartItem ADD COLUMN price integer;")},
+		})).Up(context.TODO())
+		require.NoError(t, upErr)
+
+		// An older version of the app
+		_, upErr = migrations.NewMigrator(db, sqlbuilder.SQLite, validFiles).Up(context.TODO())
+
+		assert.ErrorContains(t, upErr, "unknown")
+	})
+
+	t.Run("WhenFileNameIsWrong_ThenError", func(t *testing.T) {
+		m := migrations.NewMigrator(newDB(t), sqlbuilder.SQLite, withFiles(validFiles, fstest.MapFS{
+			"add_item_price.sql": {Data: []byte("ALTER TABLE cartItem ADD COLUMN price integer;")},
+		}))
+
+		_, upErr := m.Up(context.TODO())
+
+		assert.ErrorContains(t, upErr, "add_item_price.sql")
+	})
+
+	t.Run("WhenOnlyDownFile_ThenError", func(t *testing.T) {
+		m := migrations.NewMigrator(newDB(t), sqlbuilder.SQLite, withFiles(validFiles, fstest.MapFS{
+			"0004_add_item_price.down.sql": {Data: []byte("ALTER TABLE cartItem DROP COLUMN price;")},
+		}))
+
+		_, upErr := m.Up(context.TODO())
+
+		assert.ErrorContains(t, upErr, "no up file")
+	})
+}
+
+func Test_Down_GivenMigrationFiles(t *testing.T) {
+	t.Run("WhenNothingApplied_ThenNothingToRollBackError", func(t *testing.T) {
+		m := migrations.NewMigrator(newDB(t), sqlbuilder.SQLite, validFiles)
+
+		_, downErr := m.Down(context.TODO())
+
+		assert.ErrorIs(t, downErr, migrations.ErrNothingToRollBack)
+	})
+
+	t.Run("WhenApplied_ThenOnlyTheLastOneIsRolledBack", func(t *testing.T) {
+		m := migrations.NewMigrator(newDB(t), sqlbuilder.SQLite, validFiles)
+		_, upErr := m.Up(context.TODO())
+		require.NoError(t, upErr)
+
+		rolledBack, downErr := m.Down(context.TODO())
+
+		assert.NoError(t, downErr)
+		assert.Equal(t, int64(3), rolledBack.Version)
+		assert.Equal(t, []int64{1, 2}, appliedVersions(t, m))
+	})
+
+	t.Run("WhenRolledBackAndUpAgain_ThenItIsAppliedAgain", func(t *testing.T) {
+		m := migrations.NewMigrator(newDB(t), sqlbuilder.SQLite, validFiles)
+		_, upErr := m.Up(context.TODO())
+		require.NoError(t, upErr)
+		_, downErr := m.Down(context.TODO())
+		require.NoError(t, downErr)
+
+		applied, upErr := m.Up(context.TODO())
+
+		assert.NoError(t, upErr)
+		assert.Equal(t, []int64{3}, versions(applied))
+	})
+
+	t.Run("WhenNoDownFile_ThenError", func(t *testing.T) {
+		m := migrations.NewMigrator(newDB(t), sqlbuilder.SQLite, withFiles(validFiles, fstest.MapFS{
+			"0004_add_item_price.up.sql": {Data: []byte("ALTER TABLE cartItem ADD COLUMN price integer;")},
+		}))
+		_, upErr := m.Up(context.TODO())
+		require.NoError(t, upErr)
+
+		_, downErr := m.Down(context.TODO())
+
+		assert.ErrorContains(t, downErr, "no down file")
+		assert.Equal(t, []int64{1, 2, 3, 4}, appliedVersions(t, m))
+	})
+}
+
+func Test_Status_GivenMigrationFiles(t *testing.T) {
+	db := newDB(t)
+	_, upErr := migrations.NewMigrator(db, sqlbuilder.SQLite, withFiles(validFiles, fstest.MapFS{
+		"0005_add_item_price.up.sql": {Data: []byte("ALTER TABLE cartItem ADD COLUMN price integer;")},
+	})).Up(context.TODO())
+	require.NoError(t, upErr)
+
+	statuses, statusErr := migrations.NewMigrator(db, sqlbuilder.SQLite, withFiles(validFiles, fstest.MapFS{
+		"0004_add_item_color.up.sql": {Data: []byte("ALTER TABLE cartItem ADD COLUMN color varchar(10);")},
+	})).Status(context.TODO())
+
+	require.NoError(t, statusErr)
+	require.Len(t, statuses, 5)
+	// Pending migrations have no AppliedAt. Applied migrations unknown to the app are listed as well
+	for i, want := range []struct {
+		version int64
+		name    string
+		applied bool
+	}{
+		{1, "create_carts", true},
+		{2, "add_item_name", true},
+		{3, "add_item_quantity", true},
+		{4, "add_item_color", false},
+		{5, "add_item_price", true},
+	} {
+		assert.Equal(t, want.version, statuses[i].Version)
+		assert.Equal(t, want.name, statuses[i].Name)
+		assert.Equal(t, want.applied, statuses[i].AppliedAt != nil, "version %d", want.version)
+	}
+}
+
+// Migrations are only run against a real database for sqlite. At least, the files of every repository must be valid
+func Test_EmbeddedMigrations_GivenRepositories(t *testing.T) {
+	tests := []struct {
+		name     string
+		migrator *migrations.Migrator
+	}{
+		{name: "WhenMySQL_ThenConsecutiveAndReversible", migrator: mysql.NewMigrator(nil)},
+		{name: "WhenPostgres_ThenConsecutiveAndReversible", migrator: postgres.NewMigrator(nil)},
+		{name: "WhenSQLite_ThenConsecutiveAndReversible", migrator: sqlite.NewMigrator(nil)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			migrationList, loadErr := tc.migrator.Migrations()
+
+			require.NoError(t, loadErr)
+			require.NotEmpty(t, migrationList)
+			for i, migration := range migrationList {
+				assert.Equal(t, int64(i+1), migration.Version)
+				assert.NotEmpty(t, migration.Down, "migration %d_%s", migration.Version, migration.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+const (
+	apiKeyTable = "api_key"
+)
+
+var (
+	apiKeyColumns = []string{"id", "name", "keyHash", "scopes", "createdAt", "revokedAt"}
+)
+
+type APIKeysRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeysRepository(db *sql.DB) *APIKeysRepository {
+	return &APIKeysRepository{db: db}
+}
+
+// The columns must be selected in the apiKeyColumns order
+func scanAPIKey(scanner interface{ Scan(dest ...any) error }) (model.APIKey, error) {
+	var key model.APIKey
+	var scopes string
+	var revokedAt sql.NullTime
+	if scanErr := scanner.Scan(&key.Id, &key.Name, &key.Hash, &scopes, &key.CreatedAt, &revokedAt); scanErr != nil {
+		return model.APIKey{}, scanErr
+	}
+
+	parsed, parseErr := model.ParseAPIKeyScopes(scopes)
+	if parseErr != nil {
+		return model.APIKey{}, fmt.Errorf("stored scopes of api key %s --> %w", key.Id, parseErr)
+	}
+	key.Scopes = parsed
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
+func (akr *APIKeysRepository) Create(ctx context.Context, key model.APIKey) error {
+	ib := sqlbuilder.MySQL.NewInsertBuilder()
+	ib.InsertInto(apiKeyTable).
+		Cols("id", "name", "keyHash", "scopes", "createdAt").
+		Values(key.Id, key.Name, key.Hash, model.FormatAPIKeyScopes(key.Scopes), key.CreatedAt.UTC())
+
+	query, args := ib.Build()
+	if _, insertErr := akr.db.ExecContext(ctx, query, args...); insertErr != nil {
+		return fmt.Errorf("inserting api key --> %w", insertErr)
+	}
+	return nil
+}
+
+func (akr *APIKeysRepository) GetByHash(ctx context.Context, hash string) (model.APIKey, error) {
+	sb := sqlbuilder.MySQL.NewSelectBuilder()
+	sb.Select(apiKeyColumns...).
+		From(apiKeyTable).
+		Where(sb.Equal("keyHash", hash))
+
+	query, args := sb.Build()
+	key, scanErr := scanAPIKey(akr.db.QueryRowContext(ctx, query, args...))
+	if errors.Is(scanErr, sql.ErrNoRows) {
+		return model.APIKey{}, fmt.Errorf("api key by hash --> %w", model.ErrAPIKeyNotFound)
+	}
+	if scanErr != nil {
+		return model.APIKey{}, fmt.Errorf("reading api key --> %w", scanErr)
+	}
+	return key, nil
+}
+
+func (akr *APIKeysRepository) List(ctx context.Context) ([]model.APIKey, error) {
+	sb := sqlbuilder.MySQL.NewSelectBuilder()
+	sb.Select(apiKeyColumns...).
+		From(apiKeyTable).
+		OrderBy("createdAt", "id")
+
+	query, args := sb.Build()
+	rows, selectErr := akr.db.QueryContext(ctx, query, args...)
+	if selectErr != nil {
+		return nil, fmt.Errorf("listing api keys --> %w", selectErr)
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		key, scanErr := scanAPIKey(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("scanning api keys --> %w", scanErr)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Only keys that are not revoked yet are updated, so the first revocation date is kept
+func (akr *APIKeysRepository) Revoke(ctx context.Context, id string, revokedAt time.Time) error {
+	ub := sqlbuilder.MySQL.NewUpdateBuilder()
+	ub.Update(apiKeyTable).
+		Set(ub.Assign("revokedAt", revokedAt.UTC())).
+		Where(ub.Equal("id", id), ub.IsNull("revokedAt"))
+
+	query, args := ub.Build()
+	result, updateErr := akr.db.ExecContext(ctx, query, args...)
+	if updateErr != nil {
+		return fmt.Errorf("revoking api key --> %w", updateErr)
+	}
+	rowsAffected, rowsErr := result.RowsAffected()
+	if rowsErr != nil {
+		return fmt.Errorf("cannot check rows affected when revoking api key --> %w", rowsErr)
+	}
+	if rowsAffected == 1 {
+		return nil
+	}
+
+	// Either already revoked or unknown
+	sb := sqlbuilder.MySQL.NewSelectBuilder()
+	sb.Select("id").
+		From(apiKeyTable).
+		Where(sb.Equal("id", id))
+
+	selectQuery, selectArgs := sb.Build()
+	var found string
+	scanErr := akr.db.QueryRowContext(ctx, selectQuery, selectArgs...).Scan(&found)
+	if errors.Is(scanErr, sql.ErrNoRows) {
+		return fmt.Errorf("api key %s --> %w", id, model.ErrAPIKeyNotFound)
+	}
+	if scanErr != nil {
+		return fmt.Errorf("reading api key --> %w", scanErr)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClaimCartEvents_GivenInitializedOutbox(t *testing.T) {
+	claimQuery := "SELECT id, payload, attempts, createdAt FROM cart_event_outbox " +
+		"WHERE status = ? AND nextAttemptAt <= ? AND (claimedUntil IS NULL OR claimedUntil < ?) ORDER BY id LIMIT 2 FOR UPDATE SKIP LOCKED"
+	leaseQuery := "UPDATE cart_event_outbox SET claimedUntil = ?, attempts = attempts + 1 WHERE id IN (?)"
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiredAt := createdAt.Add(time.Hour)
+	payload := `{"cartId":"` + cartId + `","ownerId":"alice","items":[{"id":"1","name":"screen","quantity":2,"reservationId":"","reservedQuantity":0}],` +
+		`"createdAt":"2024-01-01T00:00:00Z","updatedAt":"2024-01-01T00:00:00Z","expiredAt":"2024-01-01T01:00:00Z"}`
+
+	type want struct {
+		err    bool
+		events []model.CartEvent
+	}
+
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		want  want
+	}{
+		{
+			name: "WhenClaimAndSelectError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(claimQuery).
+					WithArgs("pending", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:    true,
+				events: []model.CartEvent{},
+			},
+		}, {
+			name: "WhenClaimAndPayloadIsNotValid_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(claimQuery).
+					WithArgs("pending", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(cartEventColumns).AddRow(1, "{", 0, createdAt))
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:    true,
+				events: []model.CartEvent{},
+			},
+		}, {
+			name: "WhenClaimAndLeaseError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(claimQuery).
+					WithArgs("pending", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(cartEventColumns).AddRow(1, payload, 0, createdAt))
+				m.sql.
+					ExpectExec(leaseQuery).
+					WithArgs(sqlmock.AnyArg(), int64(1)).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:    true,
+				events: []model.CartEvent{},
+			},
+		}, {
+			name: "WhenClaimAndOK_ThenEventsReturnedWithTheNewAttempt",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(claimQuery).
+					WithArgs("pending", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(cartEventColumns).AddRow(1, payload, 2, createdAt))
+				m.sql.
+					ExpectExec(leaseQuery).
+					WithArgs(sqlmock.AnyArg(), int64(1)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				err: false,
+				events: []model.CartEvent{
+					{
+						Id: 1,
+						Cart: model.AbandonedCart{
+							CartId:    cartId,
+							OwnerId:   "alice",
+							Items:     []model.CartItem{{Id: "1", Name: "screen", Quantity: 2}},
+							CreatedAt: createdAt,
+							UpdatedAt: createdAt,
+							ExpiredAt: expiredAt,
+						},
+						Attempts:  3,
+						CreatedAt: createdAt,
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			o := NewCartEventsOutbox(db)
+
+			events, claimErr := o.Claim(context.TODO(), 2, time.Minute)
+
+			assert.Equal(t, tc.want.err, claimErr != nil)
+			assert.Equal(t, tc.want.events, events)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_UpdateCartEvents_GivenInitializedOutbox(t *testing.T) {
+	doneQuery := "UPDATE cart_event_outbox SET status = ?, claimedUntil = ? WHERE id = ?"
+	retryQuery := "UPDATE cart_event_outbox SET nextAttemptAt = ?, claimedUntil = ?, lastError = ? WHERE id = ?"
+	deadQuery := "UPDATE cart_event_outbox SET status = ?, claimedUntil = ?, lastError = ? WHERE id = ?"
+	deleteDoneQuery := "DELETE FROM cart_event_outbox WHERE status = ?"
+	eventId := int64(7)
+
+	tests := []struct {
+		name    string
+		mocks   func(m CartItemRepoMocks)
+		call    func(o *CartEventsOutbox) error
+		wantErr error
+	}{
+		{
+			name: "WhenMarkDoneAndOK_ThenOK",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(doneQuery).
+					WithArgs("done", nil, eventId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(o *CartEventsOutbox) error {
+				return o.MarkDone(context.TODO(), eventId)
+			},
+			wantErr: nil,
+		}, {
+			name: "WhenMarkDoneAndEventNotFound_ThenNotFoundError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(doneQuery).
+					WithArgs("done", nil, eventId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			call: func(o *CartEventsOutbox) error {
+				return o.MarkDone(context.TODO(), eventId)
+			},
+			wantErr: model.ErrCartEventNotFound,
+		}, {
+			name: "WhenRetryAndUpdateError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(retryQuery).
+					WithArgs(sqlmock.AnyArg(), nil, "webhook down", eventId).
+					WillReturnError(randomError)
+			},
+			call: func(o *CartEventsOutbox) error {
+				return o.Retry(context.TODO(), eventId, time.Now(), "webhook down")
+			},
+			wantErr: randomError,
+		}, {
+			name: "WhenMarkDeadAndOK_ThenOK",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(deadQuery).
+					WithArgs("dead", nil, "webhook down", eventId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(o *CartEventsOutbox) error {
+				return o.MarkDead(context.TODO(), eventId, "webhook down")
+			},
+			wantErr: nil,
+		}, {
+			name: "WhenDeleteDoneAndOK_ThenOnlyPublishedEventsAreDeleted",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(deleteDoneQuery).
+					WithArgs("done").
+					WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+			call: func(o *CartEventsOutbox) error {
+				_, deleteErr := o.DeleteDone(context.TODO())
+				return deleteErr
+			},
+			wantErr: nil,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			updateErr := tc.call(NewCartEventsOutbox(db))
+
+			assert.ErrorIs(t, updateErr, tc.wantErr)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
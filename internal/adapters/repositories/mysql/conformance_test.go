@@ -0,0 +1,58 @@
+package mysql
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/repositorytest"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+)
+
+// Needs a real database with the schema already created, so it only runs when the dsn is given. I.E.
+// SHOPPING_CART_TEST_MYSQL_DSN="root:root@tcp(127.0.0.1:45478)/shoppingCart?parseTime=true&clientFoundRows=true"
+func openTestDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("SHOPPING_CART_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("SHOPPING_CART_TEST_MYSQL_DSN not set")
+	}
+
+	db, openErr := sql.Open("mysql", dsn)
+	if openErr != nil {
+		t.Fatalf("Error when opening the database: %v", openErr)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func Test_CartItemsRepository_Conformance(t *testing.T) {
+	db := openTestDB(t)
+
+	repositorytest.Run(t, func(t *testing.T) (ports.CartItemsRepository, ports.ReservationOutbox) {
+		return NewCartItemsRepository(db), NewReservationOutbox(db)
+	})
+}
+
+func Test_CartEventsOutbox_Conformance(t *testing.T) {
+	db := openTestDB(t)
+
+	repositorytest.RunCartEvents(t, func(t *testing.T) (ports.CartItemsRepository, ports.CartEventsOutbox) {
+		return NewCartItemsRepository(db), NewCartEventsOutbox(db)
+	})
+}
+
+func Test_IdempotencyKeysRepository_Conformance(t *testing.T) {
+	db := openTestDB(t)
+
+	repositorytest.RunIdempotencyKeys(t, func(t *testing.T) ports.IdempotencyKeysRepository {
+		return NewIdempotencyKeysRepository(db)
+	})
+}
+
+func Test_APIKeysRepository_Conformance(t *testing.T) {
+	db := openTestDB(t)
+
+	repositorytest.RunAPIKeys(t, func(t *testing.T) ports.APIKeysRepository {
+		return NewAPIKeysRepository(db)
+	})
+}
@@ -0,0 +1,189 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClaimIdempotencyKey_GivenInitializedRepository(t *testing.T) {
+	deleteExpiredQuery := "DELETE FROM idempotency_key WHERE idempotencyKey = ? AND expiresAt <= ?"
+	insertQuery := "INSERT IGNORE INTO idempotency_key (idempotencyKey, requestHash, expiresAt) VALUES (?, ?, ?)"
+	selectQuery := "SELECT requestHash, statusCode, headers, body, expiresAt FROM idempotency_key WHERE idempotencyKey = ?"
+	recordColumns := []string{"requestHash", "statusCode", "headers", "body", "expiresAt"}
+
+	key := "8e0f4a9c-5d1e-4c55-a3c4-3f2ab1f1d6a7"
+	expiresAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	record := model.IdempotencyRecord{Key: key, RequestHash: "hash", ExpiresAt: expiresAt}
+
+	type want struct {
+		err     error
+		anyErr  bool
+		claimed bool
+		stored  model.IdempotencyRecord
+	}
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		want  want
+	}{
+		{
+			name: "WhenDeleteExpiredFails_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(deleteExpiredQuery).
+					WithArgs(key, sqlmock.AnyArg()).
+					WillReturnError(randomError)
+			},
+			want: want{
+				anyErr: true,
+			},
+		}, {
+			name: "WhenKeyInserted_ThenClaimed",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(deleteExpiredQuery).
+					WithArgs(key, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.sql.ExpectExec(insertQuery).
+					WithArgs(key, "hash", expiresAt).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			want: want{
+				claimed: true,
+				stored:  record,
+			},
+		}, {
+			name: "WhenKeyTakenAndDone_ThenStoredResponseIsReturned",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(deleteExpiredQuery).
+					WithArgs(key, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.sql.ExpectExec(insertQuery).
+					WithArgs(key, "hash", expiresAt).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.sql.ExpectQuery(selectQuery).
+					WithArgs(key).
+					WillReturnRows(sqlmock.NewRows(recordColumns).
+						AddRow("hash", 202, `{"ETag":"\"1\""}`, []byte{}, expiresAt))
+			},
+			want: want{
+				claimed: false,
+				stored: model.IdempotencyRecord{Key: key, RequestHash: "hash", ExpiresAt: expiresAt,
+					Response: &model.IdempotentResponse{StatusCode: 202, Headers: map[string]string{"ETag": `"1"`}, Body: []byte{}}},
+			},
+		}, {
+			name: "WhenKeyTakenAndInProgress_ThenStoredRecordIsReturned",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(deleteExpiredQuery).
+					WithArgs(key, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.sql.ExpectExec(insertQuery).
+					WithArgs(key, "hash", expiresAt).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.sql.ExpectQuery(selectQuery).
+					WithArgs(key).
+					WillReturnRows(sqlmock.NewRows(recordColumns).
+						AddRow("other hash", nil, nil, nil, expiresAt))
+			},
+			want: want{
+				claimed: false,
+				stored:  model.IdempotencyRecord{Key: key, RequestHash: "other hash", ExpiresAt: expiresAt},
+			},
+		}, {
+			name: "WhenKeyReleasedWhileBeingClaimed_ThenInProgressError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(deleteExpiredQuery).
+					WithArgs(key, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.sql.ExpectExec(insertQuery).
+					WithArgs(key, "hash", expiresAt).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.sql.ExpectQuery(selectQuery).
+					WithArgs(key).
+					WillReturnError(sql.ErrNoRows)
+			},
+			want: want{
+				err: model.ErrIdempotencyKeyInProgress,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			repo := NewIdempotencyKeysRepository(db)
+
+			stored, claimed, claimErr := repo.Claim(context.TODO(), record)
+
+			switch {
+			case tc.want.err != nil:
+				assert.ErrorIs(t, claimErr, tc.want.err)
+			case tc.want.anyErr:
+				assert.Error(t, claimErr)
+			default:
+				assert.NoError(t, claimErr)
+				assert.Equal(t, tc.want.stored, stored)
+			}
+			assert.Equal(t, tc.want.claimed, claimed)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_CompleteIdempotencyKey_GivenInitializedRepository(t *testing.T) {
+	updateQuery := "UPDATE idempotency_key SET statusCode = ?, headers = ?, body = ?, expiresAt = ? WHERE idempotencyKey = ?"
+	key := "8e0f4a9c-5d1e-4c55-a3c4-3f2ab1f1d6a7"
+	response := model.IdempotentResponse{StatusCode: 202, Headers: map[string]string{"ETag": `"1"`}, Body: []byte{}}
+
+	tests := []struct {
+		name    string
+		mocks   func(m CartItemRepoMocks)
+		wantErr bool
+	}{
+		{
+			name: "WhenKeyNotFound_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(updateQuery).
+					WithArgs(202, `{"ETag":"\"1\""}`, []byte{}, sqlmock.AnyArg(), key).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: true,
+		}, {
+			name: "WhenKeyClaimed_ThenResponseIsStored",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(updateQuery).
+					WithArgs(202, `{"ETag":"\"1\""}`, []byte{}, sqlmock.AnyArg(), key).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantErr: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			completeErr := NewIdempotencyKeysRepository(db).Complete(context.TODO(), key, response, time.Now().Add(time.Hour))
+
+			assert.Equal(t, tc.wantErr, completeErr != nil)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
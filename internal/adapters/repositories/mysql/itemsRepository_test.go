@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/Harital/shopping-cart/internal/core/model"
@@ -11,7 +12,14 @@ import (
 )
 
 const (
-	cartItemsGetQuery = "SELECT id, name, quantity, reservationId FROM cartItem"
+	cartId             = "5b9a2ecf-0a37-4f4b-9c57-0d4d2e7e3a11"
+	outboxInsertQuery  = "INSERT INTO reservation_outbox (cartId, operation, itemId, itemName, quantity, reservationId, status, nextAttemptAt) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	pendingUpdateQuery = "UPDATE cartItem SET reservationStatus = ?, reservationUpdatedAt = ? WHERE cartId = ? AND id = ?"
+	cartItemsGetQuery  = "SELECT id, name, quantity, reservationId, reservedQuantity, reservationStatus, reservationError, reservationUpdatedAt FROM cartItem WHERE cartId = ?"
+	cartVersionQuery   = "SELECT version FROM cart WHERE id = ?"
+	versionBumpQuery   = "UPDATE cart SET version = version + 1, updatedAt = ? WHERE id = ?"
+	// The client expects the cart to be at a given version
+	expectedVersionBumpQuery = "UPDATE cart SET version = version + 1, updatedAt = ? WHERE id = ? AND version = ?"
 )
 
 var (
@@ -24,12 +32,39 @@ type CartItemRepoMocks struct {
 	sql sqlmock.Sqlmock
 }
 
+func expectCartVersion(m CartItemRepoMocks, version int64) {
+	m.sql.
+		ExpectQuery(cartVersionQuery).
+		WithArgs(cartId).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+// Every change made by the clients increases the version of the cart, in the same transaction as the change
+func expectVersionBump(m CartItemRepoMocks, version int64) {
+	m.sql.
+		ExpectExec(versionBumpQuery).
+		WithArgs(sqlmock.AnyArg(), cartId).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectCartVersion(m, version)
+}
+
+// The cart is not at the expected version anymore, so nothing is updated
+func expectVersionConflict(m CartItemRepoMocks, expected int64, current int64) {
+	m.sql.
+		ExpectExec(expectedVersionBumpQuery).
+		WithArgs(sqlmock.AnyArg(), cartId, expected).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCartVersion(m, current)
+}
+
 // We use Gherkin notation for the tests
 func Test_GetCartItems_GivenInitializedRepository(t *testing.T) {
+	reservationUpdatedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 
 	type want struct {
-		err   error
-		items []model.CartItem
+		err     error
+		version int64
+		items   []model.CartItem
 	}
 
 	tests := []struct {
@@ -38,79 +73,120 @@ func Test_GetCartItems_GivenInitializedRepository(t *testing.T) {
 		want  want
 	}{
 		{
+			name: "WhenGetAndErrorInVersion_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectQuery(cartVersionQuery).
+					WithArgs(cartId).
+					WillReturnError(randomError)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
 			name: "WhenGetAndErrorInSelect_ThenError",
 			mocks: func(m CartItemRepoMocks) {
+				expectCartVersion(m, 3)
 				m.sql.
 					ExpectQuery(cartItemsGetQuery).
+					WithArgs(cartId).
 					WillReturnError(randomError)
 			},
 			want: want{
-				err:   randomError,
-				items: []model.CartItem{},
+				err: randomError,
 			},
 		}, {
 			name: "WhenGetAndErrorInScan_ThenError",
 			mocks: func(m CartItemRepoMocks) {
+				expectCartVersion(m, 3)
 				// We need to call NewRows in every test
 				m.sql.
 					ExpectQuery(cartItemsGetQuery).
+					WithArgs(cartId).
 					WillReturnRows(sqlmock.NewRows([]string{
-						"id", "name", "quantity", "reservationId",
+						"id", "name", "quantity", "reservationId", "reservedQuantity", "reservationStatus", "reservationError", "reservationUpdatedAt",
 					}).
-						AddRow("1", "pants", nil, "reservationId1"))
+						AddRow("1", "pants", nil, "reservationId1", 1, "pending", nil, nil))
 			},
 			want: want{
-				err:   randomError,
-				items: []model.CartItem{},
+				err: randomError,
 			},
 		}, {
 			name: "WhenGetAnd1ItemReturnWithoutReservationID_ThenOK",
 			mocks: func(m CartItemRepoMocks) {
+				expectCartVersion(m, 3)
 				m.sql.
 					ExpectQuery(cartItemsGetQuery).
+					WithArgs(cartId).
 					WillReturnRows(sqlmock.NewRows([]string{
-						"id", "name", "quantity", "reservationId",
+						"id", "name", "quantity", "reservationId", "reservedQuantity", "reservationStatus", "reservationError", "reservationUpdatedAt",
 					}).
-						AddRow("3", "pants", 1, nil))
+						AddRow("3", "pants", 1, nil, 0, "pending", nil, nil))
 			},
 			want: want{
-				err: nil,
+				err:     nil,
+				version: 3,
 				items: []model.CartItem{
-					{Id: "3", Name: "pants", Quantity: 1, ReservationId: ""},
+					{Id: "3", Name: "pants", Quantity: 1, ReservationId: "", ReservationStatus: model.ReservationPending},
 				},
 			},
 		}, {
 			name: "WhenGetAnd1ItemReturn_ThenOK",
 			mocks: func(m CartItemRepoMocks) {
+				expectCartVersion(m, 3)
 				m.sql.
 					ExpectQuery(cartItemsGetQuery).
+					WithArgs(cartId).
 					WillReturnRows(sqlmock.NewRows([]string{
-						"id", "name", "quantity", "reservationId",
+						"id", "name", "quantity", "reservationId", "reservedQuantity", "reservationStatus", "reservationError", "reservationUpdatedAt",
 					}).
-						AddRow("3", "pants", 1, "reservationId1"))
+						AddRow("3", "pants", 1, "reservationId1", 1, "reserved", nil, nil))
 			},
 			want: want{
-				err: nil,
+				err:     nil,
+				version: 3,
+				items: []model.CartItem{
+					{Id: "3", Name: "pants", Quantity: 1, ReservationId: "reservationId1", ReservedQuantity: 1, ReservationStatus: model.ReservationReserved},
+				},
+			},
+		}, {
+			name: "WhenGetAndReservationFailed_ThenErrorAndTimestampReturned",
+			mocks: func(m CartItemRepoMocks) {
+				expectCartVersion(m, 3)
+				m.sql.
+					ExpectQuery(cartItemsGetQuery).
+					WithArgs(cartId).
+					WillReturnRows(sqlmock.NewRows([]string{
+						"id", "name", "quantity", "reservationId", "reservedQuantity", "reservationStatus", "reservationError", "reservationUpdatedAt",
+					}).
+						AddRow("3", "pants", 1, nil, 0, "failed", "out of stock", reservationUpdatedAt))
+			},
+			want: want{
+				err:     nil,
+				version: 3,
 				items: []model.CartItem{
-					{Id: "3", Name: "pants", Quantity: 1, ReservationId: "reservationId1"},
+					{Id: "3", Name: "pants", Quantity: 1, ReservationStatus: model.ReservationFailed, ReservationError: "out of stock", ReservationUpdatedAt: &reservationUpdatedAt},
 				},
 			},
 		}, {
 			name: "WhenGetAndSeveralItemsReturn_ThenOK",
 			mocks: func(m CartItemRepoMocks) {
+				expectCartVersion(m, 3)
 				m.sql.
 					ExpectQuery(cartItemsGetQuery).
+					WithArgs(cartId).
 					WillReturnRows(sqlmock.NewRows([]string{
-						"id", "name", "quantity", "reservationId",
+						"id", "name", "quantity", "reservationId", "reservedQuantity", "reservationStatus", "reservationError", "reservationUpdatedAt",
 					}).
-						AddRow("12", "bottle", 10, "reservationId5").
-						AddRow("14", "shirt", 2, "reservationId2"))
+						AddRow("12", "bottle", 10, "reservationId5", 10, "reserved", nil, nil).
+						AddRow("14", "shirt", 2, "reservationId2", 1, "reserved", nil, nil))
 			},
 			want: want{
-				err: nil,
+				err:     nil,
+				version: 3,
 				items: []model.CartItem{
-					{Id: "12", Name: "bottle", Quantity: 10, ReservationId: "reservationId5"},
-					{Id: "14", Name: "shirt", Quantity: 2, ReservationId: "reservationId2"},
+					{Id: "12", Name: "bottle", Quantity: 10, ReservationId: "reservationId5", ReservedQuantity: 10, ReservationStatus: model.ReservationReserved},
+					{Id: "14", Name: "shirt", Quantity: 2, ReservationId: "reservationId2", ReservedQuantity: 1, ReservationStatus: model.ReservationReserved},
 				},
 			},
 		},
@@ -129,7 +205,7 @@ func Test_GetCartItems_GivenInitializedRepository(t *testing.T) {
 
 			r := NewCartItemsRepository(db)
 
-			items, getErr := r.Get(context.TODO())
+			cart, getErr := r.Get(context.TODO(), cartId)
 			if tc.want.err != nil {
 				// helps being agnostic with the error message, as it can change and wrongfully break the tests
 				// If an error comprobation is needed, assert.ErrorIs or ErrorAs can be used.
@@ -137,27 +213,35 @@ func Test_GetCartItems_GivenInitializedRepository(t *testing.T) {
 			} else {
 				assert.NoError(t, getErr)
 			}
-			assert.Equal(t, tc.want.items, items)
+			assert.Equal(t, tc.want.version, cart.Version)
+			assert.Equal(t, tc.want.items, cart.Items)
 		})
 
 	}
 }
 
 func Test_AddCartItems_GivenInitializedRepository(t *testing.T) {
-	insertQuery := `INSERT INTO cartItem (id, name, quantity) 
-		VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE quantity = quantity + ?`
+	insertCartQuery := `INSERT IGNORE INTO cart (id) VALUES (?)`
+	insertQuery := `INSERT INTO cartItem (cartId, id, name, quantity, updatedAt) 
+		VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE quantity = quantity + ?, updatedAt = VALUES(updatedAt)`
+	selectQuery := `SELECT id, name, quantity, reservationId, reservedQuantity, reservationStatus, reservationError, reservationUpdatedAt FROM cartItem WHERE cartId = ? AND id = ?`
 
 	randomCartItem := model.CartItem{
 		Id:       "1",
 		Name:     "screen",
 		Quantity: 2,
 	}
+	expectedVersion := int64(3)
 
 	type input struct {
-		item model.CartItem
+		item            model.CartItem
+		expectedVersion *int64
 	}
 	type want struct {
-		err error
+		err      error
+		conflict bool
+		item     model.CartItem
+		version  int64
 	}
 
 	tests := []struct {
@@ -167,32 +251,276 @@ func Test_AddCartItems_GivenInitializedRepository(t *testing.T) {
 		want  want
 	}{
 		{
+			name: "WhenAddItemAndBeginError_ThenError",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectBegin().
+					WillReturnError(randomError)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenAddItemAndCartInsertError_ThenError",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnError(errors.New("insert error"))
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
 			name: "WhenAddItemAndInsertError_ThenError",
 			in: input{
 				item: randomCartItem,
 			},
 			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectVersionBump(m, 1)
 				m.sql.
 					ExpectExec(insertQuery).
-					WithArgs(randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, randomCartItem.Quantity).
+					WithArgs(cartId, randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, sqlmock.AnyArg(), randomCartItem.Quantity).
 					WillReturnError(errors.New("insert error"))
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenAddItemAndCommitError_ThenError",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectVersionBump(m, 1)
+				m.sql.
+					ExpectExec(insertQuery).
+					WithArgs(cartId, randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, sqlmock.AnyArg(), randomCartItem.Quantity).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, randomCartItem.Id).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 2, nil, 0, "pending", nil, nil))
+				m.sql.
+					ExpectExec(pendingUpdateQuery).
+					WithArgs("pending", sqlmock.AnyArg(), cartId, "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectExec(outboxInsertQuery).
+					WithArgs(cartId, "reserve", "1", "screen", 2, "", "pending", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				m.sql.
+					ExpectCommit().
+					WillReturnError(randomError)
 			},
 			want: want{
 				err: randomError,
 			},
 		}, {
-			name: "WhenAddItemAndInsertOK_ThenOK",
+			name: "WhenAddItemAndOutboxInsertError_ThenError",
 			in: input{
 				item: randomCartItem,
 			},
 			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectVersionBump(m, 1)
 				m.sql.
 					ExpectExec(insertQuery).
-					WithArgs(randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, randomCartItem.Quantity).
+					WithArgs(cartId, randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, sqlmock.AnyArg(), randomCartItem.Quantity).
 					WillReturnResult(sqlmock.NewResult(1, 1))
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, randomCartItem.Id).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 2, nil, 0, "pending", nil, nil))
+				m.sql.
+					ExpectExec(pendingUpdateQuery).
+					WithArgs("pending", sqlmock.AnyArg(), cartId, "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectExec(outboxInsertQuery).
+					WithArgs(cartId, "reserve", "1", "screen", 2, "", "pending", sqlmock.AnyArg()).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
 			},
 			want: want{
-				err: nil,
+				err:  randomError,
+				item: model.CartItem{},
+			},
+		}, {
+			name: "WhenAddItemAndOK_ThenReservationTaskIsWrittenInTheSameTransaction",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectVersionBump(m, 1)
+				m.sql.
+					ExpectExec(insertQuery).
+					WithArgs(cartId, randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, sqlmock.AnyArg(), randomCartItem.Quantity).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, randomCartItem.Id).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 2, nil, 0, "pending", nil, nil))
+				m.sql.
+					ExpectExec(pendingUpdateQuery).
+					WithArgs("pending", sqlmock.AnyArg(), cartId, "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectExec(outboxInsertQuery).
+					WithArgs(cartId, "reserve", "1", "screen", 2, "", "pending", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				err:     nil,
+				item:    model.CartItem{Id: "1", Name: "screen", Quantity: 2, ReservationStatus: model.ReservationPending},
+				version: 1,
+			},
+		}, {
+			name: "WhenAddItemAlreadyInCart_ThenMergedItemIsReturned",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectVersionBump(m, 1)
+				m.sql.
+					ExpectExec(insertQuery).
+					WithArgs(cartId, randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, sqlmock.AnyArg(), randomCartItem.Quantity).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, randomCartItem.Id).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 5, "reservationId1", 3, "reserved", nil, nil))
+				// The existing reservation is sent, so it can be adjusted
+				m.sql.
+					ExpectExec(pendingUpdateQuery).
+					WithArgs("pending", sqlmock.AnyArg(), cartId, "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectExec(outboxInsertQuery).
+					WithArgs(cartId, "reserve", "1", "screen", 5, "reservationId1", "pending", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				err:     nil,
+				item:    model.CartItem{Id: "1", Name: "screen", Quantity: 5, ReservationId: "reservationId1", ReservedQuantity: 3, ReservationStatus: model.ReservationPending},
+				version: 1,
+			},
+		}, {
+			name: "WhenAddItemAndMergedQuantityTooBig_ThenInvalidQuantityAndRollback",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectVersionBump(m, 1)
+				m.sql.
+					ExpectExec(insertQuery).
+					WithArgs(cartId, randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, sqlmock.AnyArg(), randomCartItem.Quantity).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, randomCartItem.Id).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 1001, "reservationId1", 999, "reserved", nil, nil))
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err: model.ErrInvalidQuantity,
+			},
+		}, {
+			name: "WhenAddItemAndCartChanged_ThenConflictAndNothingIsWritten",
+			in: input{
+				item:            randomCartItem,
+				expectedVersion: &expectedVersion,
+			},
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectVersionConflict(m, expectedVersion, 4)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:      randomError,
+				conflict: true,
+			},
+		}, {
+			name: "WhenAddItemAndCartAtExpectedVersion_ThenNewVersionIsReturned",
+			in: input{
+				item:            randomCartItem,
+				expectedVersion: &expectedVersion,
+			},
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.sql.
+					ExpectExec(expectedVersionBumpQuery).
+					WithArgs(sqlmock.AnyArg(), cartId, expectedVersion).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectCartVersion(m, expectedVersion+1)
+				m.sql.
+					ExpectExec(insertQuery).
+					WithArgs(cartId, randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, sqlmock.AnyArg(), randomCartItem.Quantity).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, randomCartItem.Id).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 2, "reservationId1", 2, "reserved", nil, nil))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				err:     nil,
+				item:    model.CartItem{Id: "1", Name: "screen", Quantity: 2, ReservationId: "reservationId1", ReservedQuantity: 2, ReservationStatus: model.ReservationReserved},
+				version: expectedVersion + 1,
 			},
 		},
 	}
@@ -209,20 +537,33 @@ func Test_AddCartItems_GivenInitializedRepository(t *testing.T) {
 
 			r := NewCartItemsRepository(db)
 
-			addErr := r.Add(context.TODO(), tc.in.item)
+			item, version, addErr := r.Add(context.TODO(), cartId, tc.in.item, tc.in.expectedVersion)
 
 			if tc.want.err != nil {
 				assert.Error(t, addErr)
 			} else {
 				assert.NoError(t, addErr)
 			}
+			if errors.Is(tc.want.err, model.ErrInvalidQuantity) {
+				assert.ErrorIs(t, addErr, model.ErrInvalidQuantity)
+			}
+			var conflict *model.VersionConflictError
+			assert.Equal(t, tc.want.conflict, errors.As(addErr, &conflict))
+			// The time when the reservation was requested is set by the repository
+			if item.ReservationStatus == model.ReservationPending {
+				assert.NotNil(t, item.ReservationUpdatedAt)
+				item.ReservationUpdatedAt = nil
+			}
+			assert.Equal(t, tc.want.item, item)
+			assert.Equal(t, tc.want.version, version)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
 		})
 	}
 
 }
 
 func Test_AddReserveationId_GivenInitializedRepository(t *testing.T) {
-	updateQuery := `UPDATE cartItem SET reservationID = ? WHERE id = ?`
+	updateQuery := `UPDATE cartItem SET reservationID = ?, reservedQuantity = ?, reservationStatus = ?, reservationError = ?, reservationUpdatedAt = ? WHERE cartId = ? AND id = ?`
 
 	randomCartItem := model.CartItem{
 		Id:       "1",
@@ -253,7 +594,7 @@ func Test_AddReserveationId_GivenInitializedRepository(t *testing.T) {
 			},
 			mocks: func(m CartItemRepoMocks) {
 				m.sql.ExpectExec(updateQuery).
-					WithArgs(randomReservationID, randomCartItem.Id).
+					WithArgs(randomReservationID, randomCartItem.Quantity, "reserved", nil, sqlmock.AnyArg(), cartId, randomCartItem.Id).
 					WillReturnError(errors.New("insert error"))
 			},
 			want: want{
@@ -267,7 +608,7 @@ func Test_AddReserveationId_GivenInitializedRepository(t *testing.T) {
 			},
 			mocks: func(m CartItemRepoMocks) {
 				m.sql.ExpectExec(updateQuery).
-					WithArgs(randomReservationID, randomCartItem.Id).
+					WithArgs(randomReservationID, randomCartItem.Quantity, "reserved", nil, sqlmock.AnyArg(), cartId, randomCartItem.Id).
 					WillReturnResult(sqlmock.NewResult(0, 0))
 			},
 			want: want{
@@ -281,7 +622,7 @@ func Test_AddReserveationId_GivenInitializedRepository(t *testing.T) {
 			},
 			mocks: func(m CartItemRepoMocks) {
 				m.sql.ExpectExec(updateQuery).
-					WithArgs(randomReservationID, randomCartItem.Id).
+					WithArgs(randomReservationID, randomCartItem.Quantity, "reserved", nil, sqlmock.AnyArg(), cartId, randomCartItem.Id).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 			want: want{
@@ -302,7 +643,7 @@ func Test_AddReserveationId_GivenInitializedRepository(t *testing.T) {
 
 			r := NewCartItemsRepository(db)
 
-			addErr := r.SetReservationId(context.TODO(), tc.in.item, tc.in.reservationId)
+			addErr := r.SetReservationId(context.TODO(), cartId, tc.in.item, tc.in.reservationId)
 
 			if tc.want.err != nil {
 				assert.Error(t, addErr)
@@ -312,3 +653,939 @@ func Test_AddReserveationId_GivenInitializedRepository(t *testing.T) {
 		})
 	}
 }
+
+func Test_SetReservationFailed_GivenInitializedRepository(t *testing.T) {
+	updateQuery := `UPDATE cartItem SET reservationStatus = ?, reservationError = ?, reservationUpdatedAt = ? WHERE cartId = ? AND id = ?`
+	itemId := "1"
+	reason := "out of stock"
+
+	type want struct {
+		err error
+	}
+
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		want  want
+	}{
+		{
+			name: "WhenSetReservationFailedAndErrorInQuery_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(updateQuery).
+					WithArgs("failed", reason, sqlmock.AnyArg(), cartId, itemId).
+					WillReturnError(randomError)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenSetReservationFailedAndNoRowsAffected_ThenNotFoundError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(updateQuery).
+					WithArgs("failed", reason, sqlmock.AnyArg(), cartId, itemId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			want: want{
+				err: model.ErrItemNotFound,
+			},
+		}, {
+			name: "WhenSetReservationFailedAndOK_ThenOK",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(updateQuery).
+					WithArgs("failed", reason, sqlmock.AnyArg(), cartId, itemId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			want: want{
+				err: nil,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			r := NewCartItemsRepository(db)
+
+			setErr := r.SetReservationFailed(context.TODO(), cartId, itemId, reason)
+
+			if tc.want.err == model.ErrItemNotFound {
+				assert.ErrorIs(t, setErr, model.ErrItemNotFound)
+			} else if tc.want.err != nil {
+				assert.Error(t, setErr)
+			} else {
+				assert.NoError(t, setErr)
+			}
+		})
+	}
+}
+
+func Test_SetReservationReleased_GivenInitializedRepository(t *testing.T) {
+	updateQuery := `UPDATE cartItem SET reservationID = ?, reservedQuantity = ?, reservationStatus = ?, reservationUpdatedAt = ? WHERE cartId = ? AND id = ? AND reservationID = ?`
+	itemId := "1"
+	reservationId := "reservationId1"
+
+	type want struct {
+		err error
+	}
+
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		want  want
+	}{
+		{
+			name: "WhenSetReservationReleasedAndErrorInQuery_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(updateQuery).
+					WithArgs(nil, 0, "released", sqlmock.AnyArg(), cartId, itemId, reservationId).
+					WillReturnError(randomError)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenSetReservationReleasedAndReservationAlreadyReplaced_ThenNotFoundError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(updateQuery).
+					WithArgs(nil, 0, "released", sqlmock.AnyArg(), cartId, itemId, reservationId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			want: want{
+				err: model.ErrItemNotFound,
+			},
+		}, {
+			name: "WhenSetReservationReleasedAndOK_ThenOK",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(updateQuery).
+					WithArgs(nil, 0, "released", sqlmock.AnyArg(), cartId, itemId, reservationId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			want: want{
+				err: nil,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			r := NewCartItemsRepository(db)
+
+			setErr := r.SetReservationReleased(context.TODO(), cartId, itemId, reservationId)
+
+			if tc.want.err == model.ErrItemNotFound {
+				assert.ErrorIs(t, setErr, model.ErrItemNotFound)
+			} else if tc.want.err != nil {
+				assert.Error(t, setErr)
+			} else {
+				assert.NoError(t, setErr)
+			}
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_RemoveCartItem_GivenInitializedRepository(t *testing.T) {
+	selectQuery := `SELECT id, name, quantity, reservationId, reservedQuantity, reservationStatus, reservationError, reservationUpdatedAt FROM cartItem WHERE cartId = ? AND id = ? FOR UPDATE`
+	deleteQuery := `DELETE FROM cartItem WHERE cartId = ? AND id = ?`
+	itemId := "1"
+	expectedVersion := int64(3)
+
+	type want struct {
+		err      error
+		conflict bool
+		item     model.CartItem
+		version  int64
+	}
+
+	tests := []struct {
+		name            string
+		expectedVersion *int64
+		mocks           func(m CartItemRepoMocks)
+		want            want
+	}{
+		{
+			name: "WhenRemoveAndBeginError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectBegin().
+					WillReturnError(randomError)
+			},
+			want: want{
+				err:  randomError,
+				item: model.CartItem{},
+			},
+		}, {
+			name: "WhenRemoveAndItemNotFound_ThenNotFoundError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns))
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:  model.ErrItemNotFound,
+				item: model.CartItem{},
+			},
+		}, {
+			name: "WhenRemoveAndSelectError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, itemId).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:  randomError,
+				item: model.CartItem{},
+			},
+		}, {
+			name: "WhenRemoveAndDeleteError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "pants", 2, "reservationId1", 2, "reserved", nil, nil))
+				m.sql.
+					ExpectExec(deleteQuery).
+					WithArgs(cartId, itemId).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:  randomError,
+				item: model.CartItem{},
+			},
+		}, {
+			name: "WhenRemoveItemWithoutReservationAndOK_ThenItemReturned",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "pants", 2, nil, 0, "pending", nil, nil))
+				m.sql.
+					ExpectExec(deleteQuery).
+					WithArgs(cartId, itemId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				err:     nil,
+				item:    model.CartItem{Id: "1", Name: "pants", Quantity: 2, ReservationStatus: model.ReservationPending},
+				version: 2,
+			},
+		}, {
+			name: "WhenRemoveReservedItemAndOutboxError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "pants", 2, "reservationId1", 2, "reserved", nil, nil))
+				m.sql.
+					ExpectExec(deleteQuery).
+					WithArgs(cartId, itemId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectExec(outboxInsertQuery).
+					WithArgs(cartId, "release", "1", "pants", 2, "reservationId1", "pending", sqlmock.AnyArg()).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:  randomError,
+				item: model.CartItem{},
+			},
+		}, {
+			name: "WhenRemoveReservedItemAndOK_ThenReleaseTaskIsWrittenInTheSameTransaction",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "pants", 2, "reservationId1", 2, "reserved", nil, nil))
+				m.sql.
+					ExpectExec(deleteQuery).
+					WithArgs(cartId, itemId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectExec(outboxInsertQuery).
+					WithArgs(cartId, "release", "1", "pants", 2, "reservationId1", "pending", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				err:     nil,
+				item:    model.CartItem{Id: "1", Name: "pants", Quantity: 2, ReservationId: "reservationId1", ReservedQuantity: 2, ReservationStatus: model.ReservationReserved},
+				version: 2,
+			},
+		}, {
+			name:            "WhenRemoveAndCartChanged_ThenConflictAndNothingIsRemoved",
+			expectedVersion: &expectedVersion,
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionConflict(m, expectedVersion, 4)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:      randomError,
+				conflict: true,
+			},
+		}, {
+			name:            "WhenRemoveFromUnknownCart_ThenNotFoundError",
+			expectedVersion: nil,
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(versionBumpQuery).
+					WithArgs(sqlmock.AnyArg(), cartId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.sql.
+					ExpectQuery(cartVersionQuery).
+					WithArgs(cartId).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}))
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err: model.ErrItemNotFound,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			r := NewCartItemsRepository(db)
+
+			item, version, removeErr := r.Remove(context.TODO(), cartId, itemId, tc.expectedVersion)
+
+			if tc.want.err == model.ErrItemNotFound {
+				assert.ErrorIs(t, removeErr, model.ErrItemNotFound)
+			} else if tc.want.err != nil {
+				assert.Error(t, removeErr)
+			} else {
+				assert.NoError(t, removeErr)
+			}
+			var conflict *model.VersionConflictError
+			assert.Equal(t, tc.want.conflict, errors.As(removeErr, &conflict))
+			assert.Equal(t, tc.want.item, item)
+			assert.Equal(t, tc.want.version, version)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_UpdateQuantity_GivenInitializedRepository(t *testing.T) {
+	updateQuery := `UPDATE cartItem SET quantity = ?, updatedAt = ? WHERE cartId = ? AND id = ?`
+	selectQuery := `SELECT id, name, quantity, reservationId, reservedQuantity, reservationStatus, reservationError, reservationUpdatedAt FROM cartItem WHERE cartId = ? AND id = ?`
+	itemId := "1"
+	quantity := 5
+	expectedVersion := int64(3)
+
+	type want struct {
+		err      error
+		conflict bool
+		item     model.CartItem
+		version  int64
+	}
+
+	tests := []struct {
+		name            string
+		expectedVersion *int64
+		mocks           func(m CartItemRepoMocks)
+		want            want
+	}{
+		{
+			name: "WhenUpdateQuantityAndBeginError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectBegin().
+					WillReturnError(randomError)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenUpdateQuantityAndErrorInQuery_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.ExpectExec(updateQuery).
+					WithArgs(quantity, sqlmock.AnyArg(), cartId, itemId).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenUpdateQuantityAndNoRowsAffected_ThenNotFoundError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.ExpectExec(updateQuery).
+					WithArgs(quantity, sqlmock.AnyArg(), cartId, itemId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err: model.ErrItemNotFound,
+			},
+		}, {
+			name: "WhenUpdateQuantityAndOK_ThenOK",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.ExpectExec(updateQuery).
+					WithArgs(quantity, sqlmock.AnyArg(), cartId, itemId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 5, "reservationId1", 3, "reserved", nil, nil))
+				m.sql.
+					ExpectExec(pendingUpdateQuery).
+					WithArgs("pending", sqlmock.AnyArg(), cartId, "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectExec(outboxInsertQuery).
+					WithArgs(cartId, "reserve", "1", "screen", 5, "reservationId1", "pending", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				err:     nil,
+				item:    model.CartItem{Id: "1", Name: "screen", Quantity: 5, ReservationId: "reservationId1", ReservedQuantity: 3, ReservationStatus: model.ReservationPending},
+				version: 2,
+			},
+		}, {
+			name: "WhenUpdateQuantityAndReservationCoversIt_ThenNoTaskIsWritten",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.ExpectExec(updateQuery).
+					WithArgs(quantity, sqlmock.AnyArg(), cartId, itemId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 5, "reservationId1", 5, "reserved", nil, nil))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				err:     nil,
+				item:    model.CartItem{Id: "1", Name: "screen", Quantity: 5, ReservationId: "reservationId1", ReservedQuantity: 5, ReservationStatus: model.ReservationReserved},
+				version: 2,
+			},
+		}, {
+			name:            "WhenUpdateQuantityAndCartChanged_ThenConflictAndNothingIsUpdated",
+			expectedVersion: &expectedVersion,
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionConflict(m, expectedVersion, 4)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:      randomError,
+				conflict: true,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			r := NewCartItemsRepository(db)
+
+			item, version, updateErr := r.UpdateQuantity(context.TODO(), cartId, itemId, quantity, tc.expectedVersion)
+
+			if tc.want.err == model.ErrItemNotFound {
+				assert.ErrorIs(t, updateErr, model.ErrItemNotFound)
+			} else if tc.want.err != nil {
+				assert.Error(t, updateErr)
+			} else {
+				assert.NoError(t, updateErr)
+			}
+			// The time when the reservation was requested is set by the repository
+			if item.ReservationStatus == model.ReservationPending {
+				assert.NotNil(t, item.ReservationUpdatedAt)
+				item.ReservationUpdatedAt = nil
+			}
+			var conflict *model.VersionConflictError
+			assert.Equal(t, tc.want.conflict, errors.As(updateErr, &conflict))
+			assert.Equal(t, tc.want.item, item)
+			assert.Equal(t, tc.want.version, version)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_GetCartItem_GivenInitializedRepository(t *testing.T) {
+	selectQuery := `SELECT id, name, quantity, reservationId, reservedQuantity, reservationStatus, reservationError, reservationUpdatedAt FROM cartItem WHERE cartId = ? AND id = ?`
+	itemId := "1"
+
+	type want struct {
+		err  error
+		item model.CartItem
+	}
+
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		want  want
+	}{
+		{
+			name: "WhenGetItemAndSelectError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, itemId).
+					WillReturnError(randomError)
+			},
+			want: want{
+				err:  randomError,
+				item: model.CartItem{},
+			},
+		}, {
+			name: "WhenGetItemAndNotFound_ThenNotFoundError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns))
+			},
+			want: want{
+				err:  model.ErrItemNotFound,
+				item: model.CartItem{},
+			},
+		}, {
+			name: "WhenGetItemAndOK_ThenItemReturned",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "pants", 2, "reservationId1", 2, "reserved", nil, nil))
+			},
+			want: want{
+				err:  nil,
+				item: model.CartItem{Id: "1", Name: "pants", Quantity: 2, ReservationId: "reservationId1", ReservedQuantity: 2, ReservationStatus: model.ReservationReserved},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			r := NewCartItemsRepository(db)
+
+			item, getErr := r.GetItem(context.TODO(), cartId, itemId)
+
+			if tc.want.err == model.ErrItemNotFound {
+				assert.ErrorIs(t, getErr, model.ErrItemNotFound)
+			} else if tc.want.err != nil {
+				assert.Error(t, getErr)
+			} else {
+				assert.NoError(t, getErr)
+			}
+			assert.Equal(t, tc.want.item, item)
+		})
+	}
+}
+
+func Test_ClaimCart_GivenInitializedRepository(t *testing.T) {
+	claimQuery := "INSERT INTO cart (id, ownerId) VALUES (?, ?) ON DUPLICATE KEY UPDATE ownerId = COALESCE(ownerId, VALUES(ownerId))"
+	ownerQuery := "SELECT ownerId FROM cart WHERE id = ?"
+
+	type want struct {
+		err   error
+		owner string
+	}
+
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		want  want
+	}{
+		{
+			name: "WhenClaimAndInsertError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectExec(claimQuery).
+					WithArgs(cartId, "alice").
+					WillReturnError(randomError)
+			},
+			want: want{err: randomError},
+		}, {
+			name: "WhenClaimCartOwnedBySomeoneElse_ThenTheOtherOwnerIsReturned",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectExec(claimQuery).
+					WithArgs(cartId, "alice").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.sql.
+					ExpectQuery(ownerQuery).
+					WithArgs(cartId).
+					WillReturnRows(sqlmock.NewRows([]string{"ownerId"}).AddRow("bob"))
+			},
+			want: want{owner: "bob"},
+		}, {
+			name: "WhenClaimAndOK_ThenCallerIsTheOwner",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectExec(claimQuery).
+					WithArgs(cartId, "alice").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectQuery(ownerQuery).
+					WithArgs(cartId).
+					WillReturnRows(sqlmock.NewRows([]string{"ownerId"}).AddRow("alice"))
+			},
+			want: want{owner: "alice"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			r := NewCartItemsRepository(db)
+
+			owner, claimErr := r.ClaimCart(context.TODO(), cartId, "alice")
+
+			assert.ErrorIs(t, claimErr, tc.want.err)
+			assert.Equal(t, tc.want.owner, owner)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_Merge_GivenInitializedRepository(t *testing.T) {
+	const guestCartId = "0d4d2e7e-0a37-4f4b-9c57-5b9a2ecf3a11"
+	guestQuery := "SELECT id FROM cart WHERE id = ? FOR UPDATE"
+	insertCartQuery := "INSERT IGNORE INTO cart (id) VALUES (?)"
+	itemForUpdateQuery := cartItemsGetQuery + " AND id = ? FOR UPDATE"
+	writeItemQuery := "INSERT INTO cartItem (cartId, id, name, quantity, reservationId, reservedQuantity, reservationStatus, reservationError, reservationUpdatedAt, updatedAt) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE quantity = VALUES(quantity), reservationId = VALUES(reservationId), " +
+		"reservedQuantity = VALUES(reservedQuantity), reservationStatus = VALUES(reservationStatus), " +
+		"reservationError = VALUES(reservationError), reservationUpdatedAt = VALUES(reservationUpdatedAt), updatedAt = VALUES(updatedAt)"
+	deleteGuestQuery := "DELETE FROM cart WHERE id = ?"
+	itemColumns := []string{"id", "name", "quantity", "reservationId", "reservedQuantity", "reservationStatus", "reservationError", "reservationUpdatedAt"}
+	reservedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	// A reserved mouse in the guest cart, which is not in the cart yet
+	expectGuestCart := func(m CartItemRepoMocks) {
+		m.sql.ExpectBegin()
+		m.sql.
+			ExpectQuery(guestQuery).
+			WithArgs(guestCartId).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(guestCartId))
+		m.sql.
+			ExpectQuery(cartItemsGetQuery).
+			WithArgs(guestCartId).
+			WillReturnRows(sqlmock.NewRows(itemColumns).AddRow("2", "mouse", 1, "reservation-3", 1, "reserved", nil, reservedAt))
+		m.sql.
+			ExpectExec(insertCartQuery).
+			WithArgs(cartId).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		expectVersionBump(m, 2)
+	}
+	movedMouse := model.CartItem{Id: "2", Name: "mouse", Quantity: 1, ReservationId: "reservation-3", ReservedQuantity: 1,
+		ReservationStatus: model.ReservationReserved, ReservationUpdatedAt: &reservedAt}
+
+	type want struct {
+		err  error
+		cart model.Cart
+	}
+
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		want  want
+	}{
+		{
+			name: "WhenGuestCartNotFound_ThenCartNotFoundAndRollback",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(guestQuery).
+					WithArgs(guestCartId).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				m.sql.ExpectRollback()
+			},
+			want: want{err: model.ErrCartNotFound},
+		}, {
+			name: "WhenErrorReadingGuestCart_ThenErrorAndRollback",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(guestQuery).
+					WithArgs(guestCartId).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{err: randomError},
+		}, {
+			name: "WhenErrorWritingItem_ThenErrorAndRollback",
+			mocks: func(m CartItemRepoMocks) {
+				expectGuestCart(m)
+				m.sql.
+					ExpectQuery(itemForUpdateQuery).
+					WithArgs(cartId, "2").
+					WillReturnRows(sqlmock.NewRows(itemColumns))
+				m.sql.
+					ExpectExec(writeItemQuery).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{err: randomError},
+		}, {
+			name: "WhenItemNotInCart_ThenItIsMovedWithItsReservationAndGuestCartIsDeleted",
+			mocks: func(m CartItemRepoMocks) {
+				expectGuestCart(m)
+				m.sql.
+					ExpectQuery(itemForUpdateQuery).
+					WithArgs(cartId, "2").
+					WillReturnRows(sqlmock.NewRows(itemColumns))
+				m.sql.
+					ExpectExec(writeItemQuery).
+					WithArgs(cartId, "2", "mouse", 1, "reservation-3", 1, "reserved", nil, reservedAt, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				// Already covered by its reservation, so nothing is written in the outbox
+				m.sql.
+					ExpectExec(deleteGuestQuery).
+					WithArgs(guestCartId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectQuery(cartItemsGetQuery).
+					WithArgs(cartId).
+					WillReturnRows(sqlmock.NewRows(itemColumns).AddRow("2", "mouse", 1, "reservation-3", 1, "reserved", nil, reservedAt))
+				m.sql.ExpectCommit()
+			},
+			want: want{cart: model.Cart{Version: 2, Items: []model.CartItem{movedMouse}}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			r := NewCartItemsRepository(db)
+
+			cart, mergeErr := r.Merge(context.TODO(), guestCartId, cartId, nil)
+
+			assert.ErrorIs(t, mergeErr, tc.want.err)
+			assert.Equal(t, tc.want.cart, cart)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_ExpireCarts_GivenInitializedRepository(t *testing.T) {
+	const otherCartId = "0d4d2e7e-0a37-4f4b-9c57-5b9a2ecf3a11"
+	selectQuery := "SELECT id, ownerId, createdAt, updatedAt FROM cart WHERE updatedAt < ? ORDER BY updatedAt LIMIT 10 FOR UPDATE SKIP LOCKED"
+	deleteQuery := "DELETE FROM cart WHERE id IN (?, ?)"
+	eventInsertQuery := "INSERT INTO cart_event_outbox (cartId, payload, status, nextAttemptAt) VALUES (?, ?, ?, ?)"
+	cartColumns := []string{"id", "ownerId", "createdAt", "updatedAt"}
+	itemColumns := []string{"id", "name", "quantity", "reservationId", "reservedQuantity", "reservationStatus", "reservationError", "reservationUpdatedAt"}
+
+	idleSince := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	createdAt := idleSince.Add(-2 * time.Hour)
+	updatedAt := idleSince.Add(-time.Hour)
+
+	expectCartItems := func(m CartItemRepoMocks) {
+		m.sql.ExpectBegin()
+		m.sql.
+			ExpectQuery(selectQuery).
+			WithArgs(idleSince).
+			WillReturnRows(sqlmock.NewRows(cartColumns).
+				AddRow(cartId, "alice", createdAt, updatedAt).
+				AddRow(otherCartId, nil, createdAt, updatedAt))
+		m.sql.
+			ExpectQuery(cartItemsGetQuery).
+			WithArgs(cartId).
+			WillReturnRows(sqlmock.NewRows(itemColumns).
+				AddRow("1", "screen", 2, "reservation-1", 2, "reserved", nil, nil).
+				AddRow("2", "mouse", 1, nil, 0, "pending", nil, nil))
+		// Only the reserved item has something to release
+		m.sql.
+			ExpectExec(outboxInsertQuery).
+			WithArgs(cartId, "release", "1", "screen", 2, "reservation-1", "pending", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	// The empty cart gets no event
+	expectIdleCarts := func(m CartItemRepoMocks) {
+		expectCartItems(m)
+		m.sql.
+			ExpectExec(eventInsertQuery).
+			WithArgs(cartId, sqlmock.AnyArg(), "pending", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		m.sql.
+			ExpectQuery(cartItemsGetQuery).
+			WithArgs(otherCartId).
+			WillReturnRows(sqlmock.NewRows(itemColumns))
+	}
+
+	type want struct {
+		err   error
+		carts []model.AbandonedCart
+	}
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		want  want
+	}{
+		{
+			name: "WhenNoIdleCarts_ThenNothingIsDeleted",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(idleSince).
+					WillReturnRows(sqlmock.NewRows(cartColumns))
+				m.sql.ExpectRollback()
+			},
+			want: want{carts: nil},
+		}, {
+			name: "WhenErrorSelectingCarts_ThenErrorAndRollback",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(idleSince).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{err: randomError},
+		}, {
+			name: "WhenErrorWritingEvent_ThenErrorAndRollback",
+			mocks: func(m CartItemRepoMocks) {
+				expectCartItems(m)
+				m.sql.
+					ExpectExec(eventInsertQuery).
+					WithArgs(cartId, sqlmock.AnyArg(), "pending", sqlmock.AnyArg()).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{err: randomError},
+		}, {
+			name: "WhenErrorDeletingCarts_ThenErrorAndRollback",
+			mocks: func(m CartItemRepoMocks) {
+				expectIdleCarts(m)
+				m.sql.
+					ExpectExec(deleteQuery).
+					WithArgs(cartId, otherCartId).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{err: randomError},
+		}, {
+			name: "WhenIdleCarts_ThenTheyAreDeletedAndReservationsReleasedAndEventsWrittenInTheSameTransaction",
+			mocks: func(m CartItemRepoMocks) {
+				expectIdleCarts(m)
+				m.sql.
+					ExpectExec(deleteQuery).
+					WithArgs(cartId, otherCartId).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				m.sql.ExpectCommit()
+			},
+			want: want{carts: []model.AbandonedCart{
+				{CartId: cartId, OwnerId: "alice", CreatedAt: createdAt, UpdatedAt: updatedAt, Items: []model.CartItem{
+					{Id: "1", Name: "screen", Quantity: 2, ReservationId: "reservation-1", ReservedQuantity: 2, ReservationStatus: model.ReservationReserved},
+					{Id: "2", Name: "mouse", Quantity: 1, ReservationStatus: model.ReservationPending},
+				}},
+				{CartId: otherCartId, CreatedAt: createdAt, UpdatedAt: updatedAt},
+			}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			r := NewCartItemsRepository(db)
+
+			carts, expireErr := r.ExpireCarts(context.TODO(), idleSince, 10)
+
+			assert.ErrorIs(t, expireErr, tc.want.err)
+			// The expiration time is set by the repository, so it is only checked to be there
+			for i := range carts {
+				assert.False(t, carts[i].ExpiredAt.IsZero())
+				carts[i].ExpiredAt = time.Time{}
+			}
+			assert.Equal(t, tc.want.carts, carts)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package mysql
+
+import (
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/domainerr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Published through prometheus, so they can be read from the /metrics endpoint
+var queryMetrics = struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}{
+	duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "shopping_cart_mysql_query_duration_seconds",
+		Help:    "Time taken by the cart items repository operations, transaction included, by operation",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"}),
+	errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shopping_cart_mysql_query_errors_total",
+		Help: "Cart items repository operations failed, by operation",
+	}, []string{"operation"}),
+}
+
+func init() {
+	prometheus.MustRegister(queryMetrics.duration, queryMetrics.errors)
+}
+
+// Meant to be deferred at the beginning of the operation, with the error it returns.
+// Domain errors (I.E. item not found or version conflict) are answers to the client, not failures of the database,
+// so they are not counted
+func observeQuery(operation string, start time.Time, err *error) {
+	queryMetrics.duration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+
+	if *err == nil {
+		return
+	}
+	if _, isDomainErr := domainerr.As(*err); !isDomainErr {
+		queryMetrics.errors.WithLabelValues(operation).Inc()
+	}
+}
@@ -0,0 +1,86 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const cartItemGetQuery = "SELECT id, name, quantity, reservationId, reservedQuantity, reservationStatus, reservationError, reservationUpdatedAt FROM cartItem WHERE cartId = ? AND id = ?"
+
+// Number of observations of the histogram
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	var metric dto.Metric
+	require.NoError(t, observer.(prometheus.Histogram).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func Test_QueryMetrics_GivenInitializedRepository(t *testing.T) {
+	type want struct {
+		errors float64
+	}
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		want  want
+	}{
+		{
+			name: "WhenQueryFails_ThenErrorCounted",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectQuery(cartItemGetQuery).
+					WithArgs(cartId, "1").
+					WillReturnError(randomError)
+			},
+			want: want{errors: 1},
+		}, {
+			name: "WhenItemNotFound_ThenErrorNotCounted",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectQuery(cartItemGetQuery).
+					WithArgs(cartId, "1").
+					WillReturnRows(sqlmock.NewRows(cartItemColumns))
+			},
+			want: want{errors: 0},
+		}, {
+			name: "WhenQueryOK_ThenErrorNotCounted",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectQuery(cartItemGetQuery).
+					WithArgs(cartId, "1").
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "pants", 2, nil, 0, "pending", nil, nil))
+			},
+			want: want{errors: 0},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			// The metrics are global, so only the difference is checked
+			errorsBefore := testutil.ToFloat64(queryMetrics.errors.WithLabelValues("getItem"))
+			samplesBefore := sampleCount(t, queryMetrics.duration.WithLabelValues("getItem"))
+
+			r := NewCartItemsRepository(db)
+			_, _ = r.GetItem(context.TODO(), cartId, "1")
+
+			assert.Equal(t, errorsBefore+tc.want.errors, testutil.ToFloat64(queryMetrics.errors.WithLabelValues("getItem")))
+			assert.Equal(t, samplesBefore+1, sampleCount(t, queryMetrics.duration.WithLabelValues("getItem")))
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package mysql
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/migrations"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Every change of the schema ships as a new numbered migration in the migrations folder. Never edit an applied one
+func NewMigrator(db *sql.DB) *migrations.Migrator {
+	// The folder is embedded, so it is always there
+	files, _ := fs.Sub(migrationFiles, "migrations")
+	return migrations.NewMigrator(db, sqlbuilder.MySQL, files)
+}
@@ -0,0 +1,13 @@
+-- Same table as the one created by scripts/sql/databaseInitialization.sql before the migrations existed.
+-- IF NOT EXISTS, so the databases created by that script are migrated from here
+
+CREATE TABLE IF NOT EXISTS `cartItem` (
+  -- Id could be a uuid. Being an int leaves the value exposed to potential attackers, that can know how many items are, at least,
+  -- by looking at the id. A uuid makes this data more opaque. It is harder to index, though.
+  -- For simplicity, I´ve used an int. Name is a dangerous column for primary key as there could be several
+  -- items with the same name. Perhaps in the future, let´s say there are 2 jackets but with different color.
+  `id` int PRIMARY KEY,
+  `name` varchar(50),
+  `quantity` int,
+  `reservationId` varchar(50)
+);
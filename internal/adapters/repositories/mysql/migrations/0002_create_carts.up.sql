@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `cart` (
+  -- Cart ids are generated by the clients. Sized for a uuid, which is opaque and hard to guess
+  `id` varchar(36) PRIMARY KEY
+);
+
+-- There used to be a single cart. Its items are moved to the nil uuid cart, so they are not lost
+ALTER TABLE `cartItem` ADD COLUMN `cartId` varchar(36) NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000' FIRST;
+INSERT INTO `cart` (`id`) SELECT DISTINCT `cartId` FROM `cartItem`;
+ALTER TABLE `cartItem` ALTER COLUMN `cartId` DROP DEFAULT;
+
+-- The same item can be in several carts. Quantities are only merged within the same cart
+ALTER TABLE `cartItem`
+  DROP PRIMARY KEY,
+  ADD PRIMARY KEY (`cartId`, `id`),
+  ADD CONSTRAINT `cartItemCart` FOREIGN KEY (`cartId`) REFERENCES `cart` (`id`) ON DELETE CASCADE;
@@ -0,0 +1,3 @@
+-- Quantity covered by the reservation. If it differs from the quantity, the item needs to be reserved again.
+-- Existing items start at 0, so they are reserved again, with their reservation id, the next time they change
+ALTER TABLE `cartItem` ADD COLUMN `reservedQuantity` int NOT NULL DEFAULT 0;
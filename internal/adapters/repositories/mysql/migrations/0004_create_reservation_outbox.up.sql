@@ -0,0 +1,22 @@
+-- Transactional outbox for the calls to the reserver. Tasks are written in the same transaction as the cart changes
+-- and processed in background by the reservation dispatcher, so no reservation is lost if the service stops
+CREATE TABLE IF NOT EXISTS `reservation_outbox` (
+  `id` bigint AUTO_INCREMENT PRIMARY KEY,
+  `cartId` varchar(36) NOT NULL,
+  -- reserve or release
+  `operation` varchar(10) NOT NULL,
+  -- Snapshot of the item when the task was written. Releases need it, as the item is already deleted
+  `itemId` int NOT NULL,
+  `itemName` varchar(50) NOT NULL DEFAULT '',
+  `quantity` int NOT NULL,
+  `reservationId` varchar(50) NOT NULL DEFAULT '',
+  -- pending, done or dead
+  `status` varchar(10) NOT NULL,
+  `attempts` int NOT NULL DEFAULT 0,
+  `nextAttemptAt` datetime(3) NOT NULL,
+  -- A claimed task is not handed out to any other dispatcher until the claim expires
+  `claimedUntil` datetime(3),
+  `lastError` varchar(255),
+  `createdAt` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  INDEX `pendingTasks` (`status`, `nextAttemptAt`)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE `cartItem`
+  DROP COLUMN `reservationUpdatedAt`,
+  DROP COLUMN `reservationStatus`,
+  DROP COLUMN `reservationError`;
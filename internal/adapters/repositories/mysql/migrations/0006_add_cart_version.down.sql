@@ -0,0 +1 @@
+ALTER TABLE `cart` DROP COLUMN `version`;
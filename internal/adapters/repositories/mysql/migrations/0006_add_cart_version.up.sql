@@ -0,0 +1,3 @@
+-- Increased by every change made by the clients, so concurrent changes of the same cart can be detected.
+-- Existing carts start at 0, same as the carts that do not exist yet
+ALTER TABLE `cart` ADD COLUMN `version` bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,14 @@
+-- Requests sent with an Idempotency-Key, so their retries get the same response instead of being applied again
+CREATE TABLE IF NOT EXISTS `idempotency_key` (
+  `idempotencyKey` varchar(255) PRIMARY KEY,
+  -- Tells apart a retry from another request sent with the same key
+  `requestHash` char(64) NOT NULL,
+  -- The response is null until the first request is done
+  `statusCode` int,
+  -- json object with the headers of the response
+  `headers` text,
+  `body` blob,
+  -- While the first request is in progress, the end of its lease. Then, the end of the TTL
+  `expiresAt` datetime(3) NOT NULL,
+  INDEX `expiredKeys` (`expiresAt`)
+);
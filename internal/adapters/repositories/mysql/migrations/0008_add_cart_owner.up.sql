@@ -0,0 +1,3 @@
+-- Subject of the user that owns the cart, taken from its token. Existing carts have no owner until someone
+-- adds an item to them
+ALTER TABLE `cart` ADD COLUMN `ownerId` varchar(255) NULL;
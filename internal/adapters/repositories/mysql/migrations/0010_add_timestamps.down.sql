@@ -0,0 +1,2 @@
+ALTER TABLE `cartItem` DROP COLUMN `createdAt`, DROP COLUMN `updatedAt`;
+ALTER TABLE `cart` DROP INDEX `idleCarts`, DROP COLUMN `createdAt`, DROP COLUMN `updatedAt`;
@@ -0,0 +1,12 @@
+-- Existing carts and items are taken as created and changed right now, so they get a whole TTL before expiring.
+-- Updated at is set by every change made by the clients, the same ones that increase the version of the cart.
+-- Reservation updates are not changes
+ALTER TABLE `cart`
+  ADD COLUMN `createdAt` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  ADD COLUMN `updatedAt` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  -- The sweeper looks for the carts not changed for a while
+  ADD INDEX `idleCarts` (`updatedAt`);
+
+ALTER TABLE `cartItem`
+  ADD COLUMN `createdAt` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  ADD COLUMN `updatedAt` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3);
@@ -0,0 +1,3 @@
+-- Longer keys would not fit, and they are only kept for a while anyway
+DELETE FROM `idempotency_key` WHERE CHAR_LENGTH(`idempotencyKey`) > 255;
+ALTER TABLE `idempotency_key` MODIFY `idempotencyKey` varchar(255) NOT NULL;
@@ -0,0 +1,17 @@
+-- Transactional outbox for the abandoned cart events. Events are written in the same transaction that deletes the
+-- carts and published in background by the cart events dispatcher, so no event is lost if the publisher is down
+CREATE TABLE IF NOT EXISTS `cart_event_outbox` (
+  `id` bigint AUTO_INCREMENT PRIMARY KEY,
+  `cartId` varchar(36) NOT NULL,
+  -- json of the abandoned cart, as it is published. The cart is already deleted
+  `payload` text NOT NULL,
+  -- pending, done or dead
+  `status` varchar(10) NOT NULL,
+  `attempts` int NOT NULL DEFAULT 0,
+  `nextAttemptAt` datetime(3) NOT NULL,
+  -- A claimed event is not handed out to any other dispatcher until the claim expires
+  `claimedUntil` datetime(3),
+  `lastError` varchar(255),
+  `createdAt` datetime(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  INDEX `pendingCartEvents` (`status`, `nextAttemptAt`)
+);
@@ -3,17 +3,35 @@ package mysql
 import (
 	"database/sql"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql" // Import MySQL driver anonymously in order to make it work
+	"net"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
-func InitMySqlDB() (*sql.DB, error) {
-	// All these values should be in a secret manarger storage. Hardcoded for simplicity
-	user := "shopping-cart-app"
-	password := "shoppingCartPassword!"
-	host := "shopping-cart-mysql"
-	port := 3306
-	dataBase := "shoppingCart"
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true", user, password, host, port, dataBase)
+type Config struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DataBase string
+}
+
+func InitMySqlDB(cfg Config) (*sql.DB, error) {
+	// The driver config escapes the password, so it can hold any character
+	driverCfg := mysql.NewConfig()
+	driverCfg.User = cfg.User
+	driverCfg.Passwd = cfg.Password
+	driverCfg.Net = "tcp"
+	driverCfg.Addr = net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	driverCfg.DBName = cfg.DataBase
+	driverCfg.ParseTime = true
+	// clientFoundRows makes the updates report the matched rows instead of the changed ones. Otherwise updating
+	// a value with the same one would look like a missing row
+	driverCfg.ClientFoundRows = true
+	dsn := driverCfg.FormatDSN()
 
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
@@ -25,5 +43,12 @@ func InitMySqlDB() (*sql.DB, error) {
 		return nil, err
 	}
 
+	// Open, in use and idle connections, waits for a free one, etc. are read from the pool on every scrape of /metrics
+	err = prometheus.Register(collectors.NewDBStatsCollector(db, cfg.DataBase))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("registering the connection pool metrics --> %w", err)
+	}
+
 	return db, nil
 }
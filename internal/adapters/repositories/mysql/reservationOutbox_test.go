@@ -0,0 +1,283 @@
+package mysql
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClaimTasks_GivenInitializedOutbox(t *testing.T) {
+	claimQuery := "SELECT id, cartId, operation, itemId, itemName, quantity, reservationId, attempts, createdAt FROM reservation_outbox " +
+		"WHERE status = ? AND nextAttemptAt <= ? AND (claimedUntil IS NULL OR claimedUntil < ?) ORDER BY id LIMIT 2 FOR UPDATE SKIP LOCKED"
+	leaseQuery := "UPDATE reservation_outbox SET claimedUntil = ?, attempts = attempts + 1 WHERE id IN (?, ?)"
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type want struct {
+		err   bool
+		tasks []model.ReservationTask
+	}
+
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		want  want
+	}{
+		{
+			name: "WhenClaimAndBeginError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin().WillReturnError(randomError)
+			},
+			want: want{
+				err:   true,
+				tasks: []model.ReservationTask{},
+			},
+		}, {
+			name: "WhenClaimAndSelectError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(claimQuery).
+					WithArgs("pending", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:   true,
+				tasks: []model.ReservationTask{},
+			},
+		}, {
+			name: "WhenClaimAndNoPendingTasks_ThenEmpty",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(claimQuery).
+					WithArgs("pending", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(reservationTaskColumns))
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:   false,
+				tasks: nil,
+			},
+		}, {
+			name: "WhenClaimAndLeaseError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(claimQuery).
+					WithArgs("pending", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(reservationTaskColumns).
+						AddRow(1, cartId, "reserve", "1", "screen", 2, "", 0, createdAt).
+						AddRow(2, cartId, "release", "2", "pants", 1, "reservationId2", 3, createdAt))
+				m.sql.
+					ExpectExec(leaseQuery).
+					WithArgs(sqlmock.AnyArg(), int64(1), int64(2)).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:   true,
+				tasks: []model.ReservationTask{},
+			},
+		}, {
+			name: "WhenClaimAndOK_ThenTasksReturnedWithTheNewAttempt",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(claimQuery).
+					WithArgs("pending", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(reservationTaskColumns).
+						AddRow(1, cartId, "reserve", "1", "screen", 2, "", 0, createdAt).
+						AddRow(2, cartId, "release", "2", "pants", 1, "reservationId2", 3, createdAt))
+				m.sql.
+					ExpectExec(leaseQuery).
+					WithArgs(sqlmock.AnyArg(), int64(1), int64(2)).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				err: false,
+				tasks: []model.ReservationTask{
+					{
+						Id:        1,
+						CartId:    cartId,
+						Operation: model.ReserveOperation,
+						Item:      model.CartItem{Id: "1", Name: "screen", Quantity: 2},
+						Attempts:  1,
+						CreatedAt: createdAt,
+					}, {
+						Id:        2,
+						CartId:    cartId,
+						Operation: model.ReleaseOperation,
+						Item:      model.CartItem{Id: "2", Name: "pants", Quantity: 1, ReservationId: "reservationId2"},
+						Attempts:  4,
+						CreatedAt: createdAt,
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			o := NewReservationOutbox(db)
+
+			tasks, claimErr := o.Claim(context.TODO(), 2, time.Minute)
+
+			assert.Equal(t, tc.want.err, claimErr != nil)
+			assert.Equal(t, tc.want.tasks, tasks)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_UpdateTasks_GivenInitializedOutbox(t *testing.T) {
+	doneQuery := "UPDATE reservation_outbox SET status = ?, claimedUntil = ? WHERE id = ?"
+	retryQuery := "UPDATE reservation_outbox SET nextAttemptAt = ?, claimedUntil = ?, lastError = ? WHERE id = ?"
+	deadQuery := "UPDATE reservation_outbox SET status = ?, claimedUntil = ?, lastError = ? WHERE id = ?"
+	deleteDoneQuery := "DELETE FROM reservation_outbox WHERE status = ?"
+	postponeQuery := "UPDATE reservation_outbox SET nextAttemptAt = ?, claimedUntil = ?, attempts = attempts - 1 WHERE id = ?"
+	taskId := int64(7)
+	longError := strings.Repeat("e", 300)
+	longMultiByteError := strings.Repeat("é", 300)
+
+	tests := []struct {
+		name    string
+		mocks   func(m CartItemRepoMocks)
+		call    func(o *ReservationOutbox) error
+		wantErr bool
+	}{
+		{
+			name: "WhenMarkDoneAndOK_ThenOK",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(doneQuery).
+					WithArgs("done", nil, taskId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(o *ReservationOutbox) error {
+				return o.MarkDone(context.TODO(), taskId)
+			},
+			wantErr: false,
+		}, {
+			name: "WhenMarkDoneAndTaskNotFound_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(doneQuery).
+					WithArgs("done", nil, taskId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			call: func(o *ReservationOutbox) error {
+				return o.MarkDone(context.TODO(), taskId)
+			},
+			wantErr: true,
+		}, {
+			name: "WhenRetryAndUpdateError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(retryQuery).
+					WithArgs(sqlmock.AnyArg(), nil, "reserver down", taskId).
+					WillReturnError(randomError)
+			},
+			call: func(o *ReservationOutbox) error {
+				return o.Retry(context.TODO(), taskId, time.Now(), "reserver down")
+			},
+			wantErr: true,
+		}, {
+			name: "WhenRetryAndOK_ThenOK",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(retryQuery).
+					WithArgs(sqlmock.AnyArg(), nil, "reserver down", taskId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(o *ReservationOutbox) error {
+				return o.Retry(context.TODO(), taskId, time.Now(), "reserver down")
+			},
+			wantErr: false,
+		}, {
+			name: "WhenPostponeAndOK_ThenAttemptIsGivenBack",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(postponeQuery).
+					WithArgs(sqlmock.AnyArg(), nil, taskId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(o *ReservationOutbox) error {
+				return o.Postpone(context.TODO(), taskId, time.Now())
+			},
+			wantErr: false,
+		}, {
+			name: "WhenMarkDeadWithLongError_ThenErrorIsTruncated",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(deadQuery).
+					WithArgs("dead", nil, longError[:maxLastErrorLength], taskId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(o *ReservationOutbox) error {
+				return o.MarkDead(context.TODO(), taskId, longError)
+			},
+			wantErr: false,
+		}, {
+			name: "WhenMarkDeadWithLongMultiByteError_ThenErrorIsTruncatedAtACharacterBoundary",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(deadQuery).
+					WithArgs("dead", nil, strings.Repeat("é", maxLastErrorLength), taskId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(o *ReservationOutbox) error {
+				return o.MarkDead(context.TODO(), taskId, longMultiByteError)
+			},
+			wantErr: false,
+		}, {
+			name: "WhenDeleteDoneAndError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(deleteDoneQuery).
+					WithArgs("done").
+					WillReturnError(randomError)
+			},
+			call: func(o *ReservationOutbox) error {
+				_, deleteErr := o.DeleteDone(context.TODO())
+				return deleteErr
+			},
+			wantErr: true,
+		}, {
+			name: "WhenDeleteDoneAndOK_ThenOnlyDoneTasksAreDeleted",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(deleteDoneQuery).
+					WithArgs("done").
+					WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+			call: func(o *ReservationOutbox) error {
+				_, deleteErr := o.DeleteDone(context.TODO())
+				return deleteErr
+			},
+			wantErr: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			updateErr := tc.call(NewReservationOutbox(db))
+
+			assert.Equal(t, tc.wantErr, updateErr != nil)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+const (
+	cartEventOutboxTable = "cart_event_outbox"
+)
+
+var (
+	cartEventColumns = []string{"id", "payload", "attempts", "createdAt"}
+)
+
+type CartEventsOutbox struct {
+	db *sql.DB
+}
+
+func NewCartEventsOutbox(db *sql.DB) *CartEventsOutbox {
+	return &CartEventsOutbox{db: db}
+}
+
+// Used by the CartItemsRepository in order to write the event in the same transaction that deletes the cart
+func insertCartEvent(ctx context.Context, tx *sql.Tx, event model.CartEvent) error {
+	payload, marshalErr := json.Marshal(event.Cart)
+	if marshalErr != nil {
+		return fmt.Errorf("encoding abandoned cart %s --> %w", event.Cart.CartId, marshalErr)
+	}
+
+	sb := sqlbuilder.PostgreSQL.NewInsertBuilder()
+	sb.
+		InsertInto(cartEventOutboxTable).
+		Cols("cartId", "payload", "status", "nextAttemptAt").
+		Values(event.Cart.CartId, string(payload), outboxStatusPending, time.Now().UTC())
+
+	query, args := sb.Build()
+	if _, insertErr := tx.ExecContext(ctx, query, args...); insertErr != nil {
+		return fmt.Errorf("writing abandoned cart %s in the outbox --> %w", event.Cart.CartId, insertErr)
+	}
+	return nil
+}
+
+func (ceo *CartEventsOutbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]model.CartEvent, error) {
+	tx, beginErr := ceo.db.BeginTx(ctx, nil)
+	if beginErr != nil {
+		return []model.CartEvent{}, fmt.Errorf("starting transaction for claiming cart events --> %w", beginErr)
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+
+	// SKIP LOCKED lets several dispatchers claim events at the same time without waiting for each other
+	sb := sqlbuilder.PostgreSQL.NewSelectBuilder()
+	sb.
+		Select(cartEventColumns...).
+		From(cartEventOutboxTable).
+		Where(
+			sb.Equal("status", outboxStatusPending),
+			sb.LessEqualThan("nextAttemptAt", now),
+			sb.Or(sb.IsNull("claimedUntil"), sb.LessThan("claimedUntil", now)),
+		).
+		OrderBy("id").
+		Limit(limit).
+		SQL("FOR UPDATE SKIP LOCKED")
+
+	query, args := sb.Build()
+	rows, selectErr := tx.QueryContext(ctx, query, args...)
+	if selectErr != nil {
+		return []model.CartEvent{}, fmt.Errorf("selecting pending cart events --> %w", selectErr)
+	}
+
+	var events []model.CartEvent
+	var eventIds []interface{}
+	for rows.Next() {
+		event, scanErr := scanCartEvent(rows)
+		if scanErr != nil {
+			rows.Close()
+			return []model.CartEvent{}, scanErr
+		}
+		// The claim below counts as a new attempt
+		event.Attempts++
+
+		events = append(events, event)
+		eventIds = append(eventIds, event.Id)
+	}
+	rows.Close()
+
+	if len(events) == 0 {
+		return events, nil
+	}
+
+	ub := sqlbuilder.PostgreSQL.NewUpdateBuilder()
+	ub.Update(cartEventOutboxTable).
+		Set(
+			ub.Assign("claimedUntil", now.Add(lease)),
+			ub.Incr("attempts"),
+		).
+		Where(ub.In("id", eventIds...))
+
+	updateQuery, updateArgs := ub.Build()
+	if _, updateErr := tx.ExecContext(ctx, updateQuery, updateArgs...); updateErr != nil {
+		return []model.CartEvent{}, fmt.Errorf("claiming pending cart events --> %w", updateErr)
+	}
+
+	if commitErr := tx.Commit(); commitErr != nil {
+		return []model.CartEvent{}, fmt.Errorf("committing cart event claims --> %w", commitErr)
+	}
+
+	return events, nil
+}
+
+func (ceo *CartEventsOutbox) MarkDone(ctx context.Context, eventId int64) error {
+	ub := sqlbuilder.PostgreSQL.NewUpdateBuilder()
+	ub.Update(cartEventOutboxTable).
+		Set(
+			ub.Assign("status", outboxStatusDone),
+			ub.Assign("claimedUntil", nil),
+		).
+		Where(ub.Equal("id", eventId))
+
+	return ceo.update(ctx, ub, eventId)
+}
+
+func (ceo *CartEventsOutbox) Retry(ctx context.Context, eventId int64, nextAttemptAt time.Time, lastErr string) error {
+	ub := sqlbuilder.PostgreSQL.NewUpdateBuilder()
+	ub.Update(cartEventOutboxTable).
+		Set(
+			ub.Assign("nextAttemptAt", nextAttemptAt.UTC()),
+			ub.Assign("claimedUntil", nil),
+			ub.Assign("lastError", truncate(lastErr, maxLastErrorLength)),
+		).
+		Where(ub.Equal("id", eventId))
+
+	return ceo.update(ctx, ub, eventId)
+}
+
+func (ceo *CartEventsOutbox) MarkDead(ctx context.Context, eventId int64, lastErr string) error {
+	ub := sqlbuilder.PostgreSQL.NewUpdateBuilder()
+	ub.Update(cartEventOutboxTable).
+		Set(
+			ub.Assign("status", outboxStatusDead),
+			ub.Assign("claimedUntil", nil),
+			ub.Assign("lastError", truncate(lastErr, maxLastErrorLength)),
+		).
+		Where(ub.Equal("id", eventId))
+
+	return ceo.update(ctx, ub, eventId)
+}
+
+// Published events are not needed anymore. Dead ones are kept, as they are meant to be inspected
+func (ceo *CartEventsOutbox) DeleteDone(ctx context.Context) (int64, error) {
+	db := sqlbuilder.PostgreSQL.NewDeleteBuilder()
+	db.DeleteFrom(cartEventOutboxTable).
+		Where(db.Equal("status", outboxStatusDone))
+
+	query, args := db.Build()
+	result, deleteErr := ceo.db.ExecContext(ctx, query, args...)
+	if deleteErr != nil {
+		return 0, fmt.Errorf("deleting published cart events --> %w", deleteErr)
+	}
+	deleted, rowsErr := result.RowsAffected()
+	if rowsErr != nil {
+		return 0, fmt.Errorf("cannot check rows affected when deleting published cart events --> %w", rowsErr)
+	}
+	return deleted, nil
+}
+
+func (ceo *CartEventsOutbox) update(ctx context.Context, ub *sqlbuilder.UpdateBuilder, eventId int64) error {
+	query, args := ub.Build()
+	result, updateErr := ceo.db.ExecContext(ctx, query, args...)
+	if updateErr != nil {
+		return fmt.Errorf("cannot update cart event %d --> %w", eventId, updateErr)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot check rows affected when updating cart event %d --> %w", eventId, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("cart event %d --> %w", eventId, model.ErrCartEventNotFound)
+	}
+	return nil
+}
+
+func scanCartEvent(rows *sql.Rows) (model.CartEvent, error) {
+	var event model.CartEvent
+	var payload string
+	if scanErr := rows.Scan(&event.Id, &payload, &event.Attempts, &event.CreatedAt); scanErr != nil {
+		return model.CartEvent{}, fmt.Errorf("scanning pending cart events --> %w", scanErr)
+	}
+	if unmarshalErr := json.Unmarshal([]byte(payload), &event.Cart); unmarshalErr != nil {
+		return model.CartEvent{}, fmt.Errorf("decoding cart event %d --> %w", event.Id, unmarshalErr)
+	}
+	return event, nil
+}
@@ -0,0 +1,156 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+const (
+	idempotencyKeyTable = "idempotency_key"
+)
+
+type IdempotencyKeysRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyKeysRepository(db *sql.DB) *IdempotencyKeysRepository {
+	return &IdempotencyKeysRepository{db: db}
+}
+
+// The key is taken by inserting it, so only one of several concurrent requests gets it. An expired record of the
+// key is deleted beforehand, so the key can be taken again
+func (ikr *IdempotencyKeysRepository) Claim(ctx context.Context, record model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+	db := sqlbuilder.PostgreSQL.NewDeleteBuilder()
+	db.DeleteFrom(idempotencyKeyTable).
+		Where(
+			db.Equal("idempotencyKey", record.Key),
+			db.LessEqualThan("expiresAt", time.Now().UTC()),
+		)
+
+	deleteQuery, deleteArgs := db.Build()
+	if _, deleteErr := ikr.db.ExecContext(ctx, deleteQuery, deleteArgs...); deleteErr != nil {
+		return model.IdempotencyRecord{}, false, fmt.Errorf("deleting expired idempotency key --> %w", deleteErr)
+	}
+
+	ib := sqlbuilder.PostgreSQL.NewInsertBuilder()
+	ib.InsertIgnoreInto(idempotencyKeyTable).
+		Cols("idempotencyKey", "requestHash", "expiresAt").
+		Values(record.Key, record.RequestHash, record.ExpiresAt.UTC())
+
+	insertQuery, insertArgs := ib.Build()
+	result, insertErr := ikr.db.ExecContext(ctx, insertQuery, insertArgs...)
+	if insertErr != nil {
+		return model.IdempotencyRecord{}, false, fmt.Errorf("inserting idempotency key --> %w", insertErr)
+	}
+	rowsAffected, rowsErr := result.RowsAffected()
+	if rowsErr != nil {
+		return model.IdempotencyRecord{}, false, fmt.Errorf("cannot check rows affected when inserting idempotency key --> %w", rowsErr)
+	}
+	if rowsAffected == 1 {
+		return record, true, nil
+	}
+
+	stored, getErr := ikr.get(ctx, record.Key)
+	// The first request failed and released the key in the meantime
+	if errors.Is(getErr, sql.ErrNoRows) {
+		return model.IdempotencyRecord{}, false, fmt.Errorf("idempotency key %s released while being claimed --> %w",
+			record.Key, model.ErrIdempotencyKeyInProgress)
+	}
+	if getErr != nil {
+		return model.IdempotencyRecord{}, false, fmt.Errorf("reading idempotency key --> %w", getErr)
+	}
+	return stored, false, nil
+}
+
+func (ikr *IdempotencyKeysRepository) get(ctx context.Context, key string) (model.IdempotencyRecord, error) {
+	sb := sqlbuilder.PostgreSQL.NewSelectBuilder()
+	sb.Select("requestHash", "statusCode", "headers", "body", "expiresAt").
+		From(idempotencyKeyTable).
+		Where(sb.Equal("idempotencyKey", key))
+
+	query, args := sb.Build()
+	record := model.IdempotencyRecord{Key: key}
+	// The response columns are null until the first request is done
+	var statusCode sql.NullInt64
+	var headers sql.NullString
+	var body []byte
+	if scanErr := ikr.db.QueryRowContext(ctx, query, args...).
+		Scan(&record.RequestHash, &statusCode, &headers, &body, &record.ExpiresAt); scanErr != nil {
+		return model.IdempotencyRecord{}, scanErr
+	}
+
+	if statusCode.Valid {
+		record.Response = &model.IdempotentResponse{StatusCode: int(statusCode.Int64), Body: body}
+		if unmarshalErr := json.Unmarshal([]byte(headers.String), &record.Response.Headers); unmarshalErr != nil {
+			return model.IdempotencyRecord{}, fmt.Errorf("decoding stored headers --> %w", unmarshalErr)
+		}
+	}
+	return record, nil
+}
+
+func (ikr *IdempotencyKeysRepository) Complete(ctx context.Context, key string, response model.IdempotentResponse, expiresAt time.Time) error {
+	headers, marshalErr := json.Marshal(response.Headers)
+	if marshalErr != nil {
+		return fmt.Errorf("encoding headers --> %w", marshalErr)
+	}
+
+	ub := sqlbuilder.PostgreSQL.NewUpdateBuilder()
+	ub.Update(idempotencyKeyTable).
+		Set(
+			ub.Assign("statusCode", response.StatusCode),
+			ub.Assign("headers", string(headers)),
+			ub.Assign("body", response.Body),
+			ub.Assign("expiresAt", expiresAt.UTC()),
+		).
+		Where(ub.Equal("idempotencyKey", key))
+
+	query, args := ub.Build()
+	result, updateErr := ikr.db.ExecContext(ctx, query, args...)
+	if updateErr != nil {
+		return fmt.Errorf("storing response --> %w", updateErr)
+	}
+	rowsAffected, rowsErr := result.RowsAffected()
+	if rowsErr != nil {
+		return fmt.Errorf("cannot check rows affected when storing response --> %w", rowsErr)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("idempotency key %s --> %w", key, model.ErrIdempotencyKeyNotFound)
+	}
+	return nil
+}
+
+func (ikr *IdempotencyKeysRepository) Delete(ctx context.Context, key string) error {
+	db := sqlbuilder.PostgreSQL.NewDeleteBuilder()
+	db.DeleteFrom(idempotencyKeyTable).
+		Where(db.Equal("idempotencyKey", key))
+
+	query, args := db.Build()
+	if _, deleteErr := ikr.db.ExecContext(ctx, query, args...); deleteErr != nil {
+		return fmt.Errorf("deleting idempotency key --> %w", deleteErr)
+	}
+	return nil
+}
+
+func (ikr *IdempotencyKeysRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	db := sqlbuilder.PostgreSQL.NewDeleteBuilder()
+	db.DeleteFrom(idempotencyKeyTable).
+		Where(db.LessEqualThan("expiresAt", time.Now().UTC()))
+
+	query, args := db.Build()
+	result, deleteErr := ikr.db.ExecContext(ctx, query, args...)
+	if deleteErr != nil {
+		return 0, fmt.Errorf("deleting expired idempotency keys --> %w", deleteErr)
+	}
+	deleted, rowsErr := result.RowsAffected()
+	if rowsErr != nil {
+		return 0, fmt.Errorf("cannot check rows affected when deleting expired idempotency keys --> %w", rowsErr)
+	}
+	return deleted, nil
+}
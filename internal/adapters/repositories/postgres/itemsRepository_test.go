@@ -0,0 +1,643 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	cartId             = "5b9a2ecf-0a37-4f4b-9c57-0d4d2e7e3a11"
+	outboxInsertQuery  = "INSERT INTO reservation_outbox (cartId, operation, itemId, itemName, quantity, reservationId, status, nextAttemptAt) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	pendingUpdateQuery = "UPDATE cartItem SET reservationStatus = $1, reservationUpdatedAt = $2 WHERE cartId = $3 AND id = $4"
+	returningColumns   = "RETURNING id, name, quantity, reservationId, reservedQuantity, reservationStatus, reservationError, reservationUpdatedAt"
+	cartVersionQuery   = "SELECT version FROM cart WHERE id = $1"
+	versionBumpQuery   = "UPDATE cart SET version = version + 1, updatedAt = $1 WHERE id = $2 RETURNING version"
+	// The client expects the cart to be at a given version
+	expectedVersionBumpQuery = "UPDATE cart SET version = version + 1, updatedAt = $1 WHERE id = $2 AND version = $3 RETURNING version"
+)
+
+var (
+	randomError = errors.New("random error")
+)
+
+type CartItemRepoMocks struct {
+	sql sqlmock.Sqlmock
+}
+
+func newRepoMocks(t *testing.T) (*CartItemsRepository, CartItemRepoMocks) {
+	db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Error when creating the mock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return NewCartItemsRepository(db), CartItemRepoMocks{sql: dbMock}
+}
+
+func expectCartVersion(m CartItemRepoMocks, version int64) {
+	m.sql.
+		ExpectQuery(cartVersionQuery).
+		WithArgs(cartId).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+// Every change made by the clients increases the version of the cart, in the same transaction as the change
+func expectVersionBump(m CartItemRepoMocks, version int64) {
+	m.sql.
+		ExpectQuery(versionBumpQuery).
+		WithArgs(sqlmock.AnyArg(), cartId).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+// The cart is not at the expected version anymore, so nothing is returned. The current version is read for the error
+func expectVersionConflict(m CartItemRepoMocks, expected int64, current int64) {
+	m.sql.
+		ExpectQuery(expectedVersionBumpQuery).
+		WithArgs(sqlmock.AnyArg(), cartId, expected).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	expectCartVersion(m, current)
+}
+
+// We use Gherkin notation for the tests
+func Test_GetCartItems_GivenInitializedRepository(t *testing.T) {
+	selectQuery := "SELECT id, name, quantity, reservationId, reservedQuantity, reservationStatus, reservationError, reservationUpdatedAt FROM cartItem WHERE cartId = $1"
+	reservationUpdatedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type want struct {
+		err     error
+		version int64
+		items   []model.CartItem
+	}
+
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		want  want
+	}{
+		{
+			name: "WhenGetAndErrorInSelect_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				expectCartVersion(m, 3)
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId).
+					WillReturnError(randomError)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenGetAndItemsReturned_ThenOK",
+			mocks: func(m CartItemRepoMocks) {
+				expectCartVersion(m, 3)
+				m.sql.
+					ExpectQuery(selectQuery).
+					WithArgs(cartId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("3", "pants", 1, "reservationId1", 1, "reserved", nil, nil).
+						AddRow("4", "shirt", 2, nil, 0, "failed", "out of stock", reservationUpdatedAt))
+			},
+			want: want{
+				err:     nil,
+				version: 3,
+				items: []model.CartItem{
+					{Id: "3", Name: "pants", Quantity: 1, ReservationId: "reservationId1", ReservedQuantity: 1, ReservationStatus: model.ReservationReserved},
+					{Id: "4", Name: "shirt", Quantity: 2, ReservationStatus: model.ReservationFailed, ReservationError: "out of stock",
+						ReservationUpdatedAt: &reservationUpdatedAt},
+				},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, m := newRepoMocks(t)
+			tc.mocks(m)
+
+			cart, getErr := r.Get(context.TODO(), cartId)
+
+			if tc.want.err != nil {
+				assert.Error(t, getErr)
+			} else {
+				assert.NoError(t, getErr)
+			}
+			assert.Equal(t, tc.want.version, cart.Version)
+			assert.Equal(t, tc.want.items, cart.Items)
+			assert.NoError(t, m.sql.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_AddCartItems_GivenInitializedRepository(t *testing.T) {
+	insertCartQuery := `INSERT INTO cart (id) VALUES ($1) ON CONFLICT DO NOTHING`
+	upsertQuery := `INSERT INTO cartItem (cartId, id, name, quantity, updatedAt) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (cartId, id) DO UPDATE SET quantity = cartItem.quantity + EXCLUDED.quantity, updatedAt = EXCLUDED.updatedAt ` + returningColumns
+
+	randomCartItem := model.CartItem{
+		Id:       "1",
+		Name:     "screen",
+		Quantity: 2,
+	}
+	expectedVersion := int64(3)
+
+	type want struct {
+		err      error
+		conflict bool
+		item     model.CartItem
+		version  int64
+	}
+
+	tests := []struct {
+		name            string
+		expectedVersion *int64
+		mocks           func(m CartItemRepoMocks)
+		want            want
+	}{
+		{
+			name: "WhenAddItemAndBeginError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectBegin().
+					WillReturnError(randomError)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenAddItemAndCartInsertError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenAddItemAndUpsertError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectVersionBump(m, 1)
+				m.sql.
+					ExpectQuery(upsertQuery).
+					WithArgs(cartId, randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, sqlmock.AnyArg()).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenAddItemAndOutboxInsertError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectVersionBump(m, 1)
+				m.sql.
+					ExpectQuery(upsertQuery).
+					WithArgs(cartId, randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 2, nil, 0, "pending", nil, nil))
+				m.sql.
+					ExpectExec(pendingUpdateQuery).
+					WithArgs("pending", sqlmock.AnyArg(), cartId, "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectExec(outboxInsertQuery).
+					WithArgs(cartId, "reserve", "1", "screen", 2, "", "pending", sqlmock.AnyArg()).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenAddItemAndOK_ThenReservationTaskIsWrittenInTheSameTransaction",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectVersionBump(m, 1)
+				m.sql.
+					ExpectQuery(upsertQuery).
+					WithArgs(cartId, randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 2, nil, 0, "pending", nil, nil))
+				m.sql.
+					ExpectExec(pendingUpdateQuery).
+					WithArgs("pending", sqlmock.AnyArg(), cartId, "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectExec(outboxInsertQuery).
+					WithArgs(cartId, "reserve", "1", "screen", 2, "", "pending", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				err:     nil,
+				item:    model.CartItem{Id: "1", Name: "screen", Quantity: 2, ReservationStatus: model.ReservationPending},
+				version: 1,
+			},
+		}, {
+			name: "WhenAddItemAlreadyInCart_ThenMergedItemIsReturned",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectVersionBump(m, 1)
+				m.sql.
+					ExpectQuery(upsertQuery).
+					WithArgs(cartId, randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 5, "reservationId1", 3, "reserved", nil, nil))
+				// The existing reservation is sent, so it can be adjusted
+				m.sql.
+					ExpectExec(pendingUpdateQuery).
+					WithArgs("pending", sqlmock.AnyArg(), cartId, "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectExec(outboxInsertQuery).
+					WithArgs(cartId, "reserve", "1", "screen", 5, "reservationId1", "pending", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				err:     nil,
+				item:    model.CartItem{Id: "1", Name: "screen", Quantity: 5, ReservationId: "reservationId1", ReservedQuantity: 3, ReservationStatus: model.ReservationPending},
+				version: 1,
+			},
+		}, {
+			name: "WhenAddItemAndMergedQuantityTooBig_ThenInvalidQuantityAndRollback",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectVersionBump(m, 1)
+				m.sql.
+					ExpectQuery(upsertQuery).
+					WithArgs(cartId, randomCartItem.Id, randomCartItem.Name, randomCartItem.Quantity, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 1001, "reservationId1", 999, "reserved", nil, nil))
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err: model.ErrInvalidQuantity,
+			},
+		}, {
+			name:            "WhenAddItemAndCartChanged_ThenConflictAndNothingIsWritten",
+			expectedVersion: &expectedVersion,
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectExec(insertCartQuery).
+					WithArgs(cartId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectVersionConflict(m, expectedVersion, 4)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:      randomError,
+				conflict: true,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, m := newRepoMocks(t)
+			tc.mocks(m)
+
+			item, version, addErr := r.Add(context.TODO(), cartId, randomCartItem, tc.expectedVersion)
+
+			if tc.want.err != nil {
+				assert.Error(t, addErr)
+			} else {
+				assert.NoError(t, addErr)
+			}
+			if errors.Is(tc.want.err, model.ErrInvalidQuantity) {
+				assert.ErrorIs(t, addErr, model.ErrInvalidQuantity)
+			}
+			var conflict *model.VersionConflictError
+			assert.Equal(t, tc.want.conflict, errors.As(addErr, &conflict))
+			// The time when the reservation was requested is set by the repository
+			if item.ReservationStatus == model.ReservationPending {
+				assert.NotNil(t, item.ReservationUpdatedAt)
+				item.ReservationUpdatedAt = nil
+			}
+			assert.Equal(t, tc.want.item, item)
+			assert.Equal(t, tc.want.version, version)
+			assert.NoError(t, m.sql.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_SetReservation_GivenInitializedRepository(t *testing.T) {
+	reservedQuery := "UPDATE cartItem SET reservationId = $1, reservedQuantity = $2, reservationStatus = $3, reservationError = $4, " +
+		"reservationUpdatedAt = $5 WHERE cartId = $6 AND id = $7"
+	failedQuery := "UPDATE cartItem SET reservationStatus = $1, reservationError = $2, reservationUpdatedAt = $3 WHERE cartId = $4 AND id = $5"
+	releasedQuery := "UPDATE cartItem SET reservationId = $1, reservedQuantity = $2, reservationStatus = $3, reservationUpdatedAt = $4 " +
+		"WHERE cartId = $5 AND id = $6 AND reservationId = $7"
+	item := model.CartItem{Id: "1", Name: "screen", Quantity: 2}
+
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		set   func(r *CartItemsRepository) error
+		want  error
+	}{
+		{
+			name: "WhenSetReservationIdAndOK_ThenReservedWithTheItemQuantity",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectExec(reservedQuery).
+					WithArgs("reservationId1", 2, "reserved", nil, sqlmock.AnyArg(), cartId, "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			set: func(r *CartItemsRepository) error {
+				return r.SetReservationId(context.TODO(), cartId, item, "reservationId1")
+			},
+		}, {
+			name: "WhenSetReservationIdAndNoRowsAffected_ThenNotFoundError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectExec(reservedQuery).
+					WithArgs("reservationId1", 2, "reserved", nil, sqlmock.AnyArg(), cartId, "1").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			set: func(r *CartItemsRepository) error {
+				return r.SetReservationId(context.TODO(), cartId, item, "reservationId1")
+			},
+			want: model.ErrItemNotFound,
+		}, {
+			name: "WhenSetReservationFailedAndError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectExec(failedQuery).
+					WithArgs("failed", "out of stock", sqlmock.AnyArg(), cartId, "1").
+					WillReturnError(randomError)
+			},
+			set: func(r *CartItemsRepository) error {
+				return r.SetReservationFailed(context.TODO(), cartId, "1", "out of stock")
+			},
+			want: randomError,
+		}, {
+			name: "WhenSetReservationReleasedAndItemHoldsAnotherReservation_ThenNotFoundError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.
+					ExpectExec(releasedQuery).
+					WithArgs(nil, 0, "released", sqlmock.AnyArg(), cartId, "1", "reservationId1").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			set: func(r *CartItemsRepository) error {
+				return r.SetReservationReleased(context.TODO(), cartId, "1", "reservationId1")
+			},
+			want: model.ErrItemNotFound,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, m := newRepoMocks(t)
+			tc.mocks(m)
+
+			setErr := tc.set(r)
+
+			assert.ErrorIs(t, setErr, tc.want)
+			assert.NoError(t, m.sql.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_RemoveCartItem_GivenInitializedRepository(t *testing.T) {
+	deleteQuery := "DELETE FROM cartItem WHERE cartId = $1 AND id = $2 " + returningColumns
+	itemId := "1"
+	expectedVersion := int64(3)
+
+	type want struct {
+		err      error
+		conflict bool
+		item     model.CartItem
+		version  int64
+	}
+
+	tests := []struct {
+		name            string
+		expectedVersion *int64
+		mocks           func(m CartItemRepoMocks)
+		want            want
+	}{
+		{
+			name: "WhenRemoveAndItemNotInCart_ThenNotFoundError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.
+					ExpectQuery(deleteQuery).
+					WithArgs(cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns))
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err: model.ErrItemNotFound,
+			},
+		}, {
+			name: "WhenRemoveNotReservedItem_ThenNoReleaseTask",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.
+					ExpectQuery(deleteQuery).
+					WithArgs(cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 2, nil, 0, "pending", nil, nil))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				item:    model.CartItem{Id: "1", Name: "screen", Quantity: 2, ReservationStatus: model.ReservationPending},
+				version: 2,
+			},
+		}, {
+			name: "WhenRemoveReservedItem_ThenReleaseTaskIsWrittenInTheSameTransaction",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.
+					ExpectQuery(deleteQuery).
+					WithArgs(cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 2, "reservationId1", 2, "reserved", nil, nil))
+				m.sql.
+					ExpectExec(outboxInsertQuery).
+					WithArgs(cartId, "release", "1", "screen", 2, "reservationId1", "pending", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				item: model.CartItem{Id: "1", Name: "screen", Quantity: 2, ReservationId: "reservationId1", ReservedQuantity: 2,
+					ReservationStatus: model.ReservationReserved},
+				version: 2,
+			},
+		}, {
+			name:            "WhenRemoveAndCartChanged_ThenConflict",
+			expectedVersion: &expectedVersion,
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionConflict(m, expectedVersion, 4)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				conflict: true,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, m := newRepoMocks(t)
+			tc.mocks(m)
+
+			item, version, removeErr := r.Remove(context.TODO(), cartId, itemId, tc.expectedVersion)
+
+			var conflict *model.VersionConflictError
+			if tc.want.conflict {
+				assert.ErrorAs(t, removeErr, &conflict)
+			} else {
+				assert.ErrorIs(t, removeErr, tc.want.err)
+			}
+			assert.Equal(t, tc.want.item, item)
+			assert.Equal(t, tc.want.version, version)
+			assert.NoError(t, m.sql.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_UpdateQuantity_GivenInitializedRepository(t *testing.T) {
+	updateQuery := "UPDATE cartItem SET quantity = $1, updatedAt = $2 WHERE cartId = $3 AND id = $4 " + returningColumns
+	itemId := "1"
+	expectedVersion := int64(3)
+	quantity := 5
+
+	type want struct {
+		err      error
+		conflict bool
+		item     model.CartItem
+		version  int64
+	}
+
+	tests := []struct {
+		name            string
+		expectedVersion *int64
+		mocks           func(m CartItemRepoMocks)
+		want            want
+	}{
+		{
+			name: "WhenUpdateQuantityAndItemNotInCart_ThenNotFoundError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.
+					ExpectQuery(updateQuery).
+					WithArgs(quantity, sqlmock.AnyArg(), cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns))
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err: model.ErrItemNotFound,
+			},
+		}, {
+			name: "WhenUpdateQuantityCoveredByReservation_ThenNoReservationTask",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.
+					ExpectQuery(updateQuery).
+					WithArgs(quantity, sqlmock.AnyArg(), cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 5, "reservationId1", 5, "reserved", nil, nil))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				item: model.CartItem{Id: "1", Name: "screen", Quantity: 5, ReservationId: "reservationId1", ReservedQuantity: 5,
+					ReservationStatus: model.ReservationReserved},
+				version: 2,
+			},
+		}, {
+			name: "WhenUpdateQuantityNotCoveredByReservation_ThenReservationTaskIsWritten",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionBump(m, 2)
+				m.sql.
+					ExpectQuery(updateQuery).
+					WithArgs(quantity, sqlmock.AnyArg(), cartId, itemId).
+					WillReturnRows(sqlmock.NewRows(cartItemColumns).
+						AddRow("1", "screen", 5, "reservationId1", 2, "reserved", nil, nil))
+				m.sql.
+					ExpectExec(pendingUpdateQuery).
+					WithArgs("pending", sqlmock.AnyArg(), cartId, "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.sql.
+					ExpectExec(outboxInsertQuery).
+					WithArgs(cartId, "reserve", "1", "screen", 5, "reservationId1", "pending", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				item: model.CartItem{Id: "1", Name: "screen", Quantity: 5, ReservationId: "reservationId1", ReservedQuantity: 2,
+					ReservationStatus: model.ReservationPending},
+				version: 2,
+			},
+		}, {
+			name:            "WhenUpdateQuantityAndCartChanged_ThenConflict",
+			expectedVersion: &expectedVersion,
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				expectVersionConflict(m, expectedVersion, 4)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				conflict: true,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, m := newRepoMocks(t)
+			tc.mocks(m)
+
+			item, version, updateErr := r.UpdateQuantity(context.TODO(), cartId, itemId, quantity, tc.expectedVersion)
+
+			var conflict *model.VersionConflictError
+			if tc.want.conflict {
+				assert.ErrorAs(t, updateErr, &conflict)
+			} else {
+				assert.ErrorIs(t, updateErr, tc.want.err)
+			}
+			// The time when the reservation was requested is set by the repository
+			if item.ReservationStatus == model.ReservationPending {
+				assert.NotNil(t, item.ReservationUpdatedAt)
+				item.ReservationUpdatedAt = nil
+			}
+			assert.Equal(t, tc.want.item, item)
+			assert.Equal(t, tc.want.version, version)
+			assert.NoError(t, m.sql.ExpectationsWereMet())
+		})
+	}
+}
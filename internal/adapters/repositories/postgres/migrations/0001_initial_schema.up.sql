@@ -0,0 +1,10 @@
+-- Same table as the mysql one created by scripts/sql/databaseInitialization.sql before the migrations existed.
+-- Tables and columns are not quoted, so they are lower cased both here and in the queries of the app
+
+CREATE TABLE IF NOT EXISTS cartItem (
+  -- See the mysql migrations on why the id is an int
+  id integer PRIMARY KEY,
+  name varchar(50),
+  quantity integer,
+  reservationId varchar(50)
+);
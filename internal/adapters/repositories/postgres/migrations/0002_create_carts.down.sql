@@ -0,0 +1,8 @@
+ALTER TABLE cartItem DROP CONSTRAINT cartItemCart;
+-- Back to a single cart. The items of the other carts would collide with its ones
+DELETE FROM cartItem WHERE cartId <> '00000000-0000-0000-0000-000000000000';
+ALTER TABLE cartItem
+  DROP CONSTRAINT cartitem_pkey,
+  ADD PRIMARY KEY (id),
+  DROP COLUMN cartId;
+DROP TABLE IF EXISTS cart;
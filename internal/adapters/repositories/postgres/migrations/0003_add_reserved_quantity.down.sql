@@ -0,0 +1 @@
+ALTER TABLE cartItem DROP COLUMN reservedQuantity;
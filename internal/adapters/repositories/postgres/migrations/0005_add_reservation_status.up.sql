@@ -0,0 +1,9 @@
+ALTER TABLE cartItem
+  -- Reason given by the reserver when it could not reserve the item. Cleared once the item is reserved
+  ADD COLUMN reservationError varchar(255),
+  -- pending, reserved, failed or released. Exposed in the api, so the clients know how their items are doing
+  ADD COLUMN reservationStatus varchar(10) NOT NULL DEFAULT 'pending',
+  ADD COLUMN reservationUpdatedAt timestamp(3) with time zone;
+
+-- Items with a reservation id were already reserved
+UPDATE cartItem SET reservationStatus = 'reserved' WHERE reservationId IS NOT NULL AND reservationId <> '';
@@ -0,0 +1,12 @@
+-- Keys of the back office tools and services, which can use any cart within their scopes
+CREATE TABLE IF NOT EXISTS api_key (
+  id varchar(36) PRIMARY KEY,
+  name varchar(255) NOT NULL,
+  -- Sha256 of the key, hex encoded. The key itself is never stored
+  keyHash char(64) NOT NULL UNIQUE,
+  -- Comma separated, I.E. read,write
+  scopes varchar(255) NOT NULL,
+  createdAt timestamp(3) with time zone NOT NULL,
+  -- Revoked keys are kept, so they are still listed
+  revokedAt timestamp(3) with time zone
+);
@@ -0,0 +1,3 @@
+ALTER TABLE cartItem DROP COLUMN createdAt, DROP COLUMN updatedAt;
+DROP INDEX IF EXISTS idleCarts;
+ALTER TABLE cart DROP COLUMN createdAt, DROP COLUMN updatedAt;
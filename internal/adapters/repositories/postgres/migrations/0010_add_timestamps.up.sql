@@ -0,0 +1,13 @@
+-- Existing carts and items are taken as created and changed right now, so they get a whole TTL before expiring.
+-- Updated at is set by every change made by the clients, the same ones that increase the version of the cart.
+-- Reservation updates are not changes
+ALTER TABLE cart
+  ADD COLUMN createdAt timestamp(3) with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  ADD COLUMN updatedAt timestamp(3) with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP(3);
+
+-- The sweeper looks for the carts not changed for a while
+CREATE INDEX IF NOT EXISTS idleCarts ON cart (updatedAt);
+
+ALTER TABLE cartItem
+  ADD COLUMN createdAt timestamp(3) with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  ADD COLUMN updatedAt timestamp(3) with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP(3);
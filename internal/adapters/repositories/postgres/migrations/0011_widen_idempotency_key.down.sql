@@ -0,0 +1,3 @@
+-- Longer keys would not fit, and they are only kept for a while anyway
+DELETE FROM idempotency_key WHERE char_length(idempotencyKey) > 255;
+ALTER TABLE idempotency_key ALTER COLUMN idempotencyKey TYPE varchar(255);
@@ -0,0 +1,2 @@
+-- Keys are stored prefixed with the subject of the request, I.E. "subject:key". Both are up to 255 characters
+ALTER TABLE idempotency_key ALTER COLUMN idempotencyKey TYPE varchar(512);
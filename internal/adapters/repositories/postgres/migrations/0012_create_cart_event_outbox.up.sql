@@ -0,0 +1,18 @@
+-- Transactional outbox for the abandoned cart events. Events are written in the same transaction that deletes the
+-- carts and published in background by the cart events dispatcher, so no event is lost if the publisher is down
+CREATE TABLE IF NOT EXISTS cart_event_outbox (
+  id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  cartId varchar(36) NOT NULL,
+  -- json of the abandoned cart, as it is published. The cart is already deleted
+  payload text NOT NULL,
+  -- pending, done or dead
+  status varchar(10) NOT NULL,
+  attempts integer NOT NULL DEFAULT 0,
+  nextAttemptAt timestamp(3) with time zone NOT NULL,
+  -- A claimed event is not handed out to any other dispatcher until the claim expires
+  claimedUntil timestamp(3) with time zone,
+  lastError varchar(255),
+  createdAt timestamp(3) with time zone NOT NULL DEFAULT CURRENT_TIMESTAMP(3)
+);
+
+CREATE INDEX IF NOT EXISTS pendingCartEvents ON cart_event_outbox (status, nextAttemptAt);
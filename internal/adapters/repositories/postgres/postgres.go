@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+type Config struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DataBase string
+}
+
+func InitPostgresDB(cfg Config) (*sql.DB, error) {
+	// Setting the fields of the driver config instead of writing a connection string, so the password can hold any character.
+	// The rest of the settings (I.E. sslmode) keep the libpq defaults and can be changed with the PG env variables
+	driverCfg, parseErr := pgx.ParseConfig("")
+	if parseErr != nil {
+		return nil, fmt.Errorf("parsing postgres config --> %w", parseErr)
+	}
+	driverCfg.Host = cfg.Host
+	driverCfg.Port = uint16(cfg.Port)
+	driverCfg.User = cfg.User
+	driverCfg.Password = cfg.Password
+	driverCfg.Database = cfg.DataBase
+	// The fallbacks are the default hosts. They would be tried if the configured one fails
+	driverCfg.Fallbacks = nil
+
+	db := stdlib.OpenDB(*driverCfg)
+
+	err := db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
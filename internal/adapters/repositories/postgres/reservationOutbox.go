@@ -0,0 +1,223 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+const (
+	reservationOutboxTable = "reservation_outbox"
+
+	outboxStatusPending = "pending"
+	outboxStatusDone    = "done"
+	outboxStatusDead    = "dead"
+
+	// Same size as the lastError and reservationError columns
+	maxLastErrorLength = 255
+)
+
+var (
+	reservationTaskColumns = []string{"id", "cartId", "operation", "itemId", "itemName", "quantity", "reservationId", "attempts", "createdAt"}
+)
+
+type ReservationOutbox struct {
+	db *sql.DB
+}
+
+func NewReservationOutbox(db *sql.DB) *ReservationOutbox {
+	return &ReservationOutbox{db: db}
+}
+
+// Used by the CartItemsRepository in order to write the task in the same transaction as the cart change
+func insertReservationTask(ctx context.Context, tx *sql.Tx, task model.ReservationTask) error {
+	sb := sqlbuilder.PostgreSQL.NewInsertBuilder()
+	sb.
+		InsertInto(reservationOutboxTable).
+		Cols("cartId", "operation", "itemId", "itemName", "quantity", "reservationId", "status", "nextAttemptAt").
+		Values(task.CartId, string(task.Operation), task.Item.Id, task.Item.Name, task.Item.Quantity, task.Item.ReservationId,
+			outboxStatusPending, time.Now().UTC())
+
+	query, args := sb.Build()
+	if _, insertErr := tx.ExecContext(ctx, query, args...); insertErr != nil {
+		return fmt.Errorf("writing %s task in the outbox --> %w", task.Operation, insertErr)
+	}
+	return nil
+}
+
+func (ro *ReservationOutbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]model.ReservationTask, error) {
+	tx, beginErr := ro.db.BeginTx(ctx, nil)
+	if beginErr != nil {
+		return []model.ReservationTask{}, fmt.Errorf("starting transaction for claiming tasks --> %w", beginErr)
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+
+	// SKIP LOCKED lets several dispatchers claim tasks at the same time without waiting for each other
+	sb := sqlbuilder.PostgreSQL.NewSelectBuilder()
+	sb.
+		Select(reservationTaskColumns...).
+		From(reservationOutboxTable).
+		Where(
+			sb.Equal("status", outboxStatusPending),
+			sb.LessEqualThan("nextAttemptAt", now),
+			sb.Or(sb.IsNull("claimedUntil"), sb.LessThan("claimedUntil", now)),
+		).
+		OrderBy("id").
+		Limit(limit).
+		SQL("FOR UPDATE SKIP LOCKED")
+
+	query, args := sb.Build()
+	rows, selectErr := tx.QueryContext(ctx, query, args...)
+	if selectErr != nil {
+		return []model.ReservationTask{}, fmt.Errorf("selecting pending tasks --> %w", selectErr)
+	}
+
+	var tasks []model.ReservationTask
+	var taskIds []interface{}
+	for rows.Next() {
+		var task model.ReservationTask
+		var operation string
+		if scanErr := rows.Scan(&task.Id, &task.CartId, &operation, &task.Item.Id, &task.Item.Name, &task.Item.Quantity,
+			&task.Item.ReservationId, &task.Attempts, &task.CreatedAt); scanErr != nil {
+			rows.Close()
+			return []model.ReservationTask{}, fmt.Errorf("scanning pending tasks --> %w", scanErr)
+		}
+		task.Operation = model.ReservationOperation(operation)
+		// The claim below counts as a new attempt
+		task.Attempts++
+
+		tasks = append(tasks, task)
+		taskIds = append(taskIds, task.Id)
+	}
+	rows.Close()
+
+	if len(tasks) == 0 {
+		return tasks, nil
+	}
+
+	ub := sqlbuilder.PostgreSQL.NewUpdateBuilder()
+	ub.Update(reservationOutboxTable).
+		Set(
+			ub.Assign("claimedUntil", now.Add(lease)),
+			ub.Incr("attempts"),
+		).
+		Where(ub.In("id", taskIds...))
+
+	updateQuery, updateArgs := ub.Build()
+	if _, updateErr := tx.ExecContext(ctx, updateQuery, updateArgs...); updateErr != nil {
+		return []model.ReservationTask{}, fmt.Errorf("claiming pending tasks --> %w", updateErr)
+	}
+
+	if commitErr := tx.Commit(); commitErr != nil {
+		return []model.ReservationTask{}, fmt.Errorf("committing task claims --> %w", commitErr)
+	}
+
+	return tasks, nil
+}
+
+func (ro *ReservationOutbox) MarkDone(ctx context.Context, taskId int64) error {
+	ub := sqlbuilder.PostgreSQL.NewUpdateBuilder()
+	ub.Update(reservationOutboxTable).
+		Set(
+			ub.Assign("status", outboxStatusDone),
+			ub.Assign("claimedUntil", nil),
+		).
+		Where(ub.Equal("id", taskId))
+
+	return ro.update(ctx, ub, taskId)
+}
+
+func (ro *ReservationOutbox) Retry(ctx context.Context, taskId int64, nextAttemptAt time.Time, lastErr string) error {
+	ub := sqlbuilder.PostgreSQL.NewUpdateBuilder()
+	ub.Update(reservationOutboxTable).
+		Set(
+			ub.Assign("nextAttemptAt", nextAttemptAt.UTC()),
+			ub.Assign("claimedUntil", nil),
+			ub.Assign("lastError", truncate(lastErr, maxLastErrorLength)),
+		).
+		Where(ub.Equal("id", taskId))
+
+	return ro.update(ctx, ub, taskId)
+}
+
+func (ro *ReservationOutbox) Postpone(ctx context.Context, taskId int64, nextAttemptAt time.Time) error {
+	ub := sqlbuilder.PostgreSQL.NewUpdateBuilder()
+	ub.Update(reservationOutboxTable).
+		Set(
+			ub.Assign("nextAttemptAt", nextAttemptAt.UTC()),
+			ub.Assign("claimedUntil", nil),
+			// Gives back the attempt added by the claim
+			ub.Decr("attempts"),
+		).
+		Where(ub.Equal("id", taskId))
+
+	return ro.update(ctx, ub, taskId)
+}
+
+func (ro *ReservationOutbox) MarkDead(ctx context.Context, taskId int64, lastErr string) error {
+	ub := sqlbuilder.PostgreSQL.NewUpdateBuilder()
+	ub.Update(reservationOutboxTable).
+		Set(
+			ub.Assign("status", outboxStatusDead),
+			ub.Assign("claimedUntil", nil),
+			ub.Assign("lastError", truncate(lastErr, maxLastErrorLength)),
+		).
+		Where(ub.Equal("id", taskId))
+
+	return ro.update(ctx, ub, taskId)
+}
+
+// Done tasks are not needed anymore. Dead ones are kept, as they are meant to be inspected
+func (ro *ReservationOutbox) DeleteDone(ctx context.Context) (int64, error) {
+	db := sqlbuilder.PostgreSQL.NewDeleteBuilder()
+	db.DeleteFrom(reservationOutboxTable).
+		Where(db.Equal("status", outboxStatusDone))
+
+	query, args := db.Build()
+	result, deleteErr := ro.db.ExecContext(ctx, query, args...)
+	if deleteErr != nil {
+		return 0, fmt.Errorf("deleting done tasks --> %w", deleteErr)
+	}
+	deleted, rowsErr := result.RowsAffected()
+	if rowsErr != nil {
+		return 0, fmt.Errorf("cannot check rows affected when deleting done tasks --> %w", rowsErr)
+	}
+	return deleted, nil
+}
+
+func (ro *ReservationOutbox) update(ctx context.Context, ub *sqlbuilder.UpdateBuilder, taskId int64) error {
+	query, args := ub.Build()
+	result, updateErr := ro.db.ExecContext(ctx, query, args...)
+	if updateErr != nil {
+		return fmt.Errorf("cannot update task %d --> %w", taskId, updateErr)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot check rows affected when updating task %d --> %w", taskId, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("task %d --> %w", taskId, model.ErrReservationTaskNotFound)
+	}
+	return nil
+}
+
+// The columns are sized in characters, not in bytes. Cutting in the middle of a multi-byte character would
+// leave invalid utf-8 behind, so the string is cut at a character boundary
+func truncate(s string, maxLength int) string {
+	characters := 0
+	for i := range s {
+		if characters == maxLength {
+			return s[:i]
+		}
+		characters++
+	}
+	return s
+}
@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClaimTasks_GivenInitializedOutbox(t *testing.T) {
+	claimQuery := "SELECT id, cartId, operation, itemId, itemName, quantity, reservationId, attempts, createdAt FROM reservation_outbox " +
+		"WHERE status = $1 AND nextAttemptAt <= $2 AND (claimedUntil IS NULL OR claimedUntil < $3) ORDER BY id LIMIT 2 FOR UPDATE SKIP LOCKED"
+	leaseQuery := "UPDATE reservation_outbox SET claimedUntil = $1, attempts = attempts + 1 WHERE id IN ($2, $3)"
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type want struct {
+		err   bool
+		tasks []model.ReservationTask
+	}
+
+	tests := []struct {
+		name  string
+		mocks func(m CartItemRepoMocks)
+		want  want
+	}{
+		{
+			name: "WhenClaimAndNoPendingTasks_ThenEmpty",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(claimQuery).
+					WithArgs("pending", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(reservationTaskColumns))
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:   false,
+				tasks: nil,
+			},
+		}, {
+			name: "WhenClaimAndLeaseError_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(claimQuery).
+					WithArgs("pending", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(reservationTaskColumns).
+						AddRow(1, cartId, "reserve", "1", "screen", 2, "", 0, createdAt).
+						AddRow(2, cartId, "release", "2", "pants", 1, "reservationId2", 3, createdAt))
+				m.sql.
+					ExpectExec(leaseQuery).
+					WithArgs(sqlmock.AnyArg(), int64(1), int64(2)).
+					WillReturnError(randomError)
+				m.sql.ExpectRollback()
+			},
+			want: want{
+				err:   true,
+				tasks: []model.ReservationTask{},
+			},
+		}, {
+			name: "WhenClaimAndOK_ThenTasksAreLeasedAndAttemptsIncreased",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectBegin()
+				m.sql.
+					ExpectQuery(claimQuery).
+					WithArgs("pending", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(reservationTaskColumns).
+						AddRow(1, cartId, "reserve", "1", "screen", 2, "", 0, createdAt).
+						AddRow(2, cartId, "release", "2", "pants", 1, "reservationId2", 3, createdAt))
+				m.sql.
+					ExpectExec(leaseQuery).
+					WithArgs(sqlmock.AnyArg(), int64(1), int64(2)).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				m.sql.ExpectCommit()
+			},
+			want: want{
+				err: false,
+				tasks: []model.ReservationTask{
+					{Id: 1, CartId: cartId, Operation: model.ReserveOperation, Attempts: 1, CreatedAt: createdAt,
+						Item: model.CartItem{Id: "1", Name: "screen", Quantity: 2}},
+					{Id: 2, CartId: cartId, Operation: model.ReleaseOperation, Attempts: 4, CreatedAt: createdAt,
+						Item: model.CartItem{Id: "2", Name: "pants", Quantity: 1, ReservationId: "reservationId2"}},
+				},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			o := NewReservationOutbox(db)
+
+			tasks, claimErr := o.Claim(context.TODO(), 2, time.Minute)
+
+			if tc.want.err {
+				assert.Error(t, claimErr)
+			} else {
+				assert.NoError(t, claimErr)
+			}
+			assert.Equal(t, tc.want.tasks, tasks)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_UpdateTasks_GivenInitializedOutbox(t *testing.T) {
+	doneQuery := "UPDATE reservation_outbox SET status = $1, claimedUntil = $2 WHERE id = $3"
+	retryQuery := "UPDATE reservation_outbox SET nextAttemptAt = $1, claimedUntil = $2, lastError = $3 WHERE id = $4"
+	postponeQuery := "UPDATE reservation_outbox SET nextAttemptAt = $1, claimedUntil = $2, attempts = attempts - 1 WHERE id = $3"
+	taskId := int64(7)
+
+	tests := []struct {
+		name    string
+		mocks   func(m CartItemRepoMocks)
+		call    func(o *ReservationOutbox) error
+		wantErr bool
+	}{
+		{
+			name: "WhenMarkDoneAndOK_ThenOK",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(doneQuery).
+					WithArgs("done", nil, taskId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(o *ReservationOutbox) error {
+				return o.MarkDone(context.TODO(), taskId)
+			},
+			wantErr: false,
+		}, {
+			name: "WhenMarkDoneAndTaskNotFound_ThenError",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(doneQuery).
+					WithArgs("done", nil, taskId).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			call: func(o *ReservationOutbox) error {
+				return o.MarkDone(context.TODO(), taskId)
+			},
+			wantErr: true,
+		}, {
+			name: "WhenRetryAndOK_ThenOK",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(retryQuery).
+					WithArgs(sqlmock.AnyArg(), nil, "reserver down", taskId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(o *ReservationOutbox) error {
+				return o.Retry(context.TODO(), taskId, time.Now(), "reserver down")
+			},
+			wantErr: false,
+		}, {
+			name: "WhenPostponeAndOK_ThenAttemptIsGivenBack",
+			mocks: func(m CartItemRepoMocks) {
+				m.sql.ExpectExec(postponeQuery).
+					WithArgs(sqlmock.AnyArg(), nil, taskId).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(o *ReservationOutbox) error {
+				return o.Postpone(context.TODO(), taskId, time.Now())
+			},
+			wantErr: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Error when creating the mock: %v", err)
+			}
+			m := CartItemRepoMocks{sql: dbMock}
+			defer db.Close()
+
+			tc.mocks(m)
+
+			updateErr := tc.call(NewReservationOutbox(db))
+
+			assert.Equal(t, tc.wantErr, updateErr != nil)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package repositorytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Builds an api keys repository. It is called once per test
+type APIKeysFactory func(t *testing.T) ports.APIKeysRepository
+
+type apiKeysTestCase struct {
+	name string
+	test func(t *testing.T, s apiKeysSuite)
+}
+
+type apiKeysSuite struct {
+	repo ports.APIKeysRepository
+	// Every test uses its own key, so the suite can also run against a shared database
+	key model.APIKey
+}
+
+func RunAPIKeys(t *testing.T, newRepo APIKeysFactory) {
+	tests := []apiKeysTestCase{
+		{name: "WhenCreateKey_ThenItIsFoundByItsHash", test: createAPIKey},
+		{name: "WhenGetUnknownHash_ThenNotFound", test: getUnknownAPIKey},
+		{name: "WhenList_ThenKeysAreListedOldestFirst", test: listAPIKeys},
+		{name: "WhenRevokeKey_ThenItIsKeptAsRevoked", test: revokeAPIKey},
+		{name: "WhenRevokeRevokedKey_ThenFirstRevocationIsKept", test: revokeRevokedAPIKey},
+		{name: "WhenRevokeUnknownKey_ThenNotFound", test: revokeUnknownAPIKey},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, apiKeysSuite{repo: newRepo(t), key: newAPIKey(t, "checkout", time.Now())})
+		})
+	}
+}
+
+// Timestamps are truncated to milliseconds, the precision of the sql columns
+func newAPIKey(t *testing.T, name string, createdAt time.Time) model.APIKey {
+	return model.APIKey{
+		Id:        newCartId(t),
+		Name:      name,
+		Hash:      hashOf(newCartId(t)),
+		Scopes:    []model.APIKeyScope{model.ReadScope, model.WriteScope},
+		CreatedAt: createdAt.UTC().Truncate(time.Millisecond),
+	}
+}
+
+func (s apiKeysSuite) create(t *testing.T, key model.APIKey) {
+	require.NoError(t, s.repo.Create(context.Background(), key))
+}
+
+func (s apiKeysSuite) get(t *testing.T) model.APIKey {
+	key, getErr := s.repo.GetByHash(context.Background(), s.key.Hash)
+	require.NoError(t, getErr)
+	return key
+}
+
+// Databases may give back the timestamps in another location
+func assertAPIKey(t *testing.T, want model.APIKey, got model.APIKey) {
+	assert.True(t, want.CreatedAt.Equal(got.CreatedAt), "created at %s, got %s", want.CreatedAt, got.CreatedAt)
+	if want.RevokedAt != nil && assert.NotNil(t, got.RevokedAt) {
+		assert.True(t, want.RevokedAt.Equal(*got.RevokedAt), "revoked at %s, got %s", *want.RevokedAt, *got.RevokedAt)
+	}
+	want.CreatedAt, got.CreatedAt = time.Time{}, time.Time{}
+	if want.RevokedAt != nil {
+		want.RevokedAt, got.RevokedAt = nil, nil
+	}
+	assert.Equal(t, want, got)
+}
+
+func createAPIKey(t *testing.T, s apiKeysSuite) {
+	s.create(t, s.key)
+
+	assertAPIKey(t, s.key, s.get(t))
+}
+
+func getUnknownAPIKey(t *testing.T, s apiKeysSuite) {
+	_, getErr := s.repo.GetByHash(context.Background(), s.key.Hash)
+
+	assert.ErrorIs(t, getErr, model.ErrAPIKeyNotFound)
+}
+
+func listAPIKeys(t *testing.T, s apiKeysSuite) {
+	newer := newAPIKey(t, "back office", s.key.CreatedAt.Add(time.Second))
+	s.create(t, newer)
+	s.create(t, s.key)
+
+	keys, listErr := s.repo.List(context.Background())
+	require.NoError(t, listErr)
+
+	// Other tests may have written their keys in a shared database
+	var ids []string
+	for _, key := range keys {
+		if key.Id == s.key.Id || key.Id == newer.Id {
+			ids = append(ids, key.Id)
+		}
+	}
+	assert.Equal(t, []string{s.key.Id, newer.Id}, ids)
+}
+
+func revokeAPIKey(t *testing.T, s apiKeysSuite) {
+	s.create(t, s.key)
+	revokedAt := time.Now().UTC().Truncate(time.Millisecond)
+
+	require.NoError(t, s.repo.Revoke(context.Background(), s.key.Id, revokedAt))
+
+	want := s.key
+	want.RevokedAt = &revokedAt
+	assertAPIKey(t, want, s.get(t))
+}
+
+func revokeRevokedAPIKey(t *testing.T, s apiKeysSuite) {
+	s.create(t, s.key)
+	revokedAt := time.Now().UTC().Truncate(time.Millisecond)
+	require.NoError(t, s.repo.Revoke(context.Background(), s.key.Id, revokedAt))
+
+	assert.NoError(t, s.repo.Revoke(context.Background(), s.key.Id, revokedAt.Add(time.Hour)))
+
+	want := s.key
+	want.RevokedAt = &revokedAt
+	assertAPIKey(t, want, s.get(t))
+}
+
+func revokeUnknownAPIKey(t *testing.T, s apiKeysSuite) {
+	revokeErr := s.repo.Revoke(context.Background(), s.key.Id, time.Now())
+
+	assert.ErrorIs(t, revokeErr, model.ErrAPIKeyNotFound)
+}
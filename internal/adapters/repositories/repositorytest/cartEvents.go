@@ -0,0 +1,144 @@
+package repositorytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Builds a repository and the outbox where it writes the abandoned cart events. Both must share the same storage.
+// It is called once per test
+type CartEventsFactory func(t *testing.T) (ports.CartItemsRepository, ports.CartEventsOutbox)
+
+type cartEventsTestCase struct {
+	name string
+	test func(t *testing.T, s cartEventsSuite)
+}
+
+// The carts are filled and expired the same way as in the repository suite
+type cartEventsSuite struct {
+	suite
+	events ports.CartEventsOutbox
+}
+
+func RunCartEvents(t *testing.T, newRepo CartEventsFactory) {
+	tests := []cartEventsTestCase{
+		{name: "WhenExpireCartWithItems_ThenEventIsWritten", test: expireCartWithItemsWritesEvent},
+		{name: "WhenExpireEmptyCart_ThenNoEventIsWritten", test: expireEmptyCartWritesNoEvent},
+		{name: "WhenEventClaimed_ThenItIsNotHandedOutAgain", test: claimedEventNotHandedOutAgain},
+		{name: "WhenEventRetried_ThenItIsClaimedAgainOnceDue", test: retriedEventClaimedOnceDue},
+		{name: "WhenEventDead_ThenItIsNotClaimedAgain", test: deadEventNotClaimedAgain},
+		{name: "WhenDeleteDone_ThenPublishedEventsAreGone", test: deleteDoneEvents},
+		{name: "WhenUpdateUnknownEvent_ThenNotFound", test: updateUnknownEvent},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo, events := newRepo(t)
+			tc.test(t, cartEventsSuite{suite: suite{repo: repo, cartId: newCartId(t)}, events: events})
+		})
+	}
+}
+
+// Claims the events written so far and returns the ones of the cart of the suite. The others are left claimed
+func (s cartEventsSuite) claim(t *testing.T) []model.CartEvent {
+	claimed, claimErr := s.events.Claim(context.Background(), 1000, time.Minute)
+	require.NoError(t, claimErr)
+
+	events := []model.CartEvent{}
+	for _, event := range claimed {
+		if event.Cart.CartId == s.cartId {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Fills the cart of the suite, expires it and claims its event
+func (s cartEventsSuite) abandon(t *testing.T) model.CartEvent {
+	s.add(t, screen)
+	s.add(t, mouse)
+	_, expired := s.expire(t, time.Now().UTC().Add(time.Second))
+	require.True(t, expired)
+
+	events := s.claim(t)
+	require.Len(t, events, 1)
+	return events[0]
+}
+
+func expireCartWithItemsWritesEvent(t *testing.T, s cartEventsSuite) {
+	_, claimErr := s.repo.ClaimCart(context.Background(), s.cartId, "alice")
+	require.NoError(t, claimErr)
+
+	event := s.abandon(t)
+
+	assert.NotZero(t, event.Id)
+	assert.Equal(t, 1, event.Attempts)
+	assert.False(t, event.CreatedAt.IsZero())
+	assert.Equal(t, "alice", event.Cart.OwnerId)
+	assert.False(t, event.Cart.ExpiredAt.IsZero())
+	require.Len(t, event.Cart.Items, 2)
+	assert.ElementsMatch(t, []string{screen.Id, mouse.Id}, []string{event.Cart.Items[0].Id, event.Cart.Items[1].Id})
+}
+
+func expireEmptyCartWritesNoEvent(t *testing.T, s cartEventsSuite) {
+	s.add(t, screen)
+	_, _, removeErr := s.repo.Remove(context.Background(), s.cartId, screen.Id, nil)
+	require.NoError(t, removeErr)
+
+	_, expired := s.expire(t, time.Now().UTC().Add(time.Second))
+
+	require.True(t, expired)
+	assert.Empty(t, s.claim(t))
+}
+
+func claimedEventNotHandedOutAgain(t *testing.T, s cartEventsSuite) {
+	s.abandon(t)
+
+	assert.Empty(t, s.claim(t))
+}
+
+func retriedEventClaimedOnceDue(t *testing.T, s cartEventsSuite) {
+	event := s.abandon(t)
+
+	require.NoError(t, s.events.Retry(context.Background(), event.Id, time.Now().Add(time.Hour), "webhook down"))
+	assert.Empty(t, s.claim(t))
+
+	require.NoError(t, s.events.Retry(context.Background(), event.Id, time.Now().Add(-time.Second), "webhook down"))
+	events := s.claim(t)
+	require.Len(t, events, 1)
+	assert.Equal(t, event.Id, events[0].Id)
+	assert.Equal(t, 2, events[0].Attempts)
+	assert.Equal(t, event.Cart.Items, events[0].Cart.Items)
+}
+
+func deadEventNotClaimedAgain(t *testing.T, s cartEventsSuite) {
+	event := s.abandon(t)
+
+	require.NoError(t, s.events.MarkDead(context.Background(), event.Id, "webhook down"))
+
+	assert.Empty(t, s.claim(t))
+}
+
+func deleteDoneEvents(t *testing.T, s cartEventsSuite) {
+	event := s.abandon(t)
+	require.NoError(t, s.events.MarkDone(context.Background(), event.Id))
+
+	_, deleteErr := s.events.DeleteDone(context.Background())
+
+	require.NoError(t, deleteErr)
+	assert.ErrorIs(t, s.events.MarkDone(context.Background(), event.Id), model.ErrCartEventNotFound)
+}
+
+func updateUnknownEvent(t *testing.T, s cartEventsSuite) {
+	const unknownId = int64(1 << 40)
+
+	assert.ErrorIs(t, s.events.MarkDone(context.Background(), unknownId), model.ErrCartEventNotFound)
+	assert.ErrorIs(t, s.events.Retry(context.Background(), unknownId, time.Now(), "webhook down"), model.ErrCartEventNotFound)
+	assert.ErrorIs(t, s.events.MarkDead(context.Background(), unknownId, "webhook down"), model.ErrCartEventNotFound)
+}
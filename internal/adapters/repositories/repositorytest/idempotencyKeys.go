@@ -0,0 +1,196 @@
+package repositorytest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Builds an idempotency keys repository. It is called once per test
+type IdempotencyKeysFactory func(t *testing.T) ports.IdempotencyKeysRepository
+
+type idempotencyKeysTestCase struct {
+	name string
+	test func(t *testing.T, s idempotencyKeysSuite)
+}
+
+type idempotencyKeysSuite struct {
+	repo ports.IdempotencyKeysRepository
+	// Every test uses its own key, so the suite can also run against a shared database
+	key string
+}
+
+var (
+	// Same length as the sha256 hashes written by the handlers. Some adapters store them in a char column
+	requestHash      = hashOf("POST /carts/1/items")
+	otherRequestHash = hashOf("POST /carts/2/items")
+
+	acceptedResponse = model.IdempotentResponse{
+		StatusCode: 202,
+		Headers:    map[string]string{"ETag": `"1"`},
+		Body:       []byte{},
+	}
+)
+
+func RunIdempotencyKeys(t *testing.T, newRepo IdempotencyKeysFactory) {
+	tests := []idempotencyKeysTestCase{
+		{name: "WhenClaimNewKey_ThenItIsClaimed", test: claimNewKey},
+		{name: "WhenClaimKeyInProgress_ThenStoredRecordIsReturned", test: claimKeyInProgress},
+		{name: "WhenClaimCompletedKey_ThenStoredResponseIsReturned", test: claimCompletedKey},
+		{name: "WhenClaimExpiredKey_ThenItIsClaimedAgain", test: claimExpiredKey},
+		{name: "WhenClaimDeletedKey_ThenItIsClaimedAgain", test: claimDeletedKey},
+		{name: "WhenCompleteUnknownKey_ThenError", test: completeUnknownKey},
+		{name: "WhenDeleteExpired_ThenOnlyExpiredKeysAreDeleted", test: deleteExpiredKeys},
+		{name: "WhenConcurrentClaimsOfSameKey_ThenOnlyOneIsClaimed", test: concurrentClaims},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, idempotencyKeysSuite{repo: newRepo(t), key: newCartId(t)})
+		})
+	}
+}
+
+func hashOf(request string) string {
+	hash := sha256.Sum256([]byte(request))
+	return hex.EncodeToString(hash[:])
+}
+
+func (s idempotencyKeysSuite) claim(t *testing.T, hash string, expiresAt time.Time) (model.IdempotencyRecord, bool) {
+	stored, claimed, claimErr := s.repo.Claim(context.Background(), model.IdempotencyRecord{
+		Key:         s.key,
+		RequestHash: hash,
+		ExpiresAt:   expiresAt,
+	})
+	require.NoError(t, claimErr)
+	return stored, claimed
+}
+
+// Empty bodies may be read back as nil
+func assertResponse(t *testing.T, want model.IdempotentResponse, got *model.IdempotentResponse) {
+	if assert.NotNil(t, got) {
+		assert.Equal(t, want.StatusCode, got.StatusCode)
+		assert.Equal(t, want.Headers, got.Headers)
+		assert.Equal(t, string(want.Body), string(got.Body))
+	}
+}
+
+func claimNewKey(t *testing.T, s idempotencyKeysSuite) {
+	stored, claimed := s.claim(t, requestHash, time.Now().Add(time.Minute))
+
+	assert.True(t, claimed)
+	assert.Equal(t, s.key, stored.Key)
+	assert.Nil(t, stored.Response)
+}
+
+func claimKeyInProgress(t *testing.T, s idempotencyKeysSuite) {
+	leaseEnd := time.Now().UTC().Add(time.Minute)
+	s.claim(t, requestHash, leaseEnd)
+
+	stored, claimed := s.claim(t, otherRequestHash, time.Now().Add(time.Minute))
+
+	assert.False(t, claimed)
+	assert.Equal(t, s.key, stored.Key)
+	assert.Equal(t, requestHash, stored.RequestHash)
+	assert.Nil(t, stored.Response)
+	assert.WithinDuration(t, leaseEnd, stored.ExpiresAt, time.Millisecond)
+}
+
+func claimCompletedKey(t *testing.T, s idempotencyKeysSuite) {
+	s.claim(t, requestHash, time.Now().Add(time.Minute))
+	ttlEnd := time.Now().UTC().Add(time.Hour)
+	require.NoError(t, s.repo.Complete(context.Background(), s.key, model.IdempotentResponse{
+		StatusCode: 400,
+		Headers:    map[string]string{"Content-Type": "application/json; charset=utf-8"},
+		Body:       []byte(`{"version":"1.0.0","message":"bad request"}`),
+	}, ttlEnd))
+
+	stored, claimed := s.claim(t, requestHash, time.Now().Add(time.Minute))
+
+	assert.False(t, claimed)
+	assertResponse(t, model.IdempotentResponse{
+		StatusCode: 400,
+		Headers:    map[string]string{"Content-Type": "application/json; charset=utf-8"},
+		Body:       []byte(`{"version":"1.0.0","message":"bad request"}`),
+	}, stored.Response)
+	assert.WithinDuration(t, ttlEnd, stored.ExpiresAt, time.Millisecond)
+}
+
+// I.E. the service stopped while the first request was being processed
+func claimExpiredKey(t *testing.T, s idempotencyKeysSuite) {
+	s.claim(t, requestHash, time.Now().Add(-time.Second))
+
+	stored, claimed := s.claim(t, otherRequestHash, time.Now().Add(time.Minute))
+
+	assert.True(t, claimed)
+	assert.Equal(t, otherRequestHash, stored.RequestHash)
+}
+
+func claimDeletedKey(t *testing.T, s idempotencyKeysSuite) {
+	s.claim(t, requestHash, time.Now().Add(time.Minute))
+	require.NoError(t, s.repo.Delete(context.Background(), s.key))
+
+	_, claimed := s.claim(t, requestHash, time.Now().Add(time.Minute))
+
+	assert.True(t, claimed)
+}
+
+func completeUnknownKey(t *testing.T, s idempotencyKeysSuite) {
+	completeErr := s.repo.Complete(context.Background(), s.key, acceptedResponse, time.Now().Add(time.Hour))
+
+	assert.ErrorIs(t, completeErr, model.ErrIdempotencyKeyNotFound)
+}
+
+func deleteExpiredKeys(t *testing.T, s idempotencyKeysSuite) {
+	expired := idempotencyKeysSuite{repo: s.repo, key: newCartId(t)}
+	expired.claim(t, requestHash, time.Now().Add(-time.Second))
+	s.claim(t, requestHash, time.Now().Add(time.Minute))
+	require.NoError(t, s.repo.Complete(context.Background(), s.key, acceptedResponse, time.Now().Add(time.Hour)))
+
+	deleted, deleteErr := s.repo.DeleteExpired(context.Background())
+
+	require.NoError(t, deleteErr)
+	// The database may be shared, so other tests may have left expired keys as well
+	assert.GreaterOrEqual(t, deleted, int64(1))
+	stored, claimed := s.claim(t, requestHash, time.Now().Add(time.Minute))
+	assert.False(t, claimed)
+	assertResponse(t, acceptedResponse, stored.Response)
+}
+
+func concurrentClaims(t *testing.T, s idempotencyKeysSuite) {
+	const claims = 10
+
+	var wg sync.WaitGroup
+	results := make(chan bool, claims)
+	for i := 0; i < claims; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, claimed, claimErr := s.repo.Claim(context.Background(), model.IdempotencyRecord{
+				Key:         s.key,
+				RequestHash: requestHash,
+				ExpiresAt:   time.Now().Add(time.Minute),
+			})
+			assert.NoError(t, claimErr)
+			results <- claimed
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	claimedCount := 0
+	for claimed := range results {
+		if claimed {
+			claimedCount++
+		}
+	}
+	assert.Equal(t, 1, claimedCount)
+}
@@ -0,0 +1,786 @@
+// Conformance suite that every ports.CartItemsRepository adapter must pass, so all of them behave the same way.
+// Each adapter runs it from its own tests
+package repositorytest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Builds a repository and the outbox where it writes the reservation tasks. Both must share the same storage.
+// It is called once per test
+type Factory func(t *testing.T) (ports.CartItemsRepository, ports.ReservationOutbox)
+
+type testCase struct {
+	name string
+	test func(t *testing.T, s suite)
+}
+
+type suite struct {
+	repo   ports.CartItemsRepository
+	outbox ports.ReservationOutbox
+	// Every test uses its own cart, so the suite can also run against a shared database
+	cartId string
+}
+
+// Item ids are numeric, as some adapters store them in an int column
+var (
+	screen = model.CartItem{Id: "1", Name: "screen", Quantity: 2}
+	mouse  = model.CartItem{Id: "2", Name: "mouse", Quantity: 1}
+)
+
+func Run(t *testing.T, newRepo Factory) {
+	tests := []testCase{
+		{name: "WhenGetUnknownCart_ThenNoItems", test: getUnknownCart},
+		{name: "WhenAddNewItem_ThenItIsPendingAndReserveTaskIsWritten", test: addNewItem},
+		{name: "WhenAddItemAlreadyInCart_ThenQuantitiesAreMerged", test: addItemAlreadyInCart},
+		{name: "WhenMergedQuantityTooBig_ThenInvalidQuantityAndNothingIsChanged", test: addItemOverMaxQuantity},
+		{name: "WhenSameItemInTwoCarts_ThenQuantitiesAreNotMerged", test: sameItemInTwoCarts},
+		{name: "WhenAddItemAlreadyReserved_ThenReserveTaskCarriesTheReservation", test: addItemAlreadyReserved},
+		{name: "WhenGetUnknownItem_ThenNotFound", test: getUnknownItem},
+		{name: "WhenSetReservationId_ThenItemIsReserved", test: setReservationId},
+		{name: "WhenSetReservationIdOfUnknownItem_ThenNotFound", test: setReservationIdOfUnknownItem},
+		{name: "WhenSetReservationFailed_ThenReasonIsStored", test: setReservationFailed},
+		{name: "WhenSetReservationFailedOfUnknownItem_ThenNotFound", test: setReservationFailedOfUnknownItem},
+		{name: "WhenSetReservationReleased_ThenReservationIsCleared", test: setReservationReleased},
+		{name: "WhenSetReservationReleasedOfReplacedReservation_ThenNotFound", test: setReservationReleasedOfReplacedReservation},
+		{name: "WhenRemoveReservedItem_ThenReleaseTaskIsWritten", test: removeReservedItem},
+		{name: "WhenRemoveItemNotReserved_ThenNoTaskIsWritten", test: removeItemNotReserved},
+		{name: "WhenRemoveUnknownItem_ThenNotFound", test: removeUnknownItem},
+		{name: "WhenUpdateQuantity_ThenReserveTaskIsWritten", test: updateQuantity},
+		{name: "WhenUpdateQuantityCoveredByReservation_ThenNoTaskIsWritten", test: updateQuantityCoveredByReservation},
+		{name: "WhenUpdateQuantityOfUnknownItem_ThenNotFound", test: updateQuantityOfUnknownItem},
+		{name: "WhenConcurrentAddsOfSameItem_ThenEveryQuantityIsMerged", test: concurrentAdds},
+		{name: "WhenChangesAreMade_ThenVersionIsIncreased", test: versionIncreased},
+		{name: "WhenReservationIsUpdated_ThenVersionIsKept", test: versionKeptByReservations},
+		{name: "WhenExpectedVersionMatches_ThenChangesAreApplied", test: expectedVersionMatches},
+		{name: "WhenExpectedVersionIsStale_ThenConflictAndNothingIsChanged", test: expectedVersionStale},
+		{name: "WhenUnknownCartAndExpectedVersion_ThenConflictOrNotFound", test: expectedVersionOfUnknownCart},
+		{name: "WhenConcurrentChangesExpectSameVersion_ThenOnlyOneIsApplied", test: concurrentChangesWithExpectedVersion},
+		{name: "WhenOwnerOfUnknownCart_ThenNoOwner", test: ownerOfUnknownCart},
+		{name: "WhenClaimUnknownCart_ThenItIsCreatedWithTheOwner", test: claimUnknownCart},
+		{name: "WhenClaimCartWithoutOwner_ThenCallerBecomesTheOwner", test: claimCartWithoutOwner},
+		{name: "WhenClaimCartOwnedBySomeoneElse_ThenOwnerIsKept", test: claimCartOwnedBySomeoneElse},
+		{name: "WhenMergeGuestCart_ThenItemsAreFoldedAndGuestCartIsDeleted", test: mergeGuestCart},
+		{name: "WhenMergeGuestReservationIntoItemNotReserved_ThenReservationIsTakenOver", test: mergeTakesOverGuestReservation},
+		{name: "WhenMergeIntoUnknownCart_ThenItIsCreated", test: mergeIntoUnknownCart},
+		{name: "WhenMergeUnknownGuestCart_ThenCartNotFound", test: mergeUnknownGuestCart},
+		{name: "WhenMergeWithStaleVersion_ThenConflictAndNothingIsChanged", test: mergeWithStaleVersion},
+		{name: "WhenMergeAndSummedQuantityTooBig_ThenInvalidQuantityAndNothingIsChanged", test: mergeOverMaxQuantity},
+		{name: "WhenExpireIdleCart_ThenItIsDeletedAndReservationsAreReleased", test: expireIdleCart},
+		{name: "WhenExpireCartChangedSinceIdleTime_ThenItIsKept", test: expireCartChangedSince},
+		{name: "WhenExpireCartWithReservationUpdatedSinceIdleTime_ThenItIsDeleted", test: expireCartWithReservationUpdatedSince},
+		{name: "WhenExpireMoreCartsThanLimit_ThenOnlyLimitAreDeleted", test: expireMoreCartsThanLimit},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo, outbox := newRepo(t)
+			tc.test(t, suite{repo: repo, outbox: outbox, cartId: newCartId(t)})
+		})
+	}
+}
+
+// Sized for the cart id columns
+func newCartId(t *testing.T) string {
+	b := make([]byte, 16)
+	if _, randErr := rand.Read(b); randErr != nil {
+		t.Fatalf("Error when generating the cart id: %v", randErr)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Claims the tasks of the cart written so far and marks them as done, so the next call only returns the new ones
+func (s suite) takeTasks(t *testing.T) []model.ReservationTask {
+	claimed, claimErr := s.outbox.Claim(context.Background(), 1000, time.Minute)
+	require.NoError(t, claimErr)
+
+	tasks := []model.ReservationTask{}
+	for _, task := range claimed {
+		if task.CartId != s.cartId {
+			continue
+		}
+		require.NoError(t, s.outbox.MarkDone(context.Background(), task.Id))
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+func (s suite) add(t *testing.T, item model.CartItem) model.CartItem {
+	stored, _, addErr := s.repo.Add(context.Background(), s.cartId, item, nil)
+	require.NoError(t, addErr)
+	return stored
+}
+
+func (s suite) get(t *testing.T) model.Cart {
+	cart, getErr := s.repo.Get(context.Background(), s.cartId)
+	require.NoError(t, getErr)
+	return cart
+}
+
+func expect(version int64) *int64 {
+	return &version
+}
+
+// The conflict carries the current version, so the client knows which one to expect
+func assertConflict(t *testing.T, current int64, err error) {
+	var conflict *model.VersionConflictError
+	if assert.ErrorAs(t, err, &conflict) {
+		assert.Equal(t, current, conflict.Current)
+	}
+}
+
+func (s suite) getItem(t *testing.T, itemId string) model.CartItem {
+	item, getErr := s.repo.GetItem(context.Background(), s.cartId, itemId)
+	require.NoError(t, getErr)
+	return item
+}
+
+// Timestamps are set by the adapters, so they are only checked to be there
+func assertItem(t *testing.T, want model.CartItem, got model.CartItem) {
+	if want.ReservationStatus != "" {
+		assert.NotNil(t, got.ReservationUpdatedAt, "reservation timestamp of item %s", got.Id)
+	}
+	got.ReservationUpdatedAt = nil
+	assert.Equal(t, want, got)
+}
+
+func assertTask(t *testing.T, operation model.ReservationOperation, item model.CartItem, task model.ReservationTask) {
+	assert.Equal(t, operation, task.Operation)
+	assert.Equal(t, item.Id, task.Item.Id)
+	assert.Equal(t, item.Name, task.Item.Name)
+	assert.Equal(t, item.Quantity, task.Item.Quantity)
+	assert.Equal(t, item.ReservationId, task.Item.ReservationId)
+	assert.Equal(t, 1, task.Attempts)
+}
+
+func getUnknownCart(t *testing.T, s suite) {
+	cart, getErr := s.repo.Get(context.Background(), s.cartId)
+
+	assert.NoError(t, getErr)
+	assert.Empty(t, cart.Items)
+	assert.Equal(t, int64(0), cart.Version)
+}
+
+func addNewItem(t *testing.T, s suite) {
+	stored := s.add(t, screen)
+
+	want := model.CartItem{Id: "1", Name: "screen", Quantity: 2, ReservationStatus: model.ReservationPending}
+	assertItem(t, want, stored)
+
+	items := s.get(t).Items
+	require.Len(t, items, 1)
+	assertItem(t, want, items[0])
+
+	tasks := s.takeTasks(t)
+	require.Len(t, tasks, 1)
+	assertTask(t, model.ReserveOperation, screen, tasks[0])
+}
+
+func addItemAlreadyInCart(t *testing.T, s suite) {
+	s.add(t, screen)
+	s.add(t, mouse)
+	stored := s.add(t, model.CartItem{Id: "1", Name: "screen", Quantity: 3})
+
+	assert.Equal(t, 5, stored.Quantity)
+	assert.Equal(t, 5, s.getItem(t, "1").Quantity)
+	assert.Equal(t, 1, s.getItem(t, "2").Quantity)
+
+	assert.Len(t, s.get(t).Items, 2)
+}
+
+func addItemOverMaxQuantity(t *testing.T, s suite) {
+	s.add(t, screen)
+	s.takeTasks(t)
+
+	_, _, addErr := s.repo.Add(context.Background(), s.cartId, model.CartItem{Id: "1", Name: "screen", Quantity: model.MaxItemQuantity}, nil)
+
+	assert.ErrorIs(t, addErr, model.ErrInvalidQuantity)
+	assert.Equal(t, 2, s.getItem(t, "1").Quantity)
+	assert.Equal(t, int64(1), s.get(t).Version)
+	assert.Empty(t, s.takeTasks(t))
+}
+
+func sameItemInTwoCarts(t *testing.T, s suite) {
+	other := s
+	other.cartId = newCartId(t)
+
+	s.add(t, screen)
+	other.add(t, screen)
+
+	assert.Equal(t, 2, s.getItem(t, "1").Quantity)
+	assert.Equal(t, 2, other.getItem(t, "1").Quantity)
+}
+
+func addItemAlreadyReserved(t *testing.T, s suite) {
+	s.add(t, screen)
+	require.NoError(t, s.repo.SetReservationId(context.Background(), s.cartId, screen, "reservation-1"))
+	s.takeTasks(t)
+
+	stored := s.add(t, model.CartItem{Id: "1", Name: "screen", Quantity: 1})
+
+	assertItem(t, model.CartItem{Id: "1", Name: "screen", Quantity: 3, ReservationId: "reservation-1", ReservedQuantity: 2,
+		ReservationStatus: model.ReservationPending}, stored)
+	tasks := s.takeTasks(t)
+	require.Len(t, tasks, 1)
+	// The reservation travels with the task, so the reserver can adjust it
+	assertTask(t, model.ReserveOperation, model.CartItem{Id: "1", Name: "screen", Quantity: 3, ReservationId: "reservation-1"}, tasks[0])
+}
+
+func getUnknownItem(t *testing.T, s suite) {
+	s.add(t, screen)
+
+	_, getErr := s.repo.GetItem(context.Background(), s.cartId, "2")
+
+	assert.ErrorIs(t, getErr, model.ErrItemNotFound)
+}
+
+func setReservationId(t *testing.T, s suite) {
+	s.add(t, screen)
+	require.NoError(t, s.repo.SetReservationFailed(context.Background(), s.cartId, "1", "out of stock"))
+
+	setErr := s.repo.SetReservationId(context.Background(), s.cartId, screen, "reservation-1")
+
+	assert.NoError(t, setErr)
+	// A previous failure does not apply anymore
+	assertItem(t, model.CartItem{Id: "1", Name: "screen", Quantity: 2, ReservationId: "reservation-1", ReservedQuantity: 2,
+		ReservationStatus: model.ReservationReserved}, s.getItem(t, "1"))
+}
+
+func setReservationIdOfUnknownItem(t *testing.T, s suite) {
+	setErr := s.repo.SetReservationId(context.Background(), s.cartId, screen, "reservation-1")
+
+	assert.ErrorIs(t, setErr, model.ErrItemNotFound)
+}
+
+func setReservationFailed(t *testing.T, s suite) {
+	s.add(t, screen)
+	require.NoError(t, s.repo.SetReservationId(context.Background(), s.cartId, screen, "reservation-1"))
+
+	setErr := s.repo.SetReservationFailed(context.Background(), s.cartId, "1", "out of stock")
+
+	assert.NoError(t, setErr)
+	// The previous reservation is still valid for the quantity it covers
+	assertItem(t, model.CartItem{Id: "1", Name: "screen", Quantity: 2, ReservationId: "reservation-1", ReservedQuantity: 2,
+		ReservationStatus: model.ReservationFailed, ReservationError: "out of stock"}, s.getItem(t, "1"))
+}
+
+func setReservationFailedOfUnknownItem(t *testing.T, s suite) {
+	setErr := s.repo.SetReservationFailed(context.Background(), s.cartId, "1", "out of stock")
+
+	assert.ErrorIs(t, setErr, model.ErrItemNotFound)
+}
+
+func setReservationReleased(t *testing.T, s suite) {
+	s.add(t, screen)
+	require.NoError(t, s.repo.SetReservationId(context.Background(), s.cartId, screen, "reservation-1"))
+
+	setErr := s.repo.SetReservationReleased(context.Background(), s.cartId, "1", "reservation-1")
+
+	assert.NoError(t, setErr)
+	assertItem(t, model.CartItem{Id: "1", Name: "screen", Quantity: 2, ReservationStatus: model.ReservationReleased}, s.getItem(t, "1"))
+}
+
+func setReservationReleasedOfReplacedReservation(t *testing.T, s suite) {
+	s.add(t, screen)
+	require.NoError(t, s.repo.SetReservationId(context.Background(), s.cartId, screen, "reservation-2"))
+
+	setErr := s.repo.SetReservationReleased(context.Background(), s.cartId, "1", "reservation-1")
+
+	assert.ErrorIs(t, setErr, model.ErrItemNotFound)
+	assert.Equal(t, "reservation-2", s.getItem(t, "1").ReservationId)
+}
+
+func removeReservedItem(t *testing.T, s suite) {
+	s.add(t, screen)
+	require.NoError(t, s.repo.SetReservationId(context.Background(), s.cartId, screen, "reservation-1"))
+	s.takeTasks(t)
+
+	removed, _, removeErr := s.repo.Remove(context.Background(), s.cartId, "1", nil)
+
+	assert.NoError(t, removeErr)
+	assert.Equal(t, "reservation-1", removed.ReservationId)
+	_, getErr := s.repo.GetItem(context.Background(), s.cartId, "1")
+	assert.ErrorIs(t, getErr, model.ErrItemNotFound)
+
+	tasks := s.takeTasks(t)
+	require.Len(t, tasks, 1)
+	assertTask(t, model.ReleaseOperation, model.CartItem{Id: "1", Name: "screen", Quantity: 2, ReservationId: "reservation-1"}, tasks[0])
+}
+
+func removeItemNotReserved(t *testing.T, s suite) {
+	s.add(t, screen)
+	s.takeTasks(t)
+
+	_, _, removeErr := s.repo.Remove(context.Background(), s.cartId, "1", nil)
+
+	assert.NoError(t, removeErr)
+	assert.Empty(t, s.takeTasks(t))
+}
+
+func removeUnknownItem(t *testing.T, s suite) {
+	_, _, removeErr := s.repo.Remove(context.Background(), s.cartId, "1", nil)
+
+	assert.ErrorIs(t, removeErr, model.ErrItemNotFound)
+}
+
+func updateQuantity(t *testing.T, s suite) {
+	s.add(t, screen)
+	require.NoError(t, s.repo.SetReservationId(context.Background(), s.cartId, screen, "reservation-1"))
+	s.takeTasks(t)
+
+	updated, _, updateErr := s.repo.UpdateQuantity(context.Background(), s.cartId, "1", 7, nil)
+
+	assert.NoError(t, updateErr)
+	want := model.CartItem{Id: "1", Name: "screen", Quantity: 7, ReservationId: "reservation-1", ReservedQuantity: 2,
+		ReservationStatus: model.ReservationPending}
+	assertItem(t, want, updated)
+	assertItem(t, want, s.getItem(t, "1"))
+
+	tasks := s.takeTasks(t)
+	require.Len(t, tasks, 1)
+	assertTask(t, model.ReserveOperation, model.CartItem{Id: "1", Name: "screen", Quantity: 7, ReservationId: "reservation-1"}, tasks[0])
+}
+
+func updateQuantityCoveredByReservation(t *testing.T, s suite) {
+	s.add(t, screen)
+	require.NoError(t, s.repo.SetReservationId(context.Background(), s.cartId, screen, "reservation-1"))
+	s.takeTasks(t)
+
+	updated, _, updateErr := s.repo.UpdateQuantity(context.Background(), s.cartId, "1", 2, nil)
+
+	assert.NoError(t, updateErr)
+	assert.Equal(t, model.ReservationReserved, updated.ReservationStatus)
+	assert.Empty(t, s.takeTasks(t))
+}
+
+func updateQuantityOfUnknownItem(t *testing.T, s suite) {
+	_, _, updateErr := s.repo.UpdateQuantity(context.Background(), s.cartId, "1", 2, nil)
+
+	assert.ErrorIs(t, updateErr, model.ErrItemNotFound)
+}
+
+func concurrentAdds(t *testing.T, s suite) {
+	const adds = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, adds)
+	for i := 0; i < adds; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, addErr := s.repo.Add(context.Background(), s.cartId, model.CartItem{Id: "1", Name: "screen", Quantity: 1}, nil); addErr != nil {
+				errs <- fmt.Errorf("concurrent add --> %w", addErr)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for addErr := range errs {
+		assert.NoError(t, addErr)
+	}
+	assert.Equal(t, adds, s.getItem(t, "1").Quantity)
+}
+
+func versionIncreased(t *testing.T, s suite) {
+	_, added, addErr := s.repo.Add(context.Background(), s.cartId, screen, nil)
+	require.NoError(t, addErr)
+	_, merged, addErr := s.repo.Add(context.Background(), s.cartId, screen, nil)
+	require.NoError(t, addErr)
+	_, updated, updateErr := s.repo.UpdateQuantity(context.Background(), s.cartId, "1", 7, nil)
+	require.NoError(t, updateErr)
+	_, removed, removeErr := s.repo.Remove(context.Background(), s.cartId, "1", nil)
+	require.NoError(t, removeErr)
+
+	assert.Equal(t, []int64{1, 2, 3, 4}, []int64{added, merged, updated, removed})
+	assert.Equal(t, int64(4), s.get(t).Version)
+}
+
+func versionKeptByReservations(t *testing.T, s suite) {
+	s.add(t, screen)
+
+	require.NoError(t, s.repo.SetReservationId(context.Background(), s.cartId, screen, "reservation-1"))
+	require.NoError(t, s.repo.SetReservationFailed(context.Background(), s.cartId, "1", "out of stock"))
+	require.NoError(t, s.repo.SetReservationReleased(context.Background(), s.cartId, "1", "reservation-1"))
+
+	assert.Equal(t, int64(1), s.get(t).Version)
+}
+
+func expectedVersionMatches(t *testing.T, s suite) {
+	// A cart that does not exist yet is at version 0
+	_, added, addErr := s.repo.Add(context.Background(), s.cartId, screen, expect(0))
+	require.NoError(t, addErr)
+	_, updated, updateErr := s.repo.UpdateQuantity(context.Background(), s.cartId, "1", 7, expect(added))
+	require.NoError(t, updateErr)
+	_, removed, removeErr := s.repo.Remove(context.Background(), s.cartId, "1", expect(updated))
+	require.NoError(t, removeErr)
+
+	assert.Equal(t, int64(3), removed)
+}
+
+func expectedVersionStale(t *testing.T, s suite) {
+	s.add(t, screen)
+	s.add(t, mouse)
+	s.takeTasks(t)
+
+	_, _, addErr := s.repo.Add(context.Background(), s.cartId, screen, expect(1))
+	assertConflict(t, 2, addErr)
+	_, _, updateErr := s.repo.UpdateQuantity(context.Background(), s.cartId, "1", 7, expect(1))
+	assertConflict(t, 2, updateErr)
+	_, _, removeErr := s.repo.Remove(context.Background(), s.cartId, "2", expect(1))
+	assertConflict(t, 2, removeErr)
+
+	cart := s.get(t)
+	assert.Equal(t, int64(2), cart.Version)
+	assert.Len(t, cart.Items, 2)
+	assert.Equal(t, 2, s.getItem(t, "1").Quantity)
+	assert.Empty(t, s.takeTasks(t))
+}
+
+func expectedVersionOfUnknownCart(t *testing.T, s suite) {
+	_, _, removeErr := s.repo.Remove(context.Background(), s.cartId, "1", expect(0))
+	assert.ErrorIs(t, removeErr, model.ErrItemNotFound)
+
+	_, _, updateErr := s.repo.UpdateQuantity(context.Background(), s.cartId, "1", 2, expect(3))
+	assertConflict(t, 0, updateErr)
+
+	_, _, addErr := s.repo.Add(context.Background(), s.cartId, screen, expect(3))
+	assertConflict(t, 0, addErr)
+	assert.Empty(t, s.get(t).Items)
+}
+
+// Two tabs changing the same cart. Only the first change is applied, the other one is told that the cart changed
+func concurrentChangesWithExpectedVersion(t *testing.T, s suite) {
+	const changes = 10
+	s.add(t, screen)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, changes)
+	for i := 0; i < changes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, addErr := s.repo.Add(context.Background(), s.cartId, model.CartItem{Id: "1", Name: "screen", Quantity: 1}, expect(1))
+			errs <- addErr
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	applied := 0
+	for addErr := range errs {
+		if addErr == nil {
+			applied++
+			continue
+		}
+		assertConflict(t, 2, addErr)
+	}
+	assert.Equal(t, 1, applied)
+	assert.Equal(t, 3, s.getItem(t, "1").Quantity)
+}
+
+func ownerOfUnknownCart(t *testing.T, s suite) {
+	owner, ownerErr := s.repo.CartOwner(context.Background(), s.cartId)
+
+	assert.NoError(t, ownerErr)
+	assert.Empty(t, owner)
+}
+
+// The claimed cart is an empty one, same as a cart that does not exist yet
+func claimUnknownCart(t *testing.T, s suite) {
+	owner, claimErr := s.repo.ClaimCart(context.Background(), s.cartId, "alice")
+	require.NoError(t, claimErr)
+	assert.Equal(t, "alice", owner)
+
+	stored, ownerErr := s.repo.CartOwner(context.Background(), s.cartId)
+	assert.NoError(t, ownerErr)
+	assert.Equal(t, "alice", stored)
+	cart := s.get(t)
+	assert.Empty(t, cart.Items)
+	assert.Equal(t, int64(0), cart.Version)
+
+	_, version, addErr := s.repo.Add(context.Background(), s.cartId, screen, expect(0))
+	assert.NoError(t, addErr)
+	assert.Equal(t, int64(1), version)
+}
+
+// Carts created before their clients were authenticated
+func claimCartWithoutOwner(t *testing.T, s suite) {
+	s.add(t, screen)
+
+	owner, claimErr := s.repo.ClaimCart(context.Background(), s.cartId, "alice")
+	require.NoError(t, claimErr)
+	assert.Equal(t, "alice", owner)
+	assert.Equal(t, int64(1), s.get(t).Version)
+}
+
+func claimCartOwnedBySomeoneElse(t *testing.T, s suite) {
+	_, claimErr := s.repo.ClaimCart(context.Background(), s.cartId, "alice")
+	require.NoError(t, claimErr)
+
+	owner, claimErr := s.repo.ClaimCart(context.Background(), s.cartId, "bob")
+	require.NoError(t, claimErr)
+	assert.Equal(t, "alice", owner)
+
+	stored, ownerErr := s.repo.CartOwner(context.Background(), s.cartId)
+	assert.NoError(t, ownerErr)
+	assert.Equal(t, "alice", stored)
+}
+
+// A guest cart with its own id, sharing the repository and the outbox
+func (s suite) guest(t *testing.T) suite {
+	guest := s
+	guest.cartId = newCartId(t)
+	return guest
+}
+
+func (s suite) reserve(t *testing.T, item model.CartItem, reservationId string) {
+	require.NoError(t, s.repo.SetReservationId(context.Background(), s.cartId, item, reservationId))
+}
+
+// Same as takeTasks, for the tasks of the cart and the guest cart at once
+func takeMergeTasks(t *testing.T, s suite, guest suite) ([]model.ReservationTask, []model.ReservationTask) {
+	claimed, claimErr := s.outbox.Claim(context.Background(), 1000, time.Minute)
+	require.NoError(t, claimErr)
+
+	tasks, guestTasks := []model.ReservationTask{}, []model.ReservationTask{}
+	for _, task := range claimed {
+		switch task.CartId {
+		case s.cartId:
+			tasks = append(tasks, task)
+		case guest.cartId:
+			guestTasks = append(guestTasks, task)
+		default:
+			continue
+		}
+		require.NoError(t, s.outbox.MarkDone(context.Background(), task.Id))
+	}
+	return tasks, guestTasks
+}
+
+func mergeGuestCart(t *testing.T, s suite) {
+	guest := s.guest(t)
+	s.add(t, screen)
+	s.reserve(t, screen, "reservation-1")
+	guest.add(t, model.CartItem{Id: "1", Name: "screen", Quantity: 1})
+	guest.reserve(t, model.CartItem{Id: "1", Quantity: 1}, "reservation-2")
+	guest.add(t, mouse)
+	guest.reserve(t, mouse, "reservation-3")
+	s.takeTasks(t)
+
+	cart, mergeErr := s.repo.Merge(context.Background(), guest.cartId, s.cartId, expect(1))
+	require.NoError(t, mergeErr)
+
+	assert.Equal(t, int64(2), cart.Version)
+	require.Len(t, cart.Items, 2)
+	// The quantities are summed up as when adding, and the cart keeps its reservation, adjusted in background
+	mergedScreen := model.CartItem{Id: "1", Name: "screen", Quantity: 3, ReservationId: "reservation-1", ReservedQuantity: 2,
+		ReservationStatus: model.ReservationPending}
+	movedMouse := model.CartItem{Id: "2", Name: "mouse", Quantity: 1, ReservationId: "reservation-3", ReservedQuantity: 1,
+		ReservationStatus: model.ReservationReserved}
+	assertItem(t, mergedScreen, s.getItem(t, "1"))
+	assertItem(t, movedMouse, s.getItem(t, "2"))
+	assert.Equal(t, s.get(t), cart)
+
+	tasks, guestTasks := takeMergeTasks(t, s, guest)
+	require.Len(t, tasks, 1)
+	assertTask(t, model.ReserveOperation, model.CartItem{Id: "1", Name: "screen", Quantity: 3, ReservationId: "reservation-1"}, tasks[0])
+	// The guest reservation of the screen is not needed anymore
+	require.Len(t, guestTasks, 1)
+	assertTask(t, model.ReleaseOperation, model.CartItem{Id: "1", Name: "screen", Quantity: 1, ReservationId: "reservation-2"}, guestTasks[0])
+
+	guestCart := guest.get(t)
+	assert.Empty(t, guestCart.Items)
+	assert.Equal(t, int64(0), guestCart.Version)
+	_, mergeAgainErr := s.repo.Merge(context.Background(), guest.cartId, s.cartId, nil)
+	assert.ErrorIs(t, mergeAgainErr, model.ErrCartNotFound)
+}
+
+func mergeTakesOverGuestReservation(t *testing.T, s suite) {
+	guest := s.guest(t)
+	s.add(t, screen)
+	guest.add(t, screen)
+	guest.reserve(t, screen, "reservation-2")
+	s.takeTasks(t)
+
+	_, mergeErr := s.repo.Merge(context.Background(), guest.cartId, s.cartId, nil)
+	require.NoError(t, mergeErr)
+
+	assertItem(t, model.CartItem{Id: "1", Name: "screen", Quantity: 4, ReservationId: "reservation-2", ReservedQuantity: 2,
+		ReservationStatus: model.ReservationPending}, s.getItem(t, "1"))
+	tasks, guestTasks := takeMergeTasks(t, s, guest)
+	require.Len(t, tasks, 1)
+	assertTask(t, model.ReserveOperation, model.CartItem{Id: "1", Name: "screen", Quantity: 4, ReservationId: "reservation-2"}, tasks[0])
+	assert.Empty(t, guestTasks)
+}
+
+// I.E. the user had never added anything before logging in. Items still waiting for their reservation are reserved
+// for the cart, as the tasks of the guest cart find nothing to reserve
+func mergeIntoUnknownCart(t *testing.T, s suite) {
+	guest := s.guest(t)
+	guest.add(t, screen)
+	s.takeTasks(t)
+
+	cart, mergeErr := s.repo.Merge(context.Background(), guest.cartId, s.cartId, expect(0))
+	require.NoError(t, mergeErr)
+
+	assert.Equal(t, int64(1), cart.Version)
+	require.Len(t, cart.Items, 1)
+	assertItem(t, model.CartItem{Id: "1", Name: "screen", Quantity: 2, ReservationStatus: model.ReservationPending}, cart.Items[0])
+	tasks, _ := takeMergeTasks(t, s, guest)
+	require.Len(t, tasks, 1)
+	assertTask(t, model.ReserveOperation, screen, tasks[0])
+}
+
+func mergeUnknownGuestCart(t *testing.T, s suite) {
+	guest := s.guest(t)
+
+	_, mergeErr := s.repo.Merge(context.Background(), guest.cartId, s.cartId, nil)
+
+	assert.ErrorIs(t, mergeErr, model.ErrCartNotFound)
+	assert.Equal(t, int64(0), s.get(t).Version)
+}
+
+func mergeWithStaleVersion(t *testing.T, s suite) {
+	guest := s.guest(t)
+	s.add(t, screen)
+	guest.add(t, mouse)
+
+	_, mergeErr := s.repo.Merge(context.Background(), guest.cartId, s.cartId, expect(0))
+
+	assertConflict(t, 1, mergeErr)
+	assert.Len(t, s.get(t).Items, 1)
+	assert.Len(t, guest.get(t).Items, 1)
+}
+
+// Same limit as when adding. The mouse is moved before the screen fails, and it must not be moved either
+func mergeOverMaxQuantity(t *testing.T, s suite) {
+	guest := s.guest(t)
+	s.add(t, model.CartItem{Id: "1", Name: "screen", Quantity: 600})
+	guest.add(t, mouse)
+	guest.add(t, model.CartItem{Id: "1", Name: "screen", Quantity: 600})
+	s.takeTasks(t)
+	guest.takeTasks(t)
+
+	_, mergeErr := s.repo.Merge(context.Background(), guest.cartId, s.cartId, nil)
+
+	assert.ErrorIs(t, mergeErr, model.ErrInvalidQuantity)
+	cart := s.get(t)
+	assert.Equal(t, int64(1), cart.Version)
+	require.Len(t, cart.Items, 1)
+	assert.Equal(t, 600, cart.Items[0].Quantity)
+	guestCart := guest.get(t)
+	assert.Equal(t, int64(2), guestCart.Version)
+	require.Len(t, guestCart.Items, 2)
+	assert.Equal(t, 600, guest.getItem(t, "1").Quantity)
+	tasks, guestTasks := takeMergeTasks(t, s, guest)
+	assert.Empty(t, tasks)
+	assert.Empty(t, guestTasks)
+}
+
+// Other tests may have left idle carts behind, so every cart idle since then is expired until the cart of the suite
+// shows up. Returns it, if it has been expired
+func (s suite) expire(t *testing.T, idleSince time.Time) (model.AbandonedCart, bool) {
+	const batch = 100
+	for {
+		carts, expireErr := s.repo.ExpireCarts(context.Background(), idleSince, batch)
+		require.NoError(t, expireErr)
+		for _, cart := range carts {
+			if cart.CartId == s.cartId {
+				return cart, true
+			}
+		}
+		if len(carts) < batch {
+			return model.AbandonedCart{}, false
+		}
+	}
+}
+
+// Times are stored with millisecond precision, at best. Waiting a bit tells apart the changes made before and after
+func pause() time.Time {
+	time.Sleep(20 * time.Millisecond)
+	idleSince := time.Now().UTC()
+	time.Sleep(20 * time.Millisecond)
+	return idleSince
+}
+
+func expireIdleCart(t *testing.T, s suite) {
+	owner, claimErr := s.repo.ClaimCart(context.Background(), s.cartId, "alice")
+	require.NoError(t, claimErr)
+	require.Equal(t, "alice", owner)
+	reservedScreen := s.add(t, screen)
+	s.add(t, mouse)
+	s.reserve(t, reservedScreen, "reservation-1")
+	s.takeTasks(t)
+
+	cart, expired := s.expire(t, time.Now().UTC().Add(time.Second))
+
+	require.True(t, expired)
+	assert.Equal(t, "alice", cart.OwnerId)
+	assert.False(t, cart.CreatedAt.IsZero())
+	assert.False(t, cart.UpdatedAt.Before(cart.CreatedAt))
+	assert.False(t, cart.ExpiredAt.IsZero())
+	require.Len(t, cart.Items, 2)
+	assert.ElementsMatch(t, []string{screen.Id, mouse.Id}, []string{cart.Items[0].Id, cart.Items[1].Id})
+
+	// The cart starts from scratch, as if it had never existed
+	afterwards := s.get(t)
+	assert.Empty(t, afterwards.Items)
+	assert.Equal(t, int64(0), afterwards.Version)
+	owner, ownerErr := s.repo.CartOwner(context.Background(), s.cartId)
+	require.NoError(t, ownerErr)
+	assert.Empty(t, owner)
+
+	// Only the reserved item has something to release
+	tasks := s.takeTasks(t)
+	require.Len(t, tasks, 1)
+	assertTask(t, model.ReleaseOperation, model.CartItem{Id: screen.Id, Name: screen.Name, Quantity: screen.Quantity,
+		ReservationId: "reservation-1"}, tasks[0])
+}
+
+func expireCartChangedSince(t *testing.T, s suite) {
+	s.add(t, screen)
+	idleSince := pause()
+	_, _, updateErr := s.repo.UpdateQuantity(context.Background(), s.cartId, screen.Id, 3, nil)
+	require.NoError(t, updateErr)
+
+	_, expired := s.expire(t, idleSince)
+
+	assert.False(t, expired)
+	assert.Len(t, s.get(t).Items, 1)
+}
+
+// Reservations are done in background. They are not changes made by the shopper
+func expireCartWithReservationUpdatedSince(t *testing.T, s suite) {
+	stored := s.add(t, screen)
+	idleSince := pause()
+	s.reserve(t, stored, "reservation-1")
+
+	cart, expired := s.expire(t, idleSince)
+
+	require.True(t, expired)
+	require.Len(t, cart.Items, 1)
+	assert.Equal(t, "reservation-1", cart.Items[0].ReservationId)
+}
+
+func expireMoreCartsThanLimit(t *testing.T, s suite) {
+	s.add(t, screen)
+	other := s.guest(t)
+	other.add(t, mouse)
+
+	carts, expireErr := s.repo.ExpireCarts(context.Background(), time.Now().UTC().Add(time.Second), 1)
+
+	require.NoError(t, expireErr)
+	assert.Len(t, carts, 1)
+}
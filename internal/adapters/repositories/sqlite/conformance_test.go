@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/Harital/shopping-cart/internal/adapters/repositories/repositorytest"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+)
+
+// Every test gets its own migrated database file
+func newDB(t *testing.T) *sql.DB {
+	db, initErr := InitSQLiteDB(Config{Path: filepath.Join(t.TempDir(), "shopping-cart.db")})
+	if initErr != nil {
+		t.Fatalf("Error when opening the database: %v", initErr)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, migrateErr := NewMigrator(db).Up(context.TODO()); migrateErr != nil {
+		t.Fatalf("Error when migrating the database: %v", migrateErr)
+	}
+	return db
+}
+
+// No database server is needed, so the suite always runs against a real database
+func Test_CartItemsRepository_Conformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) (ports.CartItemsRepository, ports.ReservationOutbox) {
+		db := newDB(t)
+		return NewCartItemsRepository(db), NewReservationOutbox(db)
+	})
+}
+
+func Test_CartEventsOutbox_Conformance(t *testing.T) {
+	repositorytest.RunCartEvents(t, func(t *testing.T) (ports.CartItemsRepository, ports.CartEventsOutbox) {
+		db := newDB(t)
+		return NewCartItemsRepository(db), NewCartEventsOutbox(db)
+	})
+}
+
+func Test_IdempotencyKeysRepository_Conformance(t *testing.T) {
+	repositorytest.RunIdempotencyKeys(t, func(t *testing.T) ports.IdempotencyKeysRepository {
+		return NewIdempotencyKeysRepository(newDB(t))
+	})
+}
+
+func Test_APIKeysRepository_Conformance(t *testing.T) {
+	repositorytest.RunAPIKeys(t, func(t *testing.T) ports.APIKeysRepository {
+		return NewAPIKeysRepository(newDB(t))
+	})
+}
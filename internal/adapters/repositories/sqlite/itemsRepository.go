@@ -0,0 +1,710 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// Same tables as the mysql adapter. See the migrations folder
+const (
+	cartTable     = "cart"
+	cartItemTable = "cartItem"
+)
+
+var (
+	cartItemColumns = []string{"id", "name", "quantity", "reservationId", "reservedQuantity", "reservationStatus", "reservationError", "reservationUpdatedAt"}
+
+	// SQLite returns the written row, so there is no need to read it again after an insert, update or delete
+	returningCartItem = "RETURNING " + strings.Join(cartItemColumns, ", ")
+)
+
+type CartItemsRepository struct {
+	db *sql.DB
+}
+
+func NewCartItemsRepository(db *sql.DB) *CartItemsRepository {
+	return &CartItemsRepository{db: db}
+}
+
+// Both sql.Row and sql.Rows can be scanned, so the same function is used for reading one or several items.
+// The columns must be selected in the cartItemColumns order
+func scanCartItem(scanner interface{ Scan(dest ...any) error }) (model.CartItem, error) {
+	var item model.CartItem
+
+	// ReservationID, the error and the timestamp can be null, hence the need of the sql.Null types
+	var reservationId, reservationError sql.NullString
+	var reservationUpdatedAt sql.NullTime
+	if scanErr := scanner.Scan(&item.Id, &item.Name, &item.Quantity, &reservationId, &item.ReservedQuantity,
+		&item.ReservationStatus, &reservationError, &reservationUpdatedAt); scanErr != nil {
+		return model.CartItem{}, scanErr
+	}
+
+	if reservationId.Valid {
+		item.ReservationId = reservationId.String
+	}
+	if reservationError.Valid {
+		item.ReservationError = reservationError.String
+	}
+	if reservationUpdatedAt.Valid {
+		item.ReservationUpdatedAt = &reservationUpdatedAt.Time
+	}
+	return item, nil
+}
+
+// Scans the row returned by an insert, update or delete. No row means the item is not in the cart
+func scanReturnedCartItem(row *sql.Row, cartId string, itemId string) (model.CartItem, error) {
+	item, scanErr := scanCartItem(row)
+	if errors.Is(scanErr, sql.ErrNoRows) {
+		return model.CartItem{}, fmt.Errorf("item id %s in cart %s --> %w", itemId, cartId, model.ErrItemNotFound)
+	}
+	if scanErr != nil {
+		return model.CartItem{}, fmt.Errorf("reading item --> %w", scanErr)
+	}
+	return item, nil
+}
+
+// Both the db and a transaction can be queried. A cart that does not exist yet is at version 0
+func cartVersion(ctx context.Context, q interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}, cartId string) (int64, error) {
+	sb := sqlbuilder.SQLite.NewSelectBuilder()
+	sb.
+		Select("version").
+		From(cartTable).
+		Where(sb.Equal("id", cartId))
+
+	query, args := sb.Build()
+	var version int64
+	scanErr := q.QueryRowContext(ctx, query, args...).Scan(&version)
+	if errors.Is(scanErr, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if scanErr != nil {
+		return 0, fmt.Errorf("reading cart version --> %w", scanErr)
+	}
+	return version, nil
+}
+
+// Both the db and a transaction can be queried. The rows are read at once, so the transaction can be used again
+// right after
+func cartItems(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}, cartId string) ([]model.CartItem, error) {
+	sb := sqlbuilder.SQLite.NewSelectBuilder()
+	sb.
+		Select(cartItemColumns...).
+		From(cartItemTable).
+		Where(sb.Equal("cartId", cartId))
+
+	query, args := sb.Build()
+	rows, selectErr := q.QueryContext(ctx, query, args...)
+	if selectErr != nil {
+		return nil, selectErr
+	}
+
+	defer rows.Close()
+
+	var items []model.CartItem
+	for rows.Next() {
+		singleItem, scanErr := scanCartItem(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("Scanning cart items properties --> %w", scanErr)
+		}
+
+		items = append(items, singleItem)
+	}
+	return items, rows.Err()
+}
+
+// Increases the version of the cart, if it is still at the expected one. Updating the cart row locks it, so the
+// changes of the same cart are serialized until the transaction ends. Returns the new version.
+// Every change made by the clients goes through here, so it is also the last change of the cart
+func bumpCartVersion(ctx context.Context, tx *sql.Tx, cartId string, expectedVersion *int64) (int64, error) {
+	sb := sqlbuilder.SQLite.NewUpdateBuilder()
+	sb.Update(cartTable).
+		Set(
+			sb.Incr("version"),
+			sb.Assign("updatedAt", time.Now().UTC()),
+		).
+		Where(sb.Equal("id", cartId))
+	if expectedVersion != nil {
+		sb.Where(sb.Equal("version", *expectedVersion))
+	}
+	sb.SQL("RETURNING version")
+
+	query, args := sb.Build()
+	var version int64
+	scanErr := tx.QueryRowContext(ctx, query, args...).Scan(&version)
+	if errors.Is(scanErr, sql.ErrNoRows) {
+		current, versionErr := cartVersion(ctx, tx, cartId)
+		if versionErr != nil {
+			return 0, versionErr
+		}
+		if conflictErr := model.CheckCartVersion(cartId, expectedVersion, current); conflictErr != nil {
+			return 0, conflictErr
+		}
+		// Nothing to change in a cart that does not exist
+		return 0, fmt.Errorf("cart %s --> %w", cartId, model.ErrItemNotFound)
+	}
+	if scanErr != nil {
+		return 0, fmt.Errorf("cannot update cart version --> %w", scanErr)
+	}
+	return version, nil
+}
+
+// Leaves the cart untouched if it already exists. The timestamps have no default, see the migrations
+func createCart(ctx context.Context, tx *sql.Tx, cartId string) error {
+	now := time.Now().UTC()
+
+	sb := sqlbuilder.SQLite.NewInsertBuilder()
+	sb.
+		InsertIgnoreInto(cartTable).
+		Cols("id", "createdAt", "updatedAt").
+		Values(cartId, now, now)
+
+	query, args := sb.Build()
+	if _, insertErr := tx.ExecContext(ctx, query, args...); insertErr != nil {
+		return fmt.Errorf("creating cart --> %w", insertErr)
+	}
+	return nil
+}
+
+// Marks the item as pending and writes the reserve task in the outbox. The item is updated accordingly
+func requestReservation(ctx context.Context, tx *sql.Tx, cartId string, item *model.CartItem) error {
+	now := time.Now().UTC()
+
+	sb := sqlbuilder.SQLite.NewUpdateBuilder()
+	sb.Update(cartItemTable).
+		Set(
+			sb.Assign("reservationStatus", string(model.ReservationPending)),
+			sb.Assign("reservationUpdatedAt", now),
+		).
+		Where(sb.Equal("cartId", cartId), sb.Equal("id", item.Id))
+
+	query, args := sb.Build()
+	if _, updateErr := tx.ExecContext(ctx, query, args...); updateErr != nil {
+		return fmt.Errorf("setting reservation as pending --> %w", updateErr)
+	}
+	item.ReservationStatus = model.ReservationPending
+	item.ReservationUpdatedAt = &now
+
+	return insertReservationTask(ctx, tx, model.NewReserveTask(cartId, *item))
+}
+
+func (cir CartItemsRepository) Get(ctx context.Context, cartId string) (model.Cart, error) {
+	// Read before the items. See ports.CartItemsRepository
+	version, versionErr := cartVersion(ctx, cir.db, cartId)
+	if versionErr != nil {
+		return model.Cart{}, versionErr
+	}
+
+	items, itemsErr := cartItems(ctx, cir.db, cartId)
+	if itemsErr != nil {
+		return model.Cart{}, itemsErr
+	}
+	return model.Cart{Version: version, Items: items}, nil
+}
+
+func (cir CartItemsRepository) GetItem(ctx context.Context, cartId string, itemId string) (model.CartItem, error) {
+	sb := sqlbuilder.SQLite.NewSelectBuilder()
+	sb.
+		Select(cartItemColumns...).
+		From(cartItemTable).
+		Where(sb.Equal("cartId", cartId), sb.Equal("id", itemId))
+
+	query, args := sb.Build()
+	return scanReturnedCartItem(cir.db.QueryRowContext(ctx, query, args...), cartId, itemId)
+}
+
+// Returns the item as stored after the addition. If it already was in the cart, the quantity is the merged one.
+// The reservation of the item is requested through the outbox
+func (cir *CartItemsRepository) Add(ctx context.Context, cartId string, item model.CartItem, expectedVersion *int64) (model.CartItem, int64, error) {
+
+	// The cart and the item are written in the same transaction, so we never end up with orphan items
+	tx, beginErr := cir.db.BeginTx(ctx, nil)
+	if beginErr != nil {
+		return model.CartItem{}, 0, fmt.Errorf("starting transaction for adding items to cart --> %w", beginErr)
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer func() { _ = tx.Rollback() }()
+
+	// Carts are created the first time an item is added to them. INSERT OR IGNORE leaves the existing ones untouched
+	if cartErr := createCart(ctx, tx, cartId); cartErr != nil {
+		return model.CartItem{}, 0, cartErr
+	}
+
+	version, versionErr := bumpCartVersion(ctx, tx, cartId, expectedVersion)
+	if versionErr != nil {
+		return model.CartItem{}, 0, versionErr
+	}
+
+	// The primary key is (cartId, id), so the quantities are only merged within the same cart.
+	// Same upsert as the mysql ON DUPLICATE KEY UPDATE. excluded is the row that could not be inserted
+	now := time.Now().UTC()
+	sb := sqlbuilder.SQLite.NewInsertBuilder()
+	sb.
+		InsertInto(cartItemTable).
+		Cols("cartId", "id", "name", "quantity", "createdAt", "updatedAt").
+		Values(cartId, item.Id, item.Name, item.Quantity, now, now).
+		SQL("ON CONFLICT (cartId, id) DO UPDATE SET quantity = quantity + excluded.quantity, updatedAt = excluded.updatedAt").
+		SQL(returningCartItem)
+
+	// The merged quantity is needed to know if the current reservation still covers the item
+	query, args := sb.Build()
+	storedItem, scanErr := scanCartItem(tx.QueryRowContext(ctx, query, args...))
+	if scanErr != nil {
+		return model.CartItem{}, 0, fmt.Errorf("inserting items to cart --> %w", scanErr)
+	}
+
+	// The transaction is rolled back, so the quantity already in the cart is kept
+	if quantityErr := storedItem.CheckMergedQuantity(); quantityErr != nil {
+		return model.CartItem{}, 0, quantityErr
+	}
+
+	if storedItem.NeedsReservation() {
+		if taskErr := requestReservation(ctx, tx, cartId, &storedItem); taskErr != nil {
+			return model.CartItem{}, 0, taskErr
+		}
+	}
+
+	if commitErr := tx.Commit(); commitErr != nil {
+		return model.CartItem{}, 0, fmt.Errorf("committing items to cart --> %w", commitErr)
+	}
+
+	return storedItem, version, nil
+}
+
+// The reservation covers the quantity of the item when it was reserved, so it is stored alongside the reservation id
+func (cir *CartItemsRepository) SetReservationId(ctx context.Context, cartId string, item model.CartItem, reservationId string) error {
+
+	sb := sqlbuilder.SQLite.NewUpdateBuilder()
+	sb.Update(cartItemTable).
+		Set(
+			sb.Assign("reservationId", reservationId),
+			sb.Assign("reservedQuantity", item.Quantity),
+			sb.Assign("reservationStatus", string(model.ReservationReserved)),
+			// A previous failure does not apply anymore
+			sb.Assign("reservationError", nil),
+			sb.Assign("reservationUpdatedAt", time.Now().UTC()),
+		).
+		Where(sb.Equal("cartId", cartId), sb.Equal("id", item.Id))
+
+	return cir.update(ctx, sb, "reservationId", cartId, item.Id)
+}
+
+// The reason is truncated to fit in the column. The previous reservation, if any, is kept, as it is still valid
+// for the quantity it covers
+func (cir *CartItemsRepository) SetReservationFailed(ctx context.Context, cartId string, itemId string, reason string) error {
+
+	sb := sqlbuilder.SQLite.NewUpdateBuilder()
+	sb.Update(cartItemTable).
+		Set(
+			sb.Assign("reservationStatus", string(model.ReservationFailed)),
+			sb.Assign("reservationError", truncate(reason, maxLastErrorLength)),
+			sb.Assign("reservationUpdatedAt", time.Now().UTC()),
+		).
+		Where(sb.Equal("cartId", cartId), sb.Equal("id", itemId))
+
+	return cir.update(ctx, sb, "reservation error", cartId, itemId)
+}
+
+// Only applies if the item still holds the released reservation. Otherwise it has already been replaced
+func (cir *CartItemsRepository) SetReservationReleased(ctx context.Context, cartId string, itemId string, reservationId string) error {
+
+	sb := sqlbuilder.SQLite.NewUpdateBuilder()
+	sb.Update(cartItemTable).
+		Set(
+			sb.Assign("reservationId", nil),
+			sb.Assign("reservedQuantity", 0),
+			sb.Assign("reservationStatus", string(model.ReservationReleased)),
+			sb.Assign("reservationUpdatedAt", time.Now().UTC()),
+		).
+		Where(sb.Equal("cartId", cartId), sb.Equal("id", itemId), sb.Equal("reservationId", reservationId))
+
+	return cir.update(ctx, sb, "released reservation", cartId, itemId)
+}
+
+// SQLite reports the matched rows, so updating a value with the same one is not mistaken for a missing item
+func (cir *CartItemsRepository) update(ctx context.Context, sb *sqlbuilder.UpdateBuilder, what string, cartId string, itemId string) error {
+	query, args := sb.Build()
+	result, updateErr := cir.db.ExecContext(ctx, query, args...)
+	if updateErr != nil {
+		return fmt.Errorf("cannot update %s --> %w", what, updateErr)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot check rows affected when updating %s --> %w", what, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("item id %s in cart %s --> %w", itemId, cartId, model.ErrItemNotFound)
+	}
+	return nil
+}
+
+// The reservation of the removed item, if any, is released through the outbox
+func (cir *CartItemsRepository) Remove(ctx context.Context, cartId string, itemId string, expectedVersion *int64) (model.CartItem, int64, error) {
+
+	// The release task is written in the same transaction as the deletion
+	tx, beginErr := cir.db.BeginTx(ctx, nil)
+	if beginErr != nil {
+		return model.CartItem{}, 0, fmt.Errorf("starting transaction for removing item --> %w", beginErr)
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer func() { _ = tx.Rollback() }()
+
+	version, versionErr := bumpCartVersion(ctx, tx, cartId, expectedVersion)
+	if versionErr != nil {
+		return model.CartItem{}, 0, versionErr
+	}
+
+	// The deleted row is returned, as its reservation needs to be released
+	sb := sqlbuilder.SQLite.NewDeleteBuilder()
+	sb.
+		DeleteFrom(cartItemTable).
+		Where(sb.Equal("cartId", cartId), sb.Equal("id", itemId)).
+		SQL(returningCartItem)
+
+	query, args := sb.Build()
+	item, deleteErr := scanReturnedCartItem(tx.QueryRowContext(ctx, query, args...), cartId, itemId)
+	if deleteErr != nil {
+		return model.CartItem{}, 0, deleteErr
+	}
+
+	// Items whose reservation has not been done yet have nothing to release
+	if item.ReservationId != "" {
+		if taskErr := insertReservationTask(ctx, tx, model.NewReleaseTask(cartId, item)); taskErr != nil {
+			return model.CartItem{}, 0, taskErr
+		}
+	}
+
+	if commitErr := tx.Commit(); commitErr != nil {
+		return model.CartItem{}, 0, fmt.Errorf("committing item removal --> %w", commitErr)
+	}
+
+	return item, version, nil
+}
+
+// Returns the item as stored after the update. If its reservation does not cover the new quantity,
+// it is reserved again through the outbox
+func (cir *CartItemsRepository) UpdateQuantity(ctx context.Context, cartId string, itemId string, quantity int, expectedVersion *int64) (model.CartItem, int64, error) {
+
+	tx, beginErr := cir.db.BeginTx(ctx, nil)
+	if beginErr != nil {
+		return model.CartItem{}, 0, fmt.Errorf("starting transaction for updating quantity --> %w", beginErr)
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer func() { _ = tx.Rollback() }()
+
+	version, versionErr := bumpCartVersion(ctx, tx, cartId, expectedVersion)
+	if versionErr != nil {
+		return model.CartItem{}, 0, versionErr
+	}
+
+	sb := sqlbuilder.SQLite.NewUpdateBuilder()
+	sb.Update(cartItemTable).
+		Set(
+			sb.Assign("quantity", quantity),
+			sb.Assign("updatedAt", time.Now().UTC()),
+		).
+		Where(sb.Equal("cartId", cartId), sb.Equal("id", itemId)).
+		SQL(returningCartItem)
+
+	query, args := sb.Build()
+	item, updateErr := scanReturnedCartItem(tx.QueryRowContext(ctx, query, args...), cartId, itemId)
+	if updateErr != nil {
+		return model.CartItem{}, 0, updateErr
+	}
+
+	if item.NeedsReservation() {
+		if taskErr := requestReservation(ctx, tx, cartId, &item); taskErr != nil {
+			return model.CartItem{}, 0, taskErr
+		}
+	}
+
+	if commitErr := tx.Commit(); commitErr != nil {
+		return model.CartItem{}, 0, fmt.Errorf("committing quantity update --> %w", commitErr)
+	}
+
+	return item, version, nil
+}
+
+func (cir CartItemsRepository) CartOwner(ctx context.Context, cartId string) (string, error) {
+	sb := sqlbuilder.SQLite.NewSelectBuilder()
+	sb.
+		Select("ownerId").
+		From(cartTable).
+		Where(sb.Equal("id", cartId))
+
+	query, args := sb.Build()
+	var owner sql.NullString
+	scanErr := cir.db.QueryRowContext(ctx, query, args...).Scan(&owner)
+	if errors.Is(scanErr, sql.ErrNoRows) {
+		return "", nil
+	}
+	if scanErr != nil {
+		return "", fmt.Errorf("reading cart owner --> %w", scanErr)
+	}
+	return owner.String, nil
+}
+
+// Empty reservation ids and errors are stored as null, as they are when the item is added
+func nullableString(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// Writes every column of the item, whether it is already in the cart or not
+func writeCartItem(ctx context.Context, tx *sql.Tx, cartId string, item model.CartItem) error {
+	var reservationUpdatedAt any
+	if item.ReservationUpdatedAt != nil {
+		reservationUpdatedAt = item.ReservationUpdatedAt.UTC()
+	}
+
+	now := time.Now().UTC()
+
+	sb := sqlbuilder.SQLite.NewInsertBuilder()
+	sb.
+		InsertInto(cartItemTable).
+		Cols(append(append([]string{"cartId"}, cartItemColumns...), "createdAt", "updatedAt")...).
+		Values(cartId, item.Id, item.Name, item.Quantity, nullableString(item.ReservationId), item.ReservedQuantity,
+			string(item.ReservationStatus), nullableString(item.ReservationError), reservationUpdatedAt, now, now).
+		SQL("ON CONFLICT (cartId, id) DO UPDATE SET quantity = excluded.quantity, " +
+			"reservationId = excluded.reservationId, reservedQuantity = excluded.reservedQuantity, " +
+			"reservationStatus = excluded.reservationStatus, reservationError = excluded.reservationError, " +
+			"reservationUpdatedAt = excluded.reservationUpdatedAt, updatedAt = excluded.updatedAt")
+
+	query, args := sb.Build()
+	if _, writeErr := tx.ExecContext(ctx, query, args...); writeErr != nil {
+		return fmt.Errorf("writing item %s to cart %s --> %w", item.Id, cartId, writeErr)
+	}
+	return nil
+}
+
+// The guest items are merged one by one, as the reservation they end up with depends on both items. See
+// model.MergeCartItem. Everything is done in the same transaction, so the items are never in both carts nor in none
+func (cir *CartItemsRepository) Merge(ctx context.Context, guestCartId string, cartId string, expectedVersion *int64) (model.Cart, error) {
+
+	tx, beginErr := cir.db.BeginTx(ctx, nil)
+	if beginErr != nil {
+		return model.Cart{}, fmt.Errorf("starting transaction for merging carts --> %w", beginErr)
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer func() { _ = tx.Rollback() }()
+
+	// No need to lock the guest cart. The transaction already holds the write lock of the whole database
+	guestSb := sqlbuilder.SQLite.NewSelectBuilder()
+	guestSb.
+		Select("id").
+		From(cartTable).
+		Where(guestSb.Equal("id", guestCartId))
+
+	guestQuery, guestArgs := guestSb.Build()
+	var guestId string
+	guestErr := tx.QueryRowContext(ctx, guestQuery, guestArgs...).Scan(&guestId)
+	if errors.Is(guestErr, sql.ErrNoRows) {
+		return model.Cart{}, fmt.Errorf("guest cart %s --> %w", guestCartId, model.ErrCartNotFound)
+	}
+	if guestErr != nil {
+		return model.Cart{}, fmt.Errorf("reading guest cart --> %w", guestErr)
+	}
+
+	guestItems, guestItemsErr := cartItems(ctx, tx, guestCartId)
+	if guestItemsErr != nil {
+		return model.Cart{}, fmt.Errorf("reading guest cart items --> %w", guestItemsErr)
+	}
+
+	// Same as adding an item. The cart may not exist yet
+	if cartErr := createCart(ctx, tx, cartId); cartErr != nil {
+		return model.Cart{}, cartErr
+	}
+
+	version, versionErr := bumpCartVersion(ctx, tx, cartId, expectedVersion)
+	if versionErr != nil {
+		return model.Cart{}, versionErr
+	}
+
+	for _, guestItem := range guestItems {
+		itemSb := sqlbuilder.SQLite.NewSelectBuilder()
+		itemSb.
+			Select(cartItemColumns...).
+			From(cartItemTable).
+			Where(itemSb.Equal("cartId", cartId), itemSb.Equal("id", guestItem.Id))
+
+		itemQuery, itemArgs := itemSb.Build()
+		item, getErr := scanReturnedCartItem(tx.QueryRowContext(ctx, itemQuery, itemArgs...), cartId, guestItem.Id)
+
+		// Items that are not in the cart are moved as they are, reservation included
+		merged := guestItem
+		switch {
+		case errors.Is(getErr, model.ErrItemNotFound):
+		case getErr != nil:
+			return model.Cart{}, getErr
+		default:
+			var releaseGuest bool
+			var mergeErr error
+			// The transaction is rolled back, so both carts are kept as they were
+			merged, releaseGuest, mergeErr = model.MergeCartItem(item, guestItem)
+			if mergeErr != nil {
+				return model.Cart{}, mergeErr
+			}
+			if releaseGuest {
+				if taskErr := insertReservationTask(ctx, tx, model.NewReleaseTask(guestCartId, guestItem)); taskErr != nil {
+					return model.Cart{}, taskErr
+				}
+			}
+		}
+
+		if writeErr := writeCartItem(ctx, tx, cartId, merged); writeErr != nil {
+			return model.Cart{}, writeErr
+		}
+		// The reserve tasks of the guest cart find nothing to reserve once it is gone
+		if merged.NeedsReservation() {
+			if taskErr := requestReservation(ctx, tx, cartId, &merged); taskErr != nil {
+				return model.Cart{}, taskErr
+			}
+		}
+	}
+
+	// The items go along with the cart. See the foreign key
+	deleteSb := sqlbuilder.SQLite.NewDeleteBuilder()
+	deleteSb.
+		DeleteFrom(cartTable).
+		Where(deleteSb.Equal("id", guestCartId))
+
+	deleteQuery, deleteArgs := deleteSb.Build()
+	if _, deleteErr := tx.ExecContext(ctx, deleteQuery, deleteArgs...); deleteErr != nil {
+		return model.Cart{}, fmt.Errorf("deleting guest cart --> %w", deleteErr)
+	}
+
+	items, itemsErr := cartItems(ctx, tx, cartId)
+	if itemsErr != nil {
+		return model.Cart{}, itemsErr
+	}
+
+	if commitErr := tx.Commit(); commitErr != nil {
+		return model.Cart{}, fmt.Errorf("committing cart merge --> %w", commitErr)
+	}
+
+	return model.Cart{Version: version, Items: items}, nil
+}
+
+// A single upsert: the cart is created with its owner or, if it is already there, it keeps the owner it has, if any
+func (cir *CartItemsRepository) ClaimCart(ctx context.Context, cartId string, ownerId string) (string, error) {
+	now := time.Now().UTC()
+
+	sb := sqlbuilder.SQLite.NewInsertBuilder()
+	sb.
+		InsertInto(cartTable).
+		Cols("id", "ownerId", "createdAt", "updatedAt").
+		Values(cartId, ownerId, now, now).
+		SQL("ON CONFLICT (id) DO UPDATE SET ownerId = COALESCE(" + cartTable + ".ownerId, EXCLUDED.ownerId)").
+		SQL("RETURNING ownerId")
+
+	query, args := sb.Build()
+	var owner string
+	if scanErr := cir.db.QueryRowContext(ctx, query, args...).Scan(&owner); scanErr != nil {
+		return "", fmt.Errorf("claiming cart --> %w", scanErr)
+	}
+	return owner, nil
+}
+
+// No need to skip the carts locked by the clients. The transaction holds the write lock of the whole database
+func (cir *CartItemsRepository) ExpireCarts(ctx context.Context, idleSince time.Time, limit int) ([]model.AbandonedCart, error) {
+
+	tx, beginErr := cir.db.BeginTx(ctx, nil)
+	if beginErr != nil {
+		return nil, fmt.Errorf("starting transaction for expiring carts --> %w", beginErr)
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer func() { _ = tx.Rollback() }()
+
+	sb := sqlbuilder.SQLite.NewSelectBuilder()
+	sb.
+		Select("id", "ownerId", "createdAt", "updatedAt").
+		From(cartTable).
+		Where(sb.LessThan("updatedAt", idleSince.UTC())).
+		OrderBy("updatedAt").
+		Limit(limit)
+
+	query, args := sb.Build()
+	rows, selectErr := tx.QueryContext(ctx, query, args...)
+	if selectErr != nil {
+		return nil, fmt.Errorf("selecting abandoned carts --> %w", selectErr)
+	}
+
+	var carts []model.AbandonedCart
+	var cartIds []any
+	for rows.Next() {
+		var cart model.AbandonedCart
+		var owner sql.NullString
+		if scanErr := rows.Scan(&cart.CartId, &owner, &cart.CreatedAt, &cart.UpdatedAt); scanErr != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning abandoned carts --> %w", scanErr)
+		}
+		cart.OwnerId = owner.String
+
+		carts = append(carts, cart)
+		cartIds = append(cartIds, cart.CartId)
+	}
+	rows.Close()
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return nil, fmt.Errorf("reading abandoned carts --> %w", rowsErr)
+	}
+
+	if len(carts) == 0 {
+		return carts, nil
+	}
+
+	expiredAt := time.Now().UTC()
+	for i := range carts {
+		items, itemsErr := cartItems(ctx, tx, carts[i].CartId)
+		if itemsErr != nil {
+			return nil, fmt.Errorf("reading items of abandoned cart %s --> %w", carts[i].CartId, itemsErr)
+		}
+
+		// Same as removing the items one by one
+		for _, item := range items {
+			if item.ReservationId != "" {
+				if taskErr := insertReservationTask(ctx, tx, model.NewReleaseTask(carts[i].CartId, item)); taskErr != nil {
+					return nil, taskErr
+				}
+			}
+		}
+		carts[i].Items = items
+		carts[i].ExpiredAt = expiredAt
+
+		// Empty carts are not worth a reminder
+		if len(items) > 0 {
+			if eventErr := insertCartEvent(ctx, tx, model.NewAbandonedCartEvent(carts[i])); eventErr != nil {
+				return nil, eventErr
+			}
+		}
+	}
+
+	// The items go along with the carts. See the foreign key
+	deleteSb := sqlbuilder.SQLite.NewDeleteBuilder()
+	deleteSb.
+		DeleteFrom(cartTable).
+		Where(deleteSb.In("id", cartIds...))
+
+	deleteQuery, deleteArgs := deleteSb.Build()
+	if _, deleteErr := tx.ExecContext(ctx, deleteQuery, deleteArgs...); deleteErr != nil {
+		return nil, fmt.Errorf("deleting abandoned carts --> %w", deleteErr)
+	}
+
+	if commitErr := tx.Commit(); commitErr != nil {
+		return nil, fmt.Errorf("committing abandoned carts expiration --> %w", commitErr)
+	}
+
+	return carts, nil
+}
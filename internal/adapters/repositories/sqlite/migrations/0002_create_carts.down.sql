@@ -0,0 +1,12 @@
+CREATE TABLE cartItem_old (
+  id integer PRIMARY KEY,
+  name varchar(50),
+  quantity integer,
+  reservationId varchar(50)
+);
+-- Back to a single cart. The items of the other carts would collide with its ones
+INSERT INTO cartItem_old (id, name, quantity, reservationId)
+  SELECT id, name, quantity, reservationId FROM cartItem WHERE cartId = '00000000-0000-0000-0000-000000000000';
+DROP TABLE cartItem;
+ALTER TABLE cartItem_old RENAME TO cartItem;
+DROP TABLE IF EXISTS cart;
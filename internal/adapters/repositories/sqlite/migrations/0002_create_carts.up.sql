@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS cart (
+  -- Cart ids are generated by the clients. Sized for a uuid, which is opaque and hard to guess
+  id varchar(36) PRIMARY KEY
+);
+
+-- There used to be a single cart. Its items are moved to the nil uuid cart, so they are not lost
+INSERT INTO cart (id) SELECT DISTINCT '00000000-0000-0000-0000-000000000000' FROM cartItem;
+
+-- sqlite cannot change the primary key of a table, so the table is rebuilt
+CREATE TABLE cartItem_new (
+  cartId varchar(36) NOT NULL REFERENCES cart (id) ON DELETE CASCADE,
+  id integer,
+  name varchar(50),
+  quantity integer,
+  reservationId varchar(50),
+  -- The same item can be in several carts. Quantities are only merged within the same cart.
+  -- It is also the conflict target of the upsert that adds the items
+  PRIMARY KEY (cartId, id)
+);
+INSERT INTO cartItem_new (cartId, id, name, quantity, reservationId)
+  SELECT '00000000-0000-0000-0000-000000000000', id, name, quantity, reservationId FROM cartItem;
+DROP TABLE cartItem;
+ALTER TABLE cartItem_new RENAME TO cartItem;
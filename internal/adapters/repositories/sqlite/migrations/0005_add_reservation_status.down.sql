@@ -0,0 +1,3 @@
+ALTER TABLE cartItem DROP COLUMN reservationUpdatedAt;
+ALTER TABLE cartItem DROP COLUMN reservationStatus;
+ALTER TABLE cartItem DROP COLUMN reservationError;
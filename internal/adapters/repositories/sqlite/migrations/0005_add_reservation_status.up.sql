@@ -0,0 +1,8 @@
+-- Reason given by the reserver when it could not reserve the item. Cleared once the item is reserved
+ALTER TABLE cartItem ADD COLUMN reservationError varchar(255);
+-- pending, reserved, failed or released. Exposed in the api, so the clients know how their items are doing
+ALTER TABLE cartItem ADD COLUMN reservationStatus varchar(10) NOT NULL DEFAULT 'pending';
+ALTER TABLE cartItem ADD COLUMN reservationUpdatedAt datetime;
+
+-- Items with a reservation id were already reserved
+UPDATE cartItem SET reservationStatus = 'reserved' WHERE reservationId IS NOT NULL AND reservationId <> '';
@@ -0,0 +1,6 @@
+ALTER TABLE cartItem DROP COLUMN updatedAt;
+ALTER TABLE cartItem DROP COLUMN createdAt;
+-- Indexed columns cannot be dropped
+DROP INDEX IF EXISTS idleCarts;
+ALTER TABLE cart DROP COLUMN updatedAt;
+ALTER TABLE cart DROP COLUMN createdAt;
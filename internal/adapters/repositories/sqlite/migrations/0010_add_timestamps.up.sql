@@ -0,0 +1,17 @@
+-- Same columns as the mysql migrations. SQLite cannot add a column whose default is the current time, so the
+-- app writes them on every insert, and the existing carts and items are taken as created and changed right now.
+-- That gives them a whole TTL before expiring
+ALTER TABLE cart ADD COLUMN createdAt datetime;
+ALTER TABLE cart ADD COLUMN updatedAt datetime;
+UPDATE cart SET
+  createdAt = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+  updatedAt = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now');
+
+-- The sweeper looks for the carts not changed for a while
+CREATE INDEX IF NOT EXISTS idleCarts ON cart (updatedAt);
+
+ALTER TABLE cartItem ADD COLUMN createdAt datetime;
+ALTER TABLE cartItem ADD COLUMN updatedAt datetime;
+UPDATE cartItem SET
+  createdAt = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'),
+  updatedAt = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now');
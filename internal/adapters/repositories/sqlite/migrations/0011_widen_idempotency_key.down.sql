@@ -0,0 +1 @@
+-- Nothing to change, see the up migration
@@ -0,0 +1,2 @@
+-- Keys are stored prefixed with the subject of the request, I.E. "subject:key". Both are up to 255 characters.
+-- Nothing to change here, as sqlite does not enforce the length of varchar columns
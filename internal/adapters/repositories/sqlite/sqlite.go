@@ -0,0 +1,43 @@
+package sqlite
+
+import (
+	"database/sql"
+	"net/url"
+
+	// Pure go driver, so the app is still a single static binary
+	_ "modernc.org/sqlite"
+)
+
+type Config struct {
+	// Path of the database file. It is created if it does not exist
+	Path string
+}
+
+func InitSQLiteDB(cfg Config) (*sql.DB, error) {
+	params := url.Values{}
+	// WAL lets the readers go on while an item is being written, and survives a power cut without losing committed carts
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "synchronous(NORMAL)")
+	// Only one writer at a time. The others wait for it instead of failing right away
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "foreign_keys(1)")
+	// Transactions take the write lock when they start. Otherwise two transactions that read before writing
+	// would deadlock and one of them would fail
+	params.Set("_txlock", "immediate")
+	// Times are compared as strings, so all of them must be written in the same format
+	params.Set("_time_format", "sqlite")
+
+	db, err := sql.Open("sqlite", cfg.Path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	// Opening does not touch the file. The first query does
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
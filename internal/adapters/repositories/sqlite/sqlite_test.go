@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_InitSQLiteDB_GivenDatabaseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shopping-cart.db")
+
+	t.Run("WhenInit_ThenWALModeIsEnabled", func(t *testing.T) {
+		db, initErr := InitSQLiteDB(Config{Path: path})
+		require.NoError(t, initErr)
+		defer db.Close()
+
+		var journalMode string
+		require.NoError(t, db.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+		assert.Equal(t, "wal", journalMode)
+	})
+
+	t.Run("WhenReopenedAndMigratedAgain_ThenNothingIsAppliedAndCartsAreKept", func(t *testing.T) {
+		db, initErr := InitSQLiteDB(Config{Path: path})
+		require.NoError(t, initErr)
+		_, upErr := NewMigrator(db).Up(context.TODO())
+		require.NoError(t, upErr)
+		_, _, addErr := NewCartItemsRepository(db).Add(context.TODO(), "cart1", model.CartItem{Id: "1", Name: "screen", Quantity: 2}, nil)
+		require.NoError(t, addErr)
+		db.Close()
+
+		db, initErr = InitSQLiteDB(Config{Path: path})
+		require.NoError(t, initErr)
+		defer db.Close()
+		applied, upErr := NewMigrator(db).Up(context.TODO())
+		require.NoError(t, upErr)
+
+		cart, getErr := NewCartItemsRepository(db).Get(context.TODO(), "cart1")
+		assert.Empty(t, applied)
+		assert.NoError(t, getErr)
+		assert.Len(t, cart.Items, 1)
+	})
+
+	t.Run("WhenPathIsADirectory_ThenError", func(t *testing.T) {
+		_, initErr := InitSQLiteDB(Config{Path: t.TempDir()})
+		assert.Error(t, initErr)
+	})
+}
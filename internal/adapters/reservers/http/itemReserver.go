@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	reserveEndpoint = "/reserve"
+	releaseEndpoint = "/release"
+)
+
+var (
+	errUnexpectedStatus = errors.New("unexpected status code")
+)
+
+// Reserver reached through its http api
+type ItemReserver struct {
+	client *resty.Client
+}
+
+// A single client is shared by every call, so connections to the reserver are reused
+func NewItemReserver(host string, timeout time.Duration) *ItemReserver {
+	client := resty.New().
+		SetBaseURL(host).
+		SetTimeout(timeout).
+		SetHeader("Content-Type", "application/json")
+
+	return &ItemReserver{client: client}
+}
+
+func (ir *ItemReserver) Reserve(ctx context.Context, cartId string, item model.CartItem) (string, error) {
+	// Authentication should be also set in this endpoint
+	var reservationResponse model.ItemReservationResponse
+	response, reservationErr := ir.client.R().
+		SetBody(model.NewItemReservationRequest(cartId, item)).
+		SetResult(&reservationResponse).
+		SetContext(ctx).
+		Post(reserveEndpoint)
+
+	if reservationErr != nil {
+		return "", fmt.Errorf("reserving item %s of cart %s --> %w", item.Id, cartId, classify(reservationErr))
+	}
+
+	// Asynchronous reservers accept the request and send the reservation id later, through the callback
+	if response.StatusCode() == http.StatusAccepted {
+		return "", nil
+	}
+
+	if response.StatusCode() != 200 {
+		return "", fmt.Errorf("bad http response while reserving item %s of cart %s: %d %s --> %w",
+			item.Id, cartId, response.StatusCode(), response.String(), classifyStatus(response.StatusCode()))
+	}
+
+	return reservationResponse.ReservationId, nil
+}
+
+func (ir *ItemReserver) Release(ctx context.Context, cartId string, item model.CartItem) error {
+	response, releaseErr := ir.client.R().
+		SetBody(model.NewItemReservationRequest(cartId, item)).
+		SetContext(ctx).
+		Post(releaseEndpoint)
+
+	if releaseErr != nil {
+		return fmt.Errorf("releasing reservation %s --> %w", item.ReservationId, classify(releaseErr))
+	}
+
+	// The reservation is already gone. I.E. the release was retried from the outbox after the reserver took it
+	if response.StatusCode() == http.StatusNotFound {
+		return nil
+	}
+
+	if response.StatusCode() != 200 {
+		return fmt.Errorf("bad http response while releasing reservation %s: %d %s --> %w",
+			item.ReservationId, response.StatusCode(), response.String(), classifyStatus(response.StatusCode()))
+	}
+
+	return nil
+}
+
+// Timeouts and connection errors mean that the reserver is unavailable, so the call is worth retrying.
+// A cancelled context means that we gave up, so it is returned as is
+func classify(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", model.ErrReserverUnavailable, err)
+}
+
+// Only server errors are worth retrying. A 4xx will fail again with the very same request
+func classifyStatus(statusCode int) error {
+	if statusCode >= http.StatusInternalServerError {
+		return model.ErrReserverUnavailable
+	}
+	return errUnexpectedStatus
+}
@@ -0,0 +1,241 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	cartId = "5b9a2ecf-0a37-4f4b-9c57-0d4d2e7e3a11"
+)
+
+var (
+	randomCartItem   = model.CartItem{Id: "1", Name: "potato", Quantity: 1}
+	reservedCartItem = model.CartItem{Id: "1", Name: "potato", Quantity: 3, ReservationId: "oldReservationId", ReservedQuantity: 2}
+)
+
+// Make sure that the reservation call is correct and has all the needed params
+func checkReservationHttpRequest(t *testing.T, r *http.Request, expectedPath string, expectedBody string) {
+	assert.Equal(t, http.MethodPost, r.Method)
+	assert.Equal(t, expectedPath, r.URL.Path)
+	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	body, err := io.ReadAll(r.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedBody, string(body))
+}
+
+func writeReservationResponse(w http.ResponseWriter, reservationId string) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"version":"1.0.0","reservationId":"` + reservationId + `"}`))
+}
+
+// We use Gherkin notation for the tests
+func Test_Reserve_GivenHttpItemReserver(t *testing.T) {
+	type input struct {
+		timeout time.Duration
+		item    model.CartItem
+	}
+	type want struct {
+		err           bool
+		unavailable   bool
+		reservationId string
+	}
+	tests := []struct {
+		name                       string
+		in                         input
+		reservationFakeHttpHandler func(t *testing.T, w http.ResponseWriter, r *http.Request)
+		want                       want
+	}{
+		{
+			name: "WhenReserveAndRejected_ThenErrorNotWorthRetrying",
+			in: input{
+				timeout: 3 * time.Second,
+				item:    randomCartItem,
+			},
+			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound) // random error
+			},
+			want: want{
+				err:           true,
+				unavailable:   false,
+				reservationId: "",
+			},
+		}, {
+			name: "WhenReserveAndServerError_ThenUnavailableError",
+			in: input{
+				timeout: 3 * time.Second,
+				item:    randomCartItem,
+			},
+			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			want: want{
+				err:           true,
+				unavailable:   true,
+				reservationId: "",
+			},
+		}, {
+			name: "WhenReserveAndTimesOut_ThenUnavailableError",
+			in: input{
+				timeout: 1 * time.Second,
+				item:    randomCartItem,
+			},
+			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				time.Sleep(2 * time.Second)
+			},
+			want: want{
+				err:           true,
+				unavailable:   true,
+				reservationId: "",
+			},
+		}, {
+			name: "WhenReserveAndOK_ThenReservationIdReturned",
+			in: input{
+				timeout: 3 * time.Second,
+				item:    randomCartItem,
+			},
+			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				checkReservationHttpRequest(t, r, "/reserve",
+					`{"version":"1.0.0","cartId":"`+cartId+`","item":{"id":"1","name":"potato","quantity":1,"reservationId":"","reservedQuantity":0}}`)
+				writeReservationResponse(w, "fancyReservationId")
+			},
+			want: want{
+				err:           false,
+				reservationId: "fancyReservationId",
+			},
+		}, {
+			name: "WhenReserveAndAccepted_ThenEmptyReservationId",
+			in: input{
+				timeout: 3 * time.Second,
+				item:    randomCartItem,
+			},
+			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				// The reservation id will come through the callback
+				w.WriteHeader(http.StatusAccepted)
+			},
+			want: want{
+				err:           false,
+				reservationId: "",
+			},
+		}, {
+			name: "WhenReserveItemAlreadyReserved_ThenReservationIdIsSent",
+			in: input{
+				timeout: 3 * time.Second,
+				item:    reservedCartItem,
+			},
+			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				// the existing reservation is sent, so the reserver can adjust it
+				checkReservationHttpRequest(t, r, "/reserve",
+					`{"version":"1.0.0","cartId":"`+cartId+`","item":{"id":"1","name":"potato","quantity":3,"reservationId":"oldReservationId","reservedQuantity":2}}`)
+				writeReservationResponse(w, "oldReservationId")
+			},
+			want: want{
+				err:           false,
+				reservationId: "oldReservationId",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// http test to mock reservation server
+			reservationFakeHttpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tc.reservationFakeHttpHandler(t, w, r)
+			}))
+			defer reservationFakeHttpServer.Close()
+
+			reserver := NewItemReserver(reservationFakeHttpServer.URL, tc.in.timeout)
+
+			reservationId, reserveErr := reserver.Reserve(context.Background(), cartId, tc.in.item)
+			if tc.want.err {
+				assert.Error(t, reserveErr)
+			} else {
+				assert.NoError(t, reserveErr)
+			}
+			assert.Equal(t, tc.want.unavailable, errors.Is(reserveErr, model.ErrReserverUnavailable))
+			assert.Equal(t, tc.want.reservationId, reservationId)
+		})
+	}
+}
+
+func Test_Release_GivenHttpItemReserver(t *testing.T) {
+	tests := []struct {
+		name                       string
+		reservationFakeHttpHandler func(t *testing.T, w http.ResponseWriter, r *http.Request)
+		wantErr                    bool
+	}{
+		{
+			name: "WhenReleaseAndBadHttpResponse_ThenError",
+			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantErr: true,
+		}, {
+			name: "WhenReleaseAndRejected_ThenError",
+			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+			},
+			wantErr: true,
+		}, {
+			name: "WhenReleaseAlreadyReleased_ThenOK",
+			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantErr: false,
+		}, {
+			name: "WhenReleaseAndOK_ThenOK",
+			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				checkReservationHttpRequest(t, r, "/release",
+					`{"version":"1.0.0","cartId":"`+cartId+`","item":{"id":"1","name":"potato","quantity":3,"reservationId":"oldReservationId","reservedQuantity":2}}`)
+				w.WriteHeader(http.StatusOK)
+			},
+			wantErr: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reservationFakeHttpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tc.reservationFakeHttpHandler(t, w, r)
+			}))
+			defer reservationFakeHttpServer.Close()
+
+			reserver := NewItemReserver(reservationFakeHttpServer.URL, 3*time.Second)
+
+			releaseErr := reserver.Release(context.Background(), cartId, reservedCartItem)
+			if tc.wantErr {
+				assert.Error(t, releaseErr)
+			} else {
+				assert.NoError(t, releaseErr)
+			}
+		})
+	}
+}
+
+func Test_Release_GivenReservationAlreadyReleased(t *testing.T) {
+	// The reserver forgets the reservation once released, as a real one would do
+	released := false
+	reservationFakeHttpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if released {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		released = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer reservationFakeHttpServer.Close()
+	reserver := NewItemReserver(reservationFakeHttpServer.URL, 3*time.Second)
+
+	firstErr := reserver.Release(context.Background(), cartId, reservedCartItem)
+	secondErr := reserver.Release(context.Background(), cartId, reservedCartItem)
+
+	assert.NoError(t, firstErr)
+	assert.NoError(t, secondErr)
+}
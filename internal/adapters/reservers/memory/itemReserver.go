@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+// In process reserver for local development and tests. It does not check any stock, every reservation succeeds.
+// Reservation ids are deterministic: reservation-1, reservation-2 and so on, in the order they are created
+type ItemReserver struct {
+	mutex        sync.Mutex
+	lastId       int
+	reservations map[string]Reservation
+}
+
+type Reservation struct {
+	CartId   string
+	ItemId   string
+	Quantity int
+}
+
+func NewItemReserver() *ItemReserver {
+	return &ItemReserver{
+		reservations: make(map[string]Reservation),
+	}
+}
+
+// Known reservations are adjusted to the new quantity and keep their id, as a real reserver would do
+func (ir *ItemReserver) Reserve(_ context.Context, cartId string, item model.CartItem) (string, error) {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	reservationId := item.ReservationId
+	if _, found := ir.reservations[reservationId]; !found {
+		ir.lastId++
+		reservationId = fmt.Sprintf("reservation-%d", ir.lastId)
+	}
+
+	ir.reservations[reservationId] = Reservation{
+		CartId:   cartId,
+		ItemId:   item.Id,
+		Quantity: item.Quantity,
+	}
+	return reservationId, nil
+}
+
+// Releasing an unknown reservation is not an error. Releases are retried from the outbox, so the same one may
+// arrive twice, and the reservation is gone anyway
+func (ir *ItemReserver) Release(_ context.Context, _ string, item model.CartItem) error {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	delete(ir.reservations, item.ReservationId)
+	return nil
+}
+
+// Returns a copy of the active reservations, indexed by reservation id
+func (ir *ItemReserver) Reservations() map[string]Reservation {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	reservations := make(map[string]Reservation, len(ir.reservations))
+	for id, reservation := range ir.reservations {
+		reservations[id] = reservation
+	}
+	return reservations
+}
@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	cartId = "5b9a2ecf-0a37-4f4b-9c57-0d4d2e7e3a11"
+)
+
+// We use Gherkin notation for the tests
+func Test_Reserve_GivenMemoryItemReserver(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("WhenReserveNewItems_ThenIdsAreDeterministic", func(t *testing.T) {
+		reserver := NewItemReserver()
+
+		firstId, firstErr := reserver.Reserve(ctx, cartId, model.CartItem{Id: "1", Quantity: 1})
+		secondId, secondErr := reserver.Reserve(ctx, cartId, model.CartItem{Id: "2", Quantity: 2})
+
+		assert.NoError(t, firstErr)
+		assert.NoError(t, secondErr)
+		assert.Equal(t, "reservation-1", firstId)
+		assert.Equal(t, "reservation-2", secondId)
+		assert.Equal(t, map[string]Reservation{
+			"reservation-1": {CartId: cartId, ItemId: "1", Quantity: 1},
+			"reservation-2": {CartId: cartId, ItemId: "2", Quantity: 2},
+		}, reserver.Reservations())
+	})
+
+	t.Run("WhenReserveAlreadyReservedItem_ThenReservationIsAdjusted", func(t *testing.T) {
+		reserver := NewItemReserver()
+		reservationId, _ := reserver.Reserve(ctx, cartId, model.CartItem{Id: "1", Quantity: 1})
+
+		adjustedId, adjustErr := reserver.Reserve(ctx, cartId,
+			model.CartItem{Id: "1", Quantity: 4, ReservationId: reservationId, ReservedQuantity: 1})
+
+		assert.NoError(t, adjustErr)
+		assert.Equal(t, reservationId, adjustedId)
+		assert.Equal(t, map[string]Reservation{
+			"reservation-1": {CartId: cartId, ItemId: "1", Quantity: 4},
+		}, reserver.Reservations())
+	})
+
+	t.Run("WhenReserveWithUnknownReservation_ThenNewOneIsCreated", func(t *testing.T) {
+		reserver := NewItemReserver()
+
+		reservationId, reserveErr := reserver.Reserve(ctx, cartId,
+			model.CartItem{Id: "1", Quantity: 4, ReservationId: "unknown", ReservedQuantity: 1})
+
+		assert.NoError(t, reserveErr)
+		assert.Equal(t, "reservation-1", reservationId)
+	})
+}
+
+func Test_Release_GivenMemoryItemReserver(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("WhenReleaseUnknownReservation_ThenOK", func(t *testing.T) {
+		reserver := NewItemReserver()
+
+		releaseErr := reserver.Release(ctx, cartId, model.CartItem{Id: "1", ReservationId: "unknown"})
+
+		assert.NoError(t, releaseErr)
+	})
+
+	t.Run("WhenReleaseTwice_ThenBothOK", func(t *testing.T) {
+		reserver := NewItemReserver()
+		reservationId, _ := reserver.Reserve(ctx, cartId, model.CartItem{Id: "1", Quantity: 1})
+		item := model.CartItem{Id: "1", ReservationId: reservationId}
+
+		firstErr := reserver.Release(ctx, cartId, item)
+		secondErr := reserver.Release(ctx, cartId, item)
+
+		assert.NoError(t, firstErr)
+		assert.NoError(t, secondErr)
+		assert.Empty(t, reserver.Reservations())
+	})
+
+	t.Run("WhenReleaseAndOK_ThenReservationIsRemoved", func(t *testing.T) {
+		reserver := NewItemReserver()
+		reservationId, _ := reserver.Reserve(ctx, cartId, model.CartItem{Id: "1", Quantity: 1})
+
+		releaseErr := reserver.Release(ctx, cartId, model.CartItem{Id: "1", ReservationId: reservationId})
+
+		assert.NoError(t, releaseErr)
+		assert.Empty(t, reserver.Reservations())
+	})
+}
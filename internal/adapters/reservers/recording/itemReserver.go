@@ -0,0 +1,73 @@
+package recording
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+)
+
+const (
+	ReserveCall = "reserve"
+	ReleaseCall = "release"
+)
+
+// Decorator that records every call made to the wrapped reserver. Useful in tests to check what was sent to the
+// reserver without caring about how it was sent
+type ItemReserver struct {
+	next  ports.ItemReserver
+	mutex sync.Mutex
+	calls []Call
+}
+
+type Call struct {
+	Operation string
+	CartId    string
+	Item      model.CartItem
+	// Returned by the wrapped reserver. Only set in successful reserve calls
+	ReservationId string
+	Err           error
+}
+
+func NewItemReserver(next ports.ItemReserver) *ItemReserver {
+	return &ItemReserver{next: next}
+}
+
+func (ir *ItemReserver) Reserve(ctx context.Context, cartId string, item model.CartItem) (string, error) {
+	reservationId, reserveErr := ir.next.Reserve(ctx, cartId, item)
+	ir.record(Call{
+		Operation:     ReserveCall,
+		CartId:        cartId,
+		Item:          item,
+		ReservationId: reservationId,
+		Err:           reserveErr,
+	})
+	return reservationId, reserveErr
+}
+
+func (ir *ItemReserver) Release(ctx context.Context, cartId string, item model.CartItem) error {
+	releaseErr := ir.next.Release(ctx, cartId, item)
+	ir.record(Call{
+		Operation: ReleaseCall,
+		CartId:    cartId,
+		Item:      item,
+		Err:       releaseErr,
+	})
+	return releaseErr
+}
+
+// Returns a copy of the calls, in the order they were made
+func (ir *ItemReserver) Calls() []Call {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	return append([]Call(nil), ir.calls...)
+}
+
+func (ir *ItemReserver) record(call Call) {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	ir.calls = append(ir.calls, call)
+}
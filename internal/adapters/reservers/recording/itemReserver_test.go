@@ -0,0 +1,47 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Harital/shopping-cart/internal/core/mocks"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+const (
+	cartId = "5b9a2ecf-0a37-4f4b-9c57-0d4d2e7e3a11"
+)
+
+// We use Gherkin notation for the tests
+func Test_Calls_GivenRecordingItemReserver(t *testing.T) {
+	ctx := context.Background()
+	randomError := errors.New("random error")
+	item := model.CartItem{Id: "1", Name: "potato", Quantity: 2}
+	reservedItem := model.CartItem{Id: "1", Name: "potato", Quantity: 2, ReservationId: "fancyReservationId", ReservedQuantity: 2}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	next := mocks.NewMockItemReserver(mockCtrl)
+	gomock.InOrder(
+		next.EXPECT().Reserve(ctx, cartId, item).Return("fancyReservationId", nil),
+		next.EXPECT().Release(ctx, cartId, reservedItem).Return(randomError),
+	)
+
+	reserver := NewItemReserver(next)
+
+	// The results of the wrapped reserver are passed through
+	reservationId, reserveErr := reserver.Reserve(ctx, cartId, item)
+	assert.NoError(t, reserveErr)
+	assert.Equal(t, "fancyReservationId", reservationId)
+
+	releaseErr := reserver.Release(ctx, cartId, reservedItem)
+	assert.ErrorIs(t, releaseErr, randomError)
+
+	assert.Equal(t, []Call{
+		{Operation: ReserveCall, CartId: cartId, Item: item, ReservationId: "fancyReservationId"},
+		{Operation: ReleaseCall, CartId: cartId, Item: reservedItem, Err: randomError},
+	}, reserver.Calls())
+}
@@ -0,0 +1,124 @@
+package resilient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type CircuitState string
+
+const (
+	// Calls go through
+	CircuitClosed CircuitState = "closed"
+	// Calls are short-circuited until the open timeout expires
+	CircuitOpen CircuitState = "open"
+	// A single trial call goes through. Its result closes or opens the circuit again
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+type CircuitBreakerConfig struct {
+	// Consecutive failures that trip the breaker
+	FailureThreshold int
+	// Time the breaker stays open before letting a trial call through
+	OpenTimeout time.Duration
+}
+
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+
+	mutex               sync.Mutex
+	state               CircuitState
+	consecutiveFailures int
+	openedAt            time.Time
+	trialInFlight       bool
+
+	// Replaced in tests, in order not to wait for the open timeout
+	now func() time.Time
+}
+
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		config: config,
+		state:  CircuitClosed,
+		now:    time.Now,
+	}
+	metrics.state.Set(string(CircuitClosed))
+	return cb
+}
+
+// Tells whether a call can be made. Every allowed call must be followed by a call to Record
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.config.OpenTimeout {
+			return false
+		}
+		cb.setState(CircuitHalfOpen)
+		cb.trialInFlight = true
+		return true
+	case CircuitHalfOpen:
+		// Only one trial call at a time. The rest wait for its result
+		if cb.trialInFlight {
+			return false
+		}
+		cb.trialInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Only failures caused by the reserver being unavailable should be recorded as failures. A rejected request
+// means that the reserver is alive
+func (cb *CircuitBreaker) Record(failure bool) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.trialInFlight = false
+
+	if !failure {
+		cb.consecutiveFailures = 0
+		if cb.state != CircuitClosed {
+			cb.setState(CircuitClosed)
+		}
+		return
+	}
+
+	cb.consecutiveFailures++
+	if cb.state == CircuitHalfOpen || cb.consecutiveFailures >= cb.config.FailureThreshold {
+		if cb.state != CircuitOpen {
+			metrics.trips.Add(1)
+		}
+		cb.openedAt = cb.now()
+		cb.setState(CircuitOpen)
+	}
+}
+
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.state
+}
+
+// Must be called with the mutex locked
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	if cb.state == state {
+		return
+	}
+
+	log.
+		Warn().
+		Str("from", string(cb.state)).
+		Str("to", string(state)).
+		Int("consecutiveFailures", cb.consecutiveFailures).
+		Msg("reserver circuit breaker state changed")
+
+	cb.state = state
+	metrics.state.Set(string(state))
+}
@@ -0,0 +1,101 @@
+package resilient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testBreakerConfig = CircuitBreakerConfig{
+	FailureThreshold: 3,
+	OpenTimeout:      10 * time.Second,
+}
+
+// Breaker with a clock that can be moved forward by the test
+func newTestCircuitBreaker() (*CircuitBreaker, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := NewCircuitBreaker(testBreakerConfig)
+	cb.now = func() time.Time { return now }
+	return cb, &now
+}
+
+// We use Gherkin notation for the tests
+func Test_CircuitBreaker_GivenClosedBreaker(t *testing.T) {
+	t.Run("WhenFailuresBelowThreshold_ThenStaysClosed", func(t *testing.T) {
+		cb, _ := newTestCircuitBreaker()
+
+		for i := 0; i < testBreakerConfig.FailureThreshold-1; i++ {
+			assert.True(t, cb.Allow())
+			cb.Record(true)
+		}
+
+		assert.Equal(t, CircuitClosed, cb.State())
+		assert.True(t, cb.Allow())
+	})
+
+	t.Run("WhenSuccessBetweenFailures_ThenCountIsReset", func(t *testing.T) {
+		cb, _ := newTestCircuitBreaker()
+
+		cb.Record(true)
+		cb.Record(true)
+		cb.Record(false)
+		cb.Record(true)
+		cb.Record(true)
+
+		assert.Equal(t, CircuitClosed, cb.State())
+	})
+
+	t.Run("WhenConsecutiveFailuresReachThreshold_ThenOpensAndShortCircuits", func(t *testing.T) {
+		cb, _ := newTestCircuitBreaker()
+
+		for i := 0; i < testBreakerConfig.FailureThreshold; i++ {
+			cb.Record(true)
+		}
+
+		assert.Equal(t, CircuitOpen, cb.State())
+		assert.False(t, cb.Allow())
+	})
+}
+
+func Test_CircuitBreaker_GivenOpenBreaker(t *testing.T) {
+	openBreaker := func() (*CircuitBreaker, *time.Time) {
+		cb, now := newTestCircuitBreaker()
+		for i := 0; i < testBreakerConfig.FailureThreshold; i++ {
+			cb.Record(true)
+		}
+		return cb, now
+	}
+
+	t.Run("WhenOpenTimeoutExpires_ThenSingleTrialCallIsAllowed", func(t *testing.T) {
+		cb, now := openBreaker()
+		*now = now.Add(testBreakerConfig.OpenTimeout)
+
+		assert.True(t, cb.Allow())
+		assert.Equal(t, CircuitHalfOpen, cb.State())
+		// The trial is still running
+		assert.False(t, cb.Allow())
+	})
+
+	t.Run("WhenTrialSucceeds_ThenCloses", func(t *testing.T) {
+		cb, now := openBreaker()
+		*now = now.Add(testBreakerConfig.OpenTimeout)
+
+		cb.Allow()
+		cb.Record(false)
+
+		assert.Equal(t, CircuitClosed, cb.State())
+		assert.True(t, cb.Allow())
+	})
+
+	t.Run("WhenTrialFails_ThenOpensAgain", func(t *testing.T) {
+		cb, now := openBreaker()
+		*now = now.Add(testBreakerConfig.OpenTimeout)
+
+		cb.Allow()
+		cb.Record(true)
+
+		assert.Equal(t, CircuitOpen, cb.State())
+		assert.False(t, cb.Allow())
+	})
+}
@@ -0,0 +1,103 @@
+package resilient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/rs/zerolog/log"
+)
+
+type RetryPolicy struct {
+	// Total number of calls, including the first one
+	MaxAttempts int
+	// Exponential backoff between attempts: BaseDelay, 2*BaseDelay, 4*BaseDelay... up to MaxDelay.
+	// A random jitter is applied, so callers that failed at the same time do not retry at the same time
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Decorator that retries the calls to the wrapped reserver and protects it with a circuit breaker.
+// Only errors wrapping model.ErrReserverUnavailable (5xx and timeouts) are retried and count as breaker failures.
+// While the breaker is open, calls fail right away with model.ErrCircuitOpen
+type ItemReserver struct {
+	next    ports.ItemReserver
+	policy  RetryPolicy
+	breaker *CircuitBreaker
+
+	// Replaced in tests, in order to have deterministic delays
+	random func() float64
+}
+
+func NewItemReserver(next ports.ItemReserver, policy RetryPolicy, breaker *CircuitBreaker) *ItemReserver {
+	return &ItemReserver{
+		next:    next,
+		policy:  policy,
+		breaker: breaker,
+		random:  rand.Float64,
+	}
+}
+
+func (ir *ItemReserver) Reserve(ctx context.Context, cartId string, item model.CartItem) (string, error) {
+	var reservationId string
+	reserveErr := ir.call(ctx, func(ctx context.Context) error {
+		var err error
+		reservationId, err = ir.next.Reserve(ctx, cartId, item)
+		return err
+	})
+	return reservationId, reserveErr
+}
+
+func (ir *ItemReserver) Release(ctx context.Context, cartId string, item model.CartItem) error {
+	return ir.call(ctx, func(ctx context.Context) error {
+		return ir.next.Release(ctx, cartId, item)
+	})
+}
+
+func (ir *ItemReserver) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	var callErr error
+	for attempt := 1; ; attempt++ {
+		if !ir.breaker.Allow() {
+			metrics.shortCircuited.Add(1)
+			return model.ErrCircuitOpen
+		}
+
+		callErr = fn(ctx)
+		unavailable := errors.Is(callErr, model.ErrReserverUnavailable)
+		ir.breaker.Record(unavailable)
+
+		if !unavailable || attempt >= ir.policy.MaxAttempts {
+			return callErr
+		}
+
+		delay := ir.delay(attempt)
+		log.
+			Debug().
+			Err(callErr).
+			Int("attempt", attempt).
+			Dur("delay", delay).
+			Msg("retrying reserver call")
+		metrics.retries.Add(1)
+
+		select {
+		case <-ctx.Done():
+			return callErr
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Full jitter: a random delay between zero and the exponential backoff
+func (ir *ItemReserver) delay(attempt int) time.Duration {
+	backoff := ir.policy.BaseDelay
+	for i := 1; i < attempt && backoff < ir.policy.MaxDelay; i++ {
+		backoff *= 2
+	}
+	if backoff > ir.policy.MaxDelay {
+		backoff = ir.policy.MaxDelay
+	}
+	return time.Duration(ir.random() * float64(backoff))
+}
@@ -0,0 +1,163 @@
+package resilient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/mocks"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+const (
+	cartId = "5b9a2ecf-0a37-4f4b-9c57-0d4d2e7e3a11"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    2 * time.Millisecond,
+}
+
+// We use Gherkin notation for the tests
+func Test_Reserve_GivenResilientItemReserver(t *testing.T) {
+	ctx := context.Background()
+	item := model.CartItem{Id: "1", Name: "potato", Quantity: 2}
+	unavailableError := fmt.Errorf("bad http response --> %w", model.ErrReserverUnavailable)
+	rejectedError := errors.New("bad http response: 400")
+
+	type want struct {
+		err           error
+		reservationId string
+		state         CircuitState
+	}
+	tests := []struct {
+		name    string
+		breaker CircuitBreakerConfig
+		mocks   func(next *mocks.MockItemReserver)
+		want    want
+	}{
+		{
+			name:    "WhenFirstCallSucceeds_ThenNoRetries",
+			breaker: testBreakerConfig,
+			mocks: func(next *mocks.MockItemReserver) {
+				next.EXPECT().Reserve(gomock.Any(), cartId, item).
+					Return("fancyReservationId", nil)
+			},
+			want: want{
+				err:           nil,
+				reservationId: "fancyReservationId",
+				state:         CircuitClosed,
+			},
+		}, {
+			name:    "WhenReserverUnavailableAndThenRecovers_ThenRetriedUntilSuccess",
+			breaker: testBreakerConfig,
+			mocks: func(next *mocks.MockItemReserver) {
+				gomock.InOrder(
+					next.EXPECT().Reserve(gomock.Any(), cartId, item).Return("", unavailableError),
+					next.EXPECT().Reserve(gomock.Any(), cartId, item).Return("fancyReservationId", nil),
+				)
+			},
+			want: want{
+				err:           nil,
+				reservationId: "fancyReservationId",
+				state:         CircuitClosed,
+			},
+		}, {
+			name:    "WhenReserverRejectsTheRequest_ThenNotRetried",
+			breaker: testBreakerConfig,
+			mocks: func(next *mocks.MockItemReserver) {
+				next.EXPECT().Reserve(gomock.Any(), cartId, item).
+					Return("", rejectedError).
+					Times(1)
+			},
+			want: want{
+				err:           rejectedError,
+				reservationId: "",
+				state:         CircuitClosed,
+			},
+		}, {
+			name:    "WhenReserverKeepsBeingUnavailable_ThenErrorAfterMaxAttempts",
+			breaker: CircuitBreakerConfig{FailureThreshold: 10, OpenTimeout: time.Minute},
+			mocks: func(next *mocks.MockItemReserver) {
+				next.EXPECT().Reserve(gomock.Any(), cartId, item).
+					Return("", unavailableError).
+					Times(testRetryPolicy.MaxAttempts)
+			},
+			want: want{
+				err:           model.ErrReserverUnavailable,
+				reservationId: "",
+				state:         CircuitClosed,
+			},
+		}, {
+			name:    "WhenBreakerTripsWhileRetrying_ThenShortCircuited",
+			breaker: CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute},
+			mocks: func(next *mocks.MockItemReserver) {
+				next.EXPECT().Reserve(gomock.Any(), cartId, item).
+					Return("", unavailableError).
+					Times(2)
+			},
+			want: want{
+				err:           model.ErrCircuitOpen,
+				reservationId: "",
+				state:         CircuitOpen,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			next := mocks.NewMockItemReserver(mockCtrl)
+			tc.mocks(next)
+
+			breaker := NewCircuitBreaker(tc.breaker)
+			reserver := NewItemReserver(next, testRetryPolicy, breaker)
+
+			reservationId, reserveErr := reserver.Reserve(ctx, cartId, item)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, reserveErr, tc.want.err)
+			} else {
+				assert.NoError(t, reserveErr)
+			}
+			assert.Equal(t, tc.want.reservationId, reservationId)
+			assert.Equal(t, tc.want.state, breaker.State())
+		})
+	}
+}
+
+func Test_Release_GivenOpenCircuit(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	next := mocks.NewMockItemReserver(mockCtrl)
+	next.EXPECT().Release(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(0)
+
+	breaker := NewCircuitBreaker(testBreakerConfig)
+	for i := 0; i < testBreakerConfig.FailureThreshold; i++ {
+		breaker.Record(true)
+	}
+	reserver := NewItemReserver(next, testRetryPolicy, breaker)
+
+	releaseErr := reserver.Release(context.Background(), cartId, model.CartItem{Id: "1", ReservationId: "fancyReservationId"})
+
+	assert.ErrorIs(t, releaseErr, model.ErrCircuitOpen)
+}
+
+func Test_Delay_GivenResilientItemReserver(t *testing.T) {
+	reserver := NewItemReserver(nil, RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 3 * time.Second}, nil)
+
+	// No jitter, so the upper bound is returned
+	reserver.random = func() float64 { return 1 }
+	assert.Equal(t, 1*time.Second, reserver.delay(1))
+	assert.Equal(t, 2*time.Second, reserver.delay(2))
+	// Capped by the max delay
+	assert.Equal(t, 3*time.Second, reserver.delay(3))
+
+	reserver.random = func() float64 { return 0.5 }
+	assert.Equal(t, 500*time.Millisecond, reserver.delay(1))
+}
@@ -0,0 +1,65 @@
+package resilient
+
+import (
+	"expvar"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Published through expvar, so they can be read from the /debug/vars endpoint.
+// There is a single reserver in the app, so they are global
+var metrics = struct {
+	state          *expvar.String
+	trips          *expvar.Int
+	shortCircuited *expvar.Int
+	retries        *expvar.Int
+}{
+	state:          new(expvar.String),
+	trips:          new(expvar.Int),
+	shortCircuited: new(expvar.Int),
+	retries:        new(expvar.Int),
+}
+
+func init() {
+	reserverMetrics := expvar.NewMap("reserver")
+	reserverMetrics.Set("circuitState", metrics.state)
+	reserverMetrics.Set("circuitTrips", metrics.trips)
+	reserverMetrics.Set("shortCircuitedCalls", metrics.shortCircuited)
+	reserverMetrics.Set("retries", metrics.retries)
+
+	prometheus.MustRegister(prometheusCollectors()...)
+}
+
+// The same values, published through prometheus as well, so they can be read from the /metrics endpoint.
+// They are read from the expvar ones when scraped, so both endpoints always agree
+func prometheusCollectors() []prometheus.Collector {
+	collectors := []prometheus.Collector{
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "shopping_cart_reserver_circuit_trips_total",
+			Help: "Times the circuit breaker of the reserver has opened",
+		}, func() float64 { return float64(metrics.trips.Value()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "shopping_cart_reserver_short_circuited_calls_total",
+			Help: "Calls to the reserver rejected because the circuit breaker was open",
+		}, func() float64 { return float64(metrics.shortCircuited.Value()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "shopping_cart_reserver_retries_total",
+			Help: "Calls to the reserver retried after a failure",
+		}, func() float64 { return float64(metrics.retries.Value()) }),
+	}
+
+	// One series per state, I.E. 1 for the current one and 0 for the rest, so alerts do not depend on strings
+	for _, state := range []CircuitState{CircuitClosed, CircuitOpen, CircuitHalfOpen} {
+		collectors = append(collectors, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "shopping_cart_reserver_circuit_state",
+			Help:        "State of the circuit breaker of the reserver. 1 for the current state",
+			ConstLabels: prometheus.Labels{"state": string(state)},
+		}, func() float64 {
+			if metrics.state.Value() == string(state) {
+				return 1
+			}
+			return 0
+		}))
+	}
+	return collectors
+}
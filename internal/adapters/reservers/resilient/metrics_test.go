@@ -0,0 +1,68 @@
+package resilient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Harital/shopping-cart/internal/core/mocks"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// Value of the series, as scraped from the /metrics endpoint. The state is only needed by the state gauge
+func scraped(t *testing.T, name string, state CircuitState) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if state != "" && metric.GetLabel()[0].GetValue() != string(state) {
+				continue
+			}
+			if metric.GetCounter() != nil {
+				return metric.GetCounter().GetValue()
+			}
+			return metric.GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("metric %s not registered", name)
+	return 0
+}
+
+// We use Gherkin notation for the tests
+func Test_PrometheusMetrics_GivenResilientItemReserver(t *testing.T) {
+	t.Run("WhenCircuitTrips_ThenPublishedInMetricsEndpoint", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		next := mocks.NewMockItemReserver(mockCtrl)
+		next.EXPECT().Reserve(gomock.Any(), cartId, gomock.Any()).
+			Return("", model.ErrReserverUnavailable).
+			Times(testRetryPolicy.MaxAttempts)
+
+		// The metrics are global, so only the difference is checked
+		tripsBefore := scraped(t, "shopping_cart_reserver_circuit_trips_total", "")
+		shortCircuitedBefore := scraped(t, "shopping_cart_reserver_short_circuited_calls_total", "")
+		retriesBefore := scraped(t, "shopping_cart_reserver_retries_total", "")
+
+		breaker := NewCircuitBreaker(CircuitBreakerConfig{
+			FailureThreshold: testRetryPolicy.MaxAttempts,
+			OpenTimeout:      testBreakerConfig.OpenTimeout,
+		})
+		reserver := NewItemReserver(next, testRetryPolicy, breaker)
+		_, _ = reserver.Reserve(context.Background(), cartId, model.CartItem{Id: "1", Quantity: 1})
+		_, _ = reserver.Reserve(context.Background(), cartId, model.CartItem{Id: "1", Quantity: 1})
+
+		assert.Equal(t, tripsBefore+1, scraped(t, "shopping_cart_reserver_circuit_trips_total", ""))
+		assert.Equal(t, shortCircuitedBefore+1, scraped(t, "shopping_cart_reserver_short_circuited_calls_total", ""))
+		assert.Equal(t, retriesBefore+float64(testRetryPolicy.MaxAttempts-1),
+			scraped(t, "shopping_cart_reserver_retries_total", ""))
+		assert.Equal(t, float64(1), scraped(t, "shopping_cart_reserver_circuit_state", CircuitOpen))
+		assert.Equal(t, float64(0), scraped(t, "shopping_cart_reserver_circuit_state", CircuitClosed))
+		assert.Equal(t, float64(0), scraped(t, "shopping_cart_reserver_circuit_state", CircuitHalfOpen))
+	})
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Storage drivers
+const (
+	MySQLDriver    = "mysql"
+	PostgresDriver = "postgres"
+	SQLiteDriver   = "sqlite"
+	MemoryDriver   = "memory"
+)
+
+// Gin modes. Same values as gin.DebugMode, gin.ReleaseMode and gin.TestMode
+const (
+	DebugMode   = "debug"
+	ReleaseMode = "release"
+	TestMode    = "test"
+)
+
+// Whole configuration of the app. Main builds every adapter from it.
+// Every setting can be read from the config file, an env variable or a flag, in increasing order of priority.
+// I.E. reserver.retry.maxAttempts is set by
+//   - the maxAttempts key inside retry inside reserver in the config file
+//   - the SHOPPING_CART_RESERVER_RETRY_MAX_ATTEMPTS env variable
+//   - the -reserver-retry-max-attempts flag
+type Config struct {
+	Server       ServerConfig
+	Log          LogConfig
+	Database     DatabaseConfig
+	Reserver     ReserverConfig
+	Reservations ReservationsConfig
+	Idempotency  IdempotencyConfig
+	Auth         AuthConfig
+	Guests       GuestsConfig
+	Carts        CartsConfig
+}
+
+type ServerConfig struct {
+	Port int
+	// Gin mode. Debug mode logs every route and request, so it is only meant for development
+	Mode            string
+	ShutdownTimeout time.Duration
+	// Requests that do not follow api/shopping-cart-api.yaml are rejected before reaching the handlers
+	ValidateRequests bool
+	// Responses that do not follow the spec are logged and replaced by a 500, so contract violations are noticed.
+	// Every response is buffered, so it is meant for tests and staging environments
+	ValidateResponses bool
+}
+
+type LogConfig struct {
+	Level zerolog.Level
+}
+
+type DatabaseConfig struct {
+	// The memory driver keeps everything in process, for local development. Nothing else is needed for it.
+	// The sqlite one only needs the path of the database file, so no database server is needed (I.E. kiosks)
+	Driver string
+	Path   string
+	Host   string
+	// The default one is the mysql port. It needs to be changed along with the driver, I.E. 5432 for postgres
+	Port int
+	User string
+	Name string
+	// Secrets are never written in the config. Only the path of the file that holds them, I.E. a docker secret
+	PasswordFile string
+	// Read from PasswordFile
+	Password string
+	// The schema is usually migrated beforehand with the migrate command, by a user allowed to change it.
+	// Several instances starting at the same time would race to migrate it
+	AutoMigrate bool
+}
+
+type ReserverConfig struct {
+	URL string
+	// Per attempt
+	Timeout        time.Duration
+	Retry          RetryConfig
+	CircuitBreaker CircuitBreakerConfig
+	// Shared with the reserver in order to sign the reservation callbacks. Without it, every callback is rejected
+	CallbackSecretFile string
+	// Read from CallbackSecretFile
+	CallbackSecret string
+	// Callbacks signed longer ago are rejected, so they cannot be replayed
+	CallbackMaxAge time.Duration
+}
+
+type RetryConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+type CircuitBreakerConfig struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+// Reservation dispatcher and its pool of workers
+type ReservationsConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	ClaimLease   time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	Workers      int
+	QueueSize    int
+	// How often the done tasks are deleted from the outbox
+	PurgeInterval time.Duration
+}
+
+// Requests sent with an Idempotency-Key
+type IdempotencyConfig struct {
+	// Time the responses are kept for the retries
+	TTL time.Duration
+	// Time a key is held by a request in progress. Must be longer than the slowest request
+	Lease         time.Duration
+	PurgeInterval time.Duration
+}
+
+// Authentication of the clients with JWTs. Without a key set, the carts are not authenticated and anyone knowing
+// the id of a cart can use it
+type AuthConfig struct {
+	// Json web key set with the keys that sign the tokens. HS256 (oct) and RS256 (RSA) keys are supported
+	JWKSFile string
+	// Checked against the iss and aud claims, if set
+	Issuer   string
+	Audience string
+	// Clock skew allowed when checking the exp and nbf claims
+	Leeway time.Duration
+}
+
+// Shoppers can fill a cart before logging in. Every guest is told apart by an opaque token kept in a cookie, and
+// owns the carts it fills, until they are merged into the cart of the user
+type GuestsConfig struct {
+	// Disabled, requests without a token are not authenticated at all. See AuthConfig
+	Enabled bool
+	// Lifetime of the cookie. It is renewed on every request made as a guest
+	CookieMaxAge time.Duration
+	// The cookie is only sent over https. Disable it for local development
+	SecureCookie bool
+}
+
+// Carts nobody has changed for a while are abandoned. They are deleted in background, so their reservations are
+// released and their stock can be sold to someone else
+type CartsConfig struct {
+	// Time a cart is kept since its last change. Zero keeps the carts forever
+	TTL time.Duration
+	// How often the abandoned carts are looked for
+	SweepInterval time.Duration
+	// Carts deleted in every transaction
+	SweepBatchSize int
+	// Marketing is told about every abandoned cart with items by posting it to this url. Without it, the abandoned
+	// carts are only logged
+	AbandonedWebhookURL     string
+	AbandonedWebhookTimeout time.Duration
+	// The abandoned carts are published in background from an outbox, and retried until the webhook takes them.
+	// Same settings as the ones of the reservations outbox. See ReservationsConfig
+	EventsPollInterval  time.Duration
+	EventsBatchSize     int
+	EventsClaimLease    time.Duration
+	EventsMaxAttempts   int
+	EventsBaseBackoff   time.Duration
+	EventsMaxBackoff    time.Duration
+	EventsPurgeInterval time.Duration
+}
+
+// Safe values for production, I.E. gin in release mode and a 5s timeout per reserver call, instead of the debug
+// mode and the 60s the app used to hardcode. Hosts and users are the ones of the dev environment (docker-compose.yaml)
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:             8080,
+			Mode:             ReleaseMode,
+			ShutdownTimeout:  5 * time.Second,
+			ValidateRequests: true,
+		},
+		Log: LogConfig{
+			Level: zerolog.InfoLevel,
+		},
+		Database: DatabaseConfig{
+			Driver: MySQLDriver,
+			Host:   "shopping-cart-mysql",
+			Port:   3306,
+			User:   "shopping-cart-app",
+			Name:   "shoppingCart",
+		},
+		Reserver: ReserverConfig{
+			URL:     "http://www.reservationhost.com",
+			Timeout: 5 * time.Second,
+			Retry: RetryConfig{
+				MaxAttempts: 3,
+				BaseDelay:   200 * time.Millisecond,
+				MaxDelay:    2 * time.Second,
+			},
+			CircuitBreaker: CircuitBreakerConfig{
+				FailureThreshold: 5,
+				OpenTimeout:      30 * time.Second,
+			},
+			CallbackMaxAge: 5 * time.Minute,
+		},
+		Reservations: ReservationsConfig{
+			PollInterval: 1 * time.Second,
+			BatchSize:    20,
+			ClaimLease:   5 * time.Minute,
+			MaxAttempts:  10,
+			BaseBackoff:  5 * time.Second,
+			MaxBackoff:   30 * time.Minute,
+			Workers:      8,
+			QueueSize:    20,
+			// Done tasks are only useful while investigating an incident
+			PurgeInterval: time.Hour,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:           24 * time.Hour,
+			Lease:         time.Minute,
+			PurgeInterval: 10 * time.Minute,
+		},
+		Auth: AuthConfig{
+			Leeway: 30 * time.Second,
+		},
+		Guests: GuestsConfig{
+			CookieMaxAge: 30 * 24 * time.Hour,
+			SecureCookie: true,
+		},
+		Carts: CartsConfig{
+			TTL:                     7 * 24 * time.Hour,
+			SweepInterval:           time.Minute,
+			SweepBatchSize:          100,
+			AbandonedWebhookTimeout: 5 * time.Second,
+			EventsPollInterval:      5 * time.Second,
+			EventsBatchSize:         20,
+			// Events are published one by one, so a batch may take up to 20 webhook timeouts
+			EventsClaimLease:    5 * time.Minute,
+			EventsMaxAttempts:   10,
+			EventsBaseBackoff:   30 * time.Second,
+			EventsMaxBackoff:    time.Hour,
+			EventsPurgeInterval: time.Hour,
+		},
+	}
+}
@@ -0,0 +1,306 @@
+package config
+
+import (
+	"encoding"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	envPrefix = "SHOPPING_CART_"
+	// The config file is the only setting that cannot be written in the config file itself
+	configFileFlag = "config"
+	configFileEnv  = envPrefix + "CONFIG_FILE"
+)
+
+// Every setting is registered as a flag. The very same flag.Value is used to parse the value coming from the file
+// and the env variables, so all the sources behave exactly the same
+type registry struct {
+	fs   *flag.FlagSet
+	keys []string
+}
+
+func (r *registry) string(p *string, key string, usage string) {
+	r.fs.StringVar(p, flagName(key), *p, usage)
+	r.keys = append(r.keys, key)
+}
+
+func (r *registry) bool(p *bool, key string, usage string) {
+	r.fs.BoolVar(p, flagName(key), *p, usage)
+	r.keys = append(r.keys, key)
+}
+
+func (r *registry) int(p *int, key string, usage string) {
+	r.fs.IntVar(p, flagName(key), *p, usage)
+	r.keys = append(r.keys, key)
+}
+
+func (r *registry) duration(p *time.Duration, key string, usage string) {
+	r.fs.DurationVar(p, flagName(key), *p, usage)
+	r.keys = append(r.keys, key)
+}
+
+func (r *registry) text(p encoding.TextUnmarshaler, value encoding.TextMarshaler, key string, usage string) {
+	r.fs.TextVar(p, flagName(key), value, usage)
+	r.keys = append(r.keys, key)
+}
+
+func (r *registry) set(key string, value string) error {
+	if setErr := r.fs.Set(flagName(key), value); setErr != nil {
+		return fmt.Errorf("%s --> %w", key, setErr)
+	}
+	return nil
+}
+
+// The keys are the ones used in the config file. Flags and env variables are derived from them
+func register(cfg *Config, fs *flag.FlagSet) *registry {
+	r := &registry{fs: fs}
+
+	r.int(&cfg.Server.Port, "server.port", "port where the http server listens")
+	r.string(&cfg.Server.Mode, "server.mode", "gin mode: debug, release or test")
+	r.duration(&cfg.Server.ShutdownTimeout, "server.shutdownTimeout", "time given to the running requests and reservations to finish")
+	r.bool(&cfg.Server.ValidateRequests, "server.validateRequests", "reject the requests that do not follow the openapi spec")
+	r.bool(&cfg.Server.ValidateResponses, "server.validateResponses", "replace the responses that do not follow the openapi spec by a 500. Meant for tests")
+
+	r.text(&cfg.Log.Level, cfg.Log.Level, "log.level", "log level: trace, debug, info, warn, error, fatal or panic")
+
+	r.string(&cfg.Database.Driver, "database.driver", "storage of the carts: mysql, postgres, sqlite or memory")
+	r.string(&cfg.Database.Path, "database.path", "path of the sqlite database file")
+	r.string(&cfg.Database.Host, "database.host", "database host")
+	r.int(&cfg.Database.Port, "database.port", "database port")
+	r.string(&cfg.Database.User, "database.user", "database user")
+	r.string(&cfg.Database.Name, "database.name", "database name")
+	r.string(&cfg.Database.PasswordFile, "database.passwordFile", "path of the file with the database password")
+	r.bool(&cfg.Database.AutoMigrate, "database.autoMigrate", "apply the pending migrations when the server starts. Sqlite databases are always migrated")
+
+	r.string(&cfg.Reserver.URL, "reserver.url", "base url of the reserver service")
+	r.duration(&cfg.Reserver.Timeout, "reserver.timeout", "timeout of every call to the reserver")
+	r.int(&cfg.Reserver.Retry.MaxAttempts, "reserver.retry.maxAttempts", "attempts of every call to the reserver, including the first one")
+	r.duration(&cfg.Reserver.Retry.BaseDelay, "reserver.retry.baseDelay", "backoff before the first retry")
+	r.duration(&cfg.Reserver.Retry.MaxDelay, "reserver.retry.maxDelay", "maximum backoff between retries")
+	r.int(&cfg.Reserver.CircuitBreaker.FailureThreshold, "reserver.circuitBreaker.failureThreshold", "consecutive failures that open the circuit breaker")
+	r.duration(&cfg.Reserver.CircuitBreaker.OpenTimeout, "reserver.circuitBreaker.openTimeout", "time the circuit breaker stays open before a trial call")
+	r.string(&cfg.Reserver.CallbackSecretFile, "reserver.callbackSecretFile", "path of the file with the secret that signs the reservation callbacks")
+	r.duration(&cfg.Reserver.CallbackMaxAge, "reserver.callbackMaxAge", "time a signed reservation callback is accepted for")
+
+	r.duration(&cfg.Reservations.PollInterval, "reservations.pollInterval", "time between outbox polls")
+	r.int(&cfg.Reservations.BatchSize, "reservations.batchSize", "tasks claimed from the outbox at once")
+	r.duration(&cfg.Reservations.ClaimLease, "reservations.claimLease", "time a claimed task is kept away from other dispatchers")
+	r.int(&cfg.Reservations.MaxAttempts, "reservations.maxAttempts", "attempts before a task is marked as dead")
+	r.duration(&cfg.Reservations.BaseBackoff, "reservations.baseBackoff", "backoff before retrying a failed task")
+	r.duration(&cfg.Reservations.MaxBackoff, "reservations.maxBackoff", "maximum backoff before retrying a failed task")
+	r.int(&cfg.Reservations.Workers, "reservations.workers", "workers that process the reservation tasks")
+	r.int(&cfg.Reservations.QueueSize, "reservations.queueSize", "tasks queued per worker")
+	r.duration(&cfg.Reservations.PurgeInterval, "reservations.purgeInterval", "time between purges of the done tasks of the outbox")
+
+	r.duration(&cfg.Idempotency.TTL, "idempotency.ttl", "time the responses to requests with an Idempotency-Key are replayed")
+	r.duration(&cfg.Idempotency.Lease, "idempotency.lease", "time an Idempotency-Key is held by a request in progress")
+	r.duration(&cfg.Idempotency.PurgeInterval, "idempotency.purgeInterval", "time between purges of the expired idempotency keys")
+
+	r.string(&cfg.Auth.JWKSFile, "auth.jwksFile", "path of the json web key set that signs the client tokens. Clients are not authenticated without it")
+	r.string(&cfg.Auth.Issuer, "auth.issuer", "expected iss claim of the client tokens")
+	r.string(&cfg.Auth.Audience, "auth.audience", "expected aud claim of the client tokens")
+	r.duration(&cfg.Auth.Leeway, "auth.leeway", "clock skew allowed when checking the expiration of the client tokens")
+	r.bool(&cfg.Guests.Enabled, "guests.enabled", "lets the shoppers fill a cart before logging in, telling them apart by a cookie")
+	r.duration(&cfg.Guests.CookieMaxAge, "guests.cookieMaxAge", "lifetime of the guest cookie")
+	r.bool(&cfg.Guests.SecureCookie, "guests.secureCookie", "only send the guest cookie over https")
+
+	r.duration(&cfg.Carts.TTL, "carts.ttl", "time a cart is kept since its last change. 0 keeps the carts forever")
+	r.duration(&cfg.Carts.SweepInterval, "carts.sweepInterval", "time between searches of abandoned carts")
+	r.int(&cfg.Carts.SweepBatchSize, "carts.sweepBatchSize", "abandoned carts deleted at once")
+	r.string(&cfg.Carts.AbandonedWebhookURL, "carts.abandonedWebhookUrl", "url the abandoned carts are posted to. They are only logged without it")
+	r.duration(&cfg.Carts.AbandonedWebhookTimeout, "carts.abandonedWebhookTimeout", "timeout of every call to the abandoned carts webhook")
+	r.duration(&cfg.Carts.EventsPollInterval, "carts.eventsPollInterval", "time between polls of the abandoned carts outbox")
+	r.int(&cfg.Carts.EventsBatchSize, "carts.eventsBatchSize", "abandoned carts claimed from the outbox at once")
+	r.duration(&cfg.Carts.EventsClaimLease, "carts.eventsClaimLease", "time a claimed abandoned cart is kept away from other dispatchers")
+	r.int(&cfg.Carts.EventsMaxAttempts, "carts.eventsMaxAttempts", "attempts before an abandoned cart is marked as dead")
+	r.duration(&cfg.Carts.EventsBaseBackoff, "carts.eventsBaseBackoff", "backoff before publishing a failed abandoned cart again")
+	r.duration(&cfg.Carts.EventsMaxBackoff, "carts.eventsMaxBackoff", "maximum backoff before publishing a failed abandoned cart again")
+	r.duration(&cfg.Carts.EventsPurgeInterval, "carts.eventsPurgeInterval", "time between purges of the published abandoned carts of the outbox")
+
+	return r
+}
+
+// Loads the config from the defaults, the config file, the env variables and the flags, in increasing order of priority.
+// The config file is given by the -config flag or the SHOPPING_CART_CONFIG_FILE env variable.
+// flag.ErrHelp is returned if the help is requested
+func Load(name string, args []string, getenv func(string) string) (Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String(configFileFlag, getenv(configFileEnv), "path of the yaml or toml config file")
+	r := register(&cfg, fs)
+
+	if parseErr := fs.Parse(args); parseErr != nil {
+		return Config{}, parseErr
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	// The flags are parsed first in order to know the config file, but they must be applied last.
+	// The registered values point to cfg, so resetting it leaves the flags untouched
+	flags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) { flags[f.Name] = f.Value.String() })
+	cfg = Default()
+
+	if *configFile != "" {
+		if fileErr := r.applyFile(*configFile); fileErr != nil {
+			return Config{}, fileErr
+		}
+	}
+
+	for _, key := range r.keys {
+		if value := getenv(envName(key)); value != "" {
+			if setErr := r.set(key, value); setErr != nil {
+				return Config{}, fmt.Errorf("env variable %s --> %w", envName(key), setErr)
+			}
+		}
+	}
+
+	for name, value := range flags {
+		if name == configFileFlag {
+			continue
+		}
+		if setErr := fs.Set(name, value); setErr != nil {
+			return Config{}, fmt.Errorf("flag %s --> %w", name, setErr)
+		}
+	}
+
+	if secretsErr := cfg.readSecrets(); secretsErr != nil {
+		return Config{}, secretsErr
+	}
+
+	if validateErr := cfg.Validate(); validateErr != nil {
+		return Config{}, validateErr
+	}
+	return cfg, nil
+}
+
+// The format is given by the extension
+func (r *registry) applyFile(path string) error {
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return fmt.Errorf("reading config file --> %w", readErr)
+	}
+
+	var content map[string]any
+	var decodeErr error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decodeErr = yaml.Unmarshal(data, &content)
+	case ".toml":
+		decodeErr = toml.Unmarshal(data, &content)
+	default:
+		return fmt.Errorf("config file %s is neither yaml nor toml", path)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("decoding config file %s --> %w", path, decodeErr)
+	}
+
+	values := map[string]string{}
+	if flattenErr := flatten("", content, values); flattenErr != nil {
+		return fmt.Errorf("config file %s --> %w", path, flattenErr)
+	}
+
+	// Sorted, so the errors are always the same for the same file
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		// A typo in the file would silently leave the default value otherwise
+		if r.fs.Lookup(flagName(key)) == nil || key == configFileFlag {
+			return fmt.Errorf("config file %s --> unknown key %s", path, key)
+		}
+		if setErr := r.set(key, values[key]); setErr != nil {
+			return fmt.Errorf("config file %s --> %w", path, setErr)
+		}
+	}
+	return nil
+}
+
+// Turns the nested sections of the file into dotted keys. I.E. reserver: {retry: {maxAttempts: 3}} is reserver.retry.maxAttempts
+func flatten(prefix string, content map[string]any, values map[string]string) error {
+	for key, value := range content {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case map[string]any:
+			if flattenErr := flatten(key, v, values); flattenErr != nil {
+				return flattenErr
+			}
+		case []any:
+			return fmt.Errorf("%s --> lists are not supported", key)
+		case nil:
+			// An empty key leaves the previous value
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) readSecrets() error {
+	if cfg.Database.PasswordFile != "" {
+		password, readErr := readSecret(cfg.Database.PasswordFile)
+		if readErr != nil {
+			return fmt.Errorf("database.passwordFile --> %w", readErr)
+		}
+		cfg.Database.Password = password
+	}
+
+	if cfg.Reserver.CallbackSecretFile != "" {
+		secret, readErr := readSecret(cfg.Reserver.CallbackSecretFile)
+		if readErr != nil {
+			return fmt.Errorf("reserver.callbackSecretFile --> %w", readErr)
+		}
+		cfg.Reserver.CallbackSecret = secret
+	}
+	return nil
+}
+
+// Secret files are usually written with a trailing new line, which is not part of the secret
+func readSecret(path string) (string, error) {
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return "", readErr
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// server.shutdownTimeout --> server-shutdown-timeout
+func flagName(key string) string {
+	return strings.ReplaceAll(splitWords(key, '-'), ".", "-")
+}
+
+// server.shutdownTimeout --> SHOPPING_CART_SERVER_SHUTDOWN_TIMEOUT
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(splitWords(key, '_'), ".", "_"))
+}
+
+// Lower cases the camel case words, separated by sep
+func splitWords(key string, sep rune) string {
+	var sb strings.Builder
+	for _, c := range key {
+		if unicode.IsUpper(c) {
+			sb.WriteRune(sep)
+			c = unicode.ToLower(c)
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
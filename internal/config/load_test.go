@@ -0,0 +1,286 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if writeErr := os.WriteFile(path, []byte(content), 0o600); writeErr != nil {
+		t.Fatalf("Error when writing %s: %v", name, writeErr)
+	}
+	return path
+}
+
+func Test_Load(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+server:
+  port: 9090
+  mode: debug
+log:
+  level: debug
+reserver:
+  url: https://reserver.example.com
+  retry:
+    maxAttempts: 5
+    maxDelay: 10s
+`)
+	tomlFile := writeFile(t, "config.toml", `
+[server]
+port = 9091
+
+[reservations]
+workers = 2
+claimLease = "1m"
+`)
+	unknownKeyFile := writeFile(t, "unknown.yaml", `
+reserver:
+  retries: 5
+`)
+	invalidValueFile := writeFile(t, "invalid.yaml", `
+server:
+  port: eighty
+`)
+	jsonFile := writeFile(t, "config.json", `{}`)
+	passwordFile := writeFile(t, "password", "secretPassword\n")
+	callbackSecretFile := writeFile(t, "callbackSecret", "callbackSecret")
+
+	type input struct {
+		args []string
+		env  map[string]string
+	}
+	type want struct {
+		err    bool
+		help   bool
+		config func() Config
+	}
+	tests := []struct {
+		name string
+		in   input
+		want want
+	}{
+		{
+			name: "WhenNothingIsSet_ThenDefaults",
+			in:   input{},
+			want: want{
+				config: Default,
+			},
+		}, {
+			name: "WhenYamlFile_ThenFileValuesOverrideDefaults",
+			in: input{
+				args: []string{"-config", yamlFile},
+			},
+			want: want{
+				config: func() Config {
+					cfg := Default()
+					cfg.Server.Port = 9090
+					cfg.Server.Mode = DebugMode
+					cfg.Log.Level = zerolog.DebugLevel
+					cfg.Reserver.URL = "https://reserver.example.com"
+					cfg.Reserver.Retry.MaxAttempts = 5
+					cfg.Reserver.Retry.MaxDelay = 10 * time.Second
+					return cfg
+				},
+			},
+		}, {
+			name: "WhenTomlFileInEnv_ThenFileValuesOverrideDefaults",
+			in: input{
+				env: map[string]string{"SHOPPING_CART_CONFIG_FILE": tomlFile},
+			},
+			want: want{
+				config: func() Config {
+					cfg := Default()
+					cfg.Server.Port = 9091
+					cfg.Reservations.Workers = 2
+					cfg.Reservations.ClaimLease = time.Minute
+					return cfg
+				},
+			},
+		}, {
+			name: "WhenBoolInEnv_ThenItIsSet",
+			in: input{
+				env: map[string]string{"SHOPPING_CART_DATABASE_AUTO_MIGRATE": "true"},
+			},
+			want: want{
+				config: func() Config {
+					cfg := Default()
+					cfg.Database.AutoMigrate = true
+					return cfg
+				},
+			},
+		}, {
+			name: "WhenBoolFlagWithoutValue_ThenItIsSet",
+			in: input{
+				args: []string{"-database-auto-migrate"},
+			},
+			want: want{
+				config: func() Config {
+					cfg := Default()
+					cfg.Database.AutoMigrate = true
+					return cfg
+				},
+			},
+		}, {
+			name: "WhenFileEnvAndFlags_ThenFlagsOverrideEnvThatOverridesFile",
+			in: input{
+				args: []string{"-config", yamlFile, "-server-port", "7070"},
+				env: map[string]string{
+					"SHOPPING_CART_SERVER_PORT":                 "6060",
+					"SHOPPING_CART_RESERVER_RETRY_MAX_ATTEMPTS": "4",
+				},
+			},
+			want: want{
+				config: func() Config {
+					cfg := Default()
+					cfg.Server.Port = 7070
+					cfg.Server.Mode = DebugMode
+					cfg.Log.Level = zerolog.DebugLevel
+					cfg.Reserver.URL = "https://reserver.example.com"
+					cfg.Reserver.Retry.MaxAttempts = 4
+					cfg.Reserver.Retry.MaxDelay = 10 * time.Second
+					return cfg
+				},
+			},
+		}, {
+			name: "WhenSecretFiles_ThenSecretsAreRead",
+			in: input{
+				args: []string{"-reserver-callback-secret-file", callbackSecretFile},
+				env:  map[string]string{"SHOPPING_CART_DATABASE_PASSWORD_FILE": passwordFile},
+			},
+			want: want{
+				config: func() Config {
+					cfg := Default()
+					cfg.Database.PasswordFile = passwordFile
+					cfg.Database.Password = "secretPassword"
+					cfg.Reserver.CallbackSecretFile = callbackSecretFile
+					cfg.Reserver.CallbackSecret = "callbackSecret"
+					return cfg
+				},
+			},
+		}, {
+			name: "WhenSecretFileDoesNotExist_ThenError",
+			in: input{
+				args: []string{"-database-password-file", filepath.Join(t.TempDir(), "missing")},
+			},
+			want: want{
+				err: true,
+			},
+		}, {
+			name: "WhenConfigFileDoesNotExist_ThenError",
+			in: input{
+				args: []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")},
+			},
+			want: want{
+				err: true,
+			},
+		}, {
+			name: "WhenConfigFileIsNeitherYamlNorToml_ThenError",
+			in: input{
+				args: []string{"-config", jsonFile},
+			},
+			want: want{
+				err: true,
+			},
+		}, {
+			name: "WhenConfigFileHasUnknownKey_ThenError",
+			in: input{
+				args: []string{"-config", unknownKeyFile},
+			},
+			want: want{
+				err: true,
+			},
+		}, {
+			name: "WhenConfigFileHasInvalidValue_ThenError",
+			in: input{
+				args: []string{"-config", invalidValueFile},
+			},
+			want: want{
+				err: true,
+			},
+		}, {
+			name: "WhenEnvHasInvalidValue_ThenError",
+			in: input{
+				env: map[string]string{"SHOPPING_CART_RESERVER_TIMEOUT": "five seconds"},
+			},
+			want: want{
+				err: true,
+			},
+		}, {
+			name: "WhenUnknownFlag_ThenError",
+			in: input{
+				args: []string{"-database-password", "literal"},
+			},
+			want: want{
+				err: true,
+			},
+		}, {
+			name: "WhenUnexpectedArguments_ThenError",
+			in: input{
+				args: []string{"-server-port", "7070", "serve"},
+			},
+			want: want{
+				err: true,
+			},
+		}, {
+			name: "WhenInvalidSetting_ThenValidationError",
+			in: input{
+				args: []string{"-server-mode", "production"},
+			},
+			want: want{
+				err: true,
+			},
+		}, {
+			name: "WhenHelpRequested_ThenErrHelp",
+			in: input{
+				args: []string{"-h"},
+			},
+			want: want{
+				err:  true,
+				help: true,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			getenv := func(key string) string { return tc.in.env[key] }
+
+			cfg, loadErr := Load("shopping-cart", tc.in.args, getenv)
+
+			if tc.want.help {
+				assert.ErrorIs(t, loadErr, flag.ErrHelp)
+			}
+			if tc.want.err {
+				assert.Error(t, loadErr)
+				return
+			}
+			assert.NoError(t, loadErr)
+			assert.Equal(t, tc.want.config(), cfg)
+		})
+	}
+}
+
+func Test_Names(t *testing.T) {
+	tests := []struct {
+		key  string
+		flag string
+		env  string
+	}{
+		{key: "server.port", flag: "server-port", env: "SHOPPING_CART_SERVER_PORT"},
+		{key: "server.shutdownTimeout", flag: "server-shutdown-timeout", env: "SHOPPING_CART_SERVER_SHUTDOWN_TIMEOUT"},
+		{key: "reserver.circuitBreaker.failureThreshold", flag: "reserver-circuit-breaker-failure-threshold",
+			env: "SHOPPING_CART_RESERVER_CIRCUIT_BREAKER_FAILURE_THRESHOLD"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.key, func(t *testing.T) {
+			assert.Equal(t, tc.flag, flagName(tc.key))
+			assert.Equal(t, tc.env, envName(tc.key))
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Returns all the invalid settings at once, so they can be fixed in one go
+func (cfg Config) Validate() error {
+	var errs []error
+	check := func(valid bool, key string, format string, args ...any) {
+		if !valid {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+	positive := func(value int, key string) {
+		check(value > 0, key, "must be greater than zero, got %d", value)
+	}
+	positiveDuration := func(value time.Duration, key string) {
+		check(value > 0, key, "must be greater than zero, got %s", value)
+	}
+	validPort := func(value int, key string) {
+		check(value > 0 && value <= 65535, key, "must be a valid port, got %d", value)
+	}
+
+	validPort(cfg.Server.Port, "server.port")
+	check(cfg.Server.Mode == DebugMode || cfg.Server.Mode == ReleaseMode || cfg.Server.Mode == TestMode,
+		"server.mode", "must be %s, %s or %s, got %q", DebugMode, ReleaseMode, TestMode, cfg.Server.Mode)
+	positiveDuration(cfg.Server.ShutdownTimeout, "server.shutdownTimeout")
+
+	switch cfg.Database.Driver {
+	case MySQLDriver, PostgresDriver:
+		check(cfg.Database.Host != "", "database.host", "is required")
+		validPort(cfg.Database.Port, "database.port")
+		check(cfg.Database.User != "", "database.user", "is required")
+		check(cfg.Database.Name != "", "database.name", "is required")
+	case SQLiteDriver:
+		check(cfg.Database.Path != "", "database.path", "is required")
+	case MemoryDriver:
+	default:
+		check(false, "database.driver", "must be %s, %s, %s or %s, got %q", MySQLDriver, PostgresDriver, SQLiteDriver, MemoryDriver, cfg.Database.Driver)
+	}
+
+	reserverURL, urlErr := url.Parse(cfg.Reserver.URL)
+	check(urlErr == nil && (reserverURL.Scheme == "http" || reserverURL.Scheme == "https") && reserverURL.Host != "",
+		"reserver.url", "must be an absolute http or https url, got %q", cfg.Reserver.URL)
+	positiveDuration(cfg.Reserver.Timeout, "reserver.timeout")
+	positive(cfg.Reserver.Retry.MaxAttempts, "reserver.retry.maxAttempts")
+	positiveDuration(cfg.Reserver.Retry.BaseDelay, "reserver.retry.baseDelay")
+	check(cfg.Reserver.Retry.MaxDelay >= cfg.Reserver.Retry.BaseDelay, "reserver.retry.maxDelay",
+		"must not be lower than reserver.retry.baseDelay, got %s", cfg.Reserver.Retry.MaxDelay)
+	positive(cfg.Reserver.CircuitBreaker.FailureThreshold, "reserver.circuitBreaker.failureThreshold")
+	positiveDuration(cfg.Reserver.CircuitBreaker.OpenTimeout, "reserver.circuitBreaker.openTimeout")
+	positiveDuration(cfg.Reserver.CallbackMaxAge, "reserver.callbackMaxAge")
+
+	positiveDuration(cfg.Reservations.PollInterval, "reservations.pollInterval")
+	positive(cfg.Reservations.BatchSize, "reservations.batchSize")
+	positiveDuration(cfg.Reservations.ClaimLease, "reservations.claimLease")
+	positive(cfg.Reservations.MaxAttempts, "reservations.maxAttempts")
+	positiveDuration(cfg.Reservations.BaseBackoff, "reservations.baseBackoff")
+	check(cfg.Reservations.MaxBackoff >= cfg.Reservations.BaseBackoff, "reservations.maxBackoff",
+		"must not be lower than reservations.baseBackoff, got %s", cfg.Reservations.MaxBackoff)
+	positive(cfg.Reservations.Workers, "reservations.workers")
+	positive(cfg.Reservations.QueueSize, "reservations.queueSize")
+	positiveDuration(cfg.Reservations.PurgeInterval, "reservations.purgeInterval")
+
+	positiveDuration(cfg.Idempotency.TTL, "idempotency.ttl")
+	positiveDuration(cfg.Idempotency.Lease, "idempotency.lease")
+	positiveDuration(cfg.Idempotency.PurgeInterval, "idempotency.purgeInterval")
+
+	check(cfg.Auth.Leeway >= 0, "auth.leeway", "must not be negative, got %s", cfg.Auth.Leeway)
+
+	positiveDuration(cfg.Guests.CookieMaxAge, "guests.cookieMaxAge")
+
+	check(cfg.Carts.TTL >= 0, "carts.ttl", "must not be negative, got %s", cfg.Carts.TTL)
+	positiveDuration(cfg.Carts.SweepInterval, "carts.sweepInterval")
+	positive(cfg.Carts.SweepBatchSize, "carts.sweepBatchSize")
+	if cfg.Carts.AbandonedWebhookURL != "" {
+		webhookURL, webhookErr := url.Parse(cfg.Carts.AbandonedWebhookURL)
+		check(webhookErr == nil && (webhookURL.Scheme == "http" || webhookURL.Scheme == "https") && webhookURL.Host != "",
+			"carts.abandonedWebhookUrl", "must be an absolute http or https url, got %q", cfg.Carts.AbandonedWebhookURL)
+	}
+	positiveDuration(cfg.Carts.AbandonedWebhookTimeout, "carts.abandonedWebhookTimeout")
+	positiveDuration(cfg.Carts.EventsPollInterval, "carts.eventsPollInterval")
+	positive(cfg.Carts.EventsBatchSize, "carts.eventsBatchSize")
+	positiveDuration(cfg.Carts.EventsClaimLease, "carts.eventsClaimLease")
+	positive(cfg.Carts.EventsMaxAttempts, "carts.eventsMaxAttempts")
+	positiveDuration(cfg.Carts.EventsBaseBackoff, "carts.eventsBaseBackoff")
+	check(cfg.Carts.EventsMaxBackoff >= cfg.Carts.EventsBaseBackoff, "carts.eventsMaxBackoff",
+		"must not be lower than carts.eventsBaseBackoff, got %s", cfg.Carts.EventsMaxBackoff)
+	positiveDuration(cfg.Carts.EventsPurgeInterval, "carts.eventsPurgeInterval")
+
+	return errors.Join(errs...)
+}
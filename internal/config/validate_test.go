@@ -0,0 +1,129 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		// Every invalid setting is reported
+		wantErrs []string
+	}{
+		{
+			name:   "WhenDefaults_ThenValid",
+			modify: func(cfg *Config) {},
+		}, {
+			name: "WhenWrongPortAndMode_ThenBothAreReported",
+			modify: func(cfg *Config) {
+				cfg.Server.Port = 70000
+				cfg.Server.Mode = "production"
+			},
+			wantErrs: []string{"server.port", "server.mode"},
+		}, {
+			name: "WhenDatabaseHostMissing_ThenError",
+			modify: func(cfg *Config) {
+				cfg.Database.Host = ""
+			},
+			wantErrs: []string{"database.host"},
+		}, {
+			name: "WhenMemoryDriver_ThenDatabaseHostIsNotNeeded",
+			modify: func(cfg *Config) {
+				cfg.Database.Driver = MemoryDriver
+				cfg.Database.Host = ""
+			},
+		}, {
+			name: "WhenPostgresDriverWithoutUser_ThenError",
+			modify: func(cfg *Config) {
+				cfg.Database.Driver = PostgresDriver
+				cfg.Database.Port = 5432
+				cfg.Database.User = ""
+			},
+			wantErrs: []string{"database.user"},
+		}, {
+			name: "WhenSQLiteDriverWithoutPath_ThenError",
+			modify: func(cfg *Config) {
+				cfg.Database.Driver = SQLiteDriver
+				cfg.Database.Host = ""
+			},
+			wantErrs: []string{"database.path"},
+		}, {
+			name: "WhenUnknownDriver_ThenError",
+			modify: func(cfg *Config) {
+				cfg.Database.Driver = "oracle"
+			},
+			wantErrs: []string{"database.driver"},
+		}, {
+			name: "WhenReserverUrlIsRelative_ThenError",
+			modify: func(cfg *Config) {
+				cfg.Reserver.URL = "reserver/api"
+			},
+			wantErrs: []string{"reserver.url"},
+		}, {
+			name: "WhenMaxDelayLowerThanBaseDelay_ThenError",
+			modify: func(cfg *Config) {
+				cfg.Reserver.Retry.BaseDelay = time.Second
+				cfg.Reserver.Retry.MaxDelay = time.Millisecond
+			},
+			wantErrs: []string{"reserver.retry.maxDelay"},
+		}, {
+			name: "WhenNoWorkersAndZeroPollInterval_ThenBothAreReported",
+			modify: func(cfg *Config) {
+				cfg.Reservations.Workers = 0
+				cfg.Reservations.PollInterval = 0
+			},
+			wantErrs: []string{"reservations.workers", "reservations.pollInterval"},
+		}, {
+			name: "WhenZeroIdempotencyTTL_ThenError",
+			modify: func(cfg *Config) {
+				cfg.Idempotency.TTL = 0
+			},
+			wantErrs: []string{"idempotency.ttl"},
+		}, {
+			name: "WhenNegativeAuthLeeway_ThenError",
+			modify: func(cfg *Config) {
+				cfg.Auth.Leeway = -time.Second
+			},
+			wantErrs: []string{"auth.leeway"},
+		}, {
+			name: "WhenZeroGuestCookieMaxAge_ThenError",
+			modify: func(cfg *Config) {
+				cfg.Guests.CookieMaxAge = 0
+			},
+			wantErrs: []string{"guests.cookieMaxAge"},
+		}, {
+			name: "WhenZeroCartTTL_ThenCartsAreKeptForever",
+			modify: func(cfg *Config) {
+				cfg.Carts.TTL = 0
+			},
+		}, {
+			name: "WhenRelativeWebhookUrlAndNoBatchSize_ThenBothAreReported",
+			modify: func(cfg *Config) {
+				cfg.Carts.AbandonedWebhookURL = "/abandoned"
+				cfg.Carts.SweepBatchSize = 0
+			},
+			wantErrs: []string{"carts.abandonedWebhookUrl", "carts.sweepBatchSize"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Default()
+			tc.modify(&cfg)
+
+			validateErr := cfg.Validate()
+
+			if len(tc.wantErrs) == 0 {
+				assert.NoError(t, validateErr)
+				return
+			}
+			assert.Error(t, validateErr)
+			for _, key := range tc.wantErrs {
+				assert.Contains(t, validateErr.Error(), key)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Errors of the domain. Repositories and services return them, usually wrapped with some context, and the adapters
+// translate them by kind. I.E. the http handlers turn them into status codes.
+// They are checked with errors.Is and errors.As, never by their message
+package domainerr
+
+import "errors"
+
+type Kind string
+
+const (
+	// The cart, item or whatever was asked for does not exist
+	NotFound Kind = "not_found"
+	// The request is wrong. Sending it again will fail again
+	Validation Kind = "validation"
+	// The request clashes with the current state, I.E. the cart has been changed by someone else
+	Conflict Kind = "conflict"
+	// A dependency could not be reached. Worth retrying later
+	Unavailable Kind = "unavailable"
+	// The caller could not be authenticated
+	Unauthorized Kind = "unauthorized"
+	// The caller is known, but it is not allowed to do that, I.E. the cart belongs to someone else
+	Forbidden Kind = "forbidden"
+)
+
+// One per kind. errors.Is(err, domainerr.ErrNotFound) matches every not found error, whatever its code
+var (
+	ErrNotFound     = &Error{Kind: NotFound}
+	ErrValidation   = &Error{Kind: Validation}
+	ErrConflict     = &Error{Kind: Conflict}
+	ErrUnavailable  = &Error{Kind: Unavailable}
+	ErrUnauthorized = &Error{Kind: Unauthorized}
+	ErrForbidden    = &Error{Kind: Forbidden}
+)
+
+type Error struct {
+	Kind Kind
+	// Machine readable, I.E. item_not_found. It is sent to the clients, so it must not change once published
+	Code string
+	// Readable by humans. It is sent to the clients as well, so it must not carry internal details
+	Message string
+}
+
+// Errors are meant to be package level sentinels, so they can be compared with errors.Is
+func New(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return string(e.Kind)
+	}
+	return e.Message
+}
+
+// The kind sentinels have no code, and match every error of their kind. Any other error only matches itself
+func (e *Error) Is(target error) bool {
+	kindErr, ok := target.(*Error)
+	return ok && kindErr.Code == "" && kindErr.Kind == e.Kind
+}
+
+// Returns the outermost domain error of the chain, if any
+func As(err error) (*Error, bool) {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr, true
+	}
+	return nil, false
+}
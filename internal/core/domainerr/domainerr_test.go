@@ -0,0 +1,59 @@
+package domainerr_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Harital/shopping-cart/internal/core/domainerr"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	errItemNotFound = domainerr.New(domainerr.NotFound, "item_not_found", "item not found")
+	errCartNotFound = domainerr.New(domainerr.NotFound, "cart_not_found", "cart not found")
+)
+
+// We use Gherkin notation for the tests
+func Test_Is_GivenWrappedDomainError(t *testing.T) {
+	err := fmt.Errorf("removing item 3 --> %w", errItemNotFound)
+
+	tests := []struct {
+		name   string
+		target error
+		want   bool
+	}{
+		{name: "WhenSameError_ThenMatches", target: errItemNotFound, want: true},
+		{name: "WhenItsKind_ThenMatches", target: domainerr.ErrNotFound, want: true},
+		{name: "WhenAnotherErrorOfTheSameKind_ThenDoesNotMatch", target: errCartNotFound, want: false},
+		{name: "WhenAnotherKind_ThenDoesNotMatch", target: domainerr.ErrConflict, want: false},
+		{name: "WhenNotDomainError_ThenDoesNotMatch", target: errors.New("item not found"), want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, errors.Is(err, tc.target))
+		})
+	}
+}
+
+func Test_As_GivenErrors(t *testing.T) {
+	t.Run("WhenWrappedDomainError_ThenItIsReturned", func(t *testing.T) {
+		domainErr, ok := domainerr.As(fmt.Errorf("removing item 3 --> %w", errItemNotFound))
+
+		assert.True(t, ok)
+		assert.Equal(t, domainerr.NotFound, domainErr.Kind)
+		assert.Equal(t, "item_not_found", domainErr.Code)
+		assert.Equal(t, "item not found", domainErr.Message)
+	})
+
+	t.Run("WhenNotDomainError_ThenFalse", func(t *testing.T) {
+		_, ok := domainerr.As(errors.New("connection refused"))
+
+		assert.False(t, ok)
+	})
+
+	t.Run("WhenKindSentinel_ThenMessageIsTheKind", func(t *testing.T) {
+		assert.Equal(t, "not_found", domainerr.ErrNotFound.Error())
+	})
+}
@@ -0,0 +1,100 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/Harital/shopping-cart/internal/core/ports (interfaces: APIKeysRepository)
+//
+// Generated by this command:
+//
+//	mockgen -destination=../mocks/APIKeysRepository_mock.go -package=mocks . APIKeysRepository
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	model "github.com/Harital/shopping-cart/internal/core/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockAPIKeysRepository is a mock of APIKeysRepository interface.
+type MockAPIKeysRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockAPIKeysRepositoryMockRecorder
+}
+
+// MockAPIKeysRepositoryMockRecorder is the mock recorder for MockAPIKeysRepository.
+type MockAPIKeysRepositoryMockRecorder struct {
+	mock *MockAPIKeysRepository
+}
+
+// NewMockAPIKeysRepository creates a new mock instance.
+func NewMockAPIKeysRepository(ctrl *gomock.Controller) *MockAPIKeysRepository {
+	mock := &MockAPIKeysRepository{ctrl: ctrl}
+	mock.recorder = &MockAPIKeysRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAPIKeysRepository) EXPECT() *MockAPIKeysRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockAPIKeysRepository) Create(arg0 context.Context, arg1 model.APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockAPIKeysRepositoryMockRecorder) Create(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockAPIKeysRepository)(nil).Create), arg0, arg1)
+}
+
+// GetByHash mocks base method.
+func (m *MockAPIKeysRepository) GetByHash(arg0 context.Context, arg1 string) (model.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByHash", arg0, arg1)
+	ret0, _ := ret[0].(model.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByHash indicates an expected call of GetByHash.
+func (mr *MockAPIKeysRepositoryMockRecorder) GetByHash(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByHash", reflect.TypeOf((*MockAPIKeysRepository)(nil).GetByHash), arg0, arg1)
+}
+
+// List mocks base method.
+func (m *MockAPIKeysRepository) List(arg0 context.Context) ([]model.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", arg0)
+	ret0, _ := ret[0].([]model.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockAPIKeysRepositoryMockRecorder) List(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockAPIKeysRepository)(nil).List), arg0)
+}
+
+// Revoke mocks base method.
+func (m *MockAPIKeysRepository) Revoke(arg0 context.Context, arg1 string, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Revoke indicates an expected call of Revoke.
+func (mr *MockAPIKeysRepositoryMockRecorder) Revoke(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockAPIKeysRepository)(nil).Revoke), arg0, arg1, arg2)
+}
@@ -0,0 +1,101 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/Harital/shopping-cart/internal/core/ports (interfaces: APIKeysService)
+//
+// Generated by this command:
+//
+//	mockgen -destination=../mocks/APIKeysService_mock.go -package=mocks . APIKeysService
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/Harital/shopping-cart/internal/core/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockAPIKeysService is a mock of APIKeysService interface.
+type MockAPIKeysService struct {
+	ctrl     *gomock.Controller
+	recorder *MockAPIKeysServiceMockRecorder
+}
+
+// MockAPIKeysServiceMockRecorder is the mock recorder for MockAPIKeysService.
+type MockAPIKeysServiceMockRecorder struct {
+	mock *MockAPIKeysService
+}
+
+// NewMockAPIKeysService creates a new mock instance.
+func NewMockAPIKeysService(ctrl *gomock.Controller) *MockAPIKeysService {
+	mock := &MockAPIKeysService{ctrl: ctrl}
+	mock.recorder = &MockAPIKeysServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAPIKeysService) EXPECT() *MockAPIKeysServiceMockRecorder {
+	return m.recorder
+}
+
+// Authenticate mocks base method.
+func (m *MockAPIKeysService) Authenticate(arg0 context.Context, arg1 string) (model.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Authenticate", arg0, arg1)
+	ret0, _ := ret[0].(model.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Authenticate indicates an expected call of Authenticate.
+func (mr *MockAPIKeysServiceMockRecorder) Authenticate(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authenticate", reflect.TypeOf((*MockAPIKeysService)(nil).Authenticate), arg0, arg1)
+}
+
+// Create mocks base method.
+func (m *MockAPIKeysService) Create(arg0 context.Context, arg1 string, arg2 []model.APIKeyScope) (model.APIKey, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", arg0, arg1, arg2)
+	ret0, _ := ret[0].(model.APIKey)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockAPIKeysServiceMockRecorder) Create(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockAPIKeysService)(nil).Create), arg0, arg1, arg2)
+}
+
+// List mocks base method.
+func (m *MockAPIKeysService) List(arg0 context.Context) ([]model.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", arg0)
+	ret0, _ := ret[0].([]model.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockAPIKeysServiceMockRecorder) List(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockAPIKeysService)(nil).List), arg0)
+}
+
+// Revoke mocks base method.
+func (m *MockAPIKeysService) Revoke(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Revoke indicates an expected call of Revoke.
+func (mr *MockAPIKeysServiceMockRecorder) Revoke(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockAPIKeysService)(nil).Revoke), arg0, arg1)
+}
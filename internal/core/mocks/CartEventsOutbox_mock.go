@@ -0,0 +1,114 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/Harital/shopping-cart/internal/core/ports (interfaces: CartEventsOutbox)
+//
+// Generated by this command:
+//
+//	mockgen -destination=../mocks/CartEventsOutbox_mock.go -package=mocks . CartEventsOutbox
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	model "github.com/Harital/shopping-cart/internal/core/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockCartEventsOutbox is a mock of CartEventsOutbox interface.
+type MockCartEventsOutbox struct {
+	ctrl     *gomock.Controller
+	recorder *MockCartEventsOutboxMockRecorder
+}
+
+// MockCartEventsOutboxMockRecorder is the mock recorder for MockCartEventsOutbox.
+type MockCartEventsOutboxMockRecorder struct {
+	mock *MockCartEventsOutbox
+}
+
+// NewMockCartEventsOutbox creates a new mock instance.
+func NewMockCartEventsOutbox(ctrl *gomock.Controller) *MockCartEventsOutbox {
+	mock := &MockCartEventsOutbox{ctrl: ctrl}
+	mock.recorder = &MockCartEventsOutboxMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCartEventsOutbox) EXPECT() *MockCartEventsOutboxMockRecorder {
+	return m.recorder
+}
+
+// Claim mocks base method.
+func (m *MockCartEventsOutbox) Claim(arg0 context.Context, arg1 int, arg2 time.Duration) ([]model.CartEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Claim", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.CartEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Claim indicates an expected call of Claim.
+func (mr *MockCartEventsOutboxMockRecorder) Claim(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Claim", reflect.TypeOf((*MockCartEventsOutbox)(nil).Claim), arg0, arg1, arg2)
+}
+
+// DeleteDone mocks base method.
+func (m *MockCartEventsOutbox) DeleteDone(arg0 context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteDone", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteDone indicates an expected call of DeleteDone.
+func (mr *MockCartEventsOutboxMockRecorder) DeleteDone(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDone", reflect.TypeOf((*MockCartEventsOutbox)(nil).DeleteDone), arg0)
+}
+
+// MarkDead mocks base method.
+func (m *MockCartEventsOutbox) MarkDead(arg0 context.Context, arg1 int64, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkDead", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkDead indicates an expected call of MarkDead.
+func (mr *MockCartEventsOutboxMockRecorder) MarkDead(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkDead", reflect.TypeOf((*MockCartEventsOutbox)(nil).MarkDead), arg0, arg1, arg2)
+}
+
+// MarkDone mocks base method.
+func (m *MockCartEventsOutbox) MarkDone(arg0 context.Context, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkDone", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkDone indicates an expected call of MarkDone.
+func (mr *MockCartEventsOutboxMockRecorder) MarkDone(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkDone", reflect.TypeOf((*MockCartEventsOutbox)(nil).MarkDone), arg0, arg1)
+}
+
+// Retry mocks base method.
+func (m *MockCartEventsOutbox) Retry(arg0 context.Context, arg1 int64, arg2 time.Time, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Retry", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Retry indicates an expected call of Retry.
+func (mr *MockCartEventsOutboxMockRecorder) Retry(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Retry", reflect.TypeOf((*MockCartEventsOutbox)(nil).Retry), arg0, arg1, arg2, arg3)
+}
@@ -0,0 +1,55 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/Harital/shopping-cart/internal/core/ports (interfaces: CartEventsPublisher)
+//
+// Generated by this command:
+//
+//	mockgen -destination=../mocks/CartEventsPublisher_mock.go -package=mocks . CartEventsPublisher
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/Harital/shopping-cart/internal/core/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockCartEventsPublisher is a mock of CartEventsPublisher interface.
+type MockCartEventsPublisher struct {
+	ctrl     *gomock.Controller
+	recorder *MockCartEventsPublisherMockRecorder
+}
+
+// MockCartEventsPublisherMockRecorder is the mock recorder for MockCartEventsPublisher.
+type MockCartEventsPublisherMockRecorder struct {
+	mock *MockCartEventsPublisher
+}
+
+// NewMockCartEventsPublisher creates a new mock instance.
+func NewMockCartEventsPublisher(ctrl *gomock.Controller) *MockCartEventsPublisher {
+	mock := &MockCartEventsPublisher{ctrl: ctrl}
+	mock.recorder = &MockCartEventsPublisherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCartEventsPublisher) EXPECT() *MockCartEventsPublisherMockRecorder {
+	return m.recorder
+}
+
+// PublishAbandonedCart mocks base method.
+func (m *MockCartEventsPublisher) PublishAbandonedCart(arg0 context.Context, arg1 model.AbandonedCart) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishAbandonedCart", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PublishAbandonedCart indicates an expected call of PublishAbandonedCart.
+func (mr *MockCartEventsPublisherMockRecorder) PublishAbandonedCart(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishAbandonedCart", reflect.TypeOf((*MockCartEventsPublisher)(nil).PublishAbandonedCart), arg0, arg1)
+}
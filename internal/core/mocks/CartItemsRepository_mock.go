@@ -12,6 +12,7 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	model "github.com/Harital/shopping-cart/internal/core/model"
 	gomock "go.uber.org/mock/gomock"
@@ -41,44 +42,181 @@ func (m *MockCartItemsRepository) EXPECT() *MockCartItemsRepositoryMockRecorder
 }
 
 // Add mocks base method.
-func (m *MockCartItemsRepository) Add(arg0 context.Context, arg1 model.CartItem) error {
+func (m *MockCartItemsRepository) Add(arg0 context.Context, arg1 string, arg2 model.CartItem, arg3 *int64) (model.CartItem, int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Add", arg0, arg1)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "Add", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(model.CartItem)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // Add indicates an expected call of Add.
-func (mr *MockCartItemsRepositoryMockRecorder) Add(arg0, arg1 any) *gomock.Call {
+func (mr *MockCartItemsRepositoryMockRecorder) Add(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockCartItemsRepository)(nil).Add), arg0, arg1, arg2, arg3)
+}
+
+// CartOwner mocks base method.
+func (m *MockCartItemsRepository) CartOwner(arg0 context.Context, arg1 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CartOwner", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CartOwner indicates an expected call of CartOwner.
+func (mr *MockCartItemsRepositoryMockRecorder) CartOwner(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CartOwner", reflect.TypeOf((*MockCartItemsRepository)(nil).CartOwner), arg0, arg1)
+}
+
+// ClaimCart mocks base method.
+func (m *MockCartItemsRepository) ClaimCart(arg0 context.Context, arg1, arg2 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimCart", arg0, arg1, arg2)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimCart indicates an expected call of ClaimCart.
+func (mr *MockCartItemsRepositoryMockRecorder) ClaimCart(arg0, arg1, arg2 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockCartItemsRepository)(nil).Add), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimCart", reflect.TypeOf((*MockCartItemsRepository)(nil).ClaimCart), arg0, arg1, arg2)
+}
+
+// ExpireCarts mocks base method.
+func (m *MockCartItemsRepository) ExpireCarts(arg0 context.Context, arg1 time.Time, arg2 int) ([]model.AbandonedCart, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpireCarts", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.AbandonedCart)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpireCarts indicates an expected call of ExpireCarts.
+func (mr *MockCartItemsRepositoryMockRecorder) ExpireCarts(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpireCarts", reflect.TypeOf((*MockCartItemsRepository)(nil).ExpireCarts), arg0, arg1, arg2)
 }
 
 // Get mocks base method.
-func (m *MockCartItemsRepository) Get(arg0 context.Context) ([]model.CartItem, error) {
+func (m *MockCartItemsRepository) Get(arg0 context.Context, arg1 string) (model.Cart, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Get", arg0)
-	ret0, _ := ret[0].([]model.CartItem)
+	ret := m.ctrl.Call(m, "Get", arg0, arg1)
+	ret0, _ := ret[0].(model.Cart)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Get indicates an expected call of Get.
-func (mr *MockCartItemsRepositoryMockRecorder) Get(arg0 any) *gomock.Call {
+func (mr *MockCartItemsRepositoryMockRecorder) Get(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCartItemsRepository)(nil).Get), arg0, arg1)
+}
+
+// GetItem mocks base method.
+func (m *MockCartItemsRepository) GetItem(arg0 context.Context, arg1, arg2 string) (model.CartItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetItem", arg0, arg1, arg2)
+	ret0, _ := ret[0].(model.CartItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetItem indicates an expected call of GetItem.
+func (mr *MockCartItemsRepositoryMockRecorder) GetItem(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItem", reflect.TypeOf((*MockCartItemsRepository)(nil).GetItem), arg0, arg1, arg2)
+}
+
+// Merge mocks base method.
+func (m *MockCartItemsRepository) Merge(arg0 context.Context, arg1, arg2 string, arg3 *int64) (model.Cart, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Merge", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(model.Cart)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Merge indicates an expected call of Merge.
+func (mr *MockCartItemsRepositoryMockRecorder) Merge(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Merge", reflect.TypeOf((*MockCartItemsRepository)(nil).Merge), arg0, arg1, arg2, arg3)
+}
+
+// Remove mocks base method.
+func (m *MockCartItemsRepository) Remove(arg0 context.Context, arg1, arg2 string, arg3 *int64) (model.CartItem, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Remove", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(model.CartItem)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Remove indicates an expected call of Remove.
+func (mr *MockCartItemsRepositoryMockRecorder) Remove(arg0, arg1, arg2, arg3 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCartItemsRepository)(nil).Get), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockCartItemsRepository)(nil).Remove), arg0, arg1, arg2, arg3)
+}
+
+// SetReservationFailed mocks base method.
+func (m *MockCartItemsRepository) SetReservationFailed(arg0 context.Context, arg1, arg2, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetReservationFailed", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetReservationFailed indicates an expected call of SetReservationFailed.
+func (mr *MockCartItemsRepositoryMockRecorder) SetReservationFailed(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReservationFailed", reflect.TypeOf((*MockCartItemsRepository)(nil).SetReservationFailed), arg0, arg1, arg2, arg3)
 }
 
 // SetReservationId mocks base method.
-func (m *MockCartItemsRepository) SetReservationId(arg0 context.Context, arg1 model.CartItem, arg2 string) error {
+func (m *MockCartItemsRepository) SetReservationId(arg0 context.Context, arg1 string, arg2 model.CartItem, arg3 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetReservationId", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "SetReservationId", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SetReservationId indicates an expected call of SetReservationId.
-func (mr *MockCartItemsRepositoryMockRecorder) SetReservationId(arg0, arg1, arg2 any) *gomock.Call {
+func (mr *MockCartItemsRepositoryMockRecorder) SetReservationId(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReservationId", reflect.TypeOf((*MockCartItemsRepository)(nil).SetReservationId), arg0, arg1, arg2, arg3)
+}
+
+// SetReservationReleased mocks base method.
+func (m *MockCartItemsRepository) SetReservationReleased(arg0 context.Context, arg1, arg2, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetReservationReleased", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetReservationReleased indicates an expected call of SetReservationReleased.
+func (mr *MockCartItemsRepositoryMockRecorder) SetReservationReleased(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReservationReleased", reflect.TypeOf((*MockCartItemsRepository)(nil).SetReservationReleased), arg0, arg1, arg2, arg3)
+}
+
+// UpdateQuantity mocks base method.
+func (m *MockCartItemsRepository) UpdateQuantity(arg0 context.Context, arg1, arg2 string, arg3 int, arg4 *int64) (model.CartItem, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateQuantity", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(model.CartItem)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// UpdateQuantity indicates an expected call of UpdateQuantity.
+func (mr *MockCartItemsRepositoryMockRecorder) UpdateQuantity(arg0, arg1, arg2, arg3, arg4 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReservationId", reflect.TypeOf((*MockCartItemsRepository)(nil).SetReservationId), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateQuantity", reflect.TypeOf((*MockCartItemsRepository)(nil).UpdateQuantity), arg0, arg1, arg2, arg3, arg4)
 }
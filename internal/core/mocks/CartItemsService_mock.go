@@ -41,30 +41,76 @@ func (m *MockCartItemsService) EXPECT() *MockCartItemsServiceMockRecorder {
 }
 
 // Add mocks base method.
-func (m *MockCartItemsService) Add(arg0 context.Context, arg1 model.CartItem) error {
+func (m *MockCartItemsService) Add(arg0 context.Context, arg1 string, arg2 model.CartItem, arg3 *int64) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Add", arg0, arg1)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "Add", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Add indicates an expected call of Add.
-func (mr *MockCartItemsServiceMockRecorder) Add(arg0, arg1 any) *gomock.Call {
+func (mr *MockCartItemsServiceMockRecorder) Add(arg0, arg1, arg2, arg3 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockCartItemsService)(nil).Add), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockCartItemsService)(nil).Add), arg0, arg1, arg2, arg3)
 }
 
 // Get mocks base method.
-func (m *MockCartItemsService) Get(arg0 context.Context) ([]model.CartItem, error) {
+func (m *MockCartItemsService) Get(arg0 context.Context, arg1 string) (model.Cart, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Get", arg0)
-	ret0, _ := ret[0].([]model.CartItem)
+	ret := m.ctrl.Call(m, "Get", arg0, arg1)
+	ret0, _ := ret[0].(model.Cart)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Get indicates an expected call of Get.
-func (mr *MockCartItemsServiceMockRecorder) Get(arg0 any) *gomock.Call {
+func (mr *MockCartItemsServiceMockRecorder) Get(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCartItemsService)(nil).Get), arg0, arg1)
+}
+
+// Merge mocks base method.
+func (m *MockCartItemsService) Merge(arg0 context.Context, arg1, arg2 string, arg3 *int64) (model.Cart, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Merge", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(model.Cart)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Merge indicates an expected call of Merge.
+func (mr *MockCartItemsServiceMockRecorder) Merge(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Merge", reflect.TypeOf((*MockCartItemsService)(nil).Merge), arg0, arg1, arg2, arg3)
+}
+
+// Remove mocks base method.
+func (m *MockCartItemsService) Remove(arg0 context.Context, arg1, arg2 string, arg3 *int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Remove", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Remove indicates an expected call of Remove.
+func (mr *MockCartItemsServiceMockRecorder) Remove(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockCartItemsService)(nil).Remove), arg0, arg1, arg2, arg3)
+}
+
+// UpdateQuantity mocks base method.
+func (m *MockCartItemsService) UpdateQuantity(arg0 context.Context, arg1, arg2 string, arg3 int, arg4 *int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateQuantity", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateQuantity indicates an expected call of UpdateQuantity.
+func (mr *MockCartItemsServiceMockRecorder) UpdateQuantity(arg0, arg1, arg2, arg3, arg4 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCartItemsService)(nil).Get), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateQuantity", reflect.TypeOf((*MockCartItemsService)(nil).UpdateQuantity), arg0, arg1, arg2, arg3, arg4)
 }
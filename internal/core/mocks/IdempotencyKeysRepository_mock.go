@@ -0,0 +1,101 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/Harital/shopping-cart/internal/core/ports (interfaces: IdempotencyKeysRepository)
+//
+// Generated by this command:
+//
+//	mockgen -destination=../mocks/IdempotencyKeysRepository_mock.go -package=mocks . IdempotencyKeysRepository
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	model "github.com/Harital/shopping-cart/internal/core/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockIdempotencyKeysRepository is a mock of IdempotencyKeysRepository interface.
+type MockIdempotencyKeysRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockIdempotencyKeysRepositoryMockRecorder
+}
+
+// MockIdempotencyKeysRepositoryMockRecorder is the mock recorder for MockIdempotencyKeysRepository.
+type MockIdempotencyKeysRepositoryMockRecorder struct {
+	mock *MockIdempotencyKeysRepository
+}
+
+// NewMockIdempotencyKeysRepository creates a new mock instance.
+func NewMockIdempotencyKeysRepository(ctrl *gomock.Controller) *MockIdempotencyKeysRepository {
+	mock := &MockIdempotencyKeysRepository{ctrl: ctrl}
+	mock.recorder = &MockIdempotencyKeysRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIdempotencyKeysRepository) EXPECT() *MockIdempotencyKeysRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Claim mocks base method.
+func (m *MockIdempotencyKeysRepository) Claim(arg0 context.Context, arg1 model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Claim", arg0, arg1)
+	ret0, _ := ret[0].(model.IdempotencyRecord)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Claim indicates an expected call of Claim.
+func (mr *MockIdempotencyKeysRepositoryMockRecorder) Claim(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Claim", reflect.TypeOf((*MockIdempotencyKeysRepository)(nil).Claim), arg0, arg1)
+}
+
+// Complete mocks base method.
+func (m *MockIdempotencyKeysRepository) Complete(arg0 context.Context, arg1 string, arg2 model.IdempotentResponse, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Complete", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Complete indicates an expected call of Complete.
+func (mr *MockIdempotencyKeysRepositoryMockRecorder) Complete(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Complete", reflect.TypeOf((*MockIdempotencyKeysRepository)(nil).Complete), arg0, arg1, arg2, arg3)
+}
+
+// Delete mocks base method.
+func (m *MockIdempotencyKeysRepository) Delete(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockIdempotencyKeysRepositoryMockRecorder) Delete(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockIdempotencyKeysRepository)(nil).Delete), arg0, arg1)
+}
+
+// DeleteExpired mocks base method.
+func (m *MockIdempotencyKeysRepository) DeleteExpired(arg0 context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpired", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExpired indicates an expected call of DeleteExpired.
+func (mr *MockIdempotencyKeysRepositoryMockRecorder) DeleteExpired(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpired", reflect.TypeOf((*MockIdempotencyKeysRepository)(nil).DeleteExpired), arg0)
+}
@@ -0,0 +1,70 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/Harital/shopping-cart/internal/core/ports (interfaces: ItemReserver)
+//
+// Generated by this command:
+//
+//	mockgen -destination=../mocks/ItemReserver_mock.go -package=mocks . ItemReserver
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/Harital/shopping-cart/internal/core/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockItemReserver is a mock of ItemReserver interface.
+type MockItemReserver struct {
+	ctrl     *gomock.Controller
+	recorder *MockItemReserverMockRecorder
+}
+
+// MockItemReserverMockRecorder is the mock recorder for MockItemReserver.
+type MockItemReserverMockRecorder struct {
+	mock *MockItemReserver
+}
+
+// NewMockItemReserver creates a new mock instance.
+func NewMockItemReserver(ctrl *gomock.Controller) *MockItemReserver {
+	mock := &MockItemReserver{ctrl: ctrl}
+	mock.recorder = &MockItemReserverMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockItemReserver) EXPECT() *MockItemReserverMockRecorder {
+	return m.recorder
+}
+
+// Release mocks base method.
+func (m *MockItemReserver) Release(arg0 context.Context, arg1 string, arg2 model.CartItem) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Release", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Release indicates an expected call of Release.
+func (mr *MockItemReserverMockRecorder) Release(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockItemReserver)(nil).Release), arg0, arg1, arg2)
+}
+
+// Reserve mocks base method.
+func (m *MockItemReserver) Reserve(arg0 context.Context, arg1 string, arg2 model.CartItem) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reserve", arg0, arg1, arg2)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reserve indicates an expected call of Reserve.
+func (mr *MockItemReserverMockRecorder) Reserve(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reserve", reflect.TypeOf((*MockItemReserver)(nil).Reserve), arg0, arg1, arg2)
+}
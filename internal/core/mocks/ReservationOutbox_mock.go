@@ -0,0 +1,128 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/Harital/shopping-cart/internal/core/ports (interfaces: ReservationOutbox)
+//
+// Generated by this command:
+//
+//	mockgen -destination=../mocks/ReservationOutbox_mock.go -package=mocks . ReservationOutbox
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	model "github.com/Harital/shopping-cart/internal/core/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockReservationOutbox is a mock of ReservationOutbox interface.
+type MockReservationOutbox struct {
+	ctrl     *gomock.Controller
+	recorder *MockReservationOutboxMockRecorder
+}
+
+// MockReservationOutboxMockRecorder is the mock recorder for MockReservationOutbox.
+type MockReservationOutboxMockRecorder struct {
+	mock *MockReservationOutbox
+}
+
+// NewMockReservationOutbox creates a new mock instance.
+func NewMockReservationOutbox(ctrl *gomock.Controller) *MockReservationOutbox {
+	mock := &MockReservationOutbox{ctrl: ctrl}
+	mock.recorder = &MockReservationOutboxMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReservationOutbox) EXPECT() *MockReservationOutboxMockRecorder {
+	return m.recorder
+}
+
+// Claim mocks base method.
+func (m *MockReservationOutbox) Claim(arg0 context.Context, arg1 int, arg2 time.Duration) ([]model.ReservationTask, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Claim", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.ReservationTask)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Claim indicates an expected call of Claim.
+func (mr *MockReservationOutboxMockRecorder) Claim(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Claim", reflect.TypeOf((*MockReservationOutbox)(nil).Claim), arg0, arg1, arg2)
+}
+
+// DeleteDone mocks base method.
+func (m *MockReservationOutbox) DeleteDone(arg0 context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteDone", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteDone indicates an expected call of DeleteDone.
+func (mr *MockReservationOutboxMockRecorder) DeleteDone(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDone", reflect.TypeOf((*MockReservationOutbox)(nil).DeleteDone), arg0)
+}
+
+// MarkDead mocks base method.
+func (m *MockReservationOutbox) MarkDead(arg0 context.Context, arg1 int64, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkDead", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkDead indicates an expected call of MarkDead.
+func (mr *MockReservationOutboxMockRecorder) MarkDead(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkDead", reflect.TypeOf((*MockReservationOutbox)(nil).MarkDead), arg0, arg1, arg2)
+}
+
+// MarkDone mocks base method.
+func (m *MockReservationOutbox) MarkDone(arg0 context.Context, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkDone", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkDone indicates an expected call of MarkDone.
+func (mr *MockReservationOutboxMockRecorder) MarkDone(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkDone", reflect.TypeOf((*MockReservationOutbox)(nil).MarkDone), arg0, arg1)
+}
+
+// Postpone mocks base method.
+func (m *MockReservationOutbox) Postpone(arg0 context.Context, arg1 int64, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Postpone", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Postpone indicates an expected call of Postpone.
+func (mr *MockReservationOutboxMockRecorder) Postpone(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Postpone", reflect.TypeOf((*MockReservationOutbox)(nil).Postpone), arg0, arg1, arg2)
+}
+
+// Retry mocks base method.
+func (m *MockReservationOutbox) Retry(arg0 context.Context, arg1 int64, arg2 time.Time, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Retry", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Retry indicates an expected call of Retry.
+func (mr *MockReservationOutboxMockRecorder) Retry(arg0, arg1, arg2, arg3 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Retry", reflect.TypeOf((*MockReservationOutbox)(nil).Retry), arg0, arg1, arg2, arg3)
+}
@@ -0,0 +1,55 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/Harital/shopping-cart/internal/core/ports (interfaces: ReservationsService)
+//
+// Generated by this command:
+//
+//	mockgen -destination=../mocks/ReservationsService_mock.go -package=mocks . ReservationsService
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/Harital/shopping-cart/internal/core/model"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockReservationsService is a mock of ReservationsService interface.
+type MockReservationsService struct {
+	ctrl     *gomock.Controller
+	recorder *MockReservationsServiceMockRecorder
+}
+
+// MockReservationsServiceMockRecorder is the mock recorder for MockReservationsService.
+type MockReservationsServiceMockRecorder struct {
+	mock *MockReservationsService
+}
+
+// NewMockReservationsService creates a new mock instance.
+func NewMockReservationsService(ctrl *gomock.Controller) *MockReservationsService {
+	mock := &MockReservationsService{ctrl: ctrl}
+	mock.recorder = &MockReservationsServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReservationsService) EXPECT() *MockReservationsServiceMockRecorder {
+	return m.recorder
+}
+
+// CompleteReservation mocks base method.
+func (m *MockReservationsService) CompleteReservation(arg0 context.Context, arg1 model.ReservationCallback) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteReservation", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompleteReservation indicates an expected call of CompleteReservation.
+func (mr *MockReservationsServiceMockRecorder) CompleteReservation(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteReservation", reflect.TypeOf((*MockReservationsService)(nil).CompleteReservation), arg0, arg1)
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/domainerr"
+)
+
+type APIKeyScope string
+
+const (
+	// Read any cart
+	ReadScope APIKeyScope = "read"
+	// Add, remove and update the items of any cart
+	WriteScope APIKeyScope = "write"
+	// Everything
+	AdminScope APIKeyScope = "admin"
+)
+
+var (
+	// Unknown, revoked or malformed key. The caller is not told which one
+	ErrInvalidAPIKey = domainerr.New(domainerr.Unauthorized, "invalid_api_key", "invalid api key")
+	// The key is valid, but it has not been given the scope the request needs
+	ErrInsufficientScope = domainerr.New(domainerr.Forbidden, "insufficient_scope", "the api key does not have the needed scope")
+	ErrInvalidScope      = domainerr.New(domainerr.Validation, "invalid_scope", "invalid api key scope")
+	ErrAPIKeyNotFound    = domainerr.New(domainerr.NotFound, "api_key_not_found", "api key not found")
+)
+
+// Key of a back office tool or a service, which can use any cart within its scopes. Only the hash of the secret is
+// stored, so a leaked database does not leak the keys
+type APIKey struct {
+	// Public. It is listed and used to revoke the key
+	Id   string
+	Name string
+	// Sha256 of the secret, hex encoded. The secret itself is only known when the key is created
+	Hash      string
+	Scopes    []APIKeyScope
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+func (k APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// The admin scope allows everything. Any other one only allows itself
+func (k APIKey) Allows(scope APIKeyScope) bool {
+	return slices.Contains(k.Scopes, AdminScope) || slices.Contains(k.Scopes, scope)
+}
+
+// Parses a comma separated list, I.E. read,write. Duplicates are dropped
+func ParseAPIKeyScopes(list string) ([]APIKeyScope, error) {
+	var scopes []APIKeyScope
+	for _, name := range strings.Split(list, ",") {
+		scope := APIKeyScope(strings.TrimSpace(name))
+		if scope != ReadScope && scope != WriteScope && scope != AdminScope {
+			return nil, fmt.Errorf("scope %q --> %w", scope, ErrInvalidScope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// Inverse of ParseAPIKeyScopes. The repositories store the scopes this way
+func FormatAPIKeyScopes(scopes []APIKeyScope) string {
+	names := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		names = append(names, string(scope))
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Items of a cart and the version of its content. Every change made by the clients (adding, removing or updating
+// items) increases the version, so they can tell if the cart has changed since they read it.
+// Reservation updates are done in background and do not change the version. Otherwise the clients would find
+// their cart changed every time a reservation completes.
+// A cart that does not exist yet is an empty cart at version 0
+type Cart struct {
+	Version int64
+	Items   []CartItem
+}
+
+// Checks the version expected by the client against the current one. A nil expected version means that the client
+// does not care, so the change is applied whatever the version
+func CheckCartVersion(cartId string, expected *int64, current int64) error {
+	if expected == nil || *expected == current {
+		return nil
+	}
+	return &VersionConflictError{CartId: cartId, Expected: *expected, Current: current}
+}
+
+// Carts belong to the user that added their first item. Carts without owner, I.E. created before the clients were
+// authenticated, can be used by anyone until someone adds an item to them
+func CheckCartOwner(cartId string, subject string, owner string) error {
+	if owner == "" || owner == subject {
+		return nil
+	}
+	return fmt.Errorf("cart %s --> %w", cartId, ErrCartForbidden)
+}
+
+// Folds an item of a guest cart into the item with the same id of the cart, the same way adding an item does: the
+// quantities are summed up. The cart keeps its own reservation, or takes over the one of the guest item if it has
+// none. True is returned when the reservation of the guest item is not needed anymore, so it has to be released.
+// The merged item may need to be reserved again, as its reservation does not cover the summed quantity.
+// The summed quantity has the same limit as when adding an item. See CartItem.CheckMergedQuantity
+func MergeCartItem(item CartItem, guestItem CartItem) (CartItem, bool, error) {
+	item.Quantity += guestItem.Quantity
+	if quantityErr := item.CheckMergedQuantity(); quantityErr != nil {
+		return CartItem{}, false, quantityErr
+	}
+	if guestItem.ReservationId == "" {
+		return item, false, nil
+	}
+	if item.ReservationId != "" {
+		return item, true, nil
+	}
+
+	item.ReservationId = guestItem.ReservationId
+	item.ReservedQuantity = guestItem.ReservedQuantity
+	item.ReservationStatus = guestItem.ReservationStatus
+	item.ReservationError = guestItem.ReservationError
+	item.ReservationUpdatedAt = guestItem.ReservationUpdatedAt
+	return item, false, nil
+}
+
+// The guest cart is given in the path, and the cart it is merged into in the body
+type MergeCartRequest struct {
+	Version string `json:"version" binding:"omitempty,oneof=1.0.0"`
+	CartId  string `json:"cartId" binding:"required,max=36"`
+}
+
+// Cart deleted because nobody changed it during the configured TTL. Marketing gets it, so they can remind its owner
+// about it. The items are the ones the cart had when it was deleted
+type AbandonedCart struct {
+	CartId string `json:"cartId"`
+	// Empty if the cart had no owner. Guests are only known by their cookie
+	OwnerId   string     `json:"ownerId,omitempty"`
+	Items     []CartItem `json:"items"`
+	CreatedAt time.Time  `json:"createdAt"`
+	// Last change of the cart
+	UpdatedAt time.Time `json:"updatedAt"`
+	ExpiredAt time.Time `json:"expiredAt"`
+}
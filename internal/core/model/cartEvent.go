@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Pending publication of an abandoned cart. Events are written in the same transaction that deletes the cart, so
+// none is lost if the publisher is down or the service stops before publishing it
+type CartEvent struct {
+	Id   int64
+	Cart AbandonedCart
+	// Number of times the event has been claimed, including the current one
+	Attempts  int
+	CreatedAt time.Time
+}
+
+func NewAbandonedCartEvent(cart AbandonedCart) CartEvent {
+	return CartEvent{Cart: cart}
+}
@@ -1,10 +1,56 @@
 package model
 
+import (
+	"fmt"
+	"time"
+)
+
+type ReservationStatus string
+
+const (
+	// Waiting for the reserver. Either the reservation is queued or the reserver answers asynchronously
+	ReservationPending ReservationStatus = "pending"
+	// The reservation covers the quantity of the item
+	ReservationReserved ReservationStatus = "reserved"
+	// The last attempt failed. The reason is in ReservationError. It may still be retried in background
+	ReservationFailed ReservationStatus = "failed"
+	// The reservation has been given back to the reserver
+	ReservationReleased ReservationStatus = "released"
+)
+
+// The binding tags are checked when the item is added, both by the handler and the service. Id and name are sized
+// for their columns. Id is stored as an int
 type CartItem struct {
-	Id            string `json:"id"`
-	Name          string `json:"name"`
-	Quantity      int    `json:"quantity"`
+	Id            string `json:"id" binding:"required,number,max=9"`
+	Name          string `json:"name" binding:"max=50"`
+	Quantity      int    `json:"quantity" binding:"min=1,max=1000"`
 	ReservationId string `json:"reservationId,omitemtpy"`
+	// Quantity covered by the reservation. When it differs from Quantity, the item needs to be reserved again
+	ReservedQuantity int `json:"reservedQuantity"`
+	// Reservation fields are managed by the service. They are ignored in the requests
+	ReservationStatus ReservationStatus `json:"reservationStatus,omitempty"`
+	ReservationError  string            `json:"reservationError,omitempty"`
+	// Last change of the reservation status
+	ReservationUpdatedAt *time.Time `json:"reservationUpdatedAt,omitempty"`
+}
+
+// An item needs to be reserved until it has a reservation that covers its whole quantity
+func (ci CartItem) NeedsReservation() bool {
+	return ci.ReservationId == "" || ci.ReservedQuantity != ci.Quantity
+}
+
+// Adding an item that is already in the cart sums up the quantities. The sum has the same limit as the quantity
+// of any item
+func (ci CartItem) CheckMergedQuantity() error {
+	if ci.Quantity > MaxItemQuantity {
+		return fmt.Errorf("merged quantity %d for item %s --> %w", ci.Quantity, ci.Id, ErrInvalidQuantity)
+	}
+	return nil
+}
+
+// Only the item is validated, as it is what reaches the service
+func (ci CartItem) Validate() error {
+	return Validate(ci)
 }
 
 type GetCartItemsResponse struct {
@@ -13,6 +59,10 @@ type GetCartItemsResponse struct {
 }
 
 func NewGetCartITemsResponse(items *[]CartItem) *GetCartItemsResponse {
+	// An empty cart has no items, not null ones
+	if *items == nil {
+		items = &[]CartItem{}
+	}
 	return &GetCartItemsResponse{
 		Version: "1.0.0",
 		// we could set the GetCartItemsResponse.Items as a pointer, but we would need to allocate space
@@ -20,22 +70,32 @@ func NewGetCartITemsResponse(items *[]CartItem) *GetCartItemsResponse {
 	}
 }
 
+// Only version 1.0.0 is understood. A missing version is taken as the current one
 type CartItemRequest struct {
-	Version string   `json:"version"`
+	Version string   `json:"version" binding:"omitempty,oneof=1.0.0"`
 	Item    CartItem `json:"item"`
 }
 
+// Quantity is a pointer in order to tell apart a missing quantity from a zero one, which means removing the item.
+// Same bounds and versions as when the item is added
+type UpdateCartItemRequest struct {
+	Version  string `json:"version" binding:"omitempty,oneof=1.0.0"`
+	Quantity *int   `json:"quantity" binding:"required,min=0,max=1000"`
+}
+
 // Identical to Cart Item Request, but since they are 2 diffent usages, they could diverge from each other.
 // Reusing the same struct could be error prone and difficult to mantain, if some field is added for one case,
 // but not needed for the other one
 type ItemReservationRequest struct {
 	Version string   `json:"version"`
+	CartId  string   `json:"cartId"`
 	Item    CartItem `json:"item"`
 }
 
-func NewItemReservationRequest(item CartItem) ItemReservationRequest {
+func NewItemReservationRequest(cartId string, item CartItem) ItemReservationRequest {
 	return ItemReservationRequest{
 		Version: "1.0.0",
+		CartId:  cartId,
 		Item:    item,
 	}
 }
@@ -1,13 +1,69 @@
 package model
 
+import (
+	"fmt"
+
+	"github.com/Harital/shopping-cart/internal/core/domainerr"
+)
+
+// Every error the clients may get has its own code. See domainerr
+var (
+	// Returned by the repositories when the item is not in the cart
+	ErrItemNotFound = domainerr.New(domainerr.NotFound, "item_not_found", "item not found")
+	// The guest cart to merge does not exist. I.E. it has already been merged
+	ErrCartNotFound = domainerr.New(domainerr.NotFound, "cart_not_found", "cart not found")
+	// A cart cannot be merged into itself
+	ErrSameCart = domainerr.New(domainerr.Validation, "same_cart", "the guest cart and the cart are the same one")
+	// Quantities can only be zero (meaning removal) or positive
+	ErrInvalidQuantity = domainerr.New(domainerr.Validation, "invalid_quantity", "invalid quantity")
+	// Callbacks must carry either a reservation id or a failure reason
+	ErrInvalidReservationCallback = domainerr.New(domainerr.Validation, "invalid_reservation_callback", "invalid reservation callback")
+	// The reserver could not be reached, timed out or answered with a 5xx. Worth retrying
+	ErrReserverUnavailable = domainerr.New(domainerr.Unavailable, "reserver_unavailable", "reserver unavailable")
+	// The call was not even tried, because the reserver circuit breaker is open
+	ErrCircuitOpen = domainerr.New(domainerr.Unavailable, "reserver_circuit_open", "reserver circuit breaker is open")
+	// The cart has been changed since the client read it. See VersionConflictError
+	ErrVersionConflict = domainerr.New(domainerr.Conflict, "version_conflict", "the cart has been modified")
+	// The Idempotency-Key was already used by a request with a different body
+	ErrIdempotencyKeyReused = domainerr.New(domainerr.Conflict, "idempotency_key_reused", "idempotency key already used by a different request")
+	// The first request sent with the Idempotency-Key has not finished yet
+	ErrIdempotencyKeyInProgress = domainerr.New(domainerr.Conflict, "idempotency_key_in_progress", "request with the same idempotency key in progress")
+	// The cart belongs to another user
+	ErrCartForbidden           = domainerr.New(domainerr.Forbidden, "cart_forbidden", "the cart belongs to another user")
+	ErrIdempotencyKeyNotFound  = domainerr.New(domainerr.NotFound, "idempotency_key_not_found", "idempotency key not found")
+	ErrReservationTaskNotFound = domainerr.New(domainerr.NotFound, "reservation_task_not_found", "reservation task not found")
+	ErrCartEventNotFound       = domainerr.New(domainerr.NotFound, "cart_event_not_found", "cart event not found")
+)
+
+// The current version is sent back, so the client knows which one to expect once it has read the cart again.
+// It is an ErrVersionConflict, so errors.Is works with it as well
+type VersionConflictError struct {
+	CartId   string
+	Expected int64
+	Current  int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("cart %s is at version %d, not at %d", e.CartId, e.Current, e.Expected)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
 type ErrorResponse struct {
 	Version string `json:"version"`
+	// Stable, so the clients can tell the errors apart without parsing the message. I.E. item_not_found
+	Code    string `json:"code"`
 	Message string `json:"Message"`
+	// Every field of the request that is not valid. Only for validation errors
+	Errors []FieldError `json:"errors,omitempty"`
 }
 
-func NewErrorResponse(msg string) ErrorResponse {
+func NewErrorResponse(code string, msg string) ErrorResponse {
 	return ErrorResponse{
 		Version: "1.0.0",
+		Code:    code,
 		Message: msg,
 	}
-}
\ No newline at end of file
+}
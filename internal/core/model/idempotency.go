@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Response to a request sent with an Idempotency-Key. It is replayed to the retries of the same request
+type IdempotentResponse struct {
+	StatusCode int
+	// Only the headers that describe the response, I.E. Content-Type and ETag
+	Headers map[string]string
+	Body    []byte
+}
+
+// Request sent with an Idempotency-Key. The request hash tells apart a retry from another request with the same key.
+// Response is nil until the first request is done
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	Response    *IdempotentResponse
+	ExpiresAt   time.Time
+}
@@ -0,0 +1,27 @@
+package model
+
+// Media type of the RFC 7807 responses. Clients get them when they ask for it in the Accept header.
+// Otherwise they get the ErrorResponse, so the existing clients keep working
+const ProblemContentType = "application/problem+json"
+
+// Error response as defined in RFC 7807
+type Problem struct {
+	// Identifies the kind of problem. One per error code, I.E. urn:shopping-cart:problem:item_not_found
+	Type string `json:"type"`
+	// Same for every problem of the same type
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	// Explains this very occurrence of the problem. It is left empty when there is nothing to add to the title
+	Detail string `json:"detail,omitempty"`
+	// Path of the request that caused the problem
+	Instance string `json:"instance,omitempty"`
+	// Extension members. The code is the same one sent in ErrorResponse
+	Code   string       `json:"code"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// A field of the request that is not valid. Field is the json path of the field, I.E. item.quantity
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,17 @@
+package model
+
+// Sent by asynchronous reservers once the reservation is done. Either the reservation id or the failure reason is set
+type ReservationCallback struct {
+	Version       string `json:"version"`
+	CartId        string `json:"cartId" binding:"required"`
+	ItemId        string `json:"itemId" binding:"required"`
+	ReservationId string `json:"reservationId"`
+	// Quantity covered by the reservation. If missing, the reservation is assumed to cover the current quantity
+	Quantity      int    `json:"quantity" binding:"min=0"`
+	FailureReason string `json:"failureReason"`
+}
+
+// A successful reservation carries the reservation id, a failed one the reason. Anything else is malformed
+func (rc ReservationCallback) IsValid() bool {
+	return (rc.ReservationId == "") != (rc.FailureReason == "")
+}
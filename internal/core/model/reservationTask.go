@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+type ReservationOperation string
+
+const (
+	ReserveOperation ReservationOperation = "reserve"
+	ReleaseOperation ReservationOperation = "release"
+)
+
+// Pending call to the reserver. Tasks are written in the same transaction as the cart change that originated them,
+// so no reservation is lost if the service stops before calling the reserver
+type ReservationTask struct {
+	Id        int64
+	CartId    string
+	Operation ReservationOperation
+	// Snapshot of the item when the task was created. Reservations reload the item, as it may have changed since then.
+	// Releases need the snapshot, as the item is already gone
+	Item CartItem
+	// Number of times the task has been claimed, including the current one
+	Attempts  int
+	CreatedAt time.Time
+}
+
+func NewReserveTask(cartId string, item CartItem) ReservationTask {
+	return ReservationTask{
+		CartId:    cartId,
+		Operation: ReserveOperation,
+		Item:      item,
+	}
+}
+
+func NewReleaseTask(cartId string, item CartItem) ReservationTask {
+	return ReservationTask{
+		CartId:    cartId,
+		Operation: ReleaseOperation,
+		Item:      item,
+	}
+}
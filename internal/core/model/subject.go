@@ -0,0 +1,32 @@
+package model
+
+import "context"
+
+type (
+	subjectKey struct{}
+	guestKey   struct{}
+)
+
+// Stores the authenticated caller, I.E. the sub claim of its token, so the services can tell whose request it is
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// False when the request has not been authenticated, I.E. authentication is disabled or the call comes from
+// a background process
+func SubjectFromContext(ctx context.Context) (string, bool) {
+	subject, ok := ctx.Value(subjectKey{}).(string)
+	return subject, ok && subject != ""
+}
+
+// Stores the guest the caller browsed as before logging in, I.E. the one given by its guest cookie. Guests are
+// subjects as well, so their carts belong to them. See WithSubject
+func WithGuest(ctx context.Context, guest string) context.Context {
+	return context.WithValue(ctx, guestKey{}, guest)
+}
+
+// False when the caller has never browsed as a guest
+func GuestFromContext(ctx context.Context) (string, bool) {
+	guest, ok := ctx.Value(guestKey{}).(string)
+	return guest, ok && guest != ""
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Harital/shopping-cart/internal/core/domainerr"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// The rules are declared in the binding tags, the same ones gin checks when binding the requests
+	validationTag = "binding"
+	// Also in the binding tags of the quantities
+	MaxItemQuantity = 1000
+)
+
+// Every field that is not valid. See ValidationError
+var ErrInvalidRequest = domainerr.New(domainerr.Validation, "invalid_request", "invalid request")
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.SetTagName(validationTag)
+	v.RegisterTagNameFunc(FieldName)
+	return v
+}
+
+// Lists all the fields that are not valid, so the client can fix them at once. It is an ErrInvalidRequest, so
+// errors.Is works with it as well
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	details := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		details = append(details, field.String())
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidRequest.Message, strings.Join(details, ", "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidRequest
+}
+
+func (fe FieldError) String() string {
+	return fe.Field + " " + fe.Message
+}
+
+// Checks the rules declared in the binding tags of the struct. The handlers get them checked by gin, but the service
+// checks them again for the callers that do not go through http
+func Validate(s any) error {
+	validateErr := validate.Struct(s)
+	var validationErrs validator.ValidationErrors
+	if errors.As(validateErr, &validationErrs) {
+		return &ValidationError{Fields: FieldErrors(validationErrs)}
+	}
+	return validateErr
+}
+
+// Fields are named as the clients send them, I.E. quantity instead of Quantity
+func FieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// Fields are named after their json path, I.E. item.quantity
+func FieldErrors(validationErrs validator.ValidationErrors) []FieldError {
+	fields := make([]FieldError, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		// The namespace starts with the name of the validated struct, which means nothing to the client
+		_, field, _ := strings.Cut(fieldErr.Namespace(), ".")
+		fields = append(fields, FieldError{Field: field, Message: validationMessage(fieldErr)})
+	}
+	return fields
+}
+
+func validationMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "number":
+		return "must be a number"
+	case "oneof":
+		return "must be one of " + fieldErr.Param()
+	case "min", "max":
+		bound := "at least "
+		if fieldErr.Tag() == "max" {
+			bound = "at most "
+		}
+		if fieldErr.Kind() == reflect.String {
+			return "must be " + bound + fieldErr.Param() + " characters long"
+		}
+		return "must be " + bound + fieldErr.Param()
+	default:
+		return "is not valid"
+	}
+}
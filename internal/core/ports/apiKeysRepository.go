@@ -0,0 +1,22 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+// Keys of the back office tools and services. Revoked keys are kept, so they are still listed
+//
+//go:generate mockgen -destination=../mocks/APIKeysRepository_mock.go -package=mocks . APIKeysRepository
+type APIKeysRepository interface {
+	Create(ctx context.Context, key model.APIKey) error
+	// Returns model.ErrAPIKeyNotFound if there is no key with that hash, revoked or not
+	GetByHash(ctx context.Context, hash string) (model.APIKey, error)
+	// Oldest first
+	List(ctx context.Context) ([]model.APIKey, error)
+	// Returns model.ErrAPIKeyNotFound if there is no key with that id. Revoking a revoked key keeps its first
+	// revocation date
+	Revoke(ctx context.Context, id string, revokedAt time.Time) error
+}
@@ -0,0 +1,17 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+//go:generate mockgen -destination=../mocks/APIKeysService_mock.go -package=mocks . APIKeysService
+type APIKeysService interface {
+	// Returns the key along with its secret, which is not stored anywhere. It cannot be retrieved later
+	Create(ctx context.Context, name string, scopes []model.APIKeyScope) (model.APIKey, string, error)
+	// Returns the key of the secret. model.ErrInvalidAPIKey if it is unknown or has been revoked
+	Authenticate(ctx context.Context, secret string) (model.APIKey, error)
+	List(ctx context.Context) ([]model.APIKey, error)
+	Revoke(ctx context.Context, id string) error
+}
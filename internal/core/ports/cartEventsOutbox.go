@@ -0,0 +1,25 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+// Events are written by the CartItemsRepository in the same transaction as the carts they are about.
+// This port is the consumer side, used by the cart events dispatcher. See ReservationOutbox
+//
+//go:generate mockgen -destination=../mocks/CartEventsOutbox_mock.go -package=mocks . CartEventsOutbox
+type CartEventsOutbox interface {
+	// Claims up to limit pending events that are due. A claimed event is not handed out again until the lease
+	// expires, so events claimed by a dispatcher that crashed are eventually retried
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]model.CartEvent, error)
+	MarkDone(ctx context.Context, eventId int64) error
+	// Releases the claim and schedules another attempt
+	Retry(ctx context.Context, eventId int64, nextAttemptAt time.Time, lastErr string) error
+	// The event will not be retried anymore. It is kept in the outbox for manual inspection
+	MarkDead(ctx context.Context, eventId int64, lastErr string) error
+	// Deletes the events already published, so the outbox does not grow forever. Returns how many have been deleted
+	DeleteDone(ctx context.Context) (int64, error)
+}
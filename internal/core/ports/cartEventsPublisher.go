@@ -0,0 +1,14 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+// Tells the rest of the company (I.E. marketing) about what happens to the carts
+//
+//go:generate mockgen -destination=../mocks/CartEventsPublisher_mock.go -package=mocks . CartEventsPublisher
+type CartEventsPublisher interface {
+	PublishAbandonedCart(ctx context.Context, cart model.AbandonedCart) error
+}
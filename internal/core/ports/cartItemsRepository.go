@@ -2,13 +2,46 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"github.com/Harital/shopping-cart/internal/core/model"
 )
 
+// Every change that affects the reservation of an item writes the corresponding reservation task in the outbox,
+// in the same transaction as the change itself.
+// Changes made by the clients (Add, Remove and UpdateQuantity) increase the version of the cart, which is returned
+// along the item. If expectedVersion is set and the cart is not at that version anymore, nothing is changed and a
+// *model.VersionConflictError is returned. Nil applies the change whatever the version
+//
 //go:generate mockgen -destination=../mocks/CartItemsRepository_mock.go -package=mocks . CartItemsRepository
 type CartItemsRepository interface {
-	Get(ctx context.Context) ([]model.CartItem, error)
-	Add(ctx context.Context, item model.CartItem) (error)
-	SetReservationId(ctx context.Context, item model.CartItem, reservationId string) (error)
+	// The version is read before the items. If the cart changes in between, the version is older than the items,
+	// so the client gets a needless conflict at worst, never a lost update
+	Get(ctx context.Context, cartId string) (model.Cart, error)
+	GetItem(ctx context.Context, cartId string, itemId string) (model.CartItem, error)
+	// Returns the stored item. Its quantity may differ from the added one if the item was already in the cart
+	Add(ctx context.Context, cartId string, item model.CartItem, expectedVersion *int64) (model.CartItem, int64, error)
+	SetReservationId(ctx context.Context, cartId string, item model.CartItem, reservationId string) error
+	// The reserver could not reserve the item. The reason is kept until the item is reserved
+	SetReservationFailed(ctx context.Context, cartId string, itemId string, reason string) error
+	// The reservation has been given back to the reserver. Returns model.ErrItemNotFound if the item does not hold
+	// that reservation anymore
+	SetReservationReleased(ctx context.Context, cartId string, itemId string, reservationId string) error
+	// Returns the removed item. If it had a reservation, a release task is written in the outbox
+	Remove(ctx context.Context, cartId string, itemId string, expectedVersion *int64) (model.CartItem, int64, error)
+	UpdateQuantity(ctx context.Context, cartId string, itemId string, quantity int, expectedVersion *int64) (model.CartItem, int64, error)
+	// Empty if the cart does not exist or has no owner
+	CartOwner(ctx context.Context, cartId string) (string, error)
+	// Creates the cart owned by ownerId, or makes ownerId the owner of a cart without one. Returns the owner the
+	// cart ends up with, which is another one if it was already owned by someone else
+	ClaimCart(ctx context.Context, cartId string, ownerId string) (string, error)
+	// Folds every item of the guest cart into cartId (see model.MergeCartItem) and deletes the guest cart, all at
+	// once. Returns the merged cart, or model.ErrCartNotFound if the guest cart does not exist.
+	// The version checked and increased is the one of cartId
+	Merge(ctx context.Context, guestCartId string, cartId string, expectedVersion *int64) (model.Cart, error)
+	// Deletes up to limit carts not changed since idleSince, along with their items. A release task is written in
+	// the outbox for every reserved item, and an abandoned cart event for every cart with items, all at once.
+	// Returns the deleted carts, oldest first.
+	// Reservation updates are not changes, see model.Cart
+	ExpireCarts(ctx context.Context, idleSince time.Time, limit int) ([]model.AbandonedCart, error)
 }
@@ -6,8 +6,13 @@ import (
 	"github.com/Harital/shopping-cart/internal/core/model"
 )
 
+// Changes return the new version of the cart. See CartItemsRepository for the expected version
+//
 //go:generate mockgen -destination=../mocks/CartItemsService_mock.go -package=mocks . CartItemsService
 type CartItemsService interface {
-	Get(ctx context.Context) ([]model.CartItem, error)
-	Add(ctx context.Context, items model.CartItem) error
+	Get(ctx context.Context, cartId string) (model.Cart, error)
+	Add(ctx context.Context, cartId string, items model.CartItem, expectedVersion *int64) (int64, error)
+	Remove(ctx context.Context, cartId string, itemId string, expectedVersion *int64) (int64, error)
+	UpdateQuantity(ctx context.Context, cartId string, itemId string, quantity int, expectedVersion *int64) (int64, error)
+	Merge(ctx context.Context, guestCartId string, cartId string, expectedVersion *int64) (model.Cart, error)
 }
@@ -0,0 +1,23 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+// Keeps the requests sent with an Idempotency-Key, along with their responses. Expired records count as missing
+//
+//go:generate mockgen -destination=../mocks/IdempotencyKeysRepository_mock.go -package=mocks . IdempotencyKeysRepository
+type IdempotencyKeysRepository interface {
+	// Stores the record, unless there is an unexpired one with the same key, which is returned instead.
+	// The bool tells whether the given record has been stored
+	Claim(ctx context.Context, record model.IdempotencyRecord) (model.IdempotencyRecord, bool, error)
+	// Stores the response of a claimed key and keeps it until expiresAt
+	Complete(ctx context.Context, key string, response model.IdempotentResponse, expiresAt time.Time) error
+	// Drops the key, so the request can be sent again
+	Delete(ctx context.Context, key string) error
+	// Returns how many keys have been deleted
+	DeleteExpired(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,22 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+// Makes the retries of a request sent with an Idempotency-Key get the response of the first one, instead of
+// applying the request again
+//
+//go:generate mockgen -destination=../mocks/IdempotencyService_mock.go -package=mocks . IdempotencyService
+type IdempotencyService interface {
+	// Returns the response to the first request sent with the key. If there is none, the key is claimed for this
+	// request and nil is returned. The caller must then Complete or Abandon it.
+	// Returns model.ErrIdempotencyKeyReused if the key was sent with another request and
+	// model.ErrIdempotencyKeyInProgress if the first request has not finished yet
+	Start(ctx context.Context, key string, requestHash string) (*model.IdempotentResponse, error)
+	Complete(ctx context.Context, key string, response model.IdempotentResponse) error
+	// The request failed and its response is not worth replaying. The next retry is processed again
+	Abandon(ctx context.Context, key string) error
+}
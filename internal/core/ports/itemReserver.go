@@ -0,0 +1,19 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+// Client of the reserver service, where the stock of the items is reserved
+//
+//go:generate mockgen -destination=../mocks/ItemReserver_mock.go -package=mocks . ItemReserver
+type ItemReserver interface {
+	// Returns the reservation id. If the item is already reserved, the reserver may adjust the existing reservation
+	// (same id returned) or replace it with a new one.
+	// An empty id means that the reserver answers asynchronously, through the reservation callback
+	Reserve(ctx context.Context, cartId string, item model.CartItem) (string, error)
+	// The item carries the reservation id to be released
+	Release(ctx context.Context, cartId string, item model.CartItem) error
+}
@@ -0,0 +1,27 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+// Tasks are written by the CartItemsRepository in the same transaction as the cart changes.
+// This port is the consumer side, used by the dispatcher
+//
+//go:generate mockgen -destination=../mocks/ReservationOutbox_mock.go -package=mocks . ReservationOutbox
+type ReservationOutbox interface {
+	// Claims up to limit pending tasks that are due. A claimed task is not handed out again until the lease expires,
+	// so tasks claimed by a dispatcher that crashed are eventually retried
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]model.ReservationTask, error)
+	MarkDone(ctx context.Context, taskId int64) error
+	// Releases the claim and schedules another attempt
+	Retry(ctx context.Context, taskId int64, nextAttemptAt time.Time, lastErr string) error
+	// Same as Retry, but the attempt is not counted. Used when the reserver was not even called
+	Postpone(ctx context.Context, taskId int64, nextAttemptAt time.Time) error
+	// The task will not be retried anymore. It is kept in the outbox for manual inspection
+	MarkDead(ctx context.Context, taskId int64, lastErr string) error
+	// Deletes the tasks already done, so the outbox does not grow forever. Returns how many have been deleted
+	DeleteDone(ctx context.Context) (int64, error)
+}
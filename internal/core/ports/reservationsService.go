@@ -0,0 +1,14 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+// Entry point for the reservers that answer asynchronously
+//
+//go:generate mockgen -destination=../mocks/ReservationsService_mock.go -package=mocks . ReservationsService
+type ReservationsService interface {
+	CompleteReservation(ctx context.Context, callback model.ReservationCallback) error
+}
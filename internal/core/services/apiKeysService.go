@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/google/uuid"
+)
+
+const (
+	// Makes the keys easy to spot, I.E. by secret scanners
+	apiKeyPrefix = "sck_"
+	// 256 random bits. Keys are not guessable, so a plain sha256 is enough to store them
+	apiKeySecretBytes = 32
+	maxAPIKeyNameLen  = 255
+)
+
+var errAPIKeyName = errors.New("the name of the api key must be between 1 and 255 characters long")
+
+type APIKeysService struct {
+	repo ports.APIKeysRepository
+}
+
+func NewAPIKeysService(repo ports.APIKeysRepository) *APIKeysService {
+	return &APIKeysService{repo: repo}
+}
+
+func hashAPIKey(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func (aks *APIKeysService) Create(ctx context.Context, name string, scopes []model.APIKeyScope) (model.APIKey, string, error) {
+	if name == "" || len(name) > maxAPIKeyNameLen {
+		return model.APIKey{}, "", fmt.Errorf("%w --> %w", model.ErrInvalidRequest, errAPIKeyName)
+	}
+	if len(scopes) == 0 {
+		return model.APIKey{}, "", fmt.Errorf("no scopes --> %w", model.ErrInvalidScope)
+	}
+
+	random := make([]byte, apiKeySecretBytes)
+	if _, randErr := rand.Read(random); randErr != nil {
+		return model.APIKey{}, "", fmt.Errorf("generating api key --> %w", randErr)
+	}
+	secret := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+
+	key := model.APIKey{
+		Id:        uuid.NewString(),
+		Name:      name,
+		Hash:      hashAPIKey(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if createErr := aks.repo.Create(ctx, key); createErr != nil {
+		return model.APIKey{}, "", fmt.Errorf("storing api key %s --> %w", name, createErr)
+	}
+	return key, secret, nil
+}
+
+// Unknown and revoked keys get the same error, so the caller cannot tell them apart
+func (aks *APIKeysService) Authenticate(ctx context.Context, secret string) (model.APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return model.APIKey{}, fmt.Errorf("malformed api key --> %w", model.ErrInvalidAPIKey)
+	}
+
+	key, getErr := aks.repo.GetByHash(ctx, hashAPIKey(secret))
+	if errors.Is(getErr, model.ErrAPIKeyNotFound) {
+		return model.APIKey{}, fmt.Errorf("unknown api key --> %w", model.ErrInvalidAPIKey)
+	}
+	if getErr != nil {
+		return model.APIKey{}, fmt.Errorf("reading api key --> %w", getErr)
+	}
+	if key.Revoked() {
+		return model.APIKey{}, fmt.Errorf("api key %s revoked --> %w", key.Id, model.ErrInvalidAPIKey)
+	}
+	return key, nil
+}
+
+func (aks *APIKeysService) List(ctx context.Context) ([]model.APIKey, error) {
+	return aks.repo.List(ctx)
+}
+
+func (aks *APIKeysService) Revoke(ctx context.Context, id string) error {
+	return aks.repo.Revoke(ctx, id, time.Now().UTC())
+}
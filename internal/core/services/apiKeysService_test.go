@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/mocks"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_CreateAPIKey_GivenAPIKeysServiceCreated(t *testing.T) {
+	ctx := context.Background()
+	randomError := errors.New("random error")
+	scopes := []model.APIKeyScope{model.ReadScope, model.WriteScope}
+
+	tests := []struct {
+		name   string
+		in     string
+		scopes []model.APIKeyScope
+		mocks  func(repo *mocks.MockAPIKeysRepository)
+		want   error
+	}{
+		{
+			name:   "WhenNoName_ThenInvalidRequest",
+			in:     "",
+			scopes: scopes,
+			mocks:  func(repo *mocks.MockAPIKeysRepository) {},
+			want:   model.ErrInvalidRequest,
+		}, {
+			name:   "WhenNameTooLong_ThenInvalidRequest",
+			in:     strings.Repeat("n", 256),
+			scopes: scopes,
+			mocks:  func(repo *mocks.MockAPIKeysRepository) {},
+			want:   model.ErrInvalidRequest,
+		}, {
+			name:   "WhenNoScopes_ThenInvalidScope",
+			in:     "checkout",
+			scopes: nil,
+			mocks:  func(repo *mocks.MockAPIKeysRepository) {},
+			want:   model.ErrInvalidScope,
+		}, {
+			name:   "WhenRepoFails_ThenError",
+			in:     "checkout",
+			scopes: scopes,
+			mocks: func(repo *mocks.MockAPIKeysRepository) {
+				repo.EXPECT().Create(ctx, gomock.Any()).Return(randomError)
+			},
+			want: randomError,
+		}, {
+			name:   "WhenOK_ThenOnlyTheHashIsStored",
+			in:     "checkout",
+			scopes: scopes,
+			mocks: func(repo *mocks.MockAPIKeysRepository) {
+				repo.EXPECT().Create(ctx, gomock.Any()).Return(nil)
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			repo := mocks.NewMockAPIKeysRepository(mockCtrl)
+			tc.mocks(repo)
+
+			svc := NewAPIKeysService(repo)
+
+			key, secret, createErr := svc.Create(ctx, tc.in, tc.scopes)
+			if tc.want != nil {
+				assert.ErrorIs(t, createErr, tc.want)
+				assert.Empty(t, secret)
+				return
+			}
+
+			assert.NoError(t, createErr)
+			assert.True(t, strings.HasPrefix(secret, apiKeyPrefix))
+			assert.Equal(t, hashAPIKey(secret), key.Hash)
+			assert.NotEmpty(t, key.Id)
+			assert.Equal(t, tc.in, key.Name)
+			assert.Equal(t, tc.scopes, key.Scopes)
+			assert.False(t, key.Revoked())
+		})
+	}
+}
+
+func Test_AuthenticateAPIKey_GivenAPIKeysServiceCreated(t *testing.T) {
+	ctx := context.Background()
+	randomError := errors.New("random error")
+	secret := apiKeyPrefix + "secret"
+	revokedAt := time.Now().UTC()
+	stored := model.APIKey{Id: "1", Name: "checkout", Hash: hashAPIKey(secret), Scopes: []model.APIKeyScope{model.ReadScope}}
+
+	type want struct {
+		err error
+		key model.APIKey
+	}
+	tests := []struct {
+		name   string
+		secret string
+		mocks  func(repo *mocks.MockAPIKeysRepository)
+		want   want
+	}{
+		{
+			name:   "WhenNotAKey_ThenInvalidAPIKeyWithoutReadingTheRepo",
+			secret: "Bearer something",
+			mocks:  func(repo *mocks.MockAPIKeysRepository) {},
+			want:   want{err: model.ErrInvalidAPIKey},
+		}, {
+			name:   "WhenUnknownKey_ThenInvalidAPIKey",
+			secret: secret,
+			mocks: func(repo *mocks.MockAPIKeysRepository) {
+				repo.EXPECT().GetByHash(ctx, hashAPIKey(secret)).Return(model.APIKey{}, model.ErrAPIKeyNotFound)
+			},
+			want: want{err: model.ErrInvalidAPIKey},
+		}, {
+			name:   "WhenRevokedKey_ThenInvalidAPIKey",
+			secret: secret,
+			mocks: func(repo *mocks.MockAPIKeysRepository) {
+				revoked := stored
+				revoked.RevokedAt = &revokedAt
+				repo.EXPECT().GetByHash(ctx, hashAPIKey(secret)).Return(revoked, nil)
+			},
+			want: want{err: model.ErrInvalidAPIKey},
+		}, {
+			name:   "WhenRepoFails_ThenError",
+			secret: secret,
+			mocks: func(repo *mocks.MockAPIKeysRepository) {
+				repo.EXPECT().GetByHash(ctx, hashAPIKey(secret)).Return(model.APIKey{}, randomError)
+			},
+			want: want{err: randomError},
+		}, {
+			name:   "WhenValidKey_ThenKeyIsReturned",
+			secret: secret,
+			mocks: func(repo *mocks.MockAPIKeysRepository) {
+				repo.EXPECT().GetByHash(ctx, hashAPIKey(secret)).Return(stored, nil)
+			},
+			want: want{key: stored},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			repo := mocks.NewMockAPIKeysRepository(mockCtrl)
+			tc.mocks(repo)
+
+			svc := NewAPIKeysService(repo)
+
+			key, authErr := svc.Authenticate(ctx, tc.secret)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, authErr, tc.want.err)
+			} else {
+				assert.NoError(t, authErr)
+			}
+			assert.Equal(t, tc.want.key, key)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/rs/zerolog/log"
+)
+
+type CartEventsDispatcherConfig struct {
+	// How often the outbox is checked for pending events
+	PollInterval time.Duration
+	// Maximum number of events claimed at once
+	BatchSize int
+	// Time a claimed event is hidden from other dispatchers. Events are published one by one, so it must be longer
+	// than the time needed to publish a whole batch
+	ClaimLease time.Duration
+	// After this number of attempts the event is dead-lettered
+	MaxAttempts int
+	// Exponential backoff between attempts: BaseBackoff, 2*BaseBackoff, 4*BaseBackoff... up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// How often the published events are deleted from the outbox
+	PurgeInterval time.Duration
+}
+
+// Takes the abandoned cart events from the outbox and publishes them. Events are only marked as done once they are
+// published, so every event is published at least once, even if the publisher is down for a while
+type CartEventsDispatcher struct {
+	outbox    ports.CartEventsOutbox
+	publisher ports.CartEventsPublisher
+	config    CartEventsDispatcherConfig
+}
+
+func NewCartEventsDispatcher(outbox ports.CartEventsOutbox, publisher ports.CartEventsPublisher, config CartEventsDispatcherConfig) *CartEventsDispatcher {
+	return &CartEventsDispatcher{
+		outbox:    outbox,
+		publisher: publisher,
+		config:    config,
+	}
+}
+
+// Blocks until the context is done
+func (ced *CartEventsDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(ced.config.PollInterval)
+	defer ticker.Stop()
+	purgeTicker := time.NewTicker(ced.config.PurgeInterval)
+	defer purgeTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ced.DispatchBatch(ctx)
+		case <-purgeTicker.C:
+			ced.Purge(ctx)
+		}
+	}
+}
+
+// Claims a single batch of events and publishes them one by one. The events left when the context is done are
+// published again once their claim expires. Errors are logged, as there is nobody to return them to
+func (ced *CartEventsDispatcher) DispatchBatch(ctx context.Context) {
+	events, claimErr := ced.outbox.Claim(ctx, ced.config.BatchSize, ced.config.ClaimLease)
+	if claimErr != nil {
+		log.
+			Error().
+			Err(claimErr).
+			Msg("while claiming cart events")
+		return
+	}
+
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return
+		}
+		ced.publish(ctx, event)
+	}
+}
+
+// Deletes the published events, so the outbox does not grow forever. Errors are logged, as there is nobody to
+// return them to
+func (ced *CartEventsDispatcher) Purge(ctx context.Context) {
+	deleted, deleteErr := ced.outbox.DeleteDone(ctx)
+	if deleteErr != nil {
+		log.
+			Error().
+			Err(deleteErr).
+			Msg("while deleting published cart events")
+		return
+	}
+	log.
+		Debug().
+		Int64("deleted", deleted).
+		Msg("published cart events deleted")
+}
+
+func (ced *CartEventsDispatcher) publish(ctx context.Context, event model.CartEvent) {
+	publishErr := ced.publisher.PublishAbandonedCart(ctx, event.Cart)
+	// The outcome must be written even if the publisher was cancelled by the shutdown
+	ctx = context.WithoutCancel(ctx)
+
+	if publishErr == nil {
+		if doneErr := ced.outbox.MarkDone(ctx, event.Id); doneErr != nil {
+			// The event will be published again when the lease expires. Consumers must tolerate duplicates
+			log.
+				Error().
+				Err(doneErr).
+				Int64("eventId", event.Id).
+				Msg("while marking cart event as done")
+		}
+		return
+	}
+
+	if event.Attempts >= ced.config.MaxAttempts {
+		log.
+			Error().
+			Err(publishErr).
+			Int64("eventId", event.Id).
+			Str("cartId", event.Cart.CartId).
+			Int("attempts", event.Attempts).
+			Msg("cart event dead-lettered")
+		if deadErr := ced.outbox.MarkDead(ctx, event.Id, publishErr.Error()); deadErr != nil {
+			log.
+				Error().
+				Err(deadErr).
+				Int64("eventId", event.Id).
+				Msg("while dead-lettering cart event")
+		}
+		return
+	}
+
+	nextAttemptAt := time.Now().Add(exponentialBackoff(ced.config.BaseBackoff, ced.config.MaxBackoff, event.Attempts))
+	log.
+		Warn().
+		Err(publishErr).
+		Int64("eventId", event.Id).
+		Str("cartId", event.Cart.CartId).
+		Int("attempts", event.Attempts).
+		Time("nextAttemptAt", nextAttemptAt).
+		Msg("publishing cart event failed. Will be retried")
+	if retryErr := ced.outbox.Retry(ctx, event.Id, nextAttemptAt, publishErr.Error()); retryErr != nil {
+		log.
+			Error().
+			Err(retryErr).
+			Int64("eventId", event.Id).
+			Msg("while scheduling cart event retry")
+	}
+}
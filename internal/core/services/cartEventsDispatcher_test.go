@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/mocks"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+type cartEventsDispatcherMocks struct {
+	outbox    *mocks.MockCartEventsOutbox
+	publisher *mocks.MockCartEventsPublisher
+}
+
+var testCartEventsDispatcherConfig = CartEventsDispatcherConfig{
+	PollInterval:  10 * time.Millisecond,
+	BatchSize:     5,
+	ClaimLease:    time.Minute,
+	MaxAttempts:   3,
+	BaseBackoff:   time.Second,
+	MaxBackoff:    3 * time.Second,
+	PurgeInterval: time.Hour,
+}
+
+func Test_DispatchBatch_GivenCartEventsDispatcherCreated(t *testing.T) {
+	randomError := errors.New("random error")
+	cart := model.AbandonedCart{CartId: cartId, OwnerId: "alice", Items: []model.CartItem{{Id: "1", Name: "jacket", Quantity: 1}}}
+	event := model.CartEvent{Id: 1, Cart: cart, Attempts: 1}
+	otherEvent := model.CartEvent{Id: 2, Cart: model.AbandonedCart{CartId: "other"}, Attempts: 1}
+	lastAttemptEvent := model.CartEvent{Id: 3, Cart: cart, Attempts: 3}
+
+	tests := []struct {
+		name  string
+		mocks func(m cartEventsDispatcherMocks)
+	}{
+		{
+			name: "WhenClaimFails_ThenNothingIsPublished",
+			mocks: func(m cartEventsDispatcherMocks) {
+				m.outbox.EXPECT().Claim(gomock.Any(), testCartEventsDispatcherConfig.BatchSize, testCartEventsDispatcherConfig.ClaimLease).
+					Return([]model.CartEvent{}, randomError)
+				m.publisher.EXPECT().PublishAbandonedCart(gomock.Any(), gomock.Any()).Times(0)
+			},
+		}, {
+			name: "WhenPublished_ThenEventIsMarkedAsDone",
+			mocks: func(m cartEventsDispatcherMocks) {
+				m.outbox.EXPECT().Claim(gomock.Any(), testCartEventsDispatcherConfig.BatchSize, testCartEventsDispatcherConfig.ClaimLease).
+					Return([]model.CartEvent{event}, nil)
+				m.publisher.EXPECT().PublishAbandonedCart(gomock.Any(), cart).Return(nil)
+				m.outbox.EXPECT().MarkDone(gomock.Any(), event.Id).Return(nil)
+			},
+		}, {
+			name: "WhenPublishFails_ThenEventIsRetriedWithBackoffAndTheOthersArePublished",
+			mocks: func(m cartEventsDispatcherMocks) {
+				m.outbox.EXPECT().Claim(gomock.Any(), testCartEventsDispatcherConfig.BatchSize, testCartEventsDispatcherConfig.ClaimLease).
+					Return([]model.CartEvent{event, otherEvent}, nil)
+				m.publisher.EXPECT().PublishAbandonedCart(gomock.Any(), cart).Return(randomError)
+				m.outbox.EXPECT().Retry(gomock.Any(), event.Id, gomock.Any(), randomError.Error()).
+					DoAndReturn(func(ctx context.Context, eventId int64, nextAttemptAt time.Time, lastErr string) error {
+						// First attempt, so the base backoff is applied
+						assert.WithinDuration(t, time.Now().Add(testCartEventsDispatcherConfig.BaseBackoff), nextAttemptAt, 500*time.Millisecond)
+						return nil
+					})
+				m.publisher.EXPECT().PublishAbandonedCart(gomock.Any(), otherEvent.Cart).Return(nil)
+				m.outbox.EXPECT().MarkDone(gomock.Any(), otherEvent.Id).Return(nil)
+			},
+		}, {
+			name: "WhenPublishFailsInLastAttempt_ThenEventIsDeadLettered",
+			mocks: func(m cartEventsDispatcherMocks) {
+				m.outbox.EXPECT().Claim(gomock.Any(), testCartEventsDispatcherConfig.BatchSize, testCartEventsDispatcherConfig.ClaimLease).
+					Return([]model.CartEvent{lastAttemptEvent}, nil)
+				m.publisher.EXPECT().PublishAbandonedCart(gomock.Any(), cart).Return(randomError)
+				m.outbox.EXPECT().MarkDead(gomock.Any(), lastAttemptEvent.Id, randomError.Error()).Return(nil)
+			},
+		}, {
+			// The event is published again once the lease expires
+			name: "WhenMarkDoneFails_ThenNothingElseHappens",
+			mocks: func(m cartEventsDispatcherMocks) {
+				m.outbox.EXPECT().Claim(gomock.Any(), testCartEventsDispatcherConfig.BatchSize, testCartEventsDispatcherConfig.ClaimLease).
+					Return([]model.CartEvent{event}, nil)
+				m.publisher.EXPECT().PublishAbandonedCart(gomock.Any(), cart).Return(nil)
+				m.outbox.EXPECT().MarkDone(gomock.Any(), event.Id).Return(randomError)
+				m.outbox.EXPECT().Retry(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			m := cartEventsDispatcherMocks{
+				outbox:    mocks.NewMockCartEventsOutbox(mockCtrl),
+				publisher: mocks.NewMockCartEventsPublisher(mockCtrl),
+			}
+			tc.mocks(m)
+
+			NewCartEventsDispatcher(m.outbox, m.publisher, testCartEventsDispatcherConfig).DispatchBatch(context.Background())
+		})
+	}
+}
+
+// The events left are published again once their claim expires
+func Test_DispatchBatch_GivenCartEventsDispatcherCanceled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	m := cartEventsDispatcherMocks{
+		outbox:    mocks.NewMockCartEventsOutbox(mockCtrl),
+		publisher: mocks.NewMockCartEventsPublisher(mockCtrl),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	first := model.CartEvent{Id: 1, Cart: model.AbandonedCart{CartId: "c1"}, Attempts: 1}
+	second := model.CartEvent{Id: 2, Cart: model.AbandonedCart{CartId: "c2"}, Attempts: 1}
+
+	m.outbox.EXPECT().Claim(gomock.Any(), gomock.Any(), gomock.Any()).Return([]model.CartEvent{first, second}, nil)
+	m.publisher.EXPECT().PublishAbandonedCart(gomock.Any(), first.Cart).
+		DoAndReturn(func(ctx context.Context, cart model.AbandonedCart) error {
+			cancel()
+			return nil
+		})
+	// The outcome is written even though the context is done
+	m.outbox.EXPECT().MarkDone(gomock.Any(), first.Id).
+		DoAndReturn(func(ctx context.Context, eventId int64) error {
+			assert.NoError(t, ctx.Err())
+			return nil
+		})
+
+	NewCartEventsDispatcher(m.outbox, m.publisher, testCartEventsDispatcherConfig).DispatchBatch(ctx)
+}
+
+func Test_Purge_GivenCartEventsDispatcherCreated(t *testing.T) {
+	tests := []struct {
+		name  string
+		mocks func(m cartEventsDispatcherMocks)
+	}{
+		{
+			name: "WhenDeleteFails_ThenNothingElseHappens",
+			mocks: func(m cartEventsDispatcherMocks) {
+				m.outbox.EXPECT().DeleteDone(gomock.Any()).Return(int64(0), errors.New("random error"))
+			},
+		}, {
+			name: "WhenPurged_ThenOnlyPublishedEventsAreDeleted",
+			mocks: func(m cartEventsDispatcherMocks) {
+				m.outbox.EXPECT().DeleteDone(gomock.Any()).Return(int64(3), nil)
+				m.outbox.EXPECT().Claim(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			m := cartEventsDispatcherMocks{outbox: mocks.NewMockCartEventsOutbox(mockCtrl)}
+			tc.mocks(m)
+
+			NewCartEventsDispatcher(m.outbox, nil, testCartEventsDispatcherConfig).Purge(context.Background())
+		})
+	}
+}
@@ -2,91 +2,314 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/Harital/shopping-cart/internal/core/model"
 	"github.com/Harital/shopping-cart/internal/core/ports"
-	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 )
 
-const (
-	reserverEndpoint = "/reserve"
-)
-
 type CartItemsService struct {
-	repo            ports.CartItemsRepository
-	reserverHost    string
-	reserverTimeout time.Duration
+	repo     ports.CartItemsRepository
+	reserver ports.ItemReserver
 }
 
-func NewCartItemsService(repo ports.CartItemsRepository, reserverHost string, reserverTimeout time.Duration) *CartItemsService {
+func NewCartItemsService(repo ports.CartItemsRepository, reserver ports.ItemReserver) *CartItemsService {
 	return &CartItemsService{
-		repo:            repo,
-		reserverHost:    reserverHost,
-		reserverTimeout: reserverTimeout,
+		repo:     repo,
+		reserver: reserver,
 	}
 }
 
-// There should be a parameter in the get of the cart that we are getting.
-// On top of that, we should check that we have the needed permissions to access this cart
-// For the sake of simplicity, not implemented. Always accessing the same cart.
-func (cis CartItemsService) Get(ctx context.Context) ([]model.CartItem, error) {
-	return cis.repo.Get(ctx)
+// Authenticated callers can only use their own carts. Without a subject in the context (authentication disabled
+// or background processes) anyone knowing the cart id can use it
+func (cis CartItemsService) authorize(ctx context.Context, cartId string) error {
+	subject, authenticated := model.SubjectFromContext(ctx)
+	if !authenticated {
+		return nil
+	}
+
+	owner, ownerErr := cis.repo.CartOwner(ctx, cartId)
+	if ownerErr != nil {
+		return fmt.Errorf("reading owner of cart %s --> %w", cartId, ownerErr)
+	}
+	return model.CheckCartOwner(cartId, subject, owner)
 }
 
-func (cis *CartItemsService) Add(ctx context.Context, item model.CartItem) error {
-	// first we add the item to the database. Afterwards we reserve the item in background
-	if addErr := cis.repo.Add(ctx, item); addErr != nil {
-		return addErr
+// Authenticated callers become the owners of the carts without one. Same as authorize otherwise
+func (cis CartItemsService) claim(ctx context.Context, cartId string) error {
+	subject, authenticated := model.SubjectFromContext(ctx)
+	if !authenticated {
+		return nil
 	}
 
-	go cis.ReserveItem(ctx, item)
+	owner, claimErr := cis.repo.ClaimCart(ctx, cartId, subject)
+	if claimErr != nil {
+		return fmt.Errorf("claiming cart %s --> %w", cartId, claimErr)
+	}
+	return model.CheckCartOwner(cartId, subject, owner)
+}
 
-	return nil
+func (cis CartItemsService) Get(ctx context.Context, cartId string) (model.Cart, error) {
+	if authErr := cis.authorize(ctx, cartId); authErr != nil {
+		return model.Cart{}, authErr
+	}
+	return cis.repo.Get(ctx, cartId)
+}
+
+// The repository writes the reservation task in the outbox together with the item.
+// The reservation dispatcher takes it from there
+func (cis *CartItemsService) Add(ctx context.Context, cartId string, item model.CartItem, expectedVersion *int64) (int64, error) {
+	// Already checked by the http handler. Not every caller goes through it, though
+	if validateErr := item.Validate(); validateErr != nil {
+		return 0, fmt.Errorf("item %s --> %w", item.Id, validateErr)
+	}
+
+	// The cart is claimed before adding the item, so the first one adding an item becomes its owner
+	if claimErr := cis.claim(ctx, cartId); claimErr != nil {
+		return 0, claimErr
+	}
+
+	_, version, addErr := cis.repo.Add(ctx, cartId, item, expectedVersion)
+	return version, addErr
 }
 
-func (cis *CartItemsService) ReserveItem(parentContext context.Context, item model.CartItem) {
-	// Create a specific context with a big timeout for this operation
-	reqCtx, cancel := context.WithTimeout(context.Background(), cis.reserverTimeout)
-	defer cancel()
+// Same as adding. The release of the reservation, if any, is written in the outbox together with the removal
+func (cis *CartItemsService) Remove(ctx context.Context, cartId string, itemId string, expectedVersion *int64) (int64, error) {
+	if authErr := cis.authorize(ctx, cartId); authErr != nil {
+		return 0, authErr
+	}
+	_, version, removeErr := cis.repo.Remove(ctx, cartId, itemId, expectedVersion)
+	return version, removeErr
+}
 
-	// Authentication should be also set in this endpoint
-	var reservationResponse model.ItemReservationResponse
-	response, reservationErr := resty.New().R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(model.NewItemReservationRequest(item)).
-		SetResult(&reservationResponse).
-		SetContext(reqCtx).
-		Post(cis.reserverHost + reserverEndpoint)
+// Sets the absolute quantity of an item. Zero means removing it from the cart
+func (cis *CartItemsService) UpdateQuantity(ctx context.Context, cartId string, itemId string, quantity int, expectedVersion *int64) (int64, error) {
+	if quantity < 0 || quantity > model.MaxItemQuantity {
+		return 0, fmt.Errorf("quantity %d for item %s --> %w", quantity, itemId, model.ErrInvalidQuantity)
+	}
+
+	if quantity == 0 {
+		return cis.Remove(ctx, cartId, itemId, expectedVersion)
+	}
+
+	if authErr := cis.authorize(ctx, cartId); authErr != nil {
+		return 0, authErr
+	}
+
+	_, version, updateErr := cis.repo.UpdateQuantity(ctx, cartId, itemId, quantity, expectedVersion)
+	return version, updateErr
+}
+
+// Folds the cart the caller filled as a guest into its own cart, usually right after logging in. The guest cart
+// must belong to the guest the caller browsed as (or to the caller itself), and the cart is claimed as when adding
+// an item. The reservations of the guest items are carried over, so the stock is not reserved twice
+func (cis *CartItemsService) Merge(ctx context.Context, guestCartId string, cartId string, expectedVersion *int64) (model.Cart, error) {
+	if guestCartId == cartId {
+		return model.Cart{}, fmt.Errorf("cart %s --> %w", cartId, model.ErrSameCart)
+	}
+
+	if guestErr := cis.checkGuestCart(ctx, guestCartId); guestErr != nil {
+		return model.Cart{}, guestErr
+	}
+	if claimErr := cis.claim(ctx, cartId); claimErr != nil {
+		return model.Cart{}, claimErr
+	}
+
+	return cis.repo.Merge(ctx, guestCartId, cartId, expectedVersion)
+}
+
+// Merging empties and deletes the guest cart, so it takes more than being allowed to use it. See model.CheckCartOwner.
+// Carts without owner are nobody's guest cart, so they cannot be merged by any user or guest. Callers without
+// subject nor guest (I.E. api keys or authentication disabled) can merge any cart
+func (cis *CartItemsService) checkGuestCart(ctx context.Context, guestCartId string) error {
+	subject, authenticated := model.SubjectFromContext(ctx)
+	guest, browsed := model.GuestFromContext(ctx)
+	if !authenticated && !browsed {
+		return nil
+	}
+
+	owner, ownerErr := cis.repo.CartOwner(ctx, guestCartId)
+	if ownerErr != nil {
+		return fmt.Errorf("reading owner of cart %s --> %w", guestCartId, ownerErr)
+	}
+	if owner != "" && ((browsed && owner == guest) || (authenticated && owner == subject)) {
+		return nil
+	}
+
+	// Unknown carts have no owner either. They still get a not found, I.E. when the merge is retried
+	if owner == "" {
+		cart, getErr := cis.repo.Get(ctx, guestCartId)
+		if getErr != nil {
+			return fmt.Errorf("reading guest cart %s --> %w", guestCartId, getErr)
+		}
+		if cart.Version == 0 && len(cart.Items) == 0 {
+			return fmt.Errorf("guest cart %s --> %w", guestCartId, model.ErrCartNotFound)
+		}
+	}
+	return fmt.Errorf("cart %s --> %w", guestCartId, model.ErrCartForbidden)
+}
 
+// Handler for the reservation dispatcher. Any error makes the task to be retried later
+func (cis *CartItemsService) ProcessReservationTask(ctx context.Context, task model.ReservationTask) error {
+	switch task.Operation {
+	case model.ReserveOperation:
+		// The item may have changed since the task was written, so the current one is reserved
+		item, getErr := cis.repo.GetItem(ctx, task.CartId, task.Item.Id)
+		if errors.Is(getErr, model.ErrItemNotFound) {
+			// Removed in the meantime. Nothing to reserve
+			return nil
+		}
+		if getErr != nil {
+			return getErr
+		}
+
+		// Several tasks may have been written for the same item. The first one reserves the whole quantity
+		if !item.NeedsReservation() {
+			return nil
+		}
+		return cis.ReserveItem(ctx, task.CartId, item)
+
+	case model.ReleaseOperation:
+		if releaseErr := cis.ReleaseItem(ctx, task.CartId, task.Item); releaseErr != nil {
+			return releaseErr
+		}
+		cis.markReleased(ctx, task.CartId, task.Item)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown reservation operation %s", task.Operation)
+	}
+}
+
+// If the item is already reserved, the request carries the reservation id, so the reserver adjusts the existing
+// reservation to the new quantity instead of creating another one.
+// Every reservation is counted and timed by its result, see metrics.go
+func (cis *CartItemsService) ReserveItem(ctx context.Context, cartId string, item model.CartItem) error {
+	start := time.Now()
+	reservationErr := cis.reserveItem(ctx, cartId, item)
+	observeReservation(reservationErr, time.Since(start))
+	return reservationErr
+}
+
+func (cis *CartItemsService) reserveItem(ctx context.Context, cartId string, item model.CartItem) error {
+	reservationId, reservationErr := cis.reserver.Reserve(ctx, cartId, item)
 	if reservationErr != nil {
+		// An open circuit means that the reserver has not even been called. The task is just postponed
+		if !errors.Is(reservationErr, model.ErrCircuitOpen) {
+			cis.markFailed(ctx, cartId, item, reservationErr)
+		}
+		return reservationErr
+	}
+
+	// Asynchronous reserver. The reservation id comes later through the reservation callback
+	if reservationId == "" {
 		log.
-			Error().
-			Err(reservationErr).
+			Debug().
+			Str("cartId", cartId).
 			Str("itemId", item.Id).
-			Str("itemName", item.Name).
-			Msg("While reserving item")
-		return
+			Msg("reservation accepted. Waiting for the callback")
+		return nil
+	}
+
+	return cis.storeReservation(ctx, cartId, item, reservationId)
+}
+
+// Called by the reservers that answer asynchronously, once they have reserved the item or failed to do so
+func (cis *CartItemsService) CompleteReservation(ctx context.Context, callback model.ReservationCallback) error {
+	if !callback.IsValid() {
+		return fmt.Errorf("callback for item %s of cart %s --> %w", callback.ItemId, callback.CartId, model.ErrInvalidReservationCallback)
+	}
+
+	item, getErr := cis.repo.GetItem(ctx, callback.CartId, callback.ItemId)
+	if errors.Is(getErr, model.ErrItemNotFound) {
+		// Removed while it was being reserved. Nobody else knows about the reservation, so it is released
+		if callback.ReservationId != "" {
+			return cis.ReleaseItem(ctx, callback.CartId, model.CartItem{Id: callback.ItemId, ReservationId: callback.ReservationId})
+		}
+		return nil
+	}
+	if getErr != nil {
+		return getErr
+	}
+
+	if callback.FailureReason != "" {
+		return cis.repo.SetReservationFailed(ctx, callback.CartId, callback.ItemId, callback.FailureReason)
+	}
+
+	// The quantity may have changed in the meantime. In that case, a new reserve task is already in the outbox
+	if callback.Quantity > 0 {
+		item.Quantity = callback.Quantity
+	}
+	return cis.storeReservation(ctx, callback.CartId, item, callback.ReservationId)
+}
+
+// The item carries the reservation it had before, if any
+func (cis *CartItemsService) storeReservation(ctx context.Context, cartId string, item model.CartItem, reservationId string) error {
+	setResvIdErr := cis.repo.SetReservationId(ctx, cartId, item, reservationId)
+	if setResvIdErr != nil {
+		// If the item is not there anymore, it was removed while we were reserving it. The fresh reservation is
+		// released right away, as nobody else knows about it
+		if _, getErr := cis.repo.GetItem(ctx, cartId, item.Id); errors.Is(getErr, model.ErrItemNotFound) {
+			item.ReservationId = reservationId
+			return cis.ReleaseItem(ctx, cartId, item)
+		}
+		return fmt.Errorf("storing reservation id %s --> %w", reservationId, setResvIdErr)
 	}
 
-	if response.StatusCode() != 200 {
+	// The reserver may have replaced the reservation instead of adjusting it. The old one would be leaked otherwise
+	if item.ReservationId != "" && item.ReservationId != reservationId {
+		if releaseErr := cis.ReleaseItem(ctx, cartId, item); releaseErr != nil {
+			// The new reservation is already stored, so retrying the whole task would not help. Just leave a trace
+			log.
+				Error().
+				Err(releaseErr).
+				Str("cartId", cartId).
+				Str("itemId", item.Id).
+				Str("reservationId", item.ReservationId).
+				Msg("while releasing replaced reservation")
+		}
+	}
+
+	return nil
+}
+
+// The status is informative. Failing to store it must not make the reservation task to be retried,
+// so the errors are only logged.
+// The reason is returned to the clients, so the details of the error are not exposed. They are in the logs
+func (cis *CartItemsService) markFailed(ctx context.Context, cartId string, item model.CartItem, reservationErr error) {
+	reason := "reservation rejected"
+	if errors.Is(reservationErr, model.ErrReserverUnavailable) {
+		reason = "reserver unavailable"
+	}
+
+	setFailedErr := cis.repo.SetReservationFailed(ctx, cartId, item.Id, reason)
+	if setFailedErr != nil && !errors.Is(setFailedErr, model.ErrItemNotFound) {
 		log.
 			Error().
-			Str("httpResponse", response.String()).
-			Msg("bad http response while reserving the item")
-		return
+			Err(setFailedErr).
+			Str("cartId", cartId).
+			Str("itemId", item.Id).
+			Msg("while storing reservation failure")
 	}
+}
 
-	// update the database
-	setResvIdErr := cis.repo.SetReservationId(reqCtx, item, reservationResponse.ReservationId)
-	if setResvIdErr != nil {
+// Removed items are not there anymore, so most of the times there is nothing to mark
+func (cis *CartItemsService) markReleased(ctx context.Context, cartId string, item model.CartItem) {
+	setReleasedErr := cis.repo.SetReservationReleased(ctx, cartId, item.Id, item.ReservationId)
+	if setReleasedErr != nil && !errors.Is(setReleasedErr, model.ErrItemNotFound) {
 		log.
 			Error().
-			Err(setResvIdErr).
+			Err(setReleasedErr).
+			Str("cartId", cartId).
 			Str("itemId", item.Id).
-			Str("itemName", item.Name).
-			Str("reservationId", reservationResponse.ReservationId).
-			Msg("while storing resrvation id")
+			Str("reservationId", item.ReservationId).
+			Msg("while storing released reservation")
 	}
 }
+
+func (cis *CartItemsService) ReleaseItem(ctx context.Context, cartId string, item model.CartItem) error {
+	return cis.reserver.Release(ctx, cartId, item)
+}
@@ -3,14 +3,13 @@ package services
 import (
 	"context"
 	"errors"
-	"io"
-	"net/http"
-	"net/http/httptest"
+	"fmt"
+	"strings"
 	"testing"
-	"time"
 
 	"github.com/Harital/shopping-cart/internal/core/mocks"
 	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 )
@@ -18,18 +17,26 @@ import (
 // Always useful to add mocks into the struct, so it´s easier to add more mocks in the future
 // No additional parameters are needed.
 type cartItemsServiceMocks struct {
-	repo *mocks.MockCartItemsRepository
+	repo     *mocks.MockCartItemsRepository
+	reserver *mocks.MockItemReserver
 }
 
+const (
+	cartId = "5b9a2ecf-0a37-4f4b-9c57-0d4d2e7e3a11"
+)
+
 func Test_GetCartItemsService_GivenCartItemsServiceCreated(t *testing.T) {
 	ctx := context.Background()
 	randomError := errors.New("random error")
-	sampleCartItems := []model.CartItem{
-		{Name: "pants", Quantity: 1, ReservationId: "reservationId1"},
+	sampleCart := model.Cart{
+		Version: 3,
+		Items: []model.CartItem{
+			{Name: "pants", Quantity: 1, ReservationId: "reservationId1"},
+		},
 	}
 	type want struct {
-		err   error
-		items []model.CartItem
+		err  error
+		cart model.Cart
 	}
 	tests := []struct {
 		name  string
@@ -40,23 +47,22 @@ func Test_GetCartItemsService_GivenCartItemsServiceCreated(t *testing.T) {
 			name: "WhenGetAndError_ThenError",
 			mocks: func(m cartItemsServiceMocks) {
 				m.repo.EXPECT().
-					Get(ctx).
-					Return([]model.CartItem{}, randomError)
+					Get(ctx, cartId).
+					Return(model.Cart{}, randomError)
 			},
 			want: want{
-				err:   randomError,
-				items: []model.CartItem{},
+				err: randomError,
 			},
 		}, {
 			name: "WhenGetAndOK_ThenOK",
 			mocks: func(m cartItemsServiceMocks) {
 				m.repo.EXPECT().
-					Get(ctx).
-					Return(sampleCartItems, nil)
+					Get(ctx, cartId).
+					Return(sampleCart, nil)
 			},
 			want: want{
-				err:   nil,
-				items: sampleCartItems,
+				err:  nil,
+				cart: sampleCart,
 			},
 		},
 	}
@@ -65,14 +71,14 @@ func Test_GetCartItemsService_GivenCartItemsServiceCreated(t *testing.T) {
 			mockCtrl := gomock.NewController(t)
 			defer mockCtrl.Finish()
 			m := cartItemsServiceMocks{
-				repo: mocks.NewMockCartItemsRepository(mockCtrl),
+				repo:     mocks.NewMockCartItemsRepository(mockCtrl),
+				reserver: mocks.NewMockItemReserver(mockCtrl),
 			}
 			tc.mocks(m)
 
-			// 2nd and 3rd parameters are not used in this test
-			svc := NewCartItemsService(m.repo, "http://dummyhost.com", 5*time.Second)
+			svc := NewCartItemsService(m.repo, m.reserver)
 
-			items, getErr := svc.Get(ctx)
+			cart, getErr := svc.Get(ctx, cartId)
 			if tc.want.err != nil {
 				// helps being agnostic with the error message, as it can change and wrongfully break the tests
 				// If an error comprobation is needed, assert.ErrorIs or ErrorAs can be used.
@@ -80,21 +86,11 @@ func Test_GetCartItemsService_GivenCartItemsServiceCreated(t *testing.T) {
 			} else {
 				assert.NoError(t, getErr)
 			}
-			assert.Equal(t, tc.want.items, items)
+			assert.Equal(t, tc.want.cart, cart)
 		})
 	}
 }
 
-// Make sure that the reservation call is correct and has all the needed params
-func checkReservationHttpRequest(t *testing.T, r *http.Request) {
-	assert.Equal(t, r.Method, http.MethodPost)
-	assert.Equal(t, r.URL.Path, "/reserve")
-	assert.Equal(t, r.Header.Get("Content-Type"), "application/json")
-	body, err := io.ReadAll(r.Body)
-	assert.NoError(t, err)
-	assert.Equal(t, `{"version":"1.0.0","item":{"id":"1","name":"potato","quantity":1,"reservationId":""}}`, string(body))
-}
-
 func Test_AddItemsService_GivenCartItemsServiceCreated(t *testing.T) {
 	randomCartItem := model.CartItem{
 		Id:       "1",
@@ -103,107 +99,255 @@ func Test_AddItemsService_GivenCartItemsServiceCreated(t *testing.T) {
 	}
 	randomError := errors.New("random error")
 	ctx := context.Background()
+	expectedVersion := int64(3)
 
-	type input struct {
-		expectReservationCall bool
-		timeout               time.Duration
-		item                  model.CartItem
-	}
 	type want struct {
-		err   error
-		items []model.CartItem
+		err     error
+		version int64
 	}
 	tests := []struct {
-		name                       string
-		in                         input
-		mocks                      func(m cartItemsServiceMocks, c chan<- int)
-		reservationFakeHttpHandler func(t *testing.T, w http.ResponseWriter, r *http.Request, c chan<- int)
-		want                       want
+		name  string
+		mocks func(m cartItemsServiceMocks)
+		want  want
 	}{
 		{
 			name: "WhenAddItemToCartAndFailsToAddToCart_ThenError",
-			in: input{
-				expectReservationCall: false,
-				timeout: 40 * time.Second,
-				item:    randomCartItem,
-			},
-			mocks: func(m cartItemsServiceMocks, c chan<- int) {
-				m.repo.EXPECT().Add(gomock.Any(), randomCartItem).
-					Return(randomError)
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().Add(gomock.Any(), cartId, randomCartItem, &expectedVersion).
+					Return(model.CartItem{}, int64(0), randomError)
 			},
 			want: want{
 				err: randomError,
 			},
 		}, {
-			name: "WhenAddItemToCartAndReserveFails_ThenError",
-			in: input{
-				expectReservationCall: true,
-				timeout: 40 * time.Second,
-				item:    randomCartItem,
+			name: "WhenAddItemToCartAndCartChanged_ThenConflictError",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().Add(gomock.Any(), cartId, randomCartItem, &expectedVersion).
+					Return(model.CartItem{}, int64(0), &model.VersionConflictError{CartId: cartId, Expected: 3, Current: 4})
 			},
-			mocks: func(m cartItemsServiceMocks, c chan<- int) {
-				m.repo.EXPECT().Add(gomock.Any(), randomCartItem).
-					Return(nil)
-				m.repo.EXPECT().SetReservationId(gomock.Any(), gomock.Any(), gomock.Any()).
-					Times(0)
+			want: want{
+				err: &model.VersionConflictError{CartId: cartId, Expected: 3, Current: 4},
 			},
-			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request, c chan<- int) {
-				checkReservationHttpRequest(t, r)
-				w.WriteHeader(http.StatusNotFound) // random error
-				c <- 1
+		}, {
+			// The reservation is written in the outbox by the repo. The service does not call the reserver
+			name: "WhenAddItemToCartAndOK_ThenNewVersionIsReturned",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().Add(gomock.Any(), cartId, randomCartItem, &expectedVersion).
+					Return(randomCartItem, int64(4), nil)
 			},
 			want: want{
-				err: nil,
+				err:     nil,
+				version: 4,
 			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			m := cartItemsServiceMocks{
+				repo:     mocks.NewMockCartItemsRepository(mockCtrl),
+				reserver: mocks.NewMockItemReserver(mockCtrl),
+			}
+			tc.mocks(m)
+
+			// The reserver is not called in this test, as the reservation goes through the outbox
+			svc := NewCartItemsService(m.repo, m.reserver)
+
+			version, addErr := svc.Add(ctx, cartId, randomCartItem, &expectedVersion)
+			if tc.want.err != nil {
+				// helps being agnostic with the error message, as it can change and wrongfully break the tests
+				// If an error comprobation is needed, assert.ErrorIs or ErrorAs can be used.
+				assert.Error(t, addErr)
+			} else {
+				assert.NoError(t, addErr)
+			}
+			// The conflict reaches the handlers as it is, so they can tell the current version to the client
+			var conflict *model.VersionConflictError
+			if errors.As(tc.want.err, &conflict) {
+				assert.Equal(t, tc.want.err, addErr)
+			}
+			assert.Equal(t, tc.want.version, version)
+		})
+	}
+}
+
+// The handler validates the items too, but not every caller goes through it
+func Test_AddItemsService_GivenInvalidItem(t *testing.T) {
+	tests := []struct {
+		name       string
+		item       model.CartItem
+		wantFields []model.FieldError
+	}{
+		{
+			name:       "WhenEmptyId_ThenValidationError",
+			item:       model.CartItem{Name: "potato", Quantity: 1},
+			wantFields: []model.FieldError{{Field: "id", Message: "is required"}},
 		}, {
-			name: "WhenAddItemToCartAndTimesOut_ThenError",
-			in: input{
-				expectReservationCall: true,
-				timeout: 1 * time.Second,
-				item:    randomCartItem,
+			name:       "WhenIdIsNotANumber_ThenValidationError",
+			item:       model.CartItem{Id: "potato", Name: "potato", Quantity: 1},
+			wantFields: []model.FieldError{{Field: "id", Message: "must be a number"}},
+		}, {
+			name:       "WhenNameTooLong_ThenValidationError",
+			item:       model.CartItem{Id: "1", Name: strings.Repeat("a", 51), Quantity: 1},
+			wantFields: []model.FieldError{{Field: "name", Message: "must be at most 50 characters long"}},
+		}, {
+			name:       "WhenZeroQuantity_ThenValidationError",
+			item:       model.CartItem{Id: "1", Quantity: 0},
+			wantFields: []model.FieldError{{Field: "quantity", Message: "must be at least 1"}},
+		}, {
+			name: "WhenQuantityTooBigAndNoId_ThenEveryOneIsReported",
+			item: model.CartItem{Quantity: model.MaxItemQuantity + 1},
+			wantFields: []model.FieldError{
+				{Field: "id", Message: "is required"},
+				{Field: "quantity", Message: "must be at most 1000"},
 			},
-			mocks: func(m cartItemsServiceMocks, c chan<- int) {
-				m.repo.EXPECT().Add(gomock.Any(), randomCartItem).
-					Return(nil)
-				m.repo.EXPECT().SetReservationId(gomock.Any(), gomock.Any(), gomock.Any()).
-					Times(0)
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			repo := mocks.NewMockCartItemsRepository(mockCtrl)
+			repo.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+			svc := NewCartItemsService(repo, mocks.NewMockItemReserver(mockCtrl))
+
+			_, addErr := svc.Add(context.Background(), cartId, tc.item, nil)
+
+			assert.ErrorIs(t, addErr, model.ErrInvalidRequest)
+			var validationErr *model.ValidationError
+			if assert.ErrorAs(t, addErr, &validationErr) {
+				assert.Equal(t, tc.wantFields, validationErr.Fields)
+			}
+		})
+	}
+}
+
+// The caller comes in the context, as put by the authentication middleware
+func Test_CartItemsService_GivenAuthenticatedCaller(t *testing.T) {
+	ctx := model.WithSubject(context.Background(), "alice")
+	item := model.CartItem{Id: "1", Name: "potato", Quantity: 1}
+	randomError := errors.New("random error")
+
+	tests := []struct {
+		name  string
+		mocks func(m cartItemsServiceMocks)
+		call  func(svc *CartItemsService) error
+		want  error
+	}{
+		{
+			name: "WhenGetOwnCart_ThenOK",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, cartId).Return("alice", nil)
+				m.repo.EXPECT().Get(ctx, cartId).Return(model.Cart{}, nil)
 			},
-			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request, c chan<- int) {
-				checkReservationHttpRequest(t, r)
-				
-				// the request will time out and the SetReservationId method will not be called
-				time.Sleep(4 * time.Second)
-				c <- 1
+			call: func(svc *CartItemsService) error {
+				_, getErr := svc.Get(ctx, cartId)
+				return getErr
 			},
-			want: want{
-				err: nil,
+		}, {
+			name: "WhenGetCartWithoutOwner_ThenOK",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, cartId).Return("", nil)
+				m.repo.EXPECT().Get(ctx, cartId).Return(model.Cart{}, nil)
+			},
+			call: func(svc *CartItemsService) error {
+				_, getErr := svc.Get(ctx, cartId)
+				return getErr
 			},
 		}, {
-			name: "WhenAddItemToCartAndOK_ThenReservationIsWrittenInRepo",
-			in: input{
-				expectReservationCall: true,
-				timeout: 3 * time.Second,
-				item:    randomCartItem,
+			name: "WhenGetCartOfSomeoneElse_ThenForbidden",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, cartId).Return("bob", nil)
 			},
-			mocks: func(m cartItemsServiceMocks, c chan<- int) {
-				m.repo.EXPECT().Add(gomock.Any(), randomCartItem).
-					Return(nil)
-				m.repo.EXPECT().SetReservationId(gomock.Any(), gomock.Any(), "fancyReservationId").
-					DoAndReturn(func(ctx context.Context, item model.CartItem, reservationId string) error {
-						c<-1 // channel needs to be fed when setReservationId is called
-						return nil
-					})
+			call: func(svc *CartItemsService) error {
+				_, getErr := svc.Get(ctx, cartId)
+				return getErr
 			},
-			reservationFakeHttpHandler: func(t *testing.T, w http.ResponseWriter, r *http.Request, c chan<- int) {
-				checkReservationHttpRequest(t, r)
-				w.Header().Add("Content-Type", "application/json")
-				w.WriteHeader(http.StatusOK) // random error
-				w.Write([]byte(`{"version":"1.0.0","reservationId":"fancyReservationId"}`))
-							
+			want: model.ErrCartForbidden,
+		}, {
+			name: "WhenGetAndErrorReadingOwner_ThenError",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, cartId).Return("", randomError)
 			},
-			want: want{
-				err: nil,
+			call: func(svc *CartItemsService) error {
+				_, getErr := svc.Get(ctx, cartId)
+				return getErr
+			},
+			want: randomError,
+		}, {
+			name: "WhenAddToUnclaimedCart_ThenItIsClaimedBeforeAdding",
+			mocks: func(m cartItemsServiceMocks) {
+				gomock.InOrder(
+					m.repo.EXPECT().ClaimCart(ctx, cartId, "alice").Return("alice", nil),
+					m.repo.EXPECT().Add(ctx, cartId, item, nil).Return(item, int64(1), nil),
+				)
+			},
+			call: func(svc *CartItemsService) error {
+				_, addErr := svc.Add(ctx, cartId, item, nil)
+				return addErr
+			},
+		}, {
+			name: "WhenAddToCartOfSomeoneElse_ThenForbiddenAndNothingIsAdded",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().ClaimCart(ctx, cartId, "alice").Return("bob", nil)
 			},
+			call: func(svc *CartItemsService) error {
+				_, addErr := svc.Add(ctx, cartId, item, nil)
+				return addErr
+			},
+			want: model.ErrCartForbidden,
+		}, {
+			name: "WhenAddAndClaimFails_ThenError",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().ClaimCart(ctx, cartId, "alice").Return("", randomError)
+			},
+			call: func(svc *CartItemsService) error {
+				_, addErr := svc.Add(ctx, cartId, item, nil)
+				return addErr
+			},
+			want: randomError,
+		}, {
+			name: "WhenRemoveFromCartOfSomeoneElse_ThenForbidden",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, cartId).Return("bob", nil)
+			},
+			call: func(svc *CartItemsService) error {
+				_, removeErr := svc.Remove(ctx, cartId, "1", nil)
+				return removeErr
+			},
+			want: model.ErrCartForbidden,
+		}, {
+			name: "WhenRemoveFromOwnCart_ThenOK",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, cartId).Return("alice", nil)
+				m.repo.EXPECT().Remove(ctx, cartId, "1", nil).Return(item, int64(2), nil)
+			},
+			call: func(svc *CartItemsService) error {
+				_, removeErr := svc.Remove(ctx, cartId, "1", nil)
+				return removeErr
+			},
+		}, {
+			name: "WhenUpdateQuantityInCartOfSomeoneElse_ThenForbidden",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, cartId).Return("bob", nil)
+			},
+			call: func(svc *CartItemsService) error {
+				_, updateErr := svc.UpdateQuantity(ctx, cartId, "1", 3, nil)
+				return updateErr
+			},
+			want: model.ErrCartForbidden,
+		}, {
+			name: "WhenUpdateQuantityToZeroInCartOfSomeoneElse_ThenForbidden",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, cartId).Return("bob", nil)
+			},
+			call: func(svc *CartItemsService) error {
+				_, updateErr := svc.UpdateQuantity(ctx, cartId, "1", 0, nil)
+				return updateErr
+			},
+			want: model.ErrCartForbidden,
 		},
 	}
 	for _, tc := range tests {
@@ -211,42 +355,856 @@ func Test_AddItemsService_GivenCartItemsServiceCreated(t *testing.T) {
 			mockCtrl := gomock.NewController(t)
 			defer mockCtrl.Finish()
 			m := cartItemsServiceMocks{
-				repo: mocks.NewMockCartItemsRepository(mockCtrl),
+				repo:     mocks.NewMockCartItemsRepository(mockCtrl),
+				reserver: mocks.NewMockItemReserver(mockCtrl),
+			}
+			tc.mocks(m)
+
+			svc := NewCartItemsService(m.repo, m.reserver)
+
+			callErr := tc.call(svc)
+			if tc.want != nil {
+				assert.ErrorIs(t, callErr, tc.want)
+			} else {
+				assert.NoError(t, callErr)
 			}
+		})
+	}
+}
 
-			done := make(chan int)
-			tc.mocks(m, done)
+func Test_MergeService_GivenCartItemsServiceCreated(t *testing.T) {
+	const guestCartId = "0d4d2e7e-0a37-4f4b-9c57-5b9a2ecf3a11"
+	anonymous := context.Background()
+	// Alice logged in after filling the guest cart as guest-1
+	alice := model.WithGuest(model.WithSubject(context.Background(), "alice"), "guest-1")
+	// Still browsing as a guest, before logging in
+	guest1 := model.WithGuest(context.Background(), "guest-1")
+	merged := model.Cart{Version: 3, Items: []model.CartItem{{Id: "1", Name: "potato", Quantity: 2}}}
+	randomError := errors.New("random error")
 
-			// http test to mock reservation server
-			reservationFakeHttpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				tc.reservationFakeHttpHandler(t, w, r, done)
-			}))
-			defer reservationFakeHttpServer.Close()
-			reservationHost := reservationFakeHttpServer.URL
+	type want struct {
+		cart model.Cart
+		err  error
+	}
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		guestId string
+		mocks   func(ctx context.Context, m cartItemsServiceMocks)
+		want    want
+	}{
+		{
+			name:    "WhenSameCart_ThenSameCartError",
+			ctx:     alice,
+			guestId: cartId,
+			mocks:   func(ctx context.Context, m cartItemsServiceMocks) {},
+			want:    want{err: model.ErrSameCart},
+		}, {
+			name:    "WhenNotAuthenticated_ThenMergedWithoutChecks",
+			ctx:     anonymous,
+			guestId: guestCartId,
+			mocks: func(ctx context.Context, m cartItemsServiceMocks) {
+				m.repo.EXPECT().Merge(ctx, guestCartId, cartId, nil).Return(merged, nil)
+			},
+			want: want{cart: merged},
+		}, {
+			name:    "WhenGuestCartOfTheCallerGuest_ThenCartIsClaimedAndMerged",
+			ctx:     alice,
+			guestId: guestCartId,
+			mocks: func(ctx context.Context, m cartItemsServiceMocks) {
+				gomock.InOrder(
+					m.repo.EXPECT().CartOwner(ctx, guestCartId).Return("guest-1", nil),
+					m.repo.EXPECT().ClaimCart(ctx, cartId, "alice").Return("alice", nil),
+					m.repo.EXPECT().Merge(ctx, guestCartId, cartId, nil).Return(merged, nil),
+				)
+			},
+			want: want{cart: merged},
+		}, {
+			name:    "WhenGuestCartOfTheCaller_ThenMerged",
+			ctx:     alice,
+			guestId: guestCartId,
+			mocks: func(ctx context.Context, m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, guestCartId).Return("alice", nil)
+				m.repo.EXPECT().ClaimCart(ctx, cartId, "alice").Return("alice", nil)
+				m.repo.EXPECT().Merge(ctx, guestCartId, cartId, nil).Return(merged, nil)
+			},
+			want: want{cart: merged},
+		}, {
+			name:    "WhenGuestCartOfAnotherGuest_ThenForbidden",
+			ctx:     alice,
+			guestId: guestCartId,
+			mocks: func(ctx context.Context, m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, guestCartId).Return("guest-2", nil)
+			},
+			want: want{err: model.ErrCartForbidden},
+		}, {
+			name:    "WhenCartOfSomeoneElse_ThenForbiddenAndNothingIsMerged",
+			ctx:     alice,
+			guestId: guestCartId,
+			mocks: func(ctx context.Context, m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, guestCartId).Return("guest-1", nil)
+				m.repo.EXPECT().ClaimCart(ctx, cartId, "alice").Return("bob", nil)
+			},
+			want: want{err: model.ErrCartForbidden},
+		}, {
+			name:    "WhenErrorReadingOwner_ThenError",
+			ctx:     alice,
+			guestId: guestCartId,
+			mocks: func(ctx context.Context, m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, guestCartId).Return("", randomError)
+			},
+			want: want{err: randomError},
+		}, {
+			name:    "WhenGuestCartNotFound_ThenCartNotFound",
+			ctx:     alice,
+			guestId: guestCartId,
+			mocks: func(ctx context.Context, m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, guestCartId).Return("", nil)
+				m.repo.EXPECT().Get(ctx, guestCartId).Return(model.Cart{}, nil)
+			},
+			want: want{err: model.ErrCartNotFound},
+		}, {
+			name:    "WhenGuestCartWithoutOwner_ThenForbiddenAndNothingIsMerged",
+			ctx:     alice,
+			guestId: guestCartId,
+			mocks: func(ctx context.Context, m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, guestCartId).Return("", nil)
+				m.repo.EXPECT().Get(ctx, guestCartId).Return(merged, nil)
+			},
+			want: want{err: model.ErrCartForbidden},
+		}, {
+			name:    "WhenErrorReadingGuestCartWithoutOwner_ThenError",
+			ctx:     alice,
+			guestId: guestCartId,
+			mocks: func(ctx context.Context, m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, guestCartId).Return("", nil)
+				m.repo.EXPECT().Get(ctx, guestCartId).Return(model.Cart{}, randomError)
+			},
+			want: want{err: randomError},
+		}, {
+			name:    "WhenOnlyGuestAndCartOfAnotherGuest_ThenForbidden",
+			ctx:     guest1,
+			guestId: guestCartId,
+			mocks: func(ctx context.Context, m cartItemsServiceMocks) {
+				m.repo.EXPECT().CartOwner(ctx, guestCartId).Return("guest-2", nil)
+			},
+			want: want{err: model.ErrCartForbidden},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			m := cartItemsServiceMocks{
+				repo:     mocks.NewMockCartItemsRepository(mockCtrl),
+				reserver: mocks.NewMockItemReserver(mockCtrl),
+			}
+			tc.mocks(tc.ctx, m)
 
-			// 2nd and 3rd parameters are not used in this test
-			svc := NewCartItemsService(m.repo, reservationHost, tc.in.timeout)
+			svc := NewCartItemsService(m.repo, m.reserver)
 
-			addErr := svc.Add(ctx, tc.in.item)
+			cart, mergeErr := svc.Merge(tc.ctx, tc.guestId, cartId, nil)
 			if tc.want.err != nil {
-				// helps being agnostic with the error message, as it can change and wrongfully break the tests
-				// If an error comprobation is needed, assert.ErrorIs or ErrorAs can be used.
-				assert.Error(t, addErr)
+				assert.ErrorIs(t, mergeErr, tc.want.err)
 			} else {
-				assert.NoError(t, addErr)
+				assert.NoError(t, mergeErr)
+			}
+			assert.Equal(t, tc.want.cart, cart)
+		})
+	}
+}
+
+func Test_RemoveItemService_GivenCartItemsServiceCreated(t *testing.T) {
+	randomError := errors.New("random error")
+	ctx := context.Background()
+	itemId := "1"
+
+	type want struct {
+		err     error
+		version int64
+	}
+	tests := []struct {
+		name  string
+		mocks func(m cartItemsServiceMocks)
+		want  want
+	}{
+		{
+			name: "WhenRemoveItemAndRepoFails_ThenError",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().Remove(gomock.Any(), cartId, itemId, nil).
+					Return(model.CartItem{}, int64(0), randomError)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenRemoveItemAndOK_ThenNewVersionIsReturned",
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().Remove(gomock.Any(), cartId, itemId, nil).
+					Return(model.CartItem{Id: itemId, Name: "potato", Quantity: 1, ReservationId: "fancyReservationId", ReservedQuantity: 1}, int64(2), nil)
+			},
+			want: want{
+				err:     nil,
+				version: 2,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			m := cartItemsServiceMocks{
+				repo:     mocks.NewMockCartItemsRepository(mockCtrl),
+				reserver: mocks.NewMockItemReserver(mockCtrl),
 			}
+			tc.mocks(m)
+
+			// The reserver is not called in this test, as the reservation goes through the outbox
+			svc := NewCartItemsService(m.repo, m.reserver)
 
-			// we check with the channel that the http call has been made. 
-			// As it is run in a goroutine, most probably, the funcion will return before the call is even made
-			if tc.in.expectReservationCall {
-				select {
-				case <-done:
-					// Successfully received the http call to the reserve endpoint
-				case <-time.After(10 * time.Second):
-					t.Error("Timed out waiting for goroutine to finish")
-				}
+			version, removeErr := svc.Remove(ctx, cartId, itemId, nil)
+			if tc.want.err != nil {
+				assert.Error(t, removeErr)
+			} else {
+				assert.NoError(t, removeErr)
 			}
+			assert.Equal(t, tc.want.version, version)
+		})
+	}
+}
+
+func Test_UpdateQuantityService_GivenCartItemsServiceCreated(t *testing.T) {
+	randomError := errors.New("random error")
+	ctx := context.Background()
+	itemId := "1"
+	expectedVersion := int64(3)
 
+	type input struct {
+		quantity int
+	}
+	type want struct {
+		err     error
+		version int64
+	}
+	tests := []struct {
+		name  string
+		in    input
+		mocks func(m cartItemsServiceMocks)
+		want  want
+	}{
+		{
+			name: "WhenUpdateWithNegativeQuantity_ThenInvalidQuantityError",
+			in: input{
+				quantity: -1,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().UpdateQuantity(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				err: model.ErrInvalidQuantity,
+			},
+		}, {
+			name: "WhenUpdateWithTooBigQuantity_ThenInvalidQuantityError",
+			in: input{
+				quantity: model.MaxItemQuantity + 1,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().UpdateQuantity(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				err: model.ErrInvalidQuantity,
+			},
+		}, {
+			// The removal is done with the same expected version
+			name: "WhenUpdateWithZeroQuantity_ThenItemIsRemoved",
+			in: input{
+				quantity: 0,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().Remove(gomock.Any(), cartId, itemId, &expectedVersion).
+					Return(model.CartItem{Id: itemId, Quantity: 3}, int64(4), nil)
+			},
+			want: want{
+				err:     nil,
+				version: 4,
+			},
+		}, {
+			name: "WhenUpdateAndRepoFails_ThenError",
+			in: input{
+				quantity: 3,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().UpdateQuantity(gomock.Any(), cartId, itemId, 3, &expectedVersion).
+					Return(model.CartItem{}, int64(0), randomError)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenUpdateAndOK_ThenOK",
+			in: input{
+				quantity: 3,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().UpdateQuantity(gomock.Any(), cartId, itemId, 3, &expectedVersion).
+					Return(model.CartItem{Id: itemId, Quantity: 3, ReservationId: "reservationId", ReservedQuantity: 1}, int64(4), nil)
+			},
+			want: want{
+				err:     nil,
+				version: 4,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			m := cartItemsServiceMocks{
+				repo:     mocks.NewMockCartItemsRepository(mockCtrl),
+				reserver: mocks.NewMockItemReserver(mockCtrl),
+			}
+			tc.mocks(m)
+
+			// The reserver is not called in this test, as the reservation goes through the outbox
+			svc := NewCartItemsService(m.repo, m.reserver)
+
+			version, updateErr := svc.UpdateQuantity(ctx, cartId, itemId, tc.in.quantity, &expectedVersion)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, updateErr, tc.want.err)
+			} else {
+				assert.NoError(t, updateErr)
+			}
+			assert.Equal(t, tc.want.version, version)
+		})
+	}
+}
+
+func Test_ReserveItemService_GivenCartItemsServiceCreated(t *testing.T) {
+	randomCartItem := model.CartItem{
+		Id:       "1",
+		Name:     "potato",
+		Quantity: 1,
+	}
+	// The item was already in the cart, so the quantities have been merged
+	reservedCartItem := model.CartItem{Id: "1", Name: "potato", Quantity: 3, ReservationId: "oldReservationId", ReservedQuantity: 2}
+	randomError := errors.New("random error")
+	ctx := context.Background()
+
+	type input struct {
+		item model.CartItem
+	}
+	type want struct {
+		err    error
+		result string
+	}
+	tests := []struct {
+		name  string
+		in    input
+		mocks func(m cartItemsServiceMocks)
+		want  want
+	}{
+		{
+			name: "WhenReserveAndReserverFails_ThenFailureIsWrittenInRepoAndError",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Reserve(gomock.Any(), cartId, randomCartItem).
+					Return("", randomError)
+				m.repo.EXPECT().SetReservationFailed(gomock.Any(), cartId, randomCartItem.Id, "reservation rejected").
+					Return(nil)
+				m.repo.EXPECT().SetReservationId(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				err:    randomError,
+				result: reservationFailed,
+			},
+		}, {
+			name: "WhenReserveAndStoringTheFailureFails_ThenReserverError",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Reserve(gomock.Any(), cartId, randomCartItem).
+					Return("", randomError)
+				m.repo.EXPECT().SetReservationFailed(gomock.Any(), cartId, randomCartItem.Id, "reservation rejected").
+					Return(errors.New("db down"))
+			},
+			want: want{
+				err:    randomError,
+				result: reservationFailed,
+			},
+		}, {
+			name: "WhenReserveAndReserverUnavailable_ThenReasonDoesNotExposeTheDetails",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Reserve(gomock.Any(), cartId, randomCartItem).
+					Return("", fmt.Errorf("Post http://reserver.internal/reserve --> %w", model.ErrReserverUnavailable))
+				m.repo.EXPECT().SetReservationFailed(gomock.Any(), cartId, randomCartItem.Id, "reserver unavailable").
+					Return(nil)
+			},
+			want: want{
+				err:    model.ErrReserverUnavailable,
+				result: reservationFailed,
+			},
+		}, {
+			name: "WhenReserveAndCircuitOpen_ThenNothingIsWrittenInRepo",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Reserve(gomock.Any(), cartId, randomCartItem).
+					Return("", model.ErrCircuitOpen)
+				m.repo.EXPECT().SetReservationFailed(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				err:    model.ErrCircuitOpen,
+				result: reservationShortCircuited,
+			},
+		}, {
+			name: "WhenReserveAndReserverAnswersAsynchronously_ThenNothingIsWrittenInRepo",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Reserve(gomock.Any(), cartId, randomCartItem).
+					Return("", nil)
+				m.repo.EXPECT().SetReservationId(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				err:    nil,
+				result: reservationSucceeded,
+			},
+		}, {
+			name: "WhenReserveAndOK_ThenReservationIsWrittenInRepo",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Reserve(gomock.Any(), cartId, randomCartItem).
+					Return("fancyReservationId", nil)
+				m.repo.EXPECT().SetReservationId(gomock.Any(), cartId, randomCartItem, "fancyReservationId").
+					Return(nil)
+			},
+			want: want{
+				err:    nil,
+				result: reservationSucceeded,
+			},
+		}, {
+			name: "WhenReserveItemAlreadyReservedAndReserverAdjustsIt_ThenNewQuantityIsWrittenInRepo",
+			in: input{
+				item: reservedCartItem,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				// the existing reservation is sent, so the reserver can adjust it
+				m.reserver.EXPECT().Reserve(gomock.Any(), cartId, reservedCartItem).
+					Return("oldReservationId", nil)
+				m.repo.EXPECT().SetReservationId(gomock.Any(), cartId, reservedCartItem, "oldReservationId").
+					Return(nil)
+				m.reserver.EXPECT().Release(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				err:    nil,
+				result: reservationSucceeded,
+			},
+		}, {
+			name: "WhenReserveItemAlreadyReservedAndReserverReplacesIt_ThenOldReservationIsReleased",
+			in: input{
+				item: reservedCartItem,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Reserve(gomock.Any(), cartId, reservedCartItem).
+					Return("newReservationId", nil)
+				m.repo.EXPECT().SetReservationId(gomock.Any(), cartId, reservedCartItem, "newReservationId").
+					Return(nil)
+				m.reserver.EXPECT().Release(gomock.Any(), cartId, reservedCartItem).
+					Return(nil)
+			},
+			want: want{
+				err:    nil,
+				result: reservationSucceeded,
+			},
+		}, {
+			name: "WhenReserveAndReleasingTheReplacedReservationFails_ThenOK",
+			in: input{
+				item: reservedCartItem,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Reserve(gomock.Any(), cartId, reservedCartItem).
+					Return("newReservationId", nil)
+				m.repo.EXPECT().SetReservationId(gomock.Any(), cartId, reservedCartItem, "newReservationId").
+					Return(nil)
+				m.reserver.EXPECT().Release(gomock.Any(), cartId, reservedCartItem).
+					Return(randomError)
+			},
+			want: want{
+				err:    nil,
+				result: reservationSucceeded,
+			},
+		}, {
+			name: "WhenReserveAndItemRemovedInTheMeantime_ThenNewReservationIsReleased",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Reserve(gomock.Any(), cartId, randomCartItem).
+					Return("fancyReservationId", nil)
+				m.repo.EXPECT().SetReservationId(gomock.Any(), cartId, randomCartItem, "fancyReservationId").
+					Return(randomError)
+				m.repo.EXPECT().GetItem(gomock.Any(), cartId, randomCartItem.Id).
+					Return(model.CartItem{}, model.ErrItemNotFound)
+				m.reserver.EXPECT().Release(gomock.Any(), cartId,
+					model.CartItem{Id: "1", Name: "potato", Quantity: 1, ReservationId: "fancyReservationId"}).
+					Return(nil)
+			},
+			want: want{
+				err:    nil,
+				result: reservationSucceeded,
+			},
+		}, {
+			name: "WhenReserveAndStoringReservationFails_ThenError",
+			in: input{
+				item: randomCartItem,
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Reserve(gomock.Any(), cartId, randomCartItem).
+					Return("fancyReservationId", nil)
+				m.repo.EXPECT().SetReservationId(gomock.Any(), cartId, randomCartItem, "fancyReservationId").
+					Return(randomError)
+				m.repo.EXPECT().GetItem(gomock.Any(), cartId, randomCartItem.Id).
+					Return(randomCartItem, nil)
+			},
+			want: want{
+				err:    randomError,
+				result: reservationFailed,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			m := cartItemsServiceMocks{
+				repo:     mocks.NewMockCartItemsRepository(mockCtrl),
+				reserver: mocks.NewMockItemReserver(mockCtrl),
+			}
+			tc.mocks(m)
+
+			svc := NewCartItemsService(m.repo, m.reserver)
+			// The metrics are global, so only the difference is checked
+			reservations := reservationMetrics.reservations.WithLabelValues(tc.want.result)
+			before := testutil.ToFloat64(reservations)
+
+			reserveErr := svc.ReserveItem(ctx, cartId, tc.in.item)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, reserveErr, tc.want.err)
+			} else {
+				assert.NoError(t, reserveErr)
+			}
+			assert.Equal(t, before+1, testutil.ToFloat64(reservations))
+		})
+	}
+}
+
+func Test_ProcessReservationTaskService_GivenCartItemsServiceCreated(t *testing.T) {
+	randomError := errors.New("random error")
+	ctx := context.Background()
+	pendingItem := model.CartItem{Id: "1", Name: "potato", Quantity: 2}
+	reservedItem := model.CartItem{Id: "1", Name: "potato", Quantity: 2, ReservationId: "fancyReservationId", ReservedQuantity: 2}
+
+	type input struct {
+		task model.ReservationTask
+	}
+	type want struct {
+		err error
+	}
+	tests := []struct {
+		name  string
+		in    input
+		mocks func(m cartItemsServiceMocks)
+		want  want
+	}{
+		{
+			name: "WhenReserveTaskAndItemRemoved_ThenNothingIsReserved",
+			in: input{
+				task: model.NewReserveTask(cartId, pendingItem),
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().GetItem(gomock.Any(), cartId, pendingItem.Id).
+					Return(model.CartItem{}, model.ErrItemNotFound)
+				m.reserver.EXPECT().Reserve(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				err: nil,
+			},
+		}, {
+			name: "WhenReserveTaskAndErrorReadingItem_ThenError",
+			in: input{
+				task: model.NewReserveTask(cartId, pendingItem),
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().GetItem(gomock.Any(), cartId, pendingItem.Id).
+					Return(model.CartItem{}, randomError)
+				m.reserver.EXPECT().Reserve(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenReserveTaskAndItemAlreadyCovered_ThenNothingIsReserved",
+			in: input{
+				task: model.NewReserveTask(cartId, pendingItem),
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().GetItem(gomock.Any(), cartId, pendingItem.Id).
+					Return(reservedItem, nil)
+				m.reserver.EXPECT().Reserve(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				err: nil,
+			},
+		}, {
+			name: "WhenReserveTaskAndItemNeedsReservation_ThenCurrentItemIsReserved",
+			in: input{
+				// The snapshot is outdated. The current quantity is reserved
+				task: model.NewReserveTask(cartId, model.CartItem{Id: "1", Name: "potato", Quantity: 1}),
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().GetItem(gomock.Any(), cartId, pendingItem.Id).
+					Return(pendingItem, nil)
+				m.reserver.EXPECT().Reserve(gomock.Any(), cartId, pendingItem).
+					Return("fancyReservationId", nil)
+				m.repo.EXPECT().SetReservationId(gomock.Any(), cartId, pendingItem, "fancyReservationId").
+					Return(nil)
+			},
+			want: want{
+				err: nil,
+			},
+		}, {
+			name: "WhenReleaseTask_ThenSnapshotIsReleased",
+			in: input{
+				task: model.NewReleaseTask(cartId, reservedItem),
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Release(gomock.Any(), cartId, reservedItem).
+					Return(nil)
+				// Removed items are not in the repo anymore
+				m.repo.EXPECT().SetReservationReleased(gomock.Any(), cartId, reservedItem.Id, reservedItem.ReservationId).
+					Return(fmt.Errorf("wrapped --> %w", model.ErrItemNotFound))
+			},
+			want: want{
+				err: nil,
+			},
+		}, {
+			name: "WhenReleaseTaskAndItemStillHoldsTheReservation_ThenItIsMarkedAsReleased",
+			in: input{
+				task: model.NewReleaseTask(cartId, reservedItem),
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Release(gomock.Any(), cartId, reservedItem).
+					Return(nil)
+				m.repo.EXPECT().SetReservationReleased(gomock.Any(), cartId, reservedItem.Id, reservedItem.ReservationId).
+					Return(nil)
+			},
+			want: want{
+				err: nil,
+			},
+		}, {
+			name: "WhenReleaseTaskAndReserverFails_ThenError",
+			in: input{
+				task: model.NewReleaseTask(cartId, reservedItem),
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.reserver.EXPECT().Release(gomock.Any(), cartId, reservedItem).
+					Return(randomError)
+				m.repo.EXPECT().SetReservationReleased(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenUnknownOperation_ThenError",
+			in: input{
+				task: model.ReservationTask{CartId: cartId, Operation: "unknown", Item: reservedItem},
+			},
+			mocks: func(m cartItemsServiceMocks) {},
+			want: want{
+				err: randomError,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			m := cartItemsServiceMocks{
+				repo:     mocks.NewMockCartItemsRepository(mockCtrl),
+				reserver: mocks.NewMockItemReserver(mockCtrl),
+			}
+			tc.mocks(m)
+
+			svc := NewCartItemsService(m.repo, m.reserver)
+
+			processErr := svc.ProcessReservationTask(ctx, tc.in.task)
+			if tc.want.err != nil {
+				assert.Error(t, processErr)
+			} else {
+				assert.NoError(t, processErr)
+			}
+		})
+	}
+}
+
+func Test_CompleteReservationService_GivenCartItemsServiceCreated(t *testing.T) {
+	randomError := errors.New("random error")
+	ctx := context.Background()
+	pendingItem := model.CartItem{Id: "1", Name: "potato", Quantity: 2}
+	reservedItem := model.CartItem{Id: "1", Name: "potato", Quantity: 2, ReservationId: "oldReservationId", ReservedQuantity: 1}
+
+	type input struct {
+		callback model.ReservationCallback
+	}
+	type want struct {
+		err error
+	}
+	tests := []struct {
+		name  string
+		in    input
+		mocks func(m cartItemsServiceMocks)
+		want  want
+	}{
+		{
+			name: "WhenCallbackWithoutReservationNorFailure_ThenInvalidCallbackError",
+			in: input{
+				callback: model.ReservationCallback{CartId: cartId, ItemId: "1"},
+			},
+			mocks: func(m cartItemsServiceMocks) {},
+			want: want{
+				err: model.ErrInvalidReservationCallback,
+			},
+		}, {
+			name: "WhenCallbackWithReservationAndFailure_ThenInvalidCallbackError",
+			in: input{
+				callback: model.ReservationCallback{CartId: cartId, ItemId: "1", ReservationId: "fancyReservationId", FailureReason: "out of stock"},
+			},
+			mocks: func(m cartItemsServiceMocks) {},
+			want: want{
+				err: model.ErrInvalidReservationCallback,
+			},
+		}, {
+			name: "WhenCallbackAndErrorReadingItem_ThenError",
+			in: input{
+				callback: model.ReservationCallback{CartId: cartId, ItemId: "1", ReservationId: "fancyReservationId"},
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().GetItem(gomock.Any(), cartId, "1").
+					Return(model.CartItem{}, randomError)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenReservedCallbackAndItemRemoved_ThenReservationIsReleased",
+			in: input{
+				callback: model.ReservationCallback{CartId: cartId, ItemId: "1", ReservationId: "fancyReservationId"},
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().GetItem(gomock.Any(), cartId, "1").
+					Return(model.CartItem{}, model.ErrItemNotFound)
+				m.reserver.EXPECT().Release(gomock.Any(), cartId, model.CartItem{Id: "1", ReservationId: "fancyReservationId"}).
+					Return(nil)
+			},
+			want: want{
+				err: nil,
+			},
+		}, {
+			name: "WhenFailedCallbackAndItemRemoved_ThenNothingToDo",
+			in: input{
+				callback: model.ReservationCallback{CartId: cartId, ItemId: "1", FailureReason: "out of stock"},
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().GetItem(gomock.Any(), cartId, "1").
+					Return(model.CartItem{}, model.ErrItemNotFound)
+			},
+			want: want{
+				err: nil,
+			},
+		}, {
+			name: "WhenFailedCallback_ThenFailureIsWrittenInRepo",
+			in: input{
+				callback: model.ReservationCallback{CartId: cartId, ItemId: "1", FailureReason: "out of stock"},
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().GetItem(gomock.Any(), cartId, "1").
+					Return(pendingItem, nil)
+				m.repo.EXPECT().SetReservationFailed(gomock.Any(), cartId, "1", "out of stock").
+					Return(nil)
+			},
+			want: want{
+				err: nil,
+			},
+		}, {
+			name: "WhenReservedCallbackWithQuantity_ThenReservedQuantityIsTheCallbackOne",
+			in: input{
+				callback: model.ReservationCallback{CartId: cartId, ItemId: "1", ReservationId: "fancyReservationId", Quantity: 1},
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().GetItem(gomock.Any(), cartId, "1").
+					Return(pendingItem, nil)
+				m.repo.EXPECT().SetReservationId(gomock.Any(), cartId, model.CartItem{Id: "1", Name: "potato", Quantity: 1}, "fancyReservationId").
+					Return(nil)
+			},
+			want: want{
+				err: nil,
+			},
+		}, {
+			name: "WhenReservedCallbackReplacesReservation_ThenOldOneIsReleased",
+			in: input{
+				callback: model.ReservationCallback{CartId: cartId, ItemId: "1", ReservationId: "newReservationId"},
+			},
+			mocks: func(m cartItemsServiceMocks) {
+				m.repo.EXPECT().GetItem(gomock.Any(), cartId, "1").
+					Return(reservedItem, nil)
+				m.repo.EXPECT().SetReservationId(gomock.Any(), cartId, reservedItem, "newReservationId").
+					Return(nil)
+				m.reserver.EXPECT().Release(gomock.Any(), cartId, reservedItem).
+					Return(nil)
+			},
+			want: want{
+				err: nil,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			m := cartItemsServiceMocks{
+				repo:     mocks.NewMockCartItemsRepository(mockCtrl),
+				reserver: mocks.NewMockItemReserver(mockCtrl),
+			}
+			tc.mocks(m)
+
+			svc := NewCartItemsService(m.repo, m.reserver)
+
+			completeErr := svc.CompleteReservation(ctx, tc.in.callback)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, completeErr, tc.want.err)
+			} else {
+				assert.NoError(t, completeErr)
+			}
 		})
 	}
 }
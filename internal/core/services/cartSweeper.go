@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/rs/zerolog/log"
+)
+
+type CartSweeperConfig struct {
+	// Carts not changed during this time are abandoned
+	TTL time.Duration
+	// How often the abandoned carts are looked for
+	Interval time.Duration
+	// Carts deleted in every transaction, so the carts are not locked for too long
+	BatchSize int
+}
+
+// Deletes the abandoned carts in background. The repository writes the release of their reservations and the
+// abandoned cart events in the outboxes, so the reservation dispatcher gives the stock back to the reserver and the
+// cart events dispatcher tells marketing about every cart that had items
+type CartSweeper struct {
+	repo   ports.CartItemsRepository
+	config CartSweeperConfig
+}
+
+func NewCartSweeper(repo ports.CartItemsRepository, config CartSweeperConfig) *CartSweeper {
+	return &CartSweeper{
+		repo:   repo,
+		config: config,
+	}
+}
+
+// Deletes every cart abandoned by now, a batch at a time. Returns how many carts have been deleted
+func (cs *CartSweeper) Sweep(ctx context.Context) (int, error) {
+	idleSince := time.Now().UTC().Add(-cs.config.TTL)
+
+	expired := 0
+	for {
+		carts, expireErr := cs.repo.ExpireCarts(ctx, idleSince, cs.config.BatchSize)
+		if expireErr != nil {
+			return expired, fmt.Errorf("expiring carts not changed since %s --> %w", idleSince, expireErr)
+		}
+		expired += len(carts)
+
+		// A batch that is not full means that there are no more abandoned carts
+		if len(carts) < cs.config.BatchSize {
+			return expired, nil
+		}
+	}
+}
+
+// Sweeps every Interval. Blocks until the context is done
+func (cs *CartSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(cs.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, sweepErr := cs.Sweep(ctx)
+			if sweepErr != nil {
+				log.
+					Error().
+					Err(sweepErr).
+					Msg("while expiring abandoned carts")
+			}
+			if expired > 0 {
+				log.
+					Info().
+					Int("expired", expired).
+					Msg("abandoned carts expired")
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/mocks"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+var sweeperConfig = CartSweeperConfig{TTL: time.Hour, Interval: time.Minute, BatchSize: 2}
+
+// Matches the idle time of a sweep started right now, give or take a few seconds
+func idleSinceTTL() gomock.Matcher {
+	return gomock.Cond(func(x any) bool {
+		idleSince, ok := x.(time.Time)
+		expected := time.Now().UTC().Add(-sweeperConfig.TTL)
+		return ok && !idleSince.After(expected) && idleSince.After(expected.Add(-5*time.Second))
+	})
+}
+
+func Test_Sweep_GivenCartSweeperCreated(t *testing.T) {
+	ctx := context.Background()
+	randomError := errors.New("random error")
+
+	abandoned := func(cartId string, items ...model.CartItem) model.AbandonedCart {
+		return model.AbandonedCart{CartId: cartId, OwnerId: "alice", Items: items}
+	}
+	item := model.CartItem{Id: "1", Name: "jacket", Quantity: 1, ReservationId: "r1"}
+
+	type want struct {
+		err     error
+		expired int
+	}
+	tests := []struct {
+		name  string
+		mocks func(repo *mocks.MockCartItemsRepository)
+		want  want
+	}{
+		{
+			name: "WhenNoAbandonedCarts_ThenNothingIsExpired",
+			mocks: func(repo *mocks.MockCartItemsRepository) {
+				repo.EXPECT().ExpireCarts(ctx, idleSinceTTL(), 2).Return(nil, nil)
+			},
+		}, {
+			name: "WhenFullBatch_ThenNextBatchIsExpiredUntilOneIsNotFull",
+			mocks: func(repo *mocks.MockCartItemsRepository) {
+				gomock.InOrder(
+					repo.EXPECT().ExpireCarts(ctx, idleSinceTTL(), 2).
+						Return([]model.AbandonedCart{abandoned("c1", item), abandoned("c2", item)}, nil),
+					repo.EXPECT().ExpireCarts(ctx, idleSinceTTL(), 2).
+						Return([]model.AbandonedCart{abandoned("c3", item)}, nil),
+				)
+			},
+			want: want{expired: 3},
+		}, {
+			name: "WhenExpireFails_ThenErrorAndTheCartsExpiredSoFar",
+			mocks: func(repo *mocks.MockCartItemsRepository) {
+				gomock.InOrder(
+					repo.EXPECT().ExpireCarts(ctx, idleSinceTTL(), 2).
+						Return([]model.AbandonedCart{abandoned("c1", item), abandoned("c2", item)}, nil),
+					repo.EXPECT().ExpireCarts(ctx, idleSinceTTL(), 2).Return(nil, randomError),
+				)
+			},
+			want: want{err: randomError, expired: 2},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			repo := mocks.NewMockCartItemsRepository(mockCtrl)
+			tc.mocks(repo)
+
+			sweeper := NewCartSweeper(repo, sweeperConfig)
+
+			expired, sweepErr := sweeper.Sweep(ctx)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, sweepErr, tc.want.err)
+			} else {
+				assert.NoError(t, sweepErr)
+			}
+			assert.Equal(t, tc.want.expired, expired)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/rs/zerolog/log"
+)
+
+type IdempotencyServiceConfig struct {
+	// Time the response is kept for the retries
+	TTL time.Duration
+	// Time a key is kept while its first request is being processed. If the service stops in the meantime, the
+	// key is released once the lease expires. Must be longer than the slowest request
+	Lease time.Duration
+	// How often the expired keys are deleted
+	PurgeInterval time.Duration
+}
+
+type IdempotencyService struct {
+	repo   ports.IdempotencyKeysRepository
+	config IdempotencyServiceConfig
+}
+
+func NewIdempotencyService(repo ports.IdempotencyKeysRepository, config IdempotencyServiceConfig) *IdempotencyService {
+	return &IdempotencyService{
+		repo:   repo,
+		config: config,
+	}
+}
+
+func (is *IdempotencyService) Start(ctx context.Context, key string, requestHash string) (*model.IdempotentResponse, error) {
+	stored, claimed, claimErr := is.repo.Claim(ctx, model.IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().UTC().Add(is.config.Lease),
+	})
+	if claimErr != nil {
+		return nil, fmt.Errorf("claiming idempotency key --> %w", claimErr)
+	}
+	if claimed {
+		return nil, nil
+	}
+
+	// Same key, different request. Checked first, so the client learns about the mistake even while the first
+	// request is still running
+	if stored.RequestHash != requestHash {
+		return nil, fmt.Errorf("idempotency key %s --> %w", key, model.ErrIdempotencyKeyReused)
+	}
+	if stored.Response == nil {
+		return nil, fmt.Errorf("idempotency key %s --> %w", key, model.ErrIdempotencyKeyInProgress)
+	}
+	return stored.Response, nil
+}
+
+func (is *IdempotencyService) Complete(ctx context.Context, key string, response model.IdempotentResponse) error {
+	if completeErr := is.repo.Complete(ctx, key, response, time.Now().UTC().Add(is.config.TTL)); completeErr != nil {
+		return fmt.Errorf("storing the response of idempotency key %s --> %w", key, completeErr)
+	}
+	return nil
+}
+
+func (is *IdempotencyService) Abandon(ctx context.Context, key string) error {
+	if deleteErr := is.repo.Delete(ctx, key); deleteErr != nil {
+		return fmt.Errorf("releasing idempotency key %s --> %w", key, deleteErr)
+	}
+	return nil
+}
+
+// Deletes the expired keys every PurgeInterval. Blocks until the context is done.
+// Expired keys are already ignored, so this only keeps the storage from growing forever
+func (is *IdempotencyService) Run(ctx context.Context) {
+	ticker := time.NewTicker(is.config.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, deleteErr := is.repo.DeleteExpired(ctx)
+			if deleteErr != nil {
+				log.
+					Error().
+					Err(deleteErr).
+					Msg("while deleting expired idempotency keys")
+				continue
+			}
+			log.
+				Debug().
+				Int64("deleted", deleted).
+				Msg("expired idempotency keys deleted")
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/mocks"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+const (
+	idempotencyKey = "8e0f4a9c-5d1e-4c55-a3c4-3f2ab1f1d6a7"
+	requestHash    = "sha256-of-the-request"
+)
+
+var (
+	idempotencyConfig = IdempotencyServiceConfig{TTL: 24 * time.Hour, Lease: time.Minute, PurgeInterval: time.Hour}
+	storedResponse    = model.IdempotentResponse{StatusCode: 202, Headers: map[string]string{"ETag": `"1"`}}
+)
+
+// Matches the records claimed for the key and the hash, with a lease that ends within the configured one
+func claimedRecord() gomock.Matcher {
+	return gomock.Cond(func(x any) bool {
+		record, ok := x.(model.IdempotencyRecord)
+		return ok && record.Key == idempotencyKey && record.RequestHash == requestHash && record.Response == nil &&
+			!record.ExpiresAt.After(time.Now().UTC().Add(idempotencyConfig.Lease))
+	})
+}
+
+func Test_StartIdempotentRequest_GivenIdempotencyServiceCreated(t *testing.T) {
+	ctx := context.Background()
+	randomError := errors.New("random error")
+
+	type want struct {
+		err      error
+		response *model.IdempotentResponse
+	}
+	tests := []struct {
+		name  string
+		mocks func(repo *mocks.MockIdempotencyKeysRepository)
+		want  want
+	}{
+		{
+			name: "WhenClaimFails_ThenError",
+			mocks: func(repo *mocks.MockIdempotencyKeysRepository) {
+				repo.EXPECT().Claim(ctx, claimedRecord()).
+					Return(model.IdempotencyRecord{}, false, randomError)
+			},
+			want: want{
+				err: randomError,
+			},
+		}, {
+			name: "WhenNewKey_ThenNoResponseAndTheRequestMustBeProcessed",
+			mocks: func(repo *mocks.MockIdempotencyKeysRepository) {
+				repo.EXPECT().Claim(ctx, claimedRecord()).
+					Return(model.IdempotencyRecord{}, true, nil)
+			},
+			want: want{
+				err:      nil,
+				response: nil,
+			},
+		}, {
+			name: "WhenKeyUsedByAnotherRequest_ThenReusedError",
+			mocks: func(repo *mocks.MockIdempotencyKeysRepository) {
+				repo.EXPECT().Claim(ctx, claimedRecord()).
+					Return(model.IdempotencyRecord{Key: idempotencyKey, RequestHash: "another hash", Response: &storedResponse}, false, nil)
+			},
+			want: want{
+				err: model.ErrIdempotencyKeyReused,
+			},
+		}, {
+			name: "WhenKeyUsedByAnotherRequestStillInProgress_ThenReusedError",
+			mocks: func(repo *mocks.MockIdempotencyKeysRepository) {
+				repo.EXPECT().Claim(ctx, claimedRecord()).
+					Return(model.IdempotencyRecord{Key: idempotencyKey, RequestHash: "another hash"}, false, nil)
+			},
+			want: want{
+				err: model.ErrIdempotencyKeyReused,
+			},
+		}, {
+			name: "WhenFirstRequestInProgress_ThenInProgressError",
+			mocks: func(repo *mocks.MockIdempotencyKeysRepository) {
+				repo.EXPECT().Claim(ctx, claimedRecord()).
+					Return(model.IdempotencyRecord{Key: idempotencyKey, RequestHash: requestHash}, false, nil)
+			},
+			want: want{
+				err: model.ErrIdempotencyKeyInProgress,
+			},
+		}, {
+			name: "WhenFirstRequestDone_ThenItsResponseIsReturned",
+			mocks: func(repo *mocks.MockIdempotencyKeysRepository) {
+				repo.EXPECT().Claim(ctx, claimedRecord()).
+					Return(model.IdempotencyRecord{Key: idempotencyKey, RequestHash: requestHash, Response: &storedResponse}, false, nil)
+			},
+			want: want{
+				err:      nil,
+				response: &storedResponse,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			repo := mocks.NewMockIdempotencyKeysRepository(mockCtrl)
+			tc.mocks(repo)
+
+			svc := NewIdempotencyService(repo, idempotencyConfig)
+
+			response, startErr := svc.Start(ctx, idempotencyKey, requestHash)
+			if tc.want.err != nil {
+				assert.ErrorIs(t, startErr, tc.want.err)
+			} else {
+				assert.NoError(t, startErr)
+			}
+			assert.Equal(t, tc.want.response, response)
+		})
+	}
+}
+
+func Test_CompleteIdempotentRequest_GivenIdempotencyServiceCreated(t *testing.T) {
+	ctx := context.Background()
+	randomError := errors.New("random error")
+
+	tests := []struct {
+		name    string
+		mocks   func(repo *mocks.MockIdempotencyKeysRepository)
+		wantErr error
+	}{
+		{
+			name: "WhenCompleteFails_ThenError",
+			mocks: func(repo *mocks.MockIdempotencyKeysRepository) {
+				repo.EXPECT().Complete(ctx, idempotencyKey, storedResponse, gomock.Any()).
+					Return(randomError)
+			},
+			wantErr: randomError,
+		}, {
+			// The response is kept for the whole TTL, not for the lease
+			name: "WhenComplete_ThenResponseIsKeptUntilTheTTL",
+			mocks: func(repo *mocks.MockIdempotencyKeysRepository) {
+				repo.EXPECT().Complete(ctx, idempotencyKey, storedResponse, gomock.Cond(func(x any) bool {
+					expiresAt, ok := x.(time.Time)
+					return ok && expiresAt.After(time.Now().UTC().Add(idempotencyConfig.TTL-time.Minute))
+				})).
+					Return(nil)
+			},
+			wantErr: nil,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			repo := mocks.NewMockIdempotencyKeysRepository(mockCtrl)
+			tc.mocks(repo)
+
+			svc := NewIdempotencyService(repo, idempotencyConfig)
+
+			completeErr := svc.Complete(ctx, idempotencyKey, storedResponse)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, completeErr, tc.wantErr)
+			} else {
+				assert.NoError(t, completeErr)
+			}
+		})
+	}
+}
+
+func Test_AbandonIdempotentRequest_GivenIdempotencyServiceCreated(t *testing.T) {
+	ctx := context.Background()
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	repo := mocks.NewMockIdempotencyKeysRepository(mockCtrl)
+
+	t.Run("WhenAbandon_ThenKeyIsDeleted", func(t *testing.T) {
+		repo.EXPECT().Delete(ctx, idempotencyKey).Return(nil)
+
+		assert.NoError(t, NewIdempotencyService(repo, idempotencyConfig).Abandon(ctx, idempotencyKey))
+	})
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	reservationSucceeded = "success"
+	reservationFailed    = "failure"
+	// The reserver has not even been called. See resilient.ItemReserver
+	reservationShortCircuited = "short_circuited"
+)
+
+// Published through prometheus, so they can be read from the /metrics endpoint
+var reservationMetrics = struct {
+	reservations *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+}{
+	reservations: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shopping_cart_reservations_total",
+		Help: "Reservations of items processed, by result",
+	}, []string{"result"}),
+	duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "shopping_cart_reservation_duration_seconds",
+		Help:    "Time taken to reserve the items, retries included, by result",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"result"}),
+}
+
+func init() {
+	prometheus.MustRegister(reservationMetrics.reservations, reservationMetrics.duration)
+}
+
+func observeReservation(reservationErr error, elapsed time.Duration) {
+	result := reservationSucceeded
+	if errors.Is(reservationErr, model.ErrCircuitOpen) {
+		result = reservationShortCircuited
+	} else if reservationErr != nil {
+		result = reservationFailed
+	}
+
+	reservationMetrics.reservations.WithLabelValues(result).Inc()
+	reservationMetrics.duration.WithLabelValues(result).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/Harital/shopping-cart/internal/core/ports"
+	"github.com/rs/zerolog/log"
+)
+
+// Performs the actual call to the reserver. Returning an error makes the task to be retried
+type ReservationTaskHandler func(ctx context.Context, task model.ReservationTask) error
+
+type ReservationDispatcherConfig struct {
+	// How often the outbox is checked for pending tasks
+	PollInterval time.Duration
+	// Maximum number of tasks claimed at once
+	BatchSize int
+	// Time a claimed task is hidden from other dispatchers. Must be longer than the time a task may wait in the
+	// worker pool queue plus the time needed to process it
+	ClaimLease time.Duration
+	// Tasks are processed by a pool of workers. See ReservationWorkerPoolConfig
+	Workers   int
+	QueueSize int
+	// After this number of attempts the task is dead-lettered
+	MaxAttempts int
+	// Exponential backoff between attempts: BaseBackoff, 2*BaseBackoff, 4*BaseBackoff... up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// How often the done tasks are deleted from the outbox
+	PurgeInterval time.Duration
+}
+
+// Takes the reservation tasks from the outbox and hands them to the handler. Tasks are only marked as done once
+// the handler succeeds, so every task is processed at least once, even across restarts
+type ReservationDispatcher struct {
+	outbox  ports.ReservationOutbox
+	handler ReservationTaskHandler
+	config  ReservationDispatcherConfig
+	pool    *ReservationWorkerPool
+}
+
+func NewReservationDispatcher(outbox ports.ReservationOutbox, handler ReservationTaskHandler, config ReservationDispatcherConfig) *ReservationDispatcher {
+	rd := &ReservationDispatcher{
+		outbox:  outbox,
+		handler: handler,
+		config:  config,
+	}
+	rd.pool = NewReservationWorkerPool(
+		ReservationWorkerPoolConfig{Workers: config.Workers, QueueSize: config.QueueSize},
+		rd.dispatch,
+		rd.persist,
+	)
+	return rd
+}
+
+// Blocks until the context is done. Tasks already handed to the workers keep being processed until Shutdown
+func (rd *ReservationDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(rd.config.PollInterval)
+	defer ticker.Stop()
+	purgeTicker := time.NewTicker(rd.config.PurgeInterval)
+	defer purgeTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rd.DispatchBatch(ctx)
+		case <-purgeTicker.C:
+			rd.Purge(ctx)
+		}
+	}
+}
+
+// Deletes the done tasks, so the outbox does not grow forever. Errors are logged, as there is nobody to return them to
+func (rd *ReservationDispatcher) Purge(ctx context.Context) {
+	deleted, deleteErr := rd.outbox.DeleteDone(ctx)
+	if deleteErr != nil {
+		log.
+			Error().
+			Err(deleteErr).
+			Msg("while deleting done reservation tasks")
+		return
+	}
+	log.
+		Debug().
+		Int64("deleted", deleted).
+		Msg("done reservation tasks deleted")
+}
+
+// Waits for the tasks in the worker pool to be processed. Whatever is not processed when the context expires is
+// given back to the outbox
+func (rd *ReservationDispatcher) Shutdown(ctx context.Context) error {
+	return rd.pool.Shutdown(ctx)
+}
+
+// Claims a single batch of tasks and hands them to the worker pool. It blocks while the pool queue is full, so no
+// more tasks are claimed until the workers catch up. Errors are logged, as there is nobody to return them to
+func (rd *ReservationDispatcher) DispatchBatch(ctx context.Context) {
+	tasks, claimErr := rd.outbox.Claim(ctx, rd.config.BatchSize, rd.config.ClaimLease)
+	if claimErr != nil {
+		log.
+			Error().
+			Err(claimErr).
+			Msg("while claiming reservation tasks")
+		return
+	}
+
+	for i, task := range tasks {
+		if submitErr := rd.pool.Submit(ctx, task); submitErr != nil {
+			// Shutting down. The claimed tasks are given back, so they do not wait for the lease to expire
+			for _, pendingTask := range tasks[i:] {
+				rd.persist(context.WithoutCancel(ctx), pendingTask)
+			}
+			return
+		}
+	}
+}
+
+func (rd *ReservationDispatcher) dispatch(ctx context.Context, task model.ReservationTask) {
+	handlerErr := rd.handler(ctx, task)
+	// The outcome must be written even if the handler was cancelled by the shutdown
+	ctx = context.WithoutCancel(ctx)
+
+	if handlerErr == nil {
+		if doneErr := rd.outbox.MarkDone(ctx, task.Id); doneErr != nil {
+			// The task will be processed again when the lease expires. Handlers must be idempotent
+			log.
+				Error().
+				Err(doneErr).
+				Int64("taskId", task.Id).
+				Msg("while marking reservation task as done")
+		}
+		return
+	}
+
+	// The reserver was not called, so the task is queued again without spending an attempt.
+	// Otherwise, a long outage would dead-letter every pending task
+	if errors.Is(handlerErr, model.ErrCircuitOpen) {
+		nextAttemptAt := time.Now().Add(rd.config.BaseBackoff)
+		log.
+			Debug().
+			Int64("taskId", task.Id).
+			Time("nextAttemptAt", nextAttemptAt).
+			Msg("reserver circuit open. Reservation task postponed")
+		if postponeErr := rd.outbox.Postpone(ctx, task.Id, nextAttemptAt); postponeErr != nil {
+			log.
+				Error().
+				Err(postponeErr).
+				Int64("taskId", task.Id).
+				Msg("while postponing reservation task")
+		}
+		return
+	}
+
+	if task.Attempts >= rd.config.MaxAttempts {
+		log.
+			Error().
+			Err(handlerErr).
+			Int64("taskId", task.Id).
+			Str("cartId", task.CartId).
+			Str("itemId", task.Item.Id).
+			Str("operation", string(task.Operation)).
+			Int("attempts", task.Attempts).
+			Msg("reservation task dead-lettered")
+		if deadErr := rd.outbox.MarkDead(ctx, task.Id, handlerErr.Error()); deadErr != nil {
+			log.
+				Error().
+				Err(deadErr).
+				Int64("taskId", task.Id).
+				Msg("while dead-lettering reservation task")
+		}
+		return
+	}
+
+	nextAttemptAt := time.Now().Add(rd.backoff(task.Attempts))
+	log.
+		Warn().
+		Err(handlerErr).
+		Int64("taskId", task.Id).
+		Str("operation", string(task.Operation)).
+		Int("attempts", task.Attempts).
+		Time("nextAttemptAt", nextAttemptAt).
+		Msg("reservation task failed. Will be retried")
+	if retryErr := rd.outbox.Retry(ctx, task.Id, nextAttemptAt, handlerErr.Error()); retryErr != nil {
+		log.
+			Error().
+			Err(retryErr).
+			Int64("taskId", task.Id).
+			Msg("while scheduling reservation task retry")
+	}
+}
+
+// Gives the task back to the outbox without spending an attempt, as it was not processed
+func (rd *ReservationDispatcher) persist(ctx context.Context, task model.ReservationTask) {
+	if postponeErr := rd.outbox.Postpone(ctx, task.Id, time.Now()); postponeErr != nil {
+		// The task will be processed again when the lease expires
+		log.
+			Error().
+			Err(postponeErr).
+			Int64("taskId", task.Id).
+			Msg("while giving reservation task back to the outbox")
+	}
+}
+
+func (rd *ReservationDispatcher) backoff(attempts int) time.Duration {
+	return exponentialBackoff(rd.config.BaseBackoff, rd.config.MaxBackoff, attempts)
+}
+
+// base, 2*base, 4*base... up to max. Attempts starts at 1
+func exponentialBackoff(base time.Duration, max time.Duration, attempts int) time.Duration {
+	backoff := base
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
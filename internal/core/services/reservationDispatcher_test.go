@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/mocks"
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+type reservationDispatcherMocks struct {
+	outbox *mocks.MockReservationOutbox
+}
+
+var testDispatcherConfig = ReservationDispatcherConfig{
+	PollInterval:  10 * time.Millisecond,
+	BatchSize:     5,
+	ClaimLease:    time.Minute,
+	MaxAttempts:   3,
+	BaseBackoff:   time.Second,
+	MaxBackoff:    3 * time.Second,
+	Workers:       2,
+	QueueSize:     5,
+	PurgeInterval: time.Hour,
+}
+
+func Test_DispatchBatch_GivenReservationDispatcherCreated(t *testing.T) {
+	randomError := errors.New("random error")
+	ctx := context.Background()
+	reserveTask := model.ReservationTask{Id: 1, CartId: cartId, Operation: model.ReserveOperation, Item: model.CartItem{Id: "1"}, Attempts: 1}
+	lastAttemptTask := model.ReservationTask{Id: 2, CartId: cartId, Operation: model.ReleaseOperation, Item: model.CartItem{Id: "2"}, Attempts: 3}
+
+	type input struct {
+		handler ReservationTaskHandler
+		// The pool is shut down before dispatching
+		shutDown bool
+	}
+	tests := []struct {
+		name  string
+		in    input
+		mocks func(m reservationDispatcherMocks)
+	}{
+		{
+			name: "WhenClaimFails_ThenNothingIsDispatched",
+			in: input{
+				handler: func(ctx context.Context, task model.ReservationTask) error {
+					t.Error("handler should not be called")
+					return nil
+				},
+			},
+			mocks: func(m reservationDispatcherMocks) {
+				m.outbox.EXPECT().Claim(gomock.Any(), testDispatcherConfig.BatchSize, testDispatcherConfig.ClaimLease).
+					Return([]model.ReservationTask{}, randomError)
+			},
+		}, {
+			name: "WhenHandlerSucceeds_ThenTaskIsMarkedAsDone",
+			in: input{
+				handler: func(ctx context.Context, task model.ReservationTask) error {
+					return nil
+				},
+			},
+			mocks: func(m reservationDispatcherMocks) {
+				m.outbox.EXPECT().Claim(gomock.Any(), testDispatcherConfig.BatchSize, testDispatcherConfig.ClaimLease).
+					Return([]model.ReservationTask{reserveTask}, nil)
+				m.outbox.EXPECT().MarkDone(gomock.Any(), reserveTask.Id).
+					Return(nil)
+			},
+		}, {
+			name: "WhenHandlerFails_ThenTaskIsRetriedWithBackoff",
+			in: input{
+				handler: func(ctx context.Context, task model.ReservationTask) error {
+					return randomError
+				},
+			},
+			mocks: func(m reservationDispatcherMocks) {
+				m.outbox.EXPECT().Claim(gomock.Any(), testDispatcherConfig.BatchSize, testDispatcherConfig.ClaimLease).
+					Return([]model.ReservationTask{reserveTask}, nil)
+				m.outbox.EXPECT().Retry(gomock.Any(), reserveTask.Id, gomock.Any(), randomError.Error()).
+					DoAndReturn(func(ctx context.Context, taskId int64, nextAttemptAt time.Time, lastErr string) error {
+						// First attempt, so the base backoff is applied
+						assert.WithinDuration(t, time.Now().Add(testDispatcherConfig.BaseBackoff), nextAttemptAt, 500*time.Millisecond)
+						return nil
+					})
+			},
+		}, {
+			name: "WhenHandlerFailsInLastAttempt_ThenTaskIsDeadLettered",
+			in: input{
+				handler: func(ctx context.Context, task model.ReservationTask) error {
+					return randomError
+				},
+			},
+			mocks: func(m reservationDispatcherMocks) {
+				m.outbox.EXPECT().Claim(gomock.Any(), testDispatcherConfig.BatchSize, testDispatcherConfig.ClaimLease).
+					Return([]model.ReservationTask{lastAttemptTask}, nil)
+				m.outbox.EXPECT().MarkDead(gomock.Any(), lastAttemptTask.Id, randomError.Error()).
+					Return(nil)
+			},
+		}, {
+			name: "WhenCircuitOpenInLastAttempt_ThenTaskIsPostponedInsteadOfDeadLettered",
+			in: input{
+				handler: func(ctx context.Context, task model.ReservationTask) error {
+					return fmt.Errorf("reserving --> %w", model.ErrCircuitOpen)
+				},
+			},
+			mocks: func(m reservationDispatcherMocks) {
+				m.outbox.EXPECT().Claim(gomock.Any(), testDispatcherConfig.BatchSize, testDispatcherConfig.ClaimLease).
+					Return([]model.ReservationTask{lastAttemptTask}, nil)
+				m.outbox.EXPECT().Postpone(gomock.Any(), lastAttemptTask.Id, gomock.Any()).
+					Return(nil)
+				m.outbox.EXPECT().MarkDead(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+		}, {
+			name: "WhenPoolIsShutDown_ThenClaimedTasksAreGivenBack",
+			in: input{
+				handler: func(ctx context.Context, task model.ReservationTask) error {
+					t.Error("handler should not be called")
+					return nil
+				},
+				shutDown: true,
+			},
+			mocks: func(m reservationDispatcherMocks) {
+				m.outbox.EXPECT().Claim(gomock.Any(), testDispatcherConfig.BatchSize, testDispatcherConfig.ClaimLease).
+					Return([]model.ReservationTask{reserveTask, lastAttemptTask}, nil)
+				m.outbox.EXPECT().Postpone(gomock.Any(), reserveTask.Id, gomock.Any()).
+					Return(nil)
+				m.outbox.EXPECT().Postpone(gomock.Any(), lastAttemptTask.Id, gomock.Any()).
+					Return(nil)
+			},
+		}, {
+			name: "WhenSeveralTasks_ThenEveryTaskIsDispatched",
+			in: input{
+				handler: func(ctx context.Context, task model.ReservationTask) error {
+					if task.Id == lastAttemptTask.Id {
+						return randomError
+					}
+					return nil
+				},
+			},
+			mocks: func(m reservationDispatcherMocks) {
+				m.outbox.EXPECT().Claim(gomock.Any(), testDispatcherConfig.BatchSize, testDispatcherConfig.ClaimLease).
+					Return([]model.ReservationTask{reserveTask, lastAttemptTask}, nil)
+				m.outbox.EXPECT().MarkDone(gomock.Any(), reserveTask.Id).
+					Return(nil)
+				m.outbox.EXPECT().MarkDead(gomock.Any(), lastAttemptTask.Id, gomock.Any()).
+					Return(nil)
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			m := reservationDispatcherMocks{
+				outbox: mocks.NewMockReservationOutbox(mockCtrl),
+			}
+			tc.mocks(m)
+
+			dispatcher := NewReservationDispatcher(m.outbox, tc.in.handler, testDispatcherConfig)
+			if tc.in.shutDown {
+				assert.NoError(t, dispatcher.Shutdown(ctx))
+			}
+			dispatcher.DispatchBatch(ctx)
+			// Waits for the workers to process the batch
+			assert.NoError(t, dispatcher.Shutdown(ctx))
+		})
+	}
+}
+
+func Test_Purge_GivenReservationDispatcherCreated(t *testing.T) {
+	tests := []struct {
+		name  string
+		mocks func(m reservationDispatcherMocks)
+	}{
+		{
+			name: "WhenDeleteFails_ThenNothingElseHappens",
+			mocks: func(m reservationDispatcherMocks) {
+				m.outbox.EXPECT().DeleteDone(gomock.Any()).Return(int64(0), errors.New("random error"))
+			},
+		}, {
+			name: "WhenPurged_ThenOnlyDoneTasksAreDeleted",
+			mocks: func(m reservationDispatcherMocks) {
+				m.outbox.EXPECT().DeleteDone(gomock.Any()).Return(int64(3), nil)
+				m.outbox.EXPECT().Claim(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			m := reservationDispatcherMocks{outbox: mocks.NewMockReservationOutbox(mockCtrl)}
+			tc.mocks(m)
+
+			NewReservationDispatcher(m.outbox, nil, testDispatcherConfig).Purge(context.Background())
+		})
+	}
+}
+
+func Test_Backoff_GivenReservationDispatcherCreated(t *testing.T) {
+	dispatcher := NewReservationDispatcher(nil, nil, testDispatcherConfig)
+
+	assert.Equal(t, 1*time.Second, dispatcher.backoff(1))
+	assert.Equal(t, 2*time.Second, dispatcher.backoff(2))
+	// Capped by the max backoff
+	assert.Equal(t, 3*time.Second, dispatcher.backoff(3))
+	assert.Equal(t, 3*time.Second, dispatcher.backoff(30))
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+)
+
+var (
+	ErrWorkerPoolClosed = errors.New("reservation worker pool is shut down")
+)
+
+// Unlike the ReservationTaskHandler, it takes care of the outcome of the task, as there is nobody to return it to
+type ReservationTaskProcessor func(ctx context.Context, task model.ReservationTask)
+
+type ReservationWorkerPoolConfig struct {
+	// Number of tasks processed at the same time
+	Workers int
+	// Pending tasks per worker. Once the queue is full, Submit blocks until there is room
+	QueueSize int
+}
+
+// Processes reservation tasks in background with a bounded number of goroutines.
+// Tasks of the same item always go to the same worker, so they are never processed concurrently
+type ReservationWorkerPool struct {
+	queues  []chan model.ReservationTask
+	process ReservationTaskProcessor
+	// Called with the tasks that could not be processed before shutting down, so they are not lost
+	persist ReservationTaskProcessor
+
+	// Taken for reading while submitting, so Shutdown can wait for the ongoing submissions before closing the queues
+	mutex  sync.RWMutex
+	closed bool
+	quit   chan struct{}
+
+	// Not tied to the caller context, so in-flight tasks are not killed when the app starts shutting down.
+	// Only cancelled if the shutdown timeout expires
+	workCtx    context.Context
+	cancelWork context.CancelFunc
+	workers    sync.WaitGroup
+	shutdown   sync.Once
+}
+
+func NewReservationWorkerPool(config ReservationWorkerPoolConfig, process ReservationTaskProcessor, persist ReservationTaskProcessor) *ReservationWorkerPool {
+	workers := max(config.Workers, 1)
+	workCtx, cancelWork := context.WithCancel(context.Background())
+
+	wp := &ReservationWorkerPool{
+		queues:     make([]chan model.ReservationTask, workers),
+		process:    process,
+		persist:    persist,
+		quit:       make(chan struct{}),
+		workCtx:    workCtx,
+		cancelWork: cancelWork,
+	}
+
+	for i := range wp.queues {
+		wp.queues[i] = make(chan model.ReservationTask, config.QueueSize)
+		wp.workers.Add(1)
+		go wp.work(wp.queues[i])
+	}
+	return wp
+}
+
+// Blocks while the queue of the task is full. That is the backpressure: the caller stops producing tasks
+// until the workers catch up
+func (wp *ReservationWorkerPool) Submit(ctx context.Context, task model.ReservationTask) error {
+	wp.mutex.RLock()
+	defer wp.mutex.RUnlock()
+
+	if wp.closed {
+		return ErrWorkerPoolClosed
+	}
+
+	select {
+	case wp.queueFor(task) <- task:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-wp.quit:
+		return ErrWorkerPoolClosed
+	}
+}
+
+// Stops accepting tasks and waits for the queued ones to be processed. If the context expires first, in-flight
+// tasks are cancelled and the tasks still queued are handed to persist instead
+func (wp *ReservationWorkerPool) Shutdown(ctx context.Context) error {
+	wp.shutdown.Do(func() {
+		// Wakes up the blocked submissions, so they release the lock
+		close(wp.quit)
+
+		wp.mutex.Lock()
+		wp.closed = true
+		for _, queue := range wp.queues {
+			close(queue)
+		}
+		wp.mutex.Unlock()
+	})
+
+	drained := make(chan struct{})
+	go func() {
+		wp.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		wp.cancelWork()
+		return nil
+	case <-ctx.Done():
+		wp.cancelWork()
+		// Workers only persist the remaining tasks now, so they finish quickly
+		<-drained
+		return ctx.Err()
+	}
+}
+
+func (wp *ReservationWorkerPool) work(queue chan model.ReservationTask) {
+	defer wp.workers.Done()
+
+	for task := range queue {
+		if wp.workCtx.Err() != nil {
+			wp.persist(context.Background(), task)
+			continue
+		}
+		wp.process(wp.workCtx, task)
+	}
+}
+
+func (wp *ReservationWorkerPool) queueFor(task model.ReservationTask) chan model.ReservationTask {
+	hash := fnv.New32a()
+	hash.Write([]byte(task.CartId))
+	hash.Write([]byte{0})
+	hash.Write([]byte(task.Item.Id))
+	return wp.queues[hash.Sum32()%uint32(len(wp.queues))]
+}
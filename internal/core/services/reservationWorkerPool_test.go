@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Harital/shopping-cart/internal/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// Keeps track of the processed and persisted tasks. Workers run concurrently, so access is protected
+type taskRecorder struct {
+	mutex     sync.Mutex
+	processed []int64
+	persisted []int64
+}
+
+func (tr *taskRecorder) process(ctx context.Context, task model.ReservationTask) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.processed = append(tr.processed, task.Id)
+}
+
+func (tr *taskRecorder) persist(ctx context.Context, task model.ReservationTask) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.persisted = append(tr.persisted, task.Id)
+}
+
+func newTask(id int64, itemId string) model.ReservationTask {
+	return model.ReservationTask{Id: id, CartId: cartId, Operation: model.ReserveOperation, Item: model.CartItem{Id: itemId}}
+}
+
+// We use Gherkin notation for the tests
+func Test_Submit_GivenReservationWorkerPool(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("WhenTasksSubmitted_ThenEveryTaskIsProcessedBeforeShutdownReturns", func(t *testing.T) {
+		recorder := &taskRecorder{}
+		pool := NewReservationWorkerPool(ReservationWorkerPoolConfig{Workers: 3, QueueSize: 2}, recorder.process, recorder.persist)
+
+		for i := int64(1); i <= 10; i++ {
+			assert.NoError(t, pool.Submit(ctx, newTask(i, fmt.Sprint(i))))
+		}
+		assert.NoError(t, pool.Shutdown(ctx))
+
+		assert.ElementsMatch(t, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, recorder.processed)
+		assert.Empty(t, recorder.persisted)
+	})
+
+	t.Run("WhenTasksOfTheSameItem_ThenProcessedInOrderAndNeverConcurrently", func(t *testing.T) {
+		var mutex sync.Mutex
+		running := 0
+		var processed []int64
+		process := func(ctx context.Context, task model.ReservationTask) {
+			mutex.Lock()
+			running++
+			assert.Equal(t, 1, running)
+			mutex.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mutex.Lock()
+			running--
+			processed = append(processed, task.Id)
+			mutex.Unlock()
+		}
+		pool := NewReservationWorkerPool(ReservationWorkerPoolConfig{Workers: 4, QueueSize: 10}, process, process)
+
+		for i := int64(1); i <= 5; i++ {
+			assert.NoError(t, pool.Submit(ctx, newTask(i, "sameItem")))
+		}
+		assert.NoError(t, pool.Shutdown(ctx))
+
+		assert.Equal(t, []int64{1, 2, 3, 4, 5}, processed)
+	})
+
+	t.Run("WhenQueueIsFull_ThenSubmitBlocksUntilTheContextExpires", func(t *testing.T) {
+		release := make(chan struct{})
+		process := func(ctx context.Context, task model.ReservationTask) {
+			<-release
+		}
+		recorder := &taskRecorder{}
+		pool := NewReservationWorkerPool(ReservationWorkerPoolConfig{Workers: 1, QueueSize: 1}, process, recorder.persist)
+
+		// The first one is taken by the worker, the second one fills the queue
+		assert.NoError(t, pool.Submit(ctx, newTask(1, "1")))
+		assert.NoError(t, pool.Submit(ctx, newTask(2, "1")))
+
+		submitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, pool.Submit(submitCtx, newTask(3, "1")), context.DeadlineExceeded)
+
+		close(release)
+		assert.NoError(t, pool.Shutdown(ctx))
+	})
+
+	t.Run("WhenPoolIsShutDown_ThenSubmitFails", func(t *testing.T) {
+		recorder := &taskRecorder{}
+		pool := NewReservationWorkerPool(ReservationWorkerPoolConfig{Workers: 1, QueueSize: 1}, recorder.process, recorder.persist)
+
+		assert.NoError(t, pool.Shutdown(ctx))
+
+		assert.ErrorIs(t, pool.Submit(ctx, newTask(1, "1")), ErrWorkerPoolClosed)
+		assert.Empty(t, recorder.processed)
+	})
+}
+
+func Test_Shutdown_GivenReservationWorkerPool(t *testing.T) {
+	t.Run("WhenShutdownTimesOut_ThenInFlightTaskIsCancelledAndQueuedTasksArePersisted", func(t *testing.T) {
+		recorder := &taskRecorder{}
+		started := make(chan struct{})
+		process := func(ctx context.Context, task model.ReservationTask) {
+			close(started)
+			// Slow reserver. It only returns when the pool gives up
+			<-ctx.Done()
+			recorder.process(ctx, task)
+		}
+		pool := NewReservationWorkerPool(ReservationWorkerPoolConfig{Workers: 1, QueueSize: 5}, process, recorder.persist)
+
+		assert.NoError(t, pool.Submit(context.Background(), newTask(1, "1")))
+		<-started
+		assert.NoError(t, pool.Submit(context.Background(), newTask(2, "1")))
+		assert.NoError(t, pool.Submit(context.Background(), newTask(3, "1")))
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, pool.Shutdown(shutdownCtx), context.DeadlineExceeded)
+
+		assert.Equal(t, []int64{1}, recorder.processed)
+		assert.Equal(t, []int64{2, 3}, recorder.persisted)
+	})
+}
@@ -0,0 +1,12 @@
+-- Same as databaseInitialization.sql, for the postgres driver. Run with psql as a superuser, as it connects
+-- to the new database half way through.
+-- The user and the database are quoted, as postgres would lower case them otherwise
+CREATE USER "shopping-cart-app" WITH PASSWORD 'shoppingCartPassword!';
+
+CREATE DATABASE "shoppingCart";
+
+\connect "shoppingCart"
+
+-- The tables are created and updated by the migrations (shopping-cart migrate up), run with an admin user.
+-- Postgres grants the privileges per table, so the app user gets them on every table created from now on
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO "shopping-cart-app";